@@ -0,0 +1,206 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Returns an HTTP handler to administer the jobs of the default
+// scheduler. See Scheduler.AdminHandler.
+func AdminHandler(token string, types ...string) http.Handler {
+	return defaultScheduler.AdminHandler(token, types...)
+}
+
+// Returns an HTTP handler to administer the jobs, serving:
+// 		GET /jobs        lists the statuses of the jobs
+// 		GET /jobs/{name} returns the status of the job
+// 		GET /jobs/{name}/stats returns the run duration stats of the job
+// 		PUT /jobs/{name} schedules a job of a registered type
+// 		POST /jobs/{name}/trigger runs the job immediately
+// 		POST /jobs/{name}/pause pauses the job
+// 		POST /jobs/{name}/resume resumes the paused job
+// 		POST /jobs/{name}/snooze?until=... pauses the job until
+// 		the RFC 3339 time, or for the duration of ?for=2h
+// The body of PUT is a job in the snapshot format without the name:
+// 		{"type": "http", "params": {"URL": "http://localhost/reindex"}, "opts": {"when": {"Each": "1h"}}}
+// PUT only schedules the jobs of the registered types listed in
+// types, and is forbidden for the others; with no types, no jobs
+// can be scheduled. Responses are JSON. Requests should be
+// authenticated as in TriggerHandler.
+// Example:
+// 		http.Handle("/jobs", s.AdminHandler(os.Getenv("ADMIN_TOKEN"), "http"))
+// 		http.Handle("/jobs/", s.AdminHandler(os.Getenv("ADMIN_TOKEN"), "http"))
+func (s *Scheduler) AdminHandler(token string, types ...string) http.Handler {
+	return s.AdminHandlerWithAuth(tokenAuth(token), types...)
+}
+
+// Returns an HTTP handler to administer the jobs of the default
+// scheduler, authenticated by auth. See Scheduler.AdminHandlerWithAuth.
+func AdminHandlerWithAuth(auth Authenticator, types ...string) http.Handler {
+	return defaultScheduler.AdminHandlerWithAuth(auth, types...)
+}
+
+// Returns the handler of AdminHandler, with the requests
+// authenticated by auth. The GET endpoints require RoleReader,
+// the others RoleOperator. PUT schedules the jobs of types only.
+// Example:
+// 		h := s.AdminHandlerWithAuth(ticktock.TokenAuth{
+// 			os.Getenv("READ_TOKEN"): ticktock.RoleReader,
+// 			os.Getenv("OPS_TOKEN"):  ticktock.RoleOperator,
+// 		})
+func (s *Scheduler) AdminHandlerWithAuth(auth Authenticator, types ...string) http.Handler {
+	allowed := make(map[string]bool)
+	for _, typ := range types {
+		allowed[typ] = true
+	}
+	list := requireRole(auth, RoleReader, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Jobs())
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/jobs" {
+			serveMethods(w, r, map[string]http.HandlerFunc{"GET": list})
+			return
+		}
+		name, action, ok := adminRoute(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		switch action {
+		case "":
+			serveMethods(w, r, map[string]http.HandlerFunc{
+				"GET": requireRole(auth, RoleReader, func(w http.ResponseWriter, r *http.Request) {
+					st, ok := s.Status(name)
+					if !ok {
+						http.Error(w, "no job exists with the name provided", http.StatusNotFound)
+						return
+					}
+					writeJSON(w, http.StatusOK, st)
+				}),
+				"PUT": requireRole(auth, RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+					s.serveSchedule(w, r, name, allowed)
+				}),
+			})
+		case "stats":
+			serveMethods(w, r, map[string]http.HandlerFunc{
+				"GET": requireRole(auth, RoleReader, func(w http.ResponseWriter, r *http.Request) {
+					st, ok := s.Stats(name)
+					if !ok {
+						http.Error(w, "no job exists with the name provided", http.StatusNotFound)
+						return
+					}
+					writeJSON(w, http.StatusOK, st)
+				}),
+			})
+		case "snooze":
+			serveMethods(w, r, map[string]http.HandlerFunc{
+				"POST": requireRole(auth, RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+					until, err := snoozeUntil(r, s.now())
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					if err := s.Snooze(name, until); err != nil {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					}
+					w.WriteHeader(http.StatusAccepted)
+				}),
+			})
+		default:
+			f := map[string]func(string) error{
+				"trigger": s.Trigger,
+				"pause":   s.Pause,
+				"resume":  s.Resume,
+			}[action]
+			serveMethods(w, r, map[string]http.HandlerFunc{
+				"POST": requireRole(auth, RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+					if err := f(name); err != nil {
+						http.Error(w, err.Error(), http.StatusNotFound)
+						return
+					}
+					w.WriteHeader(http.StatusAccepted)
+				}),
+			})
+		}
+	})
+}
+
+// The actions of the admin handler on a job, as the last segment of
+// the path.
+var adminActions = map[string]bool{"stats": true, "trigger": true, "pause": true, "resume": true, "snooze": true}
+
+// Splits the path of a request to the admin handler into the name of
+// the job and the action, empty if the request is for the job itself.
+// Reports false if the path isn't under /jobs/.
+func adminRoute(path string) (name, action string, ok bool) {
+	rest := strings.TrimPrefix(path, "/jobs/")
+	if rest == path || rest == "" {
+		return "", "", false
+	}
+	if i := strings.LastIndex(rest, "/"); i > 0 && adminActions[rest[i+1:]] {
+		return rest[:i], rest[i+1:], true
+	}
+	return rest, "", true
+}
+
+// Schedules the job called name of the spec in the body of the
+// request, if its type is allowed.
+func (s *Scheduler) serveSchedule(w http.ResponseWriter, r *http.Request, name string, allowed map[string]bool) {
+	var spec jobSpec
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPayloadSize)).Decode(&spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !allowed[spec.Type] {
+		http.Error(w, fmt.Sprintf("job type %q can't be scheduled by the admin handler", spec.Type), http.StatusForbidden)
+		return
+	}
+	opts, err := spec.Opts.opts()
+	if err == nil {
+		err = s.ScheduleType(name, spec.Type, spec.Params, opts)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	st, _ := s.Status(name)
+	writeJSON(w, http.StatusCreated, st)
+}
+
+// Returns the time a snooze request pauses the job until, from
+// its until or for query param.
+func snoozeUntil(r *http.Request, now time.Time) (time.Time, error) {
+	q := r.URL.Query()
+	if v := q.Get("until"); v != "" {
+		return time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("for"); v != "" {
+		d, err := time.ParseDuration(v)
+		return now.Add(d), err
+	}
+	return time.Time{}, errors.New("until or for is required")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,131 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// Maximum number of upcoming runs of a job looked through.
+const maxOccurrences = 10000
+
+// Hotspot is a window of time more jobs than a limit are
+// scheduled to run within.
+type Hotspot struct {
+	// Time is the beginning of the window.
+	Time time.Time
+	// Jobs scheduled to run within the window, sorted.
+	Jobs []string
+	// Offsets are the suggested delays of the jobs, which keep at
+	// most the limit of the jobs in each window if applied, e.g.
+	// as Opts.Splay or by shifting At. Jobs not delayed are left out.
+	Offsets map[string]time.Duration
+}
+
+// Reports the windows within horizon from now, where more than
+// limit jobs are scheduled to run. limit is at least 1. Windows are aligned to the clock,
+// e.g. a minute window starts at the beginning of a minute. Runs are
+// computed with respect to the timing, calendars, blackouts and
+// splays of the jobs; jitter is not taken into account. Use it to
+// find the pile-ups, such as many jobs running at midnight, before
+// they happen.
+func (s *Scheduler) Hotspots(horizon, window time.Duration, limit int) []Hotspot {
+	if limit < 1 {
+		limit = 1
+	}
+	windows := make(map[time.Time][]string)
+	for _, o := range s.upcoming(horizon) {
+		w := o.at.Truncate(window)
+		if names := windows[w]; len(names) == 0 || names[len(names)-1] != o.job {
+			windows[w] = append(names, o.job)
+		}
+	}
+
+	var hotspots []Hotspot
+	for w, names := range windows {
+		if len(names) <= limit {
+			continue
+		}
+		sort.Strings(names)
+		h := Hotspot{Time: w, Jobs: names, Offsets: make(map[string]time.Duration)}
+		for i, name := range names {
+			if off := time.Duration(i/limit) * window; off > 0 {
+				h.Offsets[name] = off
+			}
+		}
+		hotspots = append(hotspots, h)
+	}
+	sort.Slice(hotspots, func(i, k int) bool {
+		return hotspots[i].Time.Before(hotspots[k].Time)
+	})
+	return hotspots
+}
+
+// occurrence is an upcoming run of a job.
+type occurrence struct {
+	job string
+	at  time.Time
+}
+
+// Returns the upcoming runs of the jobs within horizon from now,
+// the runs of each job in order. Runs are computed with respect to
+// the timing, calendars, blackouts and splays of the jobs.
+func (s *Scheduler) upcoming(horizon time.Duration) []occurrence {
+	type job struct {
+		name    string
+		opts    *t.Opts
+		splay   time.Duration
+		forever bool
+	}
+	jobs := s.jobs.all()
+	copies := make([]job, len(jobs))
+	// the loop owns LastRun, copy on the loop
+	s.call(func() {
+		for i, j := range jobs {
+			opts := *j.effectiveOpts()
+			when := *j.when
+			opts.When = &when
+			copies[i] = job{name: j.name, opts: &opts, splay: j.splay, forever: j.forever}
+		}
+	})
+
+	now := s.now()
+	end := now.Add(horizon)
+	var occurrences []occurrence
+	for _, j := range copies {
+		start := j.opts.When.LastRun
+		if start.IsZero() {
+			start = now
+		}
+		for i := 0; i < maxOccurrences; i++ {
+			next := nextAfter(j.opts, start.Add(-j.splay), now)
+			if next.IsZero() {
+				break
+			}
+			next = next.Add(j.splay)
+			if next.After(end) || !next.After(start) {
+				break
+			}
+			occurrences = append(occurrences, occurrence{job: j.name, at: next})
+			if !j.forever {
+				break
+			}
+			start = next
+		}
+	}
+	return occurrences
+}
@@ -0,0 +1,114 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Role is what the caller of an HTTP handler of the scheduler
+// is allowed to do.
+type Role int
+
+const (
+	// RoleNone isn't allowed anything.
+	RoleNone Role = iota
+	// RoleReader can read the statuses and the stats of the jobs.
+	RoleReader
+	// RoleOperator can also schedule, trigger, pause and
+	// resume the jobs.
+	RoleOperator
+)
+
+// Authenticator authenticates the requests to the HTTP handlers of
+// a scheduler, and returns the roles of their callers.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Role, error)
+}
+
+// AuthenticatorFunc is a func as an Authenticator.
+type AuthenticatorFunc func(r *http.Request) (Role, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (Role, error) {
+	return f(r)
+}
+
+// TokenAuth authenticates the requests with an
+// "Authorization: Bearer <token>" header, by the roles of the
+// tokens. Empty tokens are ignored.
+type TokenAuth map[string]Role
+
+func (a TokenAuth) Authenticate(r *http.Request) (Role, error) {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || got == "" {
+		return RoleNone, errors.New("no bearer token")
+	}
+	// compares against all of the tokens in constant time,
+	// not to leak which one is closer
+	role := RoleNone
+	for token, r := range a {
+		if token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			role = r
+		}
+	}
+	if role == RoleNone {
+		return RoleNone, errors.New("unknown token")
+	}
+	return role, nil
+}
+
+// CertAuth authenticates the requests by the common names of the
+// subjects of their verified client certificates, for mTLS. The
+// server must verify the certificates, e.g. with the ClientAuth
+// tls.RequireAndVerifyClientCert of its TLS config.
+type CertAuth map[string]Role
+
+func (a CertAuth) Authenticate(r *http.Request) (Role, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return RoleNone, errors.New("no verified client certificate")
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	role, ok := a[cert.Subject.CommonName]
+	if !ok {
+		return RoleNone, errors.New("unknown client certificate")
+	}
+	return role, nil
+}
+
+// Wraps h to allow only the callers with role or above.
+func requireRole(auth Authenticator, role Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, err := auth.Authenticate(r)
+		if err != nil || got == RoleNone {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if got < role {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Returns the authenticator of the token passed to the handlers,
+// the token is allowed everything. If it's empty, all requests are
+// refused.
+func tokenAuth(token string) Authenticator {
+	return TokenAuth{token: RoleOperator}
+}
@@ -0,0 +1,85 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the retries across all of the jobs of a
+// scheduler, or the launches of the runs of a namespace. It's
+// refilled continuously at its capacity per minute. A nil bucket
+// allows everything.
+type tokenBucket struct {
+	mu     sync.Mutex
+	max    float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{max: float64(perMinute), tokens: float64(perMinute)}
+}
+
+// Takes a token from the bucket, reports false if it's exhausted.
+func (b *tokenBucket) take(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Reserves a token from the bucket, and returns how long to wait
+// for it. The tokens reserved ahead are owed by the bucket, so the
+// waiters are served in order.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.max * float64(time.Minute))
+}
+
+// Must be called with mu held.
+func (b *tokenBucket) refill(now time.Time) {
+	if !now.After(b.last) {
+		// read by another goroutine before this one
+		return
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Minutes() * b.max
+		if b.tokens > b.max {
+			b.tokens = b.max
+		}
+	}
+	b.last = now
+}
@@ -0,0 +1,62 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ticktockd runs the jobs of a config file as a daemon.
+// The config is a snapshot of a scheduler, see Scheduler.Snapshot;
+// its jobs are of the types of the jobs package.
+// Usage:
+// 		ticktockd -config jobs.json -pidfile /run/ticktockd.pid -log /var/log/ticktockd.log
+// The config is reloaded on SIGHUP. The admin endpoints are served on
+// -admin if set, authenticated with the TICKTOCK_ADMIN_TOKEN variable;
+// they schedule the jobs of the types listed in -admin-types only.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rakyll/ticktock/daemon"
+	"github.com/rakyll/ticktock/jobs"
+)
+
+var (
+	config  = flag.String("config", "", "path of the JSON config of the jobs")
+	pidFile = flag.String("pidfile", "", "path of the pidfile")
+	logFile = flag.String("log", "", "path of the log file, the standard error by default")
+	admin   = flag.String("admin", "", "address to serve the admin endpoints on, e.g. localhost:8080")
+	types   = flag.String("admin-types", "", "comma separated job types the admin endpoints may schedule, none by default")
+	drain   = flag.Duration("drain", 30*time.Second, "how long the in-flight runs are waited for on exit")
+)
+
+func main() {
+	flag.Parse()
+	jobs.Register()
+	d := &daemon.Daemon{
+		PidFile:      *pidFile,
+		LogFile:      *logFile,
+		ConfigPath:   *config,
+		AdminAddr:    *admin,
+		AdminToken:   os.Getenv("TICKTOCK_ADMIN_TOKEN"),
+		DrainTimeout: *drain,
+	}
+	if *types != "" {
+		d.AdminTypes = strings.Split(*types, ",")
+	}
+	if err := d.Run(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// client calls the admin endpoints of a scheduler.
+type client struct {
+	base  string
+	token string
+}
+
+var httpClient = &http.Client{Timeout: 5 * time.Second}
+
+// Returns the statuses of the jobs.
+func (c *client) jobs() ([]ticktock.JobStatus, error) {
+	resp, err := c.do("GET", "/jobs")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var jobs []ticktock.JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Posts the action, e.g. trigger, to the job called name.
+func (c *client) post(name, action string) error {
+	resp, err := c.do("POST", "/jobs/"+url.PathEscape(name)+"/"+action)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (c *client) do(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%v %v: %v", method, path, strings.TrimSpace(string(b)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command ticktocktop shows the jobs of a scheduler live, like top.
+// It polls the endpoints of Scheduler.AdminHandler, authenticated
+// with the TICKTOCK_ADMIN_TOKEN variable.
+// Usage:
+// 		ticktocktop -addr http://localhost:8080
+// Keys: up/down or k/j select a job, t triggers it, p pauses or
+// resumes it, q quits.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rakyll/ticktock"
+)
+
+var (
+	addr     = flag.String("addr", "http://localhost:8080", "base URL of the admin endpoints")
+	interval = flag.Duration("interval", time.Second, "how often the jobs are refreshed")
+)
+
+// The number of failures kept in the failures pane.
+const maxFailures = 8
+
+type failure struct {
+	job string
+	at  time.Time
+	err string
+}
+
+type top struct {
+	client *client
+	screen tcell.Screen
+
+	jobs     []ticktock.JobStatus
+	selected int
+	failures []failure
+	// the last run of each job a failure was recorded for
+	failed map[string]time.Time
+	msg    string
+}
+
+func main() {
+	flag.Parse()
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := screen.Init(); err != nil {
+		log.Fatal(err)
+	}
+	tp := &top{
+		client: &client{base: strings.TrimSuffix(*addr, "/"), token: os.Getenv("TICKTOCK_ADMIN_TOKEN")},
+		screen: screen,
+		failed: make(map[string]time.Time),
+	}
+	tp.run()
+	screen.Fini()
+}
+
+func (tp *top) run() {
+	events := make(chan tcell.Event)
+	quit := make(chan struct{})
+	defer close(quit)
+	go tp.screen.ChannelEvents(events, quit)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	tp.refresh()
+	for {
+		tp.draw()
+		select {
+		case <-ticker.C:
+			tp.refresh()
+		case ev := <-events:
+			switch ev := ev.(type) {
+			case *tcell.EventResize:
+				tp.screen.Sync()
+			case *tcell.EventKey:
+				if !tp.key(ev) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Handles a key press, reports false if the user quits.
+func (tp *top) key(ev *tcell.EventKey) bool {
+	switch {
+	case ev.Key() == tcell.KeyEscape || ev.Key() == tcell.KeyCtrlC || ev.Rune() == 'q':
+		return false
+	case ev.Key() == tcell.KeyUp || ev.Rune() == 'k':
+		if tp.selected > 0 {
+			tp.selected--
+		}
+	case ev.Key() == tcell.KeyDown || ev.Rune() == 'j':
+		if tp.selected < len(tp.jobs)-1 {
+			tp.selected++
+		}
+	case ev.Rune() == 't':
+		if st, ok := tp.current(); ok {
+			tp.do("trigger", st.Name, "triggered")
+		}
+	case ev.Rune() == 'p':
+		if st, ok := tp.current(); ok {
+			if st.Paused {
+				tp.do("resume", st.Name, "resumed")
+			} else {
+				tp.do("pause", st.Name, "paused")
+			}
+		}
+	}
+	return true
+}
+
+// Returns the selected job.
+func (tp *top) current() (ticktock.JobStatus, bool) {
+	if tp.selected >= len(tp.jobs) {
+		return ticktock.JobStatus{}, false
+	}
+	return tp.jobs[tp.selected], true
+}
+
+func (tp *top) do(action, name, done string) {
+	if err := tp.client.post(name, action); err != nil {
+		tp.msg = err.Error()
+	} else {
+		tp.msg = fmt.Sprintf("%v %v", done, name)
+	}
+	tp.refresh()
+}
+
+// Polls the jobs, and records the failures of their new runs.
+func (tp *top) refresh() {
+	jobs, err := tp.client.jobs()
+	if err != nil {
+		tp.msg = err.Error()
+		return
+	}
+	tp.jobs = jobs
+	if tp.selected >= len(jobs) {
+		tp.selected = len(jobs) - 1
+	}
+	if tp.selected < 0 {
+		tp.selected = 0
+	}
+	for _, st := range jobs {
+		if st.LastError == "" || tp.failed[st.Name].Equal(st.LastRun) {
+			continue
+		}
+		tp.failed[st.Name] = st.LastRun
+		tp.failures = append([]failure{{job: st.Name, at: st.LastRun, err: st.LastError}}, tp.failures...)
+		if len(tp.failures) > maxFailures {
+			tp.failures = tp.failures[:maxFailures]
+		}
+	}
+}
+
+var (
+	styleHeader   = tcell.StyleDefault.Bold(true).Reverse(true)
+	styleSelected = tcell.StyleDefault.Reverse(true)
+	styleFailed   = tcell.StyleDefault.Foreground(tcell.ColorRed)
+	stylePaused   = tcell.StyleDefault.Foreground(tcell.ColorYellow)
+	styleRunning  = tcell.StyleDefault.Foreground(tcell.ColorGreen)
+)
+
+const rowFormat = "%-24.24s %-8s %-12s %-12s %s"
+
+func (tp *top) draw() {
+	s := tp.screen
+	s.Clear()
+	width, height := s.Size()
+	now := time.Now()
+	row := 0
+	drawText(s, 0, row, width, styleHeader, fmt.Sprintf("ticktocktop %v  %v jobs  %v", *addr, len(tp.jobs), now.Format("15:04:05")))
+	row += 2
+	drawText(s, 0, row, width, tcell.StyleDefault.Bold(true), fmt.Sprintf(rowFormat, "JOB", "STATE", "NEXT RUN", "LAST RUN", "LAST ERROR"))
+	row++
+	// the failures pane and the footer take the bottom rows
+	bottom := height - maxFailures - 4
+	for i, st := range tp.jobs {
+		if row >= bottom {
+			break
+		}
+		state, style := "idle", tcell.StyleDefault
+		switch {
+		case st.Running:
+			state, style = "running", styleRunning
+		case st.Paused:
+			state, style = "paused", stylePaused
+		case st.Disabled:
+			state, style = "disabled", stylePaused
+		case st.LastError != "":
+			style = styleFailed
+		}
+		if i == tp.selected {
+			style = styleSelected
+		}
+		line := fmt.Sprintf(rowFormat, st.Name, state, until(st.NextRun, now), ago(st.LastRun, now), st.LastError)
+		drawText(s, 0, row, width, style, line)
+		row++
+	}
+	row = bottom + 1
+	drawText(s, 0, row, width, tcell.StyleDefault.Bold(true), "RECENT FAILURES")
+	row++
+	for _, f := range tp.failures {
+		drawText(s, 0, row, width, styleFailed, fmt.Sprintf("%v  %-24.24s %s", f.at.Format("15:04:05"), f.job, f.err))
+		row++
+	}
+	drawText(s, 0, height-1, width, styleHeader, fmt.Sprintf("%-*s", width, "t trigger  p pause/resume  q quit  "+tp.msg))
+	s.Show()
+}
+
+// Prints text at x, y, clipped to width.
+func drawText(s tcell.Screen, x, y, width int, style tcell.Style, text string) {
+	for _, r := range text {
+		if x >= width {
+			return
+		}
+		s.SetContent(x, y, r, nil, style)
+		x++
+	}
+}
+
+func until(t, now time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return "in " + t.Sub(now).Round(time.Second).String()
+}
+
+func ago(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return now.Sub(t).Round(time.Second).String() + " ago"
+}
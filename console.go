@@ -0,0 +1,177 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const consoleHelp = `commands:
+  list                  lists the jobs
+  status <job>          shows the status of the job
+  trigger <job>         runs the job immediately
+  pause <job> [for]     pauses the job, for a duration if given, e.g. 30m
+  resume <job>          resumes the paused job
+  history <job>         lists the last runs of the job
+  stats <job>           shows the run duration stats of the job
+  quit                  closes the console
+`
+
+// Runs an interactive console on r and w, for debugging a scheduler
+// inside a long-lived process. Reads commands, one per line, until
+// r is exhausted or quit is entered; help lists the commands.
+// Example:
+// 		go s.Console(os.Stdin, os.Stdout)
+func (s *Scheduler) Console(r io.Reader, w io.Writer) error {
+	sc := bufio.NewScanner(r)
+	for {
+		fmt.Fprint(w, "> ")
+		if !sc.Scan() {
+			return sc.Err()
+		}
+		args := strings.Fields(sc.Text())
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "quit" || args[0] == "exit" {
+			return nil
+		}
+		if err := s.consoleCommand(w, args); err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+	}
+}
+
+// Serves the console on the connections accepted by l, until l is
+// closed. The console isn't authenticated, l should only be reachable
+// by the operators, e.g. a listener on localhost or a Unix socket.
+// Example:
+// 		l, err := net.Listen("tcp", "localhost:7070")
+// 		// ...
+// 		go s.ServeConsole(l)
+func (s *Scheduler) ServeConsole(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s.Console(conn, conn)
+		}()
+	}
+}
+
+func (s *Scheduler) consoleCommand(w io.Writer, args []string) error {
+	cmd, args := args[0], args[1:]
+	if cmd == "help" {
+		fmt.Fprint(w, consoleHelp)
+		return nil
+	}
+	if cmd == "list" {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "JOB\tSTATE\tNEXT RUN\tLAST RUN\tLAST ERROR")
+		for _, st := range s.Jobs() {
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", st.Name, st.state(), formatTime(st.NextRun), formatTime(st.LastRun), st.LastError)
+		}
+		return tw.Flush()
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("unknown command %q, or missing job name; see help", cmd)
+	}
+	name := args[0]
+	if _, ok := s.jobs.get(name); !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	switch cmd {
+	case "status":
+		st, _ := s.Status(name)
+		fmt.Fprintf(w, "state: %v\nnext run: %v\nlast run: %v\n", st.state(), formatTime(st.NextRun), formatTime(st.LastRun))
+		if !st.SnoozedUntil.IsZero() {
+			fmt.Fprintf(w, "snoozed until: %v\n", formatTime(st.SnoozedUntil))
+		}
+		if st.LastError != "" {
+			fmt.Fprintf(w, "last error: %v\n", st.LastError)
+		}
+	case "trigger":
+		return s.Trigger(name)
+	case "pause":
+		if len(args) < 2 {
+			return s.Pause(name)
+		}
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			return err
+		}
+		until := s.now().Add(d)
+		if err := s.Snooze(name, until); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "paused until %v\n", formatTime(until))
+	case "resume":
+		return s.Resume(name)
+	case "history":
+		runs, _ := s.History(name)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "RUN\tSTARTED\tDURATION\tERROR")
+		for _, r := range runs {
+			var errText string
+			if r.Err != nil {
+				errText = r.Err.Error()
+			}
+			fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", r.RunID, formatTime(r.Started), r.Duration, errText)
+		}
+		return tw.Flush()
+	case "stats":
+		st, _ := s.Stats(name)
+		fmt.Fprintf(w, "runs: %v, failures: %v\nmean: %v, p50: %v, p90: %v, p99: %v, max: %v\n",
+			st.Runs, st.Failures, st.Mean, st.P50, st.P90, st.P99, st.Max)
+	default:
+		return fmt.Errorf("unknown command %q; see help", cmd)
+	}
+	return nil
+}
+
+// Returns the state of the job, as reported by the console.
+func (st JobStatus) state() string {
+	switch {
+	case st.Running:
+		return "running"
+	case st.Paused:
+		return "paused"
+	case st.Disabled:
+		return "disabled"
+	case st.NextRun.IsZero():
+		return "idle"
+	}
+	return "scheduled"
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,178 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// controlRequest is a JSON-RPC 2.0 request to the control socket.
+type controlRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  struct {
+		Job string `json:"job"`
+		// For is how long pause pauses the job, e.g. "30m".
+		For string `json:"for"`
+	} `json:"params"`
+}
+
+type controlResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *controlError   `json:"error,omitempty"`
+}
+
+type controlError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// The error codes of JSON-RPC 2.0.
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// controlRun is a RunResult in the responses of the control socket.
+type controlRun struct {
+	RunID    string        `json:"runId"`
+	Time     time.Time     `json:"time"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Err      string        `json:"error,omitempty"`
+}
+
+// Serves a local control plane on the connections accepted by l,
+// typically a Unix socket, so sidecars and shell scripts can manage
+// the scheduler without an HTTP port. Connections carry JSON-RPC
+// 2.0 requests and responses, one per line. The methods are list,
+// status, trigger, pause, resume, cancel, history and stats; all
+// but list take the name of the job as the "job" param, and pause
+// takes an optional duration as "for". Connections aren't
+// authenticated, access is controlled by the permissions of the
+// socket file. Returns nil once l is closed.
+// Example:
+// 		l, err := net.Listen("unix", "/run/myapp/ticktock.sock")
+// 		// ...
+// 		go s.ServeControl(l)
+// From a shell:
+// 		echo '{"jsonrpc": "2.0", "id": 1, "method": "trigger", "params": {"job": "reindex"}}' | nc -U /run/myapp/ticktock.sock
+func (s *Scheduler) ServeControl(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveControlConn(conn)
+	}
+}
+
+func (s *Scheduler) serveControlConn(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req controlRequest
+		if err := dec.Decode(&req); err != nil {
+			if err != io.EOF {
+				enc.Encode(controlResponse{Version: "2.0", ID: json.RawMessage("null"), Error: &controlError{Code: codeParseError, Message: err.Error()}})
+			}
+			return
+		}
+		result, cerr := s.control(&req)
+		if req.ID == nil {
+			// a notification, not answered
+			continue
+		}
+		resp := controlResponse{Version: "2.0", ID: req.ID, Result: result, Error: cerr}
+		if cerr == nil && result == nil {
+			resp.Result = true
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// Runs the method of the request.
+func (s *Scheduler) control(req *controlRequest) (interface{}, *controlError) {
+	switch req.Method {
+	case "list":
+		return s.Jobs(), nil
+	case "status", "trigger", "pause", "resume", "cancel", "history", "stats":
+	default:
+		return nil, &controlError{Code: codeMethodNotFound, Message: "no such method: " + req.Method}
+	}
+	name := req.Params.Job
+	if _, ok := s.jobs.get(name); !ok {
+		return nil, &controlError{Code: codeInvalidParams, Message: "no job exists with the name provided"}
+	}
+	switch req.Method {
+	case "status":
+		st, _ := s.Status(name)
+		return st, nil
+	case "trigger":
+		if err := s.Trigger(name); err != nil {
+			return nil, &controlError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	case "pause":
+		if err := s.controlPause(name, req.Params.For); err != nil {
+			return nil, &controlError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	case "resume":
+		if err := s.Resume(name); err != nil {
+			return nil, &controlError{Code: codeInvalidParams, Message: err.Error()}
+		}
+	case "cancel":
+		s.Cancel(name)
+	case "history":
+		runs, _ := s.History(name)
+		results := make([]controlRun, len(runs))
+		for i, r := range runs {
+			results[i] = controlRun{RunID: r.RunID, Time: r.Time, Started: r.Started, Duration: r.Duration}
+			if r.Err != nil {
+				results[i].Err = r.Err.Error()
+			}
+		}
+		return results, nil
+	case "stats":
+		st, _ := s.Stats(name)
+		return st, nil
+	}
+	return nil, nil
+}
+
+// Pauses the job called name, for the duration if it's not empty.
+func (s *Scheduler) controlPause(name, duration string) error {
+	if duration == "" {
+		return s.Pause(name)
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return err
+	}
+	return s.Snooze(name, s.now().Add(d))
+}
@@ -0,0 +1,205 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package daemon runs a scheduler as a standalone daemon, with
+// a pidfile, a log file and a config reloaded on SIGHUP.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Daemon runs the jobs of a config until it's asked to stop.
+type Daemon struct {
+	// PidFile is written with the process ID on start, and
+	// removed on exit. No pidfile if empty.
+	PidFile string
+	// LogFile is appended to by the scheduler and the standard
+	// logger, rather than the standard error. Optional.
+	LogFile string
+	// ConfigPath is a JSON file of the jobs, in the format of
+	// ticktock.Scheduler.Snapshot, read on start and on SIGHUP.
+	// The jobs should be of registered types. Optional.
+	ConfigPath string
+	// Setup is called with each new scheduler before it's started,
+	// e.g. to schedule the jobs that aren't in the config. Optional.
+	Setup func(s *ticktock.Scheduler) error
+	// Options configure each new scheduler.
+	Options []ticktock.Option
+	// AdminAddr is the address ticktock.Scheduler.AdminHandler is
+	// served on, authenticated with AdminToken. Not served if empty.
+	AdminAddr  string
+	AdminToken string
+	// AdminAuth authenticates the admin requests instead of
+	// AdminToken if set, e.g. with ticktock.TokenAuth for roles.
+	AdminAuth ticktock.Authenticator
+	// AdminTypes are the job types the admin requests may schedule.
+	// None if empty.
+	AdminTypes []string
+	// DrainTimeout is how long the in-flight runs are waited for
+	// on exit, another signal cancels them right away. Defaults
+	// to 30 seconds.
+	DrainTimeout time.Duration
+
+	mu    sync.Mutex
+	s     *ticktock.Scheduler
+	admin http.Handler
+}
+
+// Runs the daemon until the process receives SIGTERM or SIGINT.
+// On SIGHUP, the config is read again into a new scheduler, which
+// replaces the running one; the in-flight runs of the old scheduler
+// are allowed to complete. If the config can't be loaded, the
+// running scheduler is kept.
+func (d *Daemon) Run() error {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if d.LogFile != "" {
+		f, err := os.OpenFile(d.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		logger.SetOutput(f)
+		log.SetOutput(f)
+		defer log.SetOutput(os.Stderr)
+	}
+	if d.PidFile != "" {
+		if err := os.WriteFile(d.PidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			return err
+		}
+		defer os.Remove(d.PidFile)
+	}
+
+	s, err := d.load(logger)
+	if err != nil {
+		return err
+	}
+	done := d.start(s)
+	if d.AdminAddr != "" {
+		srv := &http.Server{Addr: d.AdminAddr, Handler: d}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Printf("ticktockd: serving the admin handler failed: %v", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(c)
+	for sig := range c {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		next, err := d.load(logger)
+		if err != nil {
+			logger.Printf("ticktockd: reloading %v failed, keeping the running jobs: %v", d.ConfigPath, err)
+			continue
+		}
+		logger.Printf("ticktockd: reloaded %v", d.ConfigPath)
+		old, oldDone := s, done
+		s, done = next, d.start(next)
+		go retire(old, oldDone)
+	}
+
+	s.Stop()
+	timeout := d.DrainTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+	case <-c:
+	}
+	go s.CancelAll()
+	return errors.New("ticktockd: the in-flight runs didn't complete in time")
+}
+
+// Serves the admin handler of the running scheduler.
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	h := d.admin
+	d.mu.Unlock()
+	h.ServeHTTP(w, r)
+}
+
+// Creates a scheduler with the jobs of the config.
+func (d *Daemon) load(logger *log.Logger) (*ticktock.Scheduler, error) {
+	opts := append([]ticktock.Option{ticktock.WithLogger(logger)}, d.Options...)
+	s := ticktock.New(opts...)
+	if d.ConfigPath != "" {
+		f, err := os.Open(d.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.RestoreSnapshot(data); err != nil {
+			s.CancelAll()
+			return nil, fmt.Errorf("%v: %v", d.ConfigPath, err)
+		}
+	}
+	if d.Setup != nil {
+		if err := d.Setup(s); err != nil {
+			s.CancelAll()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Starts the scheduler and makes it the running one. Returns
+// a channel closed once it's stopped and drained.
+func (d *Daemon) start(s *ticktock.Scheduler) <-chan struct{} {
+	d.mu.Lock()
+	d.s, d.admin = s, s.AdminHandler(d.AdminToken, d.AdminTypes...)
+	if d.AdminAuth != nil {
+		d.admin = s.AdminHandlerWithAuth(d.AdminAuth, d.AdminTypes...)
+	}
+	d.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.Start()
+		close(done)
+	}()
+	return done
+}
+
+// Stops the replaced scheduler, and cancels its jobs once its
+// in-flight runs are completed, so its triggers stop firing.
+func retire(s *ticktock.Scheduler, done <-chan struct{}) {
+	s.Stop()
+	<-done
+	s.CancelAll()
+}
@@ -0,0 +1,112 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+type noopJob struct {
+	Msg string `json:"msg"`
+}
+
+func (job *noopJob) Run() error {
+	return nil
+}
+
+func init() {
+	ticktock.RegisterJobType("noop", func() ticktock.Job { return &noopJob{} })
+}
+
+// Writes a config of the jobs called names to path.
+func writeConfig(test *testing.T, path string, names ...string) {
+	sh := ticktock.New()
+	for _, name := range names {
+		sh.Schedule(name, &noopJob{Msg: name}, &t.When{Each: "1h"})
+	}
+	data, err := sh.Snapshot()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		test.Fatal(err)
+	}
+}
+
+// Returns the names of the jobs of the running scheduler.
+func (d *Daemon) names() string {
+	d.mu.Lock()
+	s := d.s
+	d.mu.Unlock()
+	if s == nil {
+		return ""
+	}
+	var names []string
+	for _, st := range s.Jobs() {
+		names = append(names, st.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// Tests if the jobs of the config are loaded into the scheduler,
+// along with the jobs of Setup.
+func TestLoad(test *testing.T) {
+	config := filepath.Join(test.TempDir(), "jobs.json")
+	writeConfig(test, config, "a", "b")
+	d := &Daemon{
+		ConfigPath: config,
+		Setup: func(s *ticktock.Scheduler) error {
+			return s.Schedule("c", &noopJob{}, &t.When{Each: "1h"})
+		},
+	}
+	s, err := d.load(log.New(io.Discard, "", 0))
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer s.CancelAll()
+	d.s = s
+	if names := d.names(); names != "a,b,c" {
+		test.Errorf("expected the jobs of the config and Setup, found %v", names)
+	}
+}
+
+// Tests if the daemon doesn't start with a config it can't load,
+// and leaves no pidfile behind.
+func TestRun_BadConfig(test *testing.T) {
+	dir := test.TempDir()
+	config, pidfile := filepath.Join(dir, "jobs.json"), filepath.Join(dir, "ticktockd.pid")
+	if err := os.WriteFile(config, []byte(`[{"name":"a","type":"unknown"}]`), 0644); err != nil {
+		test.Fatal(err)
+	}
+	d := &Daemon{ConfigPath: config, PidFile: pidfile, LogFile: filepath.Join(dir, "ticktockd.log")}
+	if err := d.Run(); err == nil || !strings.Contains(err.Error(), config) {
+		test.Errorf("expected an error naming the config, found %v", err)
+	}
+	if _, err := os.Stat(pidfile); !os.IsNotExist(err) {
+		test.Errorf("expected the pidfile to be removed, found %v", err)
+	}
+	d = &Daemon{ConfigPath: filepath.Join(dir, "missing.json")}
+	if err := d.Run(); !os.IsNotExist(err) {
+		test.Errorf("expected an error for a missing config, found %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package daemon
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Waits for cond, signaling the process with sig if non-zero
+// until it holds.
+func waitFor(test *testing.T, sig syscall.Signal, what string, cond func() bool) {
+	for i := 0; !cond(); i++ {
+		if i == 200 {
+			test.Fatalf("expected %v", what)
+		}
+		if sig != 0 {
+			if err := syscall.Kill(os.Getpid(), sig); err != nil {
+				test.Fatal(err)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Tests if the daemon writes its pidfile, reloads the config on
+// SIGHUP, keeps the running jobs if the config can't be loaded,
+// and exits on SIGTERM.
+func TestRun_Signals(test *testing.T) {
+	// keeps the process alive until the daemon handles the signals
+	c := make(chan os.Signal, 16)
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGTERM)
+	defer signal.Stop(c)
+
+	dir := test.TempDir()
+	config, pidfile, logfile := filepath.Join(dir, "jobs.json"), filepath.Join(dir, "ticktockd.pid"), filepath.Join(dir, "ticktockd.log")
+	writeConfig(test, config, "a")
+	d := &Daemon{ConfigPath: config, PidFile: pidfile, LogFile: logfile, DrainTimeout: time.Second}
+	done := make(chan error, 1)
+	go func() { done <- d.Run() }()
+
+	waitFor(test, 0, "the pidfile to be written", func() bool {
+		data, _ := os.ReadFile(pidfile)
+		return string(data) == strconv.Itoa(os.Getpid())+"\n"
+	})
+	waitFor(test, 0, "the jobs of the config to be loaded", func() bool { return d.names() == "a" })
+
+	// resent until the daemon is listening, reloading is idempotent
+	writeConfig(test, config, "a", "b")
+	waitFor(test, syscall.SIGHUP, "the config to be reloaded on SIGHUP", func() bool { return d.names() == "a,b" })
+
+	if err := os.WriteFile(config, []byte("{"), 0644); err != nil {
+		test.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		test.Fatal(err)
+	}
+	waitFor(test, 0, "the failed reload to be logged", func() bool {
+		data, _ := os.ReadFile(logfile)
+		return strings.Contains(string(data), "keeping the running jobs")
+	})
+	if names := d.names(); names != "a,b" {
+		test.Errorf("expected the running jobs to be kept, found %v", names)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		test.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			test.Errorf("expected the daemon to exit cleanly, found %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		test.Fatal("expected the daemon to exit on SIGTERM")
+	}
+	if _, err := os.Stat(pidfile); !os.IsNotExist(err) {
+		test.Errorf("expected the pidfile to be removed on exit, found %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import "sort"
+
+// Disables the jobs tagged with tag, e.g. all of the nonessential
+// jobs during an incident. The jobs are kept registered and are
+// listed as disabled, but their scheduled runs are skipped until the
+// tag is enabled again; the jobs scheduled later with the tag are
+// disabled too. In-flight runs are allowed to complete, and the jobs
+// can still be triggered while disabled.
+// Example:
+// 		s.DisableTag("nonessential")
+// 		defer s.EnableTag("nonessential")
+func (s *Scheduler) DisableTag(tag string) {
+	s.call(func() { s.disableTag(tag) })
+}
+
+// Enables the jobs tagged with tag, disabled by DisableTag. The jobs
+// are scheduled from their next runs, unless they are paused or have
+// another disabled tag.
+func (s *Scheduler) EnableTag(tag string) {
+	jobs := s.jobs.all()
+	s.call(func() {
+		if !s.disabledTags[tag] {
+			return
+		}
+		delete(s.disabledTags, tag)
+		for _, j := range jobs {
+			if j.hasTag(tag) && j.active && !j.inflight && j.index < 0 && j.ticker == nil {
+				s.schedule(j)
+			}
+		}
+	})
+}
+
+// Returns the disabled tags, sorted.
+func (s *Scheduler) DisabledTags() []string {
+	var tags []string
+	s.call(func() {
+		for tag := range s.disabledTags {
+			tags = append(tags, tag)
+		}
+	})
+	sort.Strings(tags)
+	return tags
+}
+
+// Must be called on the loop.
+func (s *Scheduler) disableTag(tag string) {
+	if s.disabledTags[tag] {
+		return
+	}
+	if s.disabledTags == nil {
+		s.disabledTags = make(map[string]bool)
+	}
+	s.disabledTags[tag] = true
+	for _, j := range s.jobs.all() {
+		if j.hasTag(tag) {
+			s.unschedule(j)
+		}
+	}
+}
+
+// Reports whether the job has a disabled tag. Must be called on
+// the loop.
+func (s *Scheduler) disabled(j *jobC) bool {
+	for tag := range s.disabledTags {
+		if j.hasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the scheduled runs of the job are held back,
+// because it's paused or disabled, or its zombies are being reaped.
+// Must be called on the loop.
+func (s *Scheduler) held(j *jobC) bool {
+	return j.paused || j.reaping || s.disabled(j)
+}
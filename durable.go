@@ -0,0 +1,329 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// QueueStore is a Store that also persists the payloads of the
+// triggered runs, so they are run at least once. The payloads are
+// stored as they arrive, run in order once the runs in progress
+// are completed, and removed once their runs are completed. The
+// payloads left by a previous process are run once the scheduler
+// is started.
+type QueueStore interface {
+	Store
+	// Enqueue appends the payload to the queue of the job
+	// called name.
+	Enqueue(name string, payload []byte) (id string, err error)
+	// Pending returns the payloads in the queue of the job
+	// called name, the oldest first.
+	Pending(name string) ([]QueuedPayload, error)
+	// Ack removes the payload with the id from the queue
+	// of the job called name.
+	Ack(name, id string) error
+}
+
+// OccurrenceStore is a Store that also records the occurrences of
+// the schedules of the jobs once their runs are completed. The last
+// run is stored after the run, so a process that crashes in between
+// would run the occurrence again once it's restarted; the scheduler
+// skips the occurrences recorded as completed instead. Occurrences
+// are keyed by their times in UTC, rounded to the millisecond, in
+// RFC 3339 format. Only the occurrences after the last runs are
+// looked up, the store can forget the older ones.
+type OccurrenceStore interface {
+	Store
+	// Completed reports whether the occurrence with the key of
+	// the job called name is recorded as completed.
+	Completed(name, key string) (bool, error)
+	// SetCompleted records the occurrence with the key of the
+	// job called name as completed.
+	SetCompleted(name, key string) error
+}
+
+func occurrenceKey(occurrence time.Time) string {
+	return occurrence.UTC().Round(time.Millisecond).Format(time.RFC3339Nano)
+}
+
+// Reports whether the occurrence was completed before, by
+// a previous process.
+func (j *jobC) completedBefore(occurrence time.Time) bool {
+	st, ok := j.scheduler.store.(OccurrenceStore)
+	if !ok {
+		return false
+	}
+	done, err := st.Completed(j.name, occurrenceKey(occurrence))
+	if err != nil {
+		// runs it rather than risking to miss it
+		j.scheduler.logf("ticktock: looking up the occurrence %v of %v failed: %v", occurrence, j.name, err)
+		return false
+	}
+	if done {
+		j.scheduler.logf("ticktock: skipped the occurrence %v of %v, it was completed before", occurrence, j.name)
+	}
+	return done
+}
+
+func (j *jobC) setCompleted(occurrence time.Time) {
+	st, ok := j.scheduler.store.(OccurrenceStore)
+	if !ok {
+		return
+	}
+	if err := st.SetCompleted(j.name, occurrenceKey(occurrence)); err != nil {
+		j.scheduler.logf("ticktock: recording the occurrence %v of %v failed: %v", occurrence, j.name, err)
+	}
+}
+
+// RunStore is a Store that also records the runs in progress, so
+// the runs left unfinished by a crashed process are detected. Runs
+// are recorded as they start and removed as they finish. Once the
+// scheduler is started, the runs a previous process left behind are
+// emitted as EventZombie and passed to the OnZombie of their jobs,
+// e.g. to clean up their temporary files, before the jobs are
+// scheduled.
+type RunStore interface {
+	Store
+	// SetStarted records the run of the job called name
+	// as started.
+	SetStarted(name string, run StartedRun) error
+	// SetFinished removes the run with the id of the job
+	// called name.
+	SetFinished(name, id string) error
+	// Started returns the runs of the job called name that
+	// are started but not finished.
+	Started(name string) ([]StartedRun, error)
+}
+
+// StartedRun is a run recorded in a RunStore.
+type StartedRun struct {
+	RunID string
+	// Time is the time the run was scheduled at.
+	Time    time.Time
+	Started time.Time
+}
+
+// Reports the runs of the job left unfinished by a previous process,
+// and removes them from the store. It runs off the loop, so the hooks
+// can call the scheduler, and hands the job back to the loop to be
+// scheduled once it's done, replaying the interrupted runs of the
+// jobs with the at-least-once semantics.
+func (j *jobC) reapZombies(st RunStore) {
+	runs, err := st.Started(j.name)
+	if err != nil {
+		j.scheduler.logf("ticktock: loading the started runs of %v failed: %v", j.name, err)
+	}
+	runs = j.scheduler.zombies(runs)
+	for _, r := range runs {
+		j.scheduler.logf("ticktock: the run %v of %v started at %v never finished", r.RunID, j.name, r.Started)
+		j.scheduler.emit(Event{Kind: EventZombie, Job: j.name, Time: r.Started, RunID: r.RunID})
+		if j.opts.OnZombie != nil {
+			j.opts.OnZombie(j.name, r.RunID, r.Started)
+		}
+		if err := st.SetFinished(j.name, r.RunID); err != nil {
+			j.scheduler.logf("ticktock: removing the run %v of %v failed: %v", r.RunID, j.name, err)
+		}
+	}
+	j.scheduler.do(func() {
+		j.reaping = false
+		replayed := make(map[string]bool)
+		if j.opts.Semantics == t.AtLeastOnce {
+			for _, r := range runs {
+				if key := occurrenceKey(r.Time); !replayed[key] {
+					replayed[key] = true
+					go j.fire(r.Time, nil)
+				}
+			}
+		}
+		if j.active {
+			j.scheduler.queueMissed(j, replayed)
+		}
+	})
+}
+
+// Returns the occurrence after the last run of the job if it has
+// passed, the occurrence the job missed while the scheduler was down.
+func (j *jobC) missed() (time.Time, bool) {
+	last := j.when.LastRun
+	if last.IsZero() {
+		return time.Time{}, false
+	}
+	if _, ok := j.when.Interval(); !ok {
+		if loc := j.location(); loc != nil {
+			last = last.In(loc)
+		}
+	}
+	d := j.when.Duration(last)
+	if d <= 0 {
+		return time.Time{}, false
+	}
+	occurrence := last.Add(d)
+	return occurrence, occurrence.Before(j.scheduler.now())
+}
+
+func (j *jobC) setStarted(run StartedRun) {
+	st, ok := j.scheduler.store.(RunStore)
+	if !ok {
+		return
+	}
+	s := j.scheduler
+	s.runsMu.Lock()
+	if s.ownRuns == nil {
+		s.ownRuns = make(map[string]bool)
+	}
+	s.ownRuns[run.RunID] = true
+	s.runsMu.Unlock()
+	if err := st.SetStarted(j.name, run); err != nil {
+		j.scheduler.logf("ticktock: recording the run %v of %v failed: %v", run.RunID, j.name, err)
+	}
+}
+
+func (j *jobC) setFinished(id string) {
+	st, ok := j.scheduler.store.(RunStore)
+	if !ok {
+		return
+	}
+	if err := st.SetFinished(j.name, id); err != nil {
+		j.scheduler.logf("ticktock: removing the run %v of %v failed: %v", id, j.name, err)
+	}
+	j.scheduler.runsMu.Lock()
+	delete(j.scheduler.ownRuns, id)
+	j.scheduler.runsMu.Unlock()
+}
+
+// Returns the started runs that aren't runs of the process.
+func (s *Scheduler) zombies(runs []StartedRun) []StartedRun {
+	s.runsMu.Lock()
+	defer s.runsMu.Unlock()
+	var zombies []StartedRun
+	for _, r := range runs {
+		if !s.ownRuns[r.RunID] {
+			zombies = append(zombies, r)
+		}
+	}
+	return zombies
+}
+
+// QueuedPayload is a payload waiting in a QueueStore.
+type QueuedPayload struct {
+	ID      string
+	Payload []byte
+}
+
+// Stores the payload and starts draining the queue of the job.
+func (j *jobC) enqueue(qs QueueStore, payload []byte) error {
+	if _, err := qs.Enqueue(j.name, payload); err != nil {
+		return err
+	}
+	j.drain(qs)
+	return nil
+}
+
+// Starts draining the queue of the stored payloads, unless it's
+// already being drained.
+func (j *jobC) drain(qs QueueStore) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.draining {
+		j.drainAgain = true
+		return
+	}
+	j.draining = true
+	go func() {
+		for {
+			j.drainOnce(qs)
+			j.mu.Lock()
+			if !j.drainAgain || j.cancelled {
+				j.draining = false
+				j.mu.Unlock()
+				return
+			}
+			j.drainAgain = false
+			j.mu.Unlock()
+		}
+	}()
+}
+
+// Runs the job with each of the stored payloads, and removes them
+// once their runs are completed. A payload whose run fails is
+// removed as well; the retries of the job are its second chances.
+func (j *jobC) drainOnce(qs QueueStore) {
+	pending, err := qs.Pending(j.name)
+	if err != nil {
+		j.scheduler.logf("ticktock: loading the payloads of %v failed: %v", j.name, err)
+		return
+	}
+	atMostOnce := j.opts.Semantics == t.AtMostOnce
+	for _, p := range pending {
+		if atMostOnce {
+			j.ack(qs, p.ID)
+		}
+		if !j.fireWait(j.scheduler.now(), p.Payload) {
+			return
+		}
+		if !atMostOnce {
+			j.ack(qs, p.ID)
+		}
+	}
+}
+
+func (j *jobC) ack(qs QueueStore, id string) {
+	if err := qs.Ack(j.name, id); err != nil {
+		j.scheduler.logf("ticktock: removing the payload %v of %v failed: %v", id, j.name, err)
+	}
+}
+
+// Runs the job triggered at `at` with the params once the blackouts
+// are over, its ReadyCheck passes and the host isn't overloaded, the
+// same as the scheduled runs but waiting rather than skipping the
+// run. Unless the job allows overlapping runs, the runs in progress
+// are waited for as well. Reports false if the job is cancelled
+// instead.
+func (j *jobC) fireWait(at time.Time, params interface{}) bool {
+	for !j.isCancelled() {
+		now := j.scheduler.now()
+		opts := j.effectiveOpts()
+		wait := readyCheckInterval(opts)
+		if until, ok := opts.BlackedOut(now); ok {
+			wait = until.Sub(now)
+		} else if !j.held(opts) {
+			break
+		}
+		over := make(chan struct{})
+		j.scheduler.clk().AfterFunc(wait, func() { close(over) })
+		<-over
+	}
+	j.mu.Lock()
+	for j.running > 0 && j.opts.Overlap != t.OverlapAllow && !j.cancelled {
+		if j.quiet == nil {
+			j.quiet = make(chan struct{})
+		}
+		quiet := j.quiet
+		j.mu.Unlock()
+		<-quiet
+		j.mu.Lock()
+	}
+	if j.cancelled {
+		j.mu.Unlock()
+		return false
+	}
+	j.running++
+	j.mu.Unlock()
+	j.runQueued(at, params)
+	return true
+}
@@ -0,0 +1,210 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeyProvider provides the AES keys the persisted payloads are
+// encrypted with, e.g. from a KMS. Keys are 16, 24 or 32 bytes
+// long, for AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// CurrentKey returns the key the new payloads are encrypted
+	// with, and its ID.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key with the id, to decrypt the payloads
+	// encrypted with it before a rotation.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider of a single key.
+type StaticKey []byte
+
+func (k StaticKey) CurrentKey() (string, []byte, error) {
+	return "", k, nil
+}
+
+func (k StaticKey) Key(id string) ([]byte, error) {
+	if id != "" {
+		return nil, fmt.Errorf("no key with the id %q", id)
+	}
+	return k, nil
+}
+
+// The version of the format of the encrypted payloads:
+// version, len(key id), key id, nonce, sealed payload.
+const encryptedV1 = 1
+
+// Returns a QueueStore that encrypts the payloads with AES-GCM
+// before they are stored in qs, since payloads often contain
+// connection strings and tokens. The payloads are bound to the
+// names of their jobs, so they can't be moved to another job in
+// the store. Pending fails if a payload can't be decrypted, e.g.
+// it's tampered with or its key is gone. The last runs aren't
+// secret and are stored as is, and so are the occurrences, runs
+// and history if qs is also an OccurrenceStore, a RunStore or
+// a HistoryStore.
+// Example:
+// 		st := ticktock.EncryptQueueStore(qs, ticktock.StaticKey(key))
+// 		s := ticktock.New(ticktock.WithStore(st))
+func EncryptQueueStore(qs QueueStore, keys KeyProvider) QueueStore {
+	st := &encryptedStore{QueueStore: qs, keys: keys}
+	occ, _ := qs.(occurrenceMethods)
+	runs, _ := qs.(runMethods)
+	arch, _ := qs.(archiveMethods)
+	// the returned store implements the same interfaces as qs
+	switch {
+	case occ != nil && runs != nil && arch != nil:
+		return struct {
+			*encryptedStore
+			occurrenceMethods
+			runMethods
+			archiveMethods
+		}{st, occ, runs, arch}
+	case occ != nil && runs != nil:
+		return struct {
+			*encryptedStore
+			occurrenceMethods
+			runMethods
+		}{st, occ, runs}
+	case occ != nil && arch != nil:
+		return struct {
+			*encryptedStore
+			occurrenceMethods
+			archiveMethods
+		}{st, occ, arch}
+	case runs != nil && arch != nil:
+		return struct {
+			*encryptedStore
+			runMethods
+			archiveMethods
+		}{st, runs, arch}
+	case occ != nil:
+		return struct {
+			*encryptedStore
+			occurrenceMethods
+		}{st, occ}
+	case runs != nil:
+		return struct {
+			*encryptedStore
+			runMethods
+		}{st, runs}
+	case arch != nil:
+		return struct {
+			*encryptedStore
+			archiveMethods
+		}{st, arch}
+	}
+	return st
+}
+
+// The methods of OccurrenceStore, RunStore and HistoryStore
+// beyond Store, forwarded by the encrypted stores.
+type (
+	occurrenceMethods interface {
+		Completed(name, key string) (bool, error)
+		SetCompleted(name, key string) error
+	}
+	runMethods interface {
+		SetStarted(name string, run StartedRun) error
+		SetFinished(name, id string) error
+		Started(name string) ([]StartedRun, error)
+	}
+	archiveMethods interface {
+		Archive(name string, runs []RunResult) error
+	}
+)
+
+type encryptedStore struct {
+	QueueStore
+	keys KeyProvider
+}
+
+func (st *encryptedStore) Enqueue(name string, payload []byte) (string, error) {
+	id, key, err := st.keys.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	if len(id) > 255 {
+		return "", errors.New("the key id is longer than 255 bytes")
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	b := append([]byte{encryptedV1, byte(len(id))}, id...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	b = append(b, nonce...)
+	b = aead.Seal(b, nonce, payload, []byte(name))
+	return st.QueueStore.Enqueue(name, b)
+}
+
+func (st *encryptedStore) Pending(name string) ([]QueuedPayload, error) {
+	pending, err := st.QueueStore.Pending(name)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range pending {
+		payload, err := st.decrypt(name, p.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting the payload %v: %v", p.ID, err)
+		}
+		pending[i].Payload = payload
+	}
+	return pending, nil
+}
+
+func (st *encryptedStore) decrypt(name string, b []byte) ([]byte, error) {
+	if len(b) < 2 || b[0] != encryptedV1 || len(b) < 2+int(b[1]) {
+		return nil, errors.New("not an encrypted payload")
+	}
+	id, b := string(b[2:2+int(b[1])]), b[2+int(b[1]):]
+	key, err := st.keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("not an encrypted payload")
+	}
+	payload, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return nil, err
+	}
+	if payload == nil {
+		// an empty payload, not no payload
+		payload = []byte{}
+	}
+	return payload, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"fmt"
+	"time"
+)
+
+// The number of failures Errors buffers.
+const errorsBuffer = 64
+
+// JobError is the final failure of a run, after its retries.
+type JobError struct {
+	Job   string
+	RunID string
+	// Time is the time the run was scheduled or triggered at.
+	Time time.Time
+	Err  error
+}
+
+func (e JobError) Error() string {
+	return fmt.Sprintf("%v (run %v at %v): %v", e.Job, e.RunID, e.Time, e.Err)
+}
+
+// Returns the error of the run.
+func (e JobError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error of an attempt whose job panicked. The
+// panics of the jobs are recovered, so a job can't crash the
+// scheduler; the attempt fails, and is retried as any other.
+type PanicError struct {
+	// Value is the value the job panicked with.
+	Value interface{}
+	// Stack is the stack trace of the panic, as formatted by
+	// runtime/debug.Stack.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Returns a channel delivering the final failures of the runs,
+// so applications can handle the failures of all jobs in one
+// place. The failures are delivered from the first call on; they
+// are buffered, and dropped if the buffer is full, so the channel
+// should be received from promptly.
+func (s *Scheduler) Errors() <-chan JobError {
+	s.errsMu.Lock()
+	defer s.errsMu.Unlock()
+	if s.errs == nil {
+		s.errs = make(chan JobError, errorsBuffer)
+	}
+	return s.errs
+}
+
+func (s *Scheduler) reportError(e JobError) {
+	s.errsMu.Lock()
+	errs := s.errs
+	s.errsMu.Unlock()
+	if errs == nil {
+		return
+	}
+	select {
+	case errs <- e:
+	default:
+		s.logf("ticktock: dropped the failure of %v, Errors is not received from", e.Job)
+	}
+}
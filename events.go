@@ -0,0 +1,127 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import "time"
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// A run is started.
+	EventStarted EventKind = iota
+	// A run is completed without an error.
+	EventSucceeded
+	// A run is failed after its retries.
+	EventFailed
+	// A run would have started if the scheduler wasn't in
+	// the dry-run mode.
+	EventDryRun
+	// The wall clock has stepped, the runs that depend on it
+	// are rescheduled.
+	EventClockStep
+	// A failed attempt of a run is about to be retried.
+	EventRetrying
+	// The ReadyCheck of a job failed, its run is skipped
+	// or postponed.
+	EventNotReady
+	// The host is overloaded, a run of a job that isn't critical
+	// is skipped or postponed. See WithLoadGate.
+	EventOverloaded
+	// An attempt of a run is running longer than the SoftTimeout
+	// of its job, it's cancelled at the Timeout.
+	EventSoftTimeout
+	// A run of a previous process never finished, the process
+	// crashed in the middle of it. See RunStore.
+	EventZombie
+	// A run of a preemptible job was cancelled to make room for
+	// the run of a critical job, it's run again later. See
+	// WithPreemption.
+	EventPreempted
+	// A run took longer than the DurationSLO of its job, whether
+	// it succeeded or failed.
+	EventSLOViolated
+)
+
+var eventNames = [...]string{
+	EventStarted:     "started",
+	EventSucceeded:   "succeeded",
+	EventFailed:      "failed",
+	EventDryRun:      "dry-run",
+	EventClockStep:   "clock-step",
+	EventRetrying:    "retrying",
+	EventNotReady:    "not-ready",
+	EventOverloaded:  "overloaded",
+	EventSoftTimeout: "soft-timeout",
+	EventZombie:      "zombie",
+	EventPreempted:   "preempted",
+	EventSLOViolated: "slo-violated",
+}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventNames) {
+		return "unknown"
+	}
+	return eventNames[k]
+}
+
+// Event is emitted by a scheduler as the runs of its jobs progress.
+type Event struct {
+	Kind EventKind
+	Job  string
+	// RunID identifies the run, for the events of the runs.
+	RunID string
+	// Time is the time the run started, or for EventDryRun,
+	// the time the run was scheduled at. For EventClockStep,
+	// it's the time the step is detected at.
+	Time time.Time
+	// Err is the error of a failed run, or for EventRetrying,
+	// the error of the previous attempt. For EventNotReady, it's
+	// the error of the ReadyCheck.
+	Err error
+	// Attempt is the number of the attempt to start, 2 for the
+	// first retry, for EventRetrying. For EventSoftTimeout, it's
+	// the number of the attempt running, 1 for the first one, and
+	// for EventFailed, the number of the attempts made.
+	Attempt int
+	// Step is how far the wall clock has stepped, and Jobs are
+	// the jobs whose next runs have moved, for EventClockStep.
+	// For EventPreempted, Jobs is the critical job.
+	Step time.Duration
+	Jobs []string
+	// Duration is how long the run took, including its retries,
+	// for EventSucceeded, EventFailed and EventSLOViolated.
+	Duration time.Duration
+}
+
+// Listener receives the events of a scheduler. Events are
+// delivered synchronously from the goroutines of the runs,
+// OnEvent should return quickly.
+type Listener interface {
+	OnEvent(e Event)
+}
+
+// ListenerFunc adapts an ordinary function to a Listener.
+type ListenerFunc func(e Event)
+
+// Calls f with e.
+func (f ListenerFunc) OnEvent(e Event) {
+	f(e)
+}
+
+func (s *Scheduler) emit(e Event) {
+	for _, l := range s.listeners {
+		l.OnEvent(e)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fswatch triggers scheduled jobs on file system changes.
+package fswatch
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rakyll/ticktock"
+)
+
+// Watcher triggers a job when any of the watched files or
+// directories change.
+type Watcher struct {
+	scheduler *ticktock.Scheduler
+	name      string
+	debounce  time.Duration
+	w         *fsnotify.Watcher
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// Watches paths and triggers the job called name on s when a file
+// is created, written, removed or renamed. Directories are not
+// watched recursively. If debounce is positive, a burst of changes
+// triggers the job once, after no changes have been observed for
+// the debounce duration.
+// Example:
+// 		w, err := fswatch.Trigger(s, "reprocess", time.Second, "/data/input.csv")
+func Trigger(s *ticktock.Scheduler, name string, debounce time.Duration, paths ...string) (*Watcher, error) {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if err := fw.Add(p); err != nil {
+			fw.Close()
+			return nil, err
+		}
+	}
+	w := &Watcher{scheduler: s, name: name, debounce: debounce, w: fw}
+	go w.loop()
+	return w, nil
+}
+
+// Stops watching. Pending debounced triggers are dropped.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.w.Close()
+}
+
+func (w *Watcher) loop() {
+	for {
+		select {
+		case ev, ok := <-w.w.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			w.changed()
+		case _, ok := <-w.w.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+func (w *Watcher) changed() {
+	if w.debounce <= 0 {
+		w.scheduler.Trigger(w.name)
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(w.debounce, func() {
+		w.scheduler.Trigger(w.name)
+	})
+}
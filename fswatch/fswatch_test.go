@@ -0,0 +1,116 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fswatch
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+type countJob struct{ runs int32 }
+
+func (j *countJob) Run() error {
+	atomic.AddInt32(&j.runs, 1)
+	return nil
+}
+
+func (j *countJob) count() int32 {
+	return atomic.LoadInt32(&j.runs)
+}
+
+// Returns a started scheduler with the job called reprocess.
+func start(test *testing.T, job ticktock.Job) *ticktock.Scheduler {
+	sh := &ticktock.Scheduler{}
+	if err := sh.Schedule("reprocess", job, &t.When{Each: "1h"}); err != nil {
+		test.Fatal(err)
+	}
+	go sh.Start()
+	test.Cleanup(sh.Stop)
+	return sh
+}
+
+func write(test *testing.T, path string) {
+	if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+		test.Fatal(err)
+	}
+}
+
+// Waits for the job to run n times, and reports whether it did.
+func waitRuns(job *countJob, n int32) bool {
+	for i := 0; i < 200 && job.count() < n; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return job.count() >= n
+}
+
+func TestTrigger(test *testing.T) {
+	dir := test.TempDir()
+	job := &countJob{}
+	w, err := Trigger(start(test, job), "reprocess", 0, dir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	write(test, filepath.Join(dir, "input.csv"))
+	if !waitRuns(job, 1) {
+		test.Fatal("expected a change to trigger the job")
+	}
+	if err := w.Close(); err != nil {
+		test.Fatal(err)
+	}
+	// the events in flight may still trigger it
+	time.Sleep(50 * time.Millisecond)
+	runs := job.count()
+	write(test, filepath.Join(dir, "other.csv"))
+	time.Sleep(50 * time.Millisecond)
+	if n := job.count(); n != runs {
+		test.Errorf("expected no runs once closed, found %v", n-runs)
+	}
+}
+
+func TestTrigger_Debounce(test *testing.T) {
+	dir := test.TempDir()
+	job := &countJob{}
+	w, err := Trigger(start(test, job), "reprocess", 100*time.Millisecond, dir)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer w.Close()
+	for i := 0; i < 5; i++ {
+		write(test, filepath.Join(dir, "input.csv"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.count() != 0 {
+		test.Error("expected the burst to be debounced")
+	}
+	if !waitRuns(job, 1) {
+		test.Fatal("expected the burst to trigger the job")
+	}
+	time.Sleep(150 * time.Millisecond)
+	if n := job.count(); n != 1 {
+		test.Errorf("expected the burst to trigger the job once, found %v runs", n)
+	}
+}
+
+func TestTrigger_MissingPath(test *testing.T) {
+	if _, err := Trigger(&ticktock.Scheduler{}, "reprocess", 0, filepath.Join(test.TempDir(), "missing")); err == nil {
+		test.Error("expected an error watching a missing path")
+	}
+}
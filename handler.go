@@ -0,0 +1,93 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Maximum size of a trigger payload.
+const maxPayloadSize = 1 << 20
+
+// Returns an HTTP handler that triggers jobs on the default
+// scheduler. See Scheduler.TriggerHandler.
+func TriggerHandler(token string) http.Handler {
+	return defaultScheduler.TriggerHandler(token)
+}
+
+// Returns an HTTP handler that triggers the job called name on
+// POST /trigger/{name}. The request body, if any, is passed to
+// the run as its payload. Requests should be authenticated with
+// an "Authorization: Bearer <token>" header. If token is empty,
+// all requests are refused.
+// Example:
+// 		http.Handle("/trigger/", s.TriggerHandler(os.Getenv("TRIGGER_TOKEN")))
+func (s *Scheduler) TriggerHandler(token string) http.Handler {
+	return s.TriggerHandlerWithAuth(tokenAuth(token))
+}
+
+// Returns an HTTP handler that triggers jobs on the default
+// scheduler, authenticated by auth. See Scheduler.TriggerHandlerWithAuth.
+func TriggerHandlerWithAuth(auth Authenticator) http.Handler {
+	return defaultScheduler.TriggerHandlerWithAuth(auth)
+}
+
+// Returns the handler of TriggerHandler, with the requests
+// authenticated by auth. Triggering requires RoleOperator.
+func (s *Scheduler) TriggerHandlerWithAuth(auth Authenticator) http.Handler {
+	trigger := requireRole(auth, RoleOperator, func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPayloadSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if len(payload) == 0 {
+			payload = nil
+		}
+		if err := s.TriggerWithPayload(strings.TrimPrefix(r.URL.Path, "/trigger/"), payload); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := strings.TrimPrefix(r.URL.Path, "/trigger/"); name == r.URL.Path || name == "" {
+			http.NotFound(w, r)
+			return
+		}
+		serveMethods(w, r, map[string]http.HandlerFunc{"POST": trigger})
+	})
+}
+
+// Serves the request with the handler of its method, or replies
+// with 405 if there is none. The routes are matched by hand rather
+// than with the method patterns of http.ServeMux, which older
+// toolchains and GOPATH builds don't support.
+func serveMethods(w http.ResponseWriter, r *http.Request, handlers map[string]http.HandlerFunc) {
+	if h, ok := handlers[r.Method]; ok {
+		h(w, r)
+		return
+	}
+	allowed := make([]string, 0, len(handlers))
+	for method := range handlers {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
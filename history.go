@@ -0,0 +1,105 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import "time"
+
+// The number of the runs kept in the history of a job,
+// unless HistorySize is set.
+const historySize = 32
+
+// HistoryStore is a Store that also archives the runs pruned from
+// the histories of the jobs, by HistorySize or HistoryAge, so the
+// histories are bounded in memory but kept in full elsewhere.
+type HistoryStore interface {
+	Store
+	// Archive stores the runs pruned from the history of the job
+	// called name, the oldest first.
+	Archive(name string, runs []RunResult) error
+}
+
+// history holds the results of the last runs of a job, the oldest
+// first, guarded by the mu of the job.
+type history struct {
+	runs []RunResult
+}
+
+// Adds the run and returns the runs pruned by size or age as of
+// now. The size is historySize if it's zero; no runs are pruned by
+// age if age is zero.
+func (h *history) add(r RunResult, size int, age time.Duration, now time.Time) (pruned []RunResult) {
+	h.runs = append(h.runs, r)
+	return h.prune(size, age, now)
+}
+
+func (h *history) prune(size int, age time.Duration, now time.Time) []RunResult {
+	if size <= 0 {
+		size = historySize
+	}
+	n := len(h.runs) - size
+	if n < 0 {
+		n = 0
+	}
+	if age > 0 {
+		for n < len(h.runs) && now.Sub(h.runs[n].Started) > age {
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	pruned := append([]RunResult(nil), h.runs[:n]...)
+	// appending reallocates the live runs only once the
+	// pruned ones fill the capacity
+	h.runs = h.runs[n:]
+	return pruned
+}
+
+// Returns the runs, the latest first.
+func (h *history) list() []RunResult {
+	runs := make([]RunResult, len(h.runs))
+	for i := range runs {
+		runs[i] = h.runs[len(h.runs)-1-i]
+	}
+	return runs
+}
+
+// Archives the runs pruned from the history of the job, if the
+// store of the scheduler is a HistoryStore.
+func (j *jobC) archive(pruned []RunResult) {
+	st, ok := j.scheduler.store.(HistoryStore)
+	if !ok || len(pruned) == 0 {
+		return
+	}
+	if err := st.Archive(j.name, pruned); err != nil {
+		j.scheduler.logf("ticktock: archiving the history of %v failed: %v", j.name, err)
+	}
+}
+
+// Returns the results of the last runs of the job called name,
+// the latest first, up to HistorySize runs within HistoryAge.
+// Reports false if there is no such job.
+func (s *Scheduler) History(name string) ([]RunResult, bool) {
+	j, ok := s.jobs.get(name)
+	if !ok {
+		return nil, false
+	}
+	j.mu.Lock()
+	pruned := j.history.prune(j.opts.HistorySize, j.opts.HistoryAge, s.now())
+	runs := j.history.list()
+	j.mu.Unlock()
+	j.archive(pruned)
+	return runs, true
+}
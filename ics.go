@@ -0,0 +1,283 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+const icsTime = "20060102T150405Z"
+
+// Writes the upcoming runs of the jobs within horizon from now to w
+// as an iCalendar, with an event for each run, so the schedule can
+// be followed from calendar clients. Runs are computed as in
+// Hotspots.
+func (s *Scheduler) ExportICS(w io.Writer, horizon time.Duration) error {
+	occurrences := s.upcoming(horizon)
+	sort.SliceStable(occurrences, func(i, k int) bool {
+		return occurrences[i].at.Before(occurrences[k].at)
+	})
+	stamp := s.now().UTC().Format(icsTime)
+	bw := bufio.NewWriter(w)
+	writeICSLine(bw, "BEGIN:VCALENDAR")
+	writeICSLine(bw, "VERSION:2.0")
+	writeICSLine(bw, "PRODID:-//rakyll//ticktock//EN")
+	for _, o := range occurrences {
+		at := o.at.UTC()
+		writeICSLine(bw, "BEGIN:VEVENT")
+		writeICSLine(bw, fmt.Sprintf("UID:%v-%v@ticktock", escapeICS(o.job), at.Unix()))
+		writeICSLine(bw, "DTSTAMP:"+stamp)
+		writeICSLine(bw, "DTSTART:"+at.Format(icsTime))
+		writeICSLine(bw, "SUMMARY:"+escapeICS(o.job))
+		writeICSLine(bw, "END:VEVENT")
+	}
+	writeICSLine(bw, "END:VCALENDAR")
+	return bw.Flush()
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+
+func escapeICS(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// Writes the line, folded to 75 octets as required by RFC 5545.
+func writeICSLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		n := limit
+		// don't split UTF-8 sequences
+		for n > 0 && line[n]&0xC0 == 0x80 {
+			n--
+		}
+		w.WriteString(line[:n])
+		w.WriteString("\r\n ")
+		line = line[n:]
+		// continuation lines begin with a space
+		limit = 74
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// ICSEvent is an event of an iCalendar.
+type ICSEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Start       time.Time
+	// RRule is the recurrence rule of the event, empty
+	// if the event doesn't repeat.
+	RRule string
+}
+
+// Parses the events of an iCalendar. Times without a zone are
+// interpreted in loc, time.Local if nil.
+func ParseICS(r io.Reader, loc *time.Location) ([]ICSEvent, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		events []ICSEvent
+		e      *ICSEvent
+	)
+	for _, line := range lines {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			e = &ICSEvent{}
+		case name == "END" && value == "VEVENT" && e != nil:
+			events = append(events, *e)
+			e = nil
+		case e == nil:
+		case name == "UID":
+			e.UID = unescapeICS(value)
+		case name == "SUMMARY":
+			e.Summary = unescapeICS(value)
+		case name == "DESCRIPTION":
+			e.Description = unescapeICS(value)
+		case name == "RRULE":
+			e.RRule = value
+		case name == "DTSTART":
+			if e.Start, err = parseICSTime(value, params["TZID"], loc); err != nil {
+				return nil, fmt.Errorf("event %q: %v", e.UID, err)
+			}
+		}
+	}
+	return events, nil
+}
+
+// Returns the timing of the event. Events repeating MINUTELY,
+// HOURLY, DAILY or WEEKLY with an INTERVAL are supported; a WEEKLY
+// rule may have a single BYDAY. The runs are aligned to the start
+// of the event. Events that don't repeat run once at their start,
+// and can't be in the past.
+func (e ICSEvent) When(now time.Time) (*t.When, error) {
+	if e.RRule == "" {
+		if !e.Start.After(now) {
+			return nil, errors.New("event is in the past")
+		}
+		return &t.When{Each: e.Start.Sub(now).String(), LastRun: now}, nil
+	}
+	freq, interval, start := "", 1, e.Start
+	for _, part := range strings.Split(e.RRule, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "FREQ":
+			freq = v
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", v)
+			}
+			interval = n
+		case "BYDAY":
+			day, ok := icsDays[v]
+			if !ok {
+				return nil, fmt.Errorf("unsupported BYDAY %q", v)
+			}
+			start = start.AddDate(0, 0, (int(day)-int(start.Weekday())+7)%7)
+		case "WKST":
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", k)
+		}
+	}
+	every := t.Every(interval)
+	switch freq {
+	case "MINUTELY":
+		every = every.Minutes()
+	case "HOURLY":
+		every = every.Hours()
+	case "DAILY":
+		every = every.Days()
+	case "WEEKLY":
+		every = every.Weeks()
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", freq)
+	}
+	if strings.Contains(e.RRule, "BYDAY") && freq != "WEEKLY" {
+		return nil, errors.New("BYDAY is only supported for WEEKLY")
+	}
+	w := &t.When{Every: every}
+	// the runs are at the start plus the multiples of the interval
+	w.LastRun = start.Add(-w.Duration(start))
+	return w, nil
+}
+
+var icsDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// Schedules a job for each event of the iCalendar read from r. Jobs
+// are named after the summaries of the events, and are created from
+// the registered types; the description of each event should be a
+// job in the snapshot format without the name and opts:
+// 		{"type": "cmd", "params": {"Path": "close-books"}}
+// See ICSEvent.When for the supported recurrence rules. All of the
+// events are decoded before any job is scheduled.
+func (s *Scheduler) ImportICS(r io.Reader) error {
+	events, err := ParseICS(r, s.loc)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	opts := make([]*t.Opts, len(events))
+	jobs := make([]Job, len(events))
+	for i, e := range events {
+		var spec jobSpec
+		if err := json.Unmarshal([]byte(e.Description), &spec); err != nil {
+			return fmt.Errorf("event %q: %v", e.Summary, err)
+		}
+		when, err := e.When(now)
+		if err != nil {
+			return fmt.Errorf("event %q: %v", e.Summary, err)
+		}
+		if jobs[i], err = NewJob(spec.Type, spec.Params); err != nil {
+			return fmt.Errorf("event %q: %v", e.Summary, err)
+		}
+		opts[i] = &t.Opts{When: when}
+	}
+	for i, e := range events {
+		if err := s.ScheduleWithOpts(e.Summary, jobs[i], opts[i]); err != nil {
+			return fmt.Errorf("event %q: %v", e.Summary, err)
+		}
+	}
+	return nil
+}
+
+// Reads the lines of an iCalendar, joining the folded ones.
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, sc.Err()
+}
+
+// Splits a content line into its name, params and value.
+func splitICSLine(line string) (name string, params map[string]string, value string) {
+	head, value, _ := strings.Cut(line, ":")
+	parts := strings.Split(head, ";")
+	name = strings.ToUpper(parts[0])
+	params = make(map[string]string)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return
+}
+
+func parseICSTime(value, tzid string, loc *time.Location) (time.Time, error) {
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(icsTime, value)
+	}
+	if tzid != "" {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+	if len(value) == len("20060102") {
+		return time.ParseInLocation("20060102", value, loc)
+	}
+	return time.ParseInLocation("20060102T150405", value, loc)
+}
+
+var icsUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescapeICS(s string) string {
+	return icsUnescaper.Replace(s)
+}
@@ -0,0 +1,109 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Step is a step of a ChainJob. It's called with the output of the
+// previous step and returns its own output, which is passed to the
+// next step. The first step is called with the params of the run,
+// see ticktock.Params.
+type Step func(ctx context.Context, in interface{}) (out interface{}, err error)
+
+// TypedStep adapts a function with typed input and output to a Step,
+// so extract, transform and load steps can pass data to each other
+// without shared globals. The step fails if the output of the previous
+// step isn't an In; a nil output is passed as the zero In.
+func TypedStep[In, Out any](f func(ctx context.Context, in In) (Out, error)) Step {
+	return func(ctx context.Context, in interface{}) (interface{}, error) {
+		var v In
+		if in != nil {
+			var ok bool
+			if v, ok = in.(In); !ok {
+				return nil, fmt.Errorf("step expects %T, found %T", v, in)
+			}
+		}
+		return f(ctx, v)
+	}
+}
+
+// ChainJob runs its steps in order, piping the output of each step
+// to the next one. The run fails at the first failing step, or once
+// its context is done, with a *PartialError.
+// Example:
+// 		// extract returns []Row, transform takes and returns []Row,
+// 		// load takes []Row
+// 		jobs.Chain(jobs.TypedStep(extract), jobs.TypedStep(transform), jobs.TypedStep(load))
+type ChainJob struct {
+	Steps []Step
+}
+
+// Chains the steps into a job.
+func Chain(steps ...Step) *ChainJob {
+	return &ChainJob{Steps: steps}
+}
+
+// Runs the steps with a background context.
+func (c *ChainJob) Run() error {
+	return c.RunContext(context.Background())
+}
+
+// Runs the steps, stops at the first failure or once the
+// context is done. The steps are passed the context.
+func (c *ChainJob) RunContext(ctx context.Context) error {
+	v := ticktock.Params(ctx)
+	var completed []int
+	for i, step := range c.Steps {
+		if err := ctx.Err(); err != nil {
+			return &PartialError{Completed: completed, Total: len(c.Steps), Err: err}
+		}
+		out, err := step(ctx, v)
+		if err != nil {
+			return &PartialError{Completed: completed, Total: len(c.Steps), Err: fmt.Errorf("step %d: %w", i, err)}
+		}
+		completed = append(completed, i)
+		v = out
+	}
+	return nil
+}
+
+// PartialError is the error of a composite job, such as a ChainJob
+// or a ParallelJob, whose children didn't all complete. It wraps the
+// error that stopped the job, ctx.Err() if its run was cancelled.
+// Example:
+// 		var perr *jobs.PartialError
+// 		if errors.As(err, &perr) && errors.Is(err, context.Canceled) {
+// 			log.Printf("cancelled after %v of %v steps", len(perr.Completed), perr.Total)
+// 		}
+type PartialError struct {
+	// Completed are the indexes of the children that completed
+	// successfully, in order.
+	Completed []int
+	Total     int
+	Err       error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%v (%v of %v completed)", e.Err, len(e.Completed), e.Total)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
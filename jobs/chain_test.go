@@ -0,0 +1,104 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// Tests if the output of each step is piped to the next one,
+// starting with the params of the run.
+func TestChain(test *testing.T) {
+	loaded := make(chan int, 1)
+	job := Chain(
+		TypedStep(func(ctx context.Context, in string) ([]string, error) {
+			return strings.Split(in, ","), nil
+		}),
+		TypedStep(func(ctx context.Context, in []string) ([]int, error) {
+			out := make([]int, len(in))
+			for i, s := range in {
+				n, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, err
+				}
+				out[i] = n
+			}
+			return out, nil
+		}),
+		TypedStep(func(ctx context.Context, in []int) (struct{}, error) {
+			sum := 0
+			for _, n := range in {
+				sum += n
+			}
+			loaded <- sum
+			return struct{}{}, nil
+		}),
+	)
+	sh := &ticktock.Scheduler{}
+	sh.Schedule("etl", job, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	if err := sh.TriggerWithParams("etl", "1,2,3"); err != nil {
+		test.Fatal(err)
+	}
+	if sum := <-loaded; sum != 6 {
+		test.Errorf("expected the rows to be piped to the load step, found %v", sum)
+	}
+}
+
+func TestChain_Failure(test *testing.T) {
+	var ran bool
+	job := Chain(
+		TypedStep(func(ctx context.Context, in int) (string, error) { return "rows", nil }),
+		// expects an int, the previous step outputs a string
+		TypedStep(func(ctx context.Context, in int) (int, error) { return in, nil }),
+		func(ctx context.Context, in interface{}) (interface{}, error) {
+			ran = true
+			return nil, nil
+		},
+	)
+	err := job.Run()
+	var perr *PartialError
+	if !errors.As(err, &perr) || len(perr.Completed) != 1 || perr.Total != 3 {
+		test.Fatalf("expected the chain to stop at the second step, found %v", err)
+	}
+	if ran {
+		test.Error("expected no steps to run after the failure")
+	}
+}
+
+func TestChain_Cancelled(test *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := Chain(
+		func(ctx context.Context, in interface{}) (interface{}, error) {
+			cancel()
+			return nil, nil
+		},
+		func(ctx context.Context, in interface{}) (interface{}, error) {
+			test.Error("expected the chain to stop once its context is done")
+			return nil, nil
+		},
+	)
+	if err := job.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		test.Errorf("expected the chain to be cancelled, found %v", err)
+	}
+}
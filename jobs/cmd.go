@@ -15,21 +15,80 @@
 package jobs
 
 import (
+	"context"
+	"fmt"
 	"os/exec"
+	"strings"
+
+	"github.com/rakyll/ticktock"
 )
 
-// CmdJob spawns a process.
+// CmdJob spawns a process. Register registers it as the "cmd"
+// job type.
 // Example usage:
-// cmd := exec.Command("echo", "Hello world")
 // ticktock.Schedule(
 //     "echo",
-//     &jobs.CmdJob{Cmd: cmd},
+//     &jobs.CmdJob{Path: "echo", Args: []string{"Hello world"}},
 //     &t.When{Every: t.Every(1).Seconds()})
 type CmdJob struct {
-	Cmd *exec.Cmd
+	// Cmd is the command to run, used if Path is empty. An
+	// exec.Cmd can only be run once, prefer Path.
+	Cmd *exec.Cmd `json:"-"`
+
+	// Path of the program, looked up in PATH if it contains
+	// no path separators. A new process is spawned on each run.
+	Path string
+	Args []string
+	Dir  string
+	// Env of the process, the environment of the current
+	// process if nil. The values can refer to secrets, e.g.
+	// "DB_PASSWORD=secret://db-password", see
+	// ticktock.ResolveSecrets.
+	Env []string
 }
 
 // Runs the command.
 func (j *CmdJob) Run() error {
-	return j.Cmd.Run()
+	return j.RunContext(context.Background())
+}
+
+// Runs the command, with the secrets of the env resolved. Once ctx
+// is done, e.g. at the Timeout of the job, the process is killed
+// along with its children.
+func (j *CmdJob) RunContext(ctx context.Context) error {
+	if j.Path == "" {
+		return runCmd(ctx, j.Cmd)
+	}
+	cmd := exec.Command(j.Path, j.Args...)
+	cmd.Dir = j.Dir
+	if j.Env != nil {
+		cmd.Env = make([]string, 0, len(j.Env))
+	}
+	for _, kv := range j.Env {
+		k, v, _ := strings.Cut(kv, "=")
+		v, err := ticktock.ResolveSecrets(ctx, v)
+		if err != nil {
+			return err
+		}
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	return runCmd(ctx, cmd)
+}
+
+// Runs cmd, killing its process group once ctx is done.
+func runCmd(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { killProcessGroup(cmd) })
+	err := cmd.Wait()
+	if !stop() && err != nil {
+		// killed, report why
+		return fmt.Errorf("%v: %w", err, ctx.Err())
+	}
+	return err
 }
@@ -0,0 +1,83 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rakyll/ticktock"
+)
+
+// HTTPJob sends an HTTP request, and fails on non-2xx responses.
+// Register registers it as the "http" job type. The values of the
+// headers can refer to secrets, see ticktock.ResolveSecrets.
+// Example usage:
+// ticktock.Schedule(
+//     "warm-cache",
+//     &jobs.HTTPJob{
+//         Method:  "POST",
+//         URL:     "https://api.internal/cache/warm",
+//         Headers: map[string]string{"Authorization": "Bearer secret://api-token"}},
+//     &t.When{Every: t.Every(10).Minutes()})
+type HTTPJob struct {
+	// Method defaults to GET.
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    string
+	// Client sends the request, http.DefaultClient if nil.
+	Client *http.Client `json:"-"`
+}
+
+// Sends the request.
+func (j *HTTPJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Sends the request with the context of the run, with the secrets
+// of the headers resolved.
+func (j *HTTPJob) RunContext(ctx context.Context) error {
+	method := j.Method
+	if method == "" {
+		method = "GET"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, j.URL, strings.NewReader(j.Body))
+	if err != nil {
+		return err
+	}
+	for k, v := range j.Headers {
+		v, err := ticktock.ResolveSecrets(ctx, v)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(k, v)
+	}
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v %v failed with %v", method, j.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// LuaJob runs a Lua snippet in a sandboxed state. Only the base,
+// table, string and math libraries are available; the script can't
+// access the file system or spawn processes, and its memory can be
+// bounded with MaxMemory. In addition to these, the script may use the following:
+//     log(args...)                      -- logs with the standard logger
+//     http.get(url)                     -- returns {status=..., body=...}
+//     http.post(url, contentType, body) -- returns {status=..., body=...}
+// Raising an error fails the run. Register registers it as the "lua"
+// job type.
+// Example usage:
+// ticktock.Schedule(
+//     "ping",
+//     &jobs.LuaJob{Script: `
+//         local res = http.get("http://localhost:8080/health")
+//         if res.status ~= 200 then error("unhealthy") end`,
+//         Timeout: 10 * time.Second},
+//     &t.When{Every: t.Every(1).Minutes()})
+type LuaJob struct {
+	Script string
+	// Path of a script file, read on each run, used if Script is empty.
+	Path string
+
+	// Client is used for the HTTP calls, http.DefaultClient if nil.
+	Client *http.Client `json:"-"`
+	// Timeout stops the script if it runs longer. No limit if zero.
+	Timeout time.Duration
+	// MaxRegistrySize limits the number of values the registry,
+	// the data stack of the script, can grow up to. If zero, the
+	// registry is fixed to lua.RegistrySize. The tables and strings
+	// of the script are limited by MaxMemory instead.
+	MaxRegistrySize int
+	// MaxMemory stops the script once it allocates more bytes. The
+	// allocations are sampled from the heap of the process every few
+	// milliseconds, so they include the allocations of the other
+	// goroutines in the meantime. No limit if zero.
+	MaxMemory uint64
+	// MaxCallDepth limits the depth of nested function calls.
+	// Defaults to lua.CallStackSize if zero.
+	MaxCallDepth int
+}
+
+var luaLibs = []struct {
+	name string
+	fn   lua.LGFunction
+}{
+	{lua.BaseLibName, lua.OpenBase},
+	{lua.TabLibName, lua.OpenTable},
+	{lua.StringLibName, lua.OpenString},
+	{lua.MathLibName, lua.OpenMath},
+}
+
+// Runs the script.
+func (j *LuaJob) Run() error {
+	src, err := readScript(j.Script, j.Path)
+	if err != nil {
+		return err
+	}
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   j.MaxCallDepth,
+		RegistryMaxSize: j.MaxRegistrySize,
+	})
+	defer L.Close()
+	for _, lib := range luaLibs {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// base library can load code from the file system
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("log", L.NewFunction(luaLog))
+	h := L.NewTable()
+	L.SetField(h, "get", L.NewFunction(func(L *lua.LState) int {
+		status, body, err := fetch(luaContext(L), j.Client, "GET", L.CheckString(1), "", nil)
+		return luaResponse(L, status, body, err)
+	}))
+	L.SetField(h, "post", L.NewFunction(func(L *lua.LState) int {
+		status, body, err := fetch(luaContext(L), j.Client, "POST", L.CheckString(1), L.CheckString(2), strings.NewReader(L.CheckString(3)))
+		return luaResponse(L, status, body, err)
+	}))
+	L.SetGlobal("http", h)
+	if j.Timeout > 0 || j.MaxMemory > 0 {
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		if j.Timeout > 0 {
+			var stop context.CancelFunc
+			ctx, stop = context.WithTimeout(ctx, j.Timeout)
+			defer stop()
+		}
+		if j.MaxMemory > 0 {
+			go limitAllocs(ctx, j.MaxMemory, cancel)
+		}
+		L.SetContext(ctx)
+		if err := L.DoString(src); err != nil {
+			if context.Cause(ctx) == errLuaMemory {
+				return fmt.Errorf("the script allocated more than %v bytes", j.MaxMemory)
+			}
+			return err
+		}
+		return nil
+	}
+	return L.DoString(src)
+}
+
+var errLuaMemory = errors.New("over the memory limit")
+
+// Cancels ctx once the heap allocations of the process since the
+// call exceed max.
+func limitAllocs(ctx context.Context, max uint64, cancel context.CancelCauseFunc) {
+	allocs := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(allocs)
+	start := allocs[0].Value.Uint64()
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			metrics.Read(allocs)
+			if allocs[0].Value.Uint64()-start > max {
+				cancel(errLuaMemory)
+				return
+			}
+		}
+	}
+}
+
+// Returns the context of the state, which stops the HTTP calls of
+// the script once it times out.
+func luaContext(L *lua.LState) context.Context {
+	if ctx := L.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+func luaLog(L *lua.LState) int {
+	args := make([]interface{}, L.GetTop())
+	for i := range args {
+		args[i] = L.ToStringMeta(L.Get(i + 1))
+	}
+	log.Println(args...)
+	return 0
+}
+
+func luaResponse(L *lua.LState, status int, body string, err error) int {
+	if err != nil {
+		L.RaiseError("%v", err)
+		return 0
+	}
+	res := L.NewTable()
+	L.SetField(res, "status", lua.LNumber(status))
+	L.SetField(res, "body", lua.LString(body))
+	L.Push(res)
+	return 1
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Tests if the script can't reach the file system or the process.
+func TestLuaJob_Sandbox(test *testing.T) {
+	job := &LuaJob{Script: `
+		for _, name in ipairs({"os", "io", "require", "module", "dofile", "loadfile"}) do
+			if _G[name] ~= nil then error(name .. " is available") end
+		end`}
+	if err := job.Run(); err != nil {
+		test.Error(err)
+	}
+	job = &LuaJob{Script: `os.exit(1)`}
+	if err := job.Run(); err == nil {
+		test.Error("expected the script to fail calling os.exit")
+	}
+}
+
+func TestLuaJob_Timeout(test *testing.T) {
+	job := &LuaJob{Script: `while true do end`, Timeout: 50 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- job.Run() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			test.Error("expected the script to fail once it times out")
+		}
+	case <-time.After(5 * time.Second):
+		test.Fatal("expected the script to be stopped after the timeout")
+	}
+}
+
+func TestLuaJob_MaxRegistrySize(test *testing.T) {
+	script := `
+		local t = {}
+		for i = 1, %d do t[i] = i end
+		local n = select("#", unpack(t))`
+	job := &LuaJob{Script: fmt.Sprintf(script, 10000), MaxRegistrySize: 1 << 14}
+	if err := job.Run(); err != nil {
+		test.Errorf("expected the registry to grow, found %v", err)
+	}
+	job = &LuaJob{Script: fmt.Sprintf(script, 20000), MaxRegistrySize: 1 << 14}
+	if err := job.Run(); err == nil {
+		test.Error("expected the script to fail once the registry is full")
+	}
+}
+
+func TestLuaJob_MaxMemory(test *testing.T) {
+	job := &LuaJob{Script: `
+		local t = {}
+		for i = 1, 1e9 do t[i] = string.rep("x", 1024) .. i end`, MaxMemory: 32 << 20}
+	done := make(chan error, 1)
+	go func() { done <- job.Run() }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "allocated more than") {
+			test.Errorf("expected the script to be stopped over the memory limit, found %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		test.Fatal("expected the script to be stopped over the memory limit")
+	}
+	job = &LuaJob{Script: `local s = string.rep("x", 1024)`, MaxMemory: 32 << 20}
+	if err := job.Run(); err != nil {
+		test.Errorf("expected the script within the limit to succeed, found %v", err)
+	}
+}
+
+func TestLuaJob_HTTP(test *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.WriteHeader(http.StatusCreated)
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+	job := &LuaJob{Script: strings.ReplaceAll(`
+		local res = http.get("URL")
+		if res.status ~= 200 or res.body ~= "ok" then error("unexpected get") end
+		res = http.post("URL", "text/plain", "hi")
+		if res.status ~= 201 then error("unexpected post") end`, "URL", srv.URL)}
+	if err := job.Run(); err != nil {
+		test.Error(err)
+	}
+}
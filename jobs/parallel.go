@@ -0,0 +1,82 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rakyll/ticktock"
+)
+
+// ParallelJob runs its jobs at the same time, with the context of
+// its run; cancelling the run cancels all of them. The run fails
+// with a *PartialError if any of the jobs fails or the run is
+// cancelled, wrapping their errors and ctx.Err().
+// Example:
+// 		jobs.Parallel(backupUsers, backupOrders, backupInvoices)
+type ParallelJob struct {
+	Jobs []ticktock.Job
+	// FailFast cancels the other jobs once one of them fails.
+	FailFast bool
+}
+
+// Runs the jobs in parallel.
+func Parallel(jobs ...ticktock.Job) *ParallelJob {
+	return &ParallelJob{Jobs: jobs}
+}
+
+// Runs the jobs with a background context.
+func (p *ParallelJob) Run() error {
+	return p.RunContext(context.Background())
+}
+
+// Runs the jobs, and waits for all of them to return.
+func (p *ParallelJob) RunContext(parent context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	errs := make([]error, len(p.Jobs))
+	var wg sync.WaitGroup
+	for i, job := range p.Jobs {
+		wg.Add(1)
+		go func(i int, job ticktock.Job) {
+			defer wg.Done()
+			if errs[i] = ticktock.RunJob(ctx, job); errs[i] != nil && p.FailFast {
+				cancel()
+			}
+		}(i, job)
+	}
+	wg.Wait()
+	var completed []int
+	var failed []error
+	if err := parent.Err(); err != nil {
+		// the jobs that don't take a context may have
+		// completed regardless
+		failed = append(failed, err)
+	}
+	for i, err := range errs {
+		if err == nil {
+			completed = append(completed, i)
+		} else {
+			failed = append(failed, fmt.Errorf("job %d: %w", i, err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &PartialError{Completed: completed, Total: len(p.Jobs), Err: errors.Join(failed...)}
+}
@@ -0,0 +1,75 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"plugin"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// PluginSpec describes a job shipped as a Go plugin. The plugin
+// should export a New func returning the job:
+//     func New() ticktock.Job
+type PluginSpec struct {
+	Name string  `json:"name"`
+	Path string  `json:"path"`
+	When *t.When `json:"when"`
+}
+
+// Opens the plugin at path and creates a job with its New func.
+func OpenPlugin(path string) (ticktock.Job, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("New")
+	if err != nil {
+		return nil, err
+	}
+	newFn, ok := sym.(func() ticktock.Job)
+	if !ok {
+		return nil, fmt.Errorf("plugin %v: New is %T, not func() ticktock.Job", path, sym)
+	}
+	return newFn(), nil
+}
+
+// Reads a JSON list of plugin specs from r, opens each plugin and
+// schedules its job on s with the spec's name.
+// Example config:
+// [
+//     {"name": "cleanup", "path": "/opt/jobs/cleanup.so", "when": {"Each": "1h"}},
+//     {"name": "report", "path": "/opt/jobs/report.so", "when": {"On": 2, "At": "09:00"}}
+// ]
+func LoadPlugins(s *ticktock.Scheduler, r io.Reader) error {
+	var specs []PluginSpec
+	if err := json.NewDecoder(r).Decode(&specs); err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		job, err := OpenPlugin(spec.Path)
+		if err != nil {
+			return err
+		}
+		if err := s.Schedule(spec.Name, job, spec.When); err != nil {
+			return fmt.Errorf("plugin %v: %v", spec.Name, err)
+		}
+	}
+	return nil
+}
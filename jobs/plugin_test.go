@@ -0,0 +1,95 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Builds the plugin in testdata, or skips the test if plugins
+// aren't supported.
+func buildPlugin(test *testing.T) string {
+	if testing.Short() {
+		test.Skip("building a plugin is slow")
+	}
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd":
+	default:
+		test.Skipf("plugins aren't supported on %v", runtime.GOOS)
+	}
+	path := filepath.Join(test.TempDir(), "job.so")
+	args := []string{"build", "-buildmode=plugin", "-o", path}
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), append(args, "./testdata/plugin")...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		test.Skipf("building the plugin failed: %v\n%s", err, out)
+	}
+	return path
+}
+
+func TestLoadPlugins(test *testing.T) {
+	path := buildPlugin(test)
+	out := filepath.Join(test.TempDir(), "out")
+	test.Setenv("TICKTOCK_PLUGIN_OUT", out)
+
+	sh := &ticktock.Scheduler{}
+	config := fmt.Sprintf(`[{"name": "touch", "path": %q, "when": {"Each": "1h"}}]`, path)
+	if err := LoadPlugins(sh, strings.NewReader(config)); err != nil {
+		if strings.Contains(err.Error(), "different version") {
+			// e.g. the test is built with -race or -cover
+			test.Skip(err)
+		}
+		test.Fatal(err)
+	}
+	go sh.Start()
+	defer sh.Stop()
+	if err := sh.Trigger("touch"); err != nil {
+		test.Fatal(err)
+	}
+	for i := 0; ; i++ {
+		b, err := os.ReadFile(out)
+		if err == nil && string(b) == "ran" {
+			break
+		}
+		if i == 100 {
+			test.Fatalf("expected the plugin's job to run, found %q, %v", b, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLoadPlugins_Errors(test *testing.T) {
+	notPlugin := filepath.Join(test.TempDir(), "job.so")
+	if err := os.WriteFile(notPlugin, []byte("not a plugin"), 0644); err != nil {
+		test.Fatal(err)
+	}
+	for _, config := range []string{
+		`{`,
+		`[{"name": "missing", "path": "/no/such/job.so", "when": {"Each": "1h"}}]`,
+		fmt.Sprintf(`[{"name": "bad", "path": %q, "when": {"Each": "1h"}}]`, notPlugin),
+	} {
+		if err := LoadPlugins(&ticktock.Scheduler{}, strings.NewReader(config)); err == nil {
+			test.Errorf("expected an error loading %v", config)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// SchedulerJob runs the jobs of a child scheduler on each of its
+// runs, for hierarchical schedules such as a burst of sub-tasks every
+// night. Each run starts a clone of Scheduler, see Scheduler.Clone,
+// so the jobs that run once run again on the next run; Scheduler
+// itself is a template and isn't started. A run completes once the
+// jobs of the clone have no runs left, or is stopped once Duration
+// passes. Cancelling the run cancels the jobs of the clone and the
+// contexts of their runs, the run fails with ctx.Err() once they
+// return.
+// Example:
+// 		child := ticktock.New()
+// 		child.Schedule("warm-cache", warm, &t.When{Each: "1s"})
+// 		child.Schedule("rebuild-index", rebuild, &t.When{Each: "1m"})
+// 		parent.Schedule("nightly", &jobs.SchedulerJob{Scheduler: child}, &t.When{Cron: "@daily"})
+type SchedulerJob struct {
+	Scheduler *ticktock.Scheduler
+	// Duration stops the clone of a run, e.g. for the child
+	// schedules that repeat. No limit if zero.
+	Duration time.Duration
+	// Started is called with the clone of each run as it's
+	// started, e.g. to watch its jobs. Optional.
+	Started func(child *ticktock.Scheduler)
+}
+
+// Runs the child scheduler with a background context.
+func (j *SchedulerJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Starts a clone of the child scheduler, and waits for its jobs.
+func (j *SchedulerJob) RunContext(ctx context.Context) error {
+	child, err := j.Scheduler.Clone()
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	go func() {
+		child.Start()
+		close(done)
+	}()
+	if j.Started != nil {
+		j.Started(child)
+	}
+	var elapsed <-chan time.Time
+	if j.Duration > 0 {
+		timer := time.NewTimer(j.Duration)
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+	select {
+	case <-done:
+		return nil
+	case <-elapsed:
+		child.Stop()
+		<-done
+		return nil
+	case <-ctx.Done():
+		child.CancelAll()
+		child.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+type funcJob func(ctx context.Context) error
+
+func (f funcJob) Run() error {
+	return f(context.Background())
+}
+
+func (f funcJob) RunContext(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Tests if each run runs the jobs of a clone of the child scheduler
+// until they have no runs left.
+func TestSchedulerJob(test *testing.T) {
+	var runs int32
+	child := ticktock.New()
+	child.Schedule("once", funcJob(func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}), &t.When{Each: "5ms"})
+	var clones []*ticktock.Scheduler
+	job := &SchedulerJob{Scheduler: child, Started: func(c *ticktock.Scheduler) { clones = append(clones, c) }}
+	for i := 1; i <= 2; i++ {
+		if err := job.Run(); err != nil {
+			test.Fatal(err)
+		}
+		if n := atomic.LoadInt32(&runs); n != int32(i) {
+			test.Errorf("expected the one-off job to run on each run, ran %v times after %v runs", n, i)
+		}
+	}
+	if len(clones) != 2 || clones[0] == child || clones[0] == clones[1] {
+		test.Error("expected each run to start a clone of the child scheduler")
+	}
+	if st, _ := child.Status("once"); !st.LastRun.IsZero() {
+		test.Error("expected the child scheduler not to run its jobs")
+	}
+}
+
+func TestSchedulerJob_Duration(test *testing.T) {
+	var runs int32
+	child := ticktock.New()
+	child.Schedule("tick", funcJob(func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}), &t.When{Every: t.Every(5).Milliseconds()})
+	job := &SchedulerJob{Scheduler: child, Duration: 60 * time.Millisecond}
+	start := time.Now()
+	if err := job.Run(); err != nil {
+		test.Fatal(err)
+	}
+	if took := time.Since(start); took < 60*time.Millisecond || took > time.Second {
+		test.Errorf("expected the run to stop after its duration, took %v", took)
+	}
+	if n := atomic.LoadInt32(&runs); n < 3 {
+		test.Errorf("expected the repeating job to run while the run lasts, ran %v times", n)
+	}
+}
+
+func TestSchedulerJob_Cancel(test *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	child := ticktock.New()
+	child.Schedule("block", funcJob(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}), &t.When{Each: "1ms"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&SchedulerJob{Scheduler: child}).RunContext(ctx) }()
+	<-started
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			test.Errorf("expected the run to be cancelled, found %v", err)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the run to return once cancelled")
+	}
+	select {
+	case <-cancelled:
+	default:
+		test.Error("expected the context of the child's run to be cancelled")
+	}
+}
+
+func TestSchedulerJob_CloneError(test *testing.T) {
+	var over int32
+	child := ticktock.New()
+	child.Schedule("bounded", funcJob(func(ctx context.Context) error { return nil }),
+		t.Intersect(&t.When{Each: "1h"}, t.SetFunc(func(time.Time) bool { return atomic.LoadInt32(&over) == 0 })))
+	atomic.StoreInt32(&over, 1)
+	if err := (&SchedulerJob{Scheduler: child}).Run(); err == nil {
+		test.Error("expected the run to fail if the child can't be cloned")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/rakyll/ticktock"
+)
+
+// ScriptJob runs a JavaScript snippet. The script is evaluated
+// in a fresh runtime on each run, and may use the following:
+//     params                            // the params of the run, a payload as a string
+//     log(args...)                      // logs with the standard logger
+//     http.get(url)                     // returns {status, body}
+//     http.post(url, contentType, body) // returns {status, body}
+// A thrown exception fails the run. The script is interrupted once
+// the run is cancelled. Register registers it as the
+// "script" job type.
+// Example usage:
+// ticktock.Schedule(
+//     "ping",
+//     &jobs.ScriptJob{Script: `
+//         var res = http.get("http://localhost:8080/health");
+//         if (res.status != 200) throw new Error("unhealthy");`},
+//     &t.When{Every: t.Every(1).Minutes()})
+type ScriptJob struct {
+	Script string
+	// Path of a script file, read on each run, used if Script is empty.
+	// Allows the script to be modified without restarting the process.
+	Path string
+
+	// Client is used for the HTTP calls, http.DefaultClient if nil.
+	Client *http.Client `json:"-"`
+	// Timeout interrupts the script if it runs longer. No limit if zero.
+	Timeout time.Duration
+}
+
+// Runs the script.
+func (j *ScriptJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Runs the script with the params of the run of ctx, until it
+// returns or ctx is done.
+func (j *ScriptJob) RunContext(ctx context.Context) error {
+	src, err := readScript(j.Script, j.Path)
+	if err != nil {
+		return err
+	}
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+	vm := goja.New()
+	params := ticktock.Params(ctx)
+	if payload, ok := params.([]byte); ok {
+		params = string(payload)
+	}
+	vm.Set("params", params)
+	vm.Set("log", func(args ...interface{}) {
+		log.Println(args...)
+	})
+	vm.Set("http", map[string]interface{}{
+		"get": func(url string) (map[string]interface{}, error) {
+			return jsResponse(fetch(ctx, j.Client, "GET", url, "", nil))
+		},
+		"post": func(url, contentType, body string) (map[string]interface{}, error) {
+			return jsResponse(fetch(ctx, j.Client, "POST", url, contentType, strings.NewReader(body)))
+		},
+	})
+	stop := context.AfterFunc(ctx, func() {
+		vm.Interrupt(ctx.Err())
+	})
+	defer stop()
+	_, err = vm.RunString(src)
+	return err
+}
+
+func readScript(script, path string) (string, error) {
+	if script != "" {
+		return script, nil
+	}
+	if path == "" {
+		return "", errors.New("neither a script nor a path is provided")
+	}
+	b, err := os.ReadFile(path)
+	return string(b), err
+}
+
+func jsResponse(status int, body string, err error) (map[string]interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"status": status, "body": body}, nil
+}
+
+// Makes an HTTP request on behalf of a script, returns the
+// status code and the body of the response.
+func fetch(ctx context.Context, client *http.Client, method, url, contentType string, body io.Reader) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, "", err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, "", err
+	}
+	return resp.StatusCode, string(b), nil
+}
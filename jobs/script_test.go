@@ -0,0 +1,97 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// Tests if the script is run with the params of the run.
+func TestScriptJob_Params(test *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Query().Get("q"))
+	}))
+	defer srv.Close()
+	// the run fails unless it echoes the params through the server
+	job := &ScriptJob{Script: `
+		var res = http.get("` + srv.URL + `?q=" + params.table);
+		if (res.status != 200 || res.body != "users") throw new Error("unexpected response " + res.body);`}
+	sh := &ticktock.Scheduler{}
+	sh.Schedule("script", job, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	sh.TriggerWithParams("script", map[string]string{"table": "users"})
+	var runs []ticktock.RunResult
+	for i := 0; i < 100 && len(runs) == 0; i++ {
+		// the run is recorded after the job returns
+		time.Sleep(10 * time.Millisecond)
+		runs, _ = sh.History("script")
+	}
+	if len(runs) != 1 || runs[0].Err != nil {
+		test.Errorf("expected the script to succeed with the params, found %+v", runs)
+	}
+
+	job = &ScriptJob{Script: `if (params !== null) throw new Error("unexpected params " + params);`}
+	if err := job.Run(); err != nil {
+		test.Errorf("expected no params outside of a run, found %v", err)
+	}
+}
+
+func TestScriptJob_Timeout(test *testing.T) {
+	job := &ScriptJob{Script: `while (true) {}`, Timeout: 50 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- job.Run() }()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+			test.Errorf("expected the script to be interrupted once it times out, found %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		test.Fatal("expected the script to be stopped after the timeout")
+	}
+}
+
+// Tests if cancelling the run interrupts the script and its HTTP calls.
+func TestScriptJob_Interrupt(test *testing.T) {
+	for _, script := range []string{`while (true) {}`, `http.get("URL")`} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}))
+		job := &ScriptJob{Script: strings.ReplaceAll(script, "URL", srv.URL)}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- job.RunContext(ctx) }()
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-done:
+			if err == nil {
+				test.Errorf("expected %q to fail once the run is cancelled", script)
+			}
+		case <-time.After(5 * time.Second):
+			test.Fatalf("expected %q to be interrupted once the run is cancelled", script)
+		}
+		srv.Close()
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rakyll/ticktock"
+)
+
+// SQLJob executes a statement on a database, e.g. to refresh
+// a materialized view or to delete the expired rows. Register
+// registers it as the "sql" job type. The driver should be
+// imported by the program.
+// Example usage:
+// ticktock.Schedule(
+//     "expire-sessions",
+//     &jobs.SQLJob{
+//         Driver: "postgres",
+//         DSN:    "secret://reporting-dsn",
+//         Query:  "DELETE FROM sessions WHERE expires_at < now()"},
+//     &t.When{Every: t.Every(1).Hours()})
+type SQLJob struct {
+	Driver string
+	// DSN can refer to secrets, see ticktock.ResolveSecrets.
+	// The database is opened for each run, so the credentials
+	// are resolved again on each run.
+	DSN   string
+	Query string
+	Args  []interface{}
+}
+
+// Executes the statement.
+func (j *SQLJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Executes the statement with the context of the run, with the
+// secrets of the DSN resolved.
+func (j *SQLJob) RunContext(ctx context.Context) error {
+	dsn, err := ticktock.ResolveSecrets(ctx, j.DSN)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open(j.Driver, dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.ExecContext(ctx, j.Query, j.Args...)
+	return err
+}
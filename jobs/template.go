@@ -0,0 +1,195 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Sink receives the output of a TemplateJob.
+type Sink interface {
+	Write(output []byte) error
+}
+
+// SinkFunc adapts an ordinary function to a Sink. It can be used
+// to hand the output to another job.
+type SinkFunc func(output []byte) error
+
+// Calls f with output.
+func (f SinkFunc) Write(output []byte) error {
+	return f(output)
+}
+
+// FileSink writes the output to a file.
+type FileSink struct {
+	Path string
+	// Append appends to the file rather than truncating it.
+	Append bool
+}
+
+// Writes output to the file.
+func (s *FileSink) Write(output []byte) error {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if s.Append {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(s.Path, flag, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(output); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// HTTPSink posts the output to a URL.
+type HTTPSink struct {
+	URL         string
+	ContentType string
+	// Client is used to post, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Posts output to the URL, fails on non-2xx responses.
+func (s *HTTPSink) Write(output []byte) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(s.URL, s.ContentType, bytes.NewReader(output))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("posting to %v failed with %v", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// TemplateData is the data a TemplateJob executes its template with.
+type TemplateData struct {
+	JobName string
+	// ScheduledTime is the time the run was scheduled or
+	// triggered at, the current time if the job isn't run
+	// by a scheduler.
+	ScheduledTime time.Time
+	// RunID is the ID of the run, empty if the job isn't
+	// run by a scheduler.
+	RunID string
+	// Previous contains the results of the previous runs,
+	// the most recent first.
+	Previous []TemplateResult
+	// Data is the TemplateJob's Data.
+	Data interface{}
+}
+
+// TemplateResult is the result of a TemplateJob run.
+type TemplateResult struct {
+	RunID  string
+	Time   time.Time
+	Output string
+	Err    error
+}
+
+// TemplateJob renders a text/template and writes the output to
+// a sink.
+// Example usage:
+// ticktock.Schedule(
+//     "daily-digest",
+//     &jobs.TemplateJob{
+//         Name:     "daily-digest",
+//         Template: "Digest for {{.ScheduledTime.Format \"Jan 2\"}}: {{.Data.Count}} new signups",
+//         Data:     stats,
+//         Sink:     &jobs.HTTPSink{URL: webhookURL, ContentType: "text/plain"}},
+//     &t.When{Every: t.Every(1).Days(), At: "08:00"})
+type TemplateJob struct {
+	// Name is available to the template as .JobName.
+	Name     string
+	Template string
+	Data     interface{}
+	Sink     Sink
+	// History is the number of previous results kept
+	// for the template. Defaults to 1.
+	History int
+
+	mu       sync.Mutex
+	tmpl     *template.Template
+	previous []TemplateResult
+}
+
+// Renders the template and writes the output to the sink.
+func (j *TemplateJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Renders the template with the run of ctx and writes the output
+// to the sink.
+func (j *TemplateJob) RunContext(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.tmpl == nil {
+		tmpl, err := template.New(j.Name).Parse(j.Template)
+		if err != nil {
+			return err
+		}
+		j.tmpl = tmpl
+	}
+	scheduled := ticktock.ScheduledTime(ctx)
+	if scheduled.IsZero() {
+		scheduled = time.Now()
+	}
+	data := &TemplateData{
+		JobName:       j.Name,
+		ScheduledTime: scheduled,
+		RunID:         ticktock.RunID(ctx),
+		Previous:      j.previous,
+		Data:          j.Data,
+	}
+	var buf bytes.Buffer
+	err := j.tmpl.Execute(&buf, data)
+	if err == nil {
+		err = j.Sink.Write(buf.Bytes())
+	}
+	j.remember(TemplateResult{
+		RunID:  data.RunID,
+		Time:   data.ScheduledTime,
+		Output: buf.String(),
+		Err:    err,
+	})
+	return err
+}
+
+func (j *TemplateJob) remember(r TemplateResult) {
+	n := j.History
+	if n < 1 {
+		n = 1
+	}
+	j.previous = append([]TemplateResult{r}, j.previous...)
+	if len(j.previous) > n {
+		j.previous = j.previous[:n]
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// Tests if the template is executed with the run of the scheduler.
+func TestTemplateJob(test *testing.T) {
+	outputs := make(chan string, 1)
+	job := &TemplateJob{
+		Name:     "digest",
+		Template: "{{.RunID}} {{.ScheduledTime.UnixNano}}",
+		Sink:     SinkFunc(func(output []byte) error { outputs <- string(output); return nil }),
+	}
+	sh := &ticktock.Scheduler{}
+	sh.Schedule("digest", job, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("digest")
+	output := <-outputs
+
+	var runs []ticktock.RunResult
+	for i := 0; i < 100 && len(runs) == 0; i++ {
+		// the run is recorded after the job returns
+		time.Sleep(time.Millisecond)
+		runs, _ = sh.History("digest")
+	}
+	if len(runs) != 1 {
+		test.Fatalf("expected a run in the history, found %v", len(runs))
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 2 || fields[0] != runs[0].RunID {
+		test.Errorf("expected the ID of the run %v, found %q", runs[0].RunID, output)
+	}
+	if want := fmt.Sprint(runs[0].Time.UnixNano()); fields[1] != want {
+		test.Errorf("expected the run scheduled at %v, found %q", want, fields[1])
+	}
+	if len(job.previous) != 1 || job.previous[0].RunID != runs[0].RunID {
+		test.Errorf("expected the result to be kept for the next run, found %+v", job.previous)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command plugin is a job plugin for the tests of LoadPlugins.
+package main
+
+import (
+	"os"
+
+	"github.com/rakyll/ticktock"
+)
+
+type touchJob struct{}
+
+// Creates the file named by TICKTOCK_PLUGIN_OUT.
+func (touchJob) Run() error {
+	return os.WriteFile(os.Getenv("TICKTOCK_PLUGIN_OUT"), []byte("ran"), 0644)
+}
+
+func New() ticktock.Job {
+	return touchJob{}
+}
+
+func main() {}
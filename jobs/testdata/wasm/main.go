@@ -0,0 +1,44 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command wasm is a WASI module for the tests of WasmJob. It prints
+// its args, and runs the command in the args after the time of the
+// run: "fail" exits with 3, "loop" never returns and "read" reads
+// a file of the host.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	fmt.Println(strings.Join(os.Args[1:], " "))
+	if len(os.Args) < 3 {
+		return
+	}
+	switch os.Args[2] {
+	case "fail":
+		os.Exit(3)
+	case "loop":
+		for {
+		}
+	case "read":
+		if _, err := os.ReadFile("/etc/hostname"); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"fmt"
+
+	"github.com/rakyll/ticktock"
+)
+
+// The job types of the package, by their type names.
+var types = map[string]func() ticktock.Job{
+	"cmd":    func() ticktock.Job { return &CmdJob{} },
+	"http":   func() ticktock.Job { return &HTTPJob{} },
+	"sql":    func() ticktock.Job { return &SQLJob{} },
+	"script": func() ticktock.Job { return &ScriptJob{} },
+	"lua":    func() ticktock.Job { return &LuaJob{} },
+	"wasm":   func() ticktock.Job { return &WasmJob{} },
+}
+
+// Registers the job types of the package called names, or all of
+// them if no names are given, with ticktock.RegisterJobType. Types
+// such as "cmd" run arbitrary code from their parameters, so only
+// the types the configs need should be registered. No types are
+// registered by importing the package. Panics if a name isn't
+// a job type of the package, or is already registered.
+// Example:
+// 		jobs.Register("http", "sql")
+func Register(names ...string) {
+	if len(names) == 0 {
+		names = []string{"cmd", "http", "sql", "script", "lua", "wasm"}
+	}
+	for _, name := range names {
+		factory, ok := types[name]
+		if !ok {
+			panic(fmt.Sprintf("jobs: no job type is called %q", name))
+		}
+		ticktock.RegisterJobType(name, factory)
+	}
+}
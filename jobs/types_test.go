@@ -0,0 +1,43 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"testing"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Tests if only the job types asked for are registered.
+func TestRegister(test *testing.T) {
+	if _, err := ticktock.NewJob("sql", nil); err == nil {
+		test.Fatal("expected no job types to be registered on import")
+	}
+	Register("sql")
+	if job, err := ticktock.NewJob("sql", []byte(`{"Driver": "postgres"}`)); err != nil || job.(*SQLJob).Driver != "postgres" {
+		test.Errorf("expected the registered type, found %v, %v", job, err)
+	}
+	if _, err := ticktock.NewJob("cmd", nil); err == nil {
+		test.Error("expected the types not asked for to be left out")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				test.Error("expected an unknown type to panic")
+			}
+		}()
+		Register("unknown")
+	}()
+}
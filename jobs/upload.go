@@ -0,0 +1,115 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Uploader writes an object to a bucket on an object storage
+// such as S3 or GCS. Wrap the storage client of your choice
+// to satisfy it. The upload should be aborted once ctx is done.
+type Uploader interface {
+	Upload(ctx context.Context, bucket, key string, r io.Reader) error
+}
+
+// UploaderFunc adapts an ordinary function to an Uploader.
+type UploaderFunc func(ctx context.Context, bucket, key string, r io.Reader) error
+
+// Uploads r to bucket with key.
+func (f UploaderFunc) Upload(ctx context.Context, bucket, key string, r io.Reader) error {
+	return f(ctx, bucket, key, r)
+}
+
+// UploadJob uploads a local file or the contents of a reader
+// to object storage.
+// Key is a text/template executed with the time the run was
+// scheduled at as .Time.
+// Example usage:
+// ticktock.Schedule(
+//     "backup-upload",
+//     &jobs.UploadJob{
+//         Uploader: s3Uploader,
+//         Bucket:   "backups",
+//         Key:      `db/{{.Time.Format "2006-01-02"}}.sql.gz`,
+//         Path:     "/var/backups/db.sql.gz"},
+//     &t.When{Every: t.Every(1).Days(), At: "03:00"})
+type UploadJob struct {
+	Uploader Uploader
+	Bucket   string
+	Key      string
+
+	// Path of the local file to be uploaded.
+	Path string
+	// Open returns the reader to be uploaded, used if Path is empty.
+	// If the reader is also an io.Closer, it is closed after the upload.
+	Open func() (io.Reader, error)
+}
+
+// Uploads the source to the bucket.
+func (j *UploadJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Uploads the source to the bucket, with the key of the time the
+// run of ctx was scheduled at.
+func (j *UploadJob) RunContext(ctx context.Context) error {
+	at := ticktock.ScheduledTime(ctx)
+	if at.IsZero() {
+		at = time.Now()
+	}
+	key, err := j.key(at)
+	if err != nil {
+		return err
+	}
+	r, err := j.open()
+	if err != nil {
+		return err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+	return j.Uploader.Upload(ctx, j.Bucket, key, r)
+}
+
+func (j *UploadJob) key(at time.Time) (string, error) {
+	tmpl, err := template.New("key").Parse(j.Key)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ Time time.Time }{at}); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (j *UploadJob) open() (io.Reader, error) {
+	if j.Path != "" {
+		return os.Open(j.Path)
+	}
+	if j.Open != nil {
+		return j.Open()
+	}
+	return nil, errors.New("neither a path nor an open func is provided")
+}
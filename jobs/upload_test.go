@@ -0,0 +1,145 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// fakeUploader records the uploaded objects.
+type fakeUploader struct {
+	objects map[string]string
+	err     error
+}
+
+func (u *fakeUploader) Upload(ctx context.Context, bucket, key string, r io.Reader) error {
+	if u.err != nil {
+		return u.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	u.objects[bucket+"/"+key] = string(b)
+	return nil
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestUploadJob_Path(test *testing.T) {
+	path := filepath.Join(test.TempDir(), "db.sql")
+	if err := os.WriteFile(path, []byte("dump"), 0644); err != nil {
+		test.Fatal(err)
+	}
+	u := &fakeUploader{objects: map[string]string{}}
+	job := &UploadJob{Uploader: u, Bucket: "backups", Key: `db/{{.Time.Format "2006"}}.sql`, Path: path}
+	if err := job.Run(); err != nil {
+		test.Fatal(err)
+	}
+	key := "backups/db/" + time.Now().Format("2006") + ".sql"
+	if got := u.objects[key]; got != "dump" {
+		test.Errorf("expected the file to be uploaded to %v, found %v", key, u.objects)
+	}
+}
+
+func TestUploadJob_Open(test *testing.T) {
+	u := &fakeUploader{objects: map[string]string{}}
+	r := &closeRecorder{Reader: strings.NewReader("report")}
+	job := &UploadJob{Uploader: u, Bucket: "reports", Key: "daily.csv", Open: func() (io.Reader, error) { return r, nil }}
+	if err := job.Run(); err != nil {
+		test.Fatal(err)
+	}
+	if u.objects["reports/daily.csv"] != "report" {
+		test.Errorf("unexpected objects: %v", u.objects)
+	}
+	if !r.closed {
+		test.Error("expected the reader to be closed after the upload")
+	}
+}
+
+func TestUploadJob_Errors(test *testing.T) {
+	u := &fakeUploader{objects: map[string]string{}, err: errors.New("denied")}
+	for _, job := range []*UploadJob{
+		{Uploader: u, Key: "{{.Nope"},
+		{Uploader: u, Key: "k"},
+		{Uploader: u, Key: "k", Path: filepath.Join(test.TempDir(), "missing")},
+		{Uploader: u, Key: "k", Open: func() (io.Reader, error) { return strings.NewReader(""), nil }},
+	} {
+		if err := job.Run(); err == nil {
+			test.Errorf("expected an error uploading with %+v", job)
+		}
+	}
+}
+
+// Tests if the key is of the time the run was scheduled at, and the
+// upload is passed the context of the run.
+func TestUploadJob_RunContext(test *testing.T) {
+	keys := make(chan string, 1)
+	u := UploaderFunc(func(ctx context.Context, bucket, key string, r io.Reader) error {
+		if ticktock.RunID(ctx) == "" {
+			return errors.New("expected the context of the run")
+		}
+		keys <- key
+		return nil
+	})
+	job := &UploadJob{Uploader: u, Key: `{{.Time.UnixNano}}`, Open: func() (io.Reader, error) { return strings.NewReader(""), nil }}
+	sh := &ticktock.Scheduler{}
+	sh.Schedule("upload", job, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("upload")
+	key := <-keys
+	var runs []ticktock.RunResult
+	for i := 0; i < 100 && len(runs) == 0; i++ {
+		// the run is recorded after the job returns
+		time.Sleep(time.Millisecond)
+		runs, _ = sh.History("upload")
+	}
+	if len(runs) != 1 || runs[0].Err != nil {
+		test.Fatalf("expected a successful run in the history, found %+v", runs)
+	}
+	if want := fmt.Sprint(runs[0].Time.UnixNano()); key != want {
+		test.Errorf("expected the key of the run scheduled at %v, found %v", want, key)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fake := &UploadJob{Uploader: &fakeUploader{objects: map[string]string{}}, Key: "k", Open: job.Open}
+	if err := fake.RunContext(ctx); !errors.Is(err, context.Canceled) {
+		test.Errorf("expected the upload to be cancelled with the run, found %v", err)
+	}
+}
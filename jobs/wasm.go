@@ -0,0 +1,134 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// WasmJob runs a WebAssembly (WASI) module in a sandbox. Each run
+// instantiates the module in a fresh runtime and calls its _start
+// func. The time the run was scheduled at is passed to the module as
+// its first argument, formatted in RFC 3339, followed by Args. The
+// module is closed once the run is cancelled. The module
+// has no access to the file system or the network; a non-zero exit
+// code fails the run. Register registers it as the "wasm" job type.
+// Example usage:
+// ticktock.Schedule(
+//     "tenant-42-report",
+//     &jobs.WasmJob{Path: "/var/lib/jobs/tenant-42.wasm", Timeout: time.Minute},
+//     &t.When{Every: t.Every(1).Hours()})
+type WasmJob struct {
+	// Module is the binary of the module.
+	Module []byte
+	// Path of the module file, used if Module is empty.
+	Path string
+	Args []string
+
+	// Stdout and Stderr of the module, discarded if nil.
+	Stdout io.Writer `json:"-"`
+	Stderr io.Writer `json:"-"`
+
+	// Timeout stops the module if it runs longer. No limit if zero.
+	Timeout time.Duration
+	// MaxMemoryPages limits the memory of the module in 64KiB
+	// pages. Defaults to the wazero limit if zero.
+	MaxMemoryPages uint32
+
+	once  sync.Once
+	cache wazero.CompilationCache
+}
+
+// Runs the module.
+func (j *WasmJob) Run() error {
+	return j.RunContext(context.Background())
+}
+
+// Runs the module until it exits or ctx is done.
+func (j *WasmJob) RunContext(ctx context.Context) error {
+	bin, err := j.module()
+	if err != nil {
+		return err
+	}
+	j.once.Do(func() {
+		j.cache = wazero.NewCompilationCache()
+	})
+	at := ticktock.ScheduledTime(ctx)
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+	rc := wazero.NewRuntimeConfig().
+		WithCompilationCache(j.cache).
+		WithCloseOnContextDone(true)
+	if j.MaxMemoryPages > 0 {
+		rc = rc.WithMemoryLimitPages(j.MaxMemoryPages)
+	}
+	r := wazero.NewRuntimeWithConfig(ctx, rc)
+	defer r.Close(context.Background())
+	wasi_snapshot_preview1.MustInstantiate(ctx, r)
+
+	args := append([]string{"job", at.Format(time.RFC3339)}, j.Args...)
+	mc := wazero.NewModuleConfig().
+		WithArgs(args...).
+		WithStdout(orDiscard(j.Stdout)).
+		WithStderr(orDiscard(j.Stderr)).
+		WithSysWalltime().
+		WithSysNanotime()
+	mod, err := r.InstantiateWithConfig(ctx, bin, mc)
+	if mod != nil {
+		mod.Close(context.Background())
+	}
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.ExitCode() == 0 {
+			return nil
+		}
+		return fmt.Errorf("wasm module exited with code %d", exitErr.ExitCode())
+	}
+	return err
+}
+
+func (j *WasmJob) module() ([]byte, error) {
+	if len(j.Module) > 0 {
+		return j.Module, nil
+	}
+	if j.Path == "" {
+		return nil, errors.New("neither a module nor a path is provided")
+	}
+	return os.ReadFile(j.Path)
+}
+
+func orDiscard(w io.Writer) io.Writer {
+	if w == nil {
+		return io.Discard
+	}
+	return w
+}
@@ -0,0 +1,137 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// Builds the module in testdata, or skips the test if it can't be
+// built.
+func buildWasm(test *testing.T) []byte {
+	if testing.Short() {
+		test.Skip("building a module is slow")
+	}
+	path := filepath.Join(test.TempDir(), "job.wasm")
+	cmd := exec.Command(filepath.Join(runtime.GOROOT(), "bin", "go"), "build", "-o", path, "./testdata/wasm")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		test.Skipf("building the module failed: %v\n%s", err, out)
+	}
+	bin, err := os.ReadFile(path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	return bin
+}
+
+func TestWasmJob(test *testing.T) {
+	bin := buildWasm(test)
+	var stdout, stderr bytes.Buffer
+	job := &WasmJob{Module: bin, Args: []string{"hello"}, Stdout: &stdout}
+	before := time.Now().Truncate(time.Second)
+	if err := job.Run(); err != nil {
+		test.Fatal(err)
+	}
+	args := strings.Fields(stdout.String())
+	if len(args) != 2 || args[1] != "hello" {
+		test.Fatalf("unexpected args: %q", stdout.String())
+	}
+	if at, err := time.Parse(time.RFC3339, args[0]); err != nil || at.Before(before) {
+		test.Errorf("expected the time of the run as the first arg, found %v", args[0])
+	}
+
+	job = &WasmJob{Module: bin, Args: []string{"fail"}}
+	if err := job.Run(); err == nil || !strings.Contains(err.Error(), "code 3") {
+		test.Errorf("expected the exit code to fail the run, found %v", err)
+	}
+	// the module has no access to the file system
+	job = &WasmJob{Module: bin, Args: []string{"read"}, Stderr: &stderr}
+	if err := job.Run(); err == nil {
+		test.Error("expected the module not to read the files of the host")
+	}
+}
+
+func TestWasmJob_Timeout(test *testing.T) {
+	bin := buildWasm(test)
+	job := &WasmJob{Module: bin, Args: []string{"loop"}, Timeout: 100 * time.Millisecond}
+	done := make(chan error, 1)
+	go func() { done <- job.Run() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			test.Error("expected the module to fail once it times out")
+		}
+	case <-time.After(30 * time.Second):
+		test.Fatal("expected the module to be stopped after the timeout")
+	}
+}
+
+// Tests if the module is passed the time the run was scheduled at,
+// and closed once the run is cancelled.
+func TestWasmJob_RunContext(test *testing.T) {
+	bin := buildWasm(test)
+	var stdout bytes.Buffer
+	sh := &ticktock.Scheduler{}
+	sh.Schedule("wasm", &WasmJob{Module: bin, Stdout: &stdout}, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("wasm")
+	var runs []ticktock.RunResult
+	for i := 0; i < 1000 && len(runs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		runs, _ = sh.History("wasm")
+	}
+	if len(runs) != 1 || runs[0].Err != nil {
+		test.Fatalf("expected a successful run in the history, found %+v", runs)
+	}
+	if want := runs[0].Time.Format(time.RFC3339); strings.TrimSpace(stdout.String()) != want {
+		test.Errorf("expected the run scheduled at %v, found %q", want, stdout.String())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- (&WasmJob{Module: bin, Args: []string{"loop"}}).RunContext(ctx) }()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			test.Error("expected the module to fail once the run is cancelled")
+		}
+	case <-time.After(30 * time.Second):
+		test.Fatal("expected the module to be closed once the run is cancelled")
+	}
+}
+
+func TestWasmJob_Path(test *testing.T) {
+	if err := (&WasmJob{}).Run(); err == nil {
+		test.Error("expected an error without a module")
+	}
+	if err := (&WasmJob{Path: filepath.Join(test.TempDir(), "missing.wasm")}).Run(); err == nil {
+		test.Error("expected an error for a missing module file")
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LoadGate reports whether the host is too loaded to start the
+// runs of the jobs that aren't critical. See WithLoadGate.
+type LoadGate interface {
+	Overloaded() bool
+}
+
+// LoadGateFunc adapts a func to a LoadGate.
+type LoadGateFunc func() bool
+
+func (f LoadGateFunc) Overloaded() bool {
+	return f()
+}
+
+// Returns a LoadGate reporting the host overloaded while its
+// 1-minute load average is over max. The load average is read
+// from /proc/loadavg; the host is never overloaded on the systems
+// without it.
+// Example:
+// 		ticktock.MaxLoadAverage(float64(runtime.NumCPU()))
+func MaxLoadAverage(max float64) LoadGate {
+	return LoadGateFunc(func() bool {
+		b, err := os.ReadFile("/proc/loadavg")
+		if err != nil {
+			return false
+		}
+		fields := strings.Fields(string(b))
+		if len(fields) == 0 {
+			return false
+		}
+		load, err := strconv.ParseFloat(fields[0], 64)
+		return err == nil && load > max
+	})
+}
+
+// Returns a LoadGate reporting the host overloaded while the
+// fraction of the CPU time spent busy since the previous check
+// is over max, e.g. 0.9. The CPU times are read from /proc/stat;
+// the host is never overloaded on the systems without it.
+func MaxCPU(max float64) LoadGate {
+	var (
+		mu                sync.Mutex
+		lastBusy, lastAll uint64
+	)
+	return LoadGateFunc(func() bool {
+		busy, all, ok := cpuTimes()
+		if !ok {
+			return false
+		}
+		mu.Lock()
+		db, da := busy-lastBusy, all-lastAll
+		lastBusy, lastAll = busy, all
+		mu.Unlock()
+		return da > 0 && float64(db)/float64(da) > max
+	})
+}
+
+// Returns the busy and the total CPU time of the host from the
+// aggregate cpu line of /proc/stat, in clock ticks.
+func cpuTimes() (busy, all uint64, ok bool) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, 0, false
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	if !sc.Scan() {
+		return 0, 0, false
+	}
+	fields := strings.Fields(sc.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, false
+	}
+	// guest time is already counted in user time
+	if len(fields) > 9 {
+		fields = fields[:9]
+	}
+	for i, field := range fields[1:] {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		all += v
+		// idle and iowait are the 4th and 5th columns
+		if i != 3 && i != 4 {
+			busy += v
+		}
+	}
+	return busy, all, true
+}
@@ -0,0 +1,535 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"container/heap"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// A single loop goroutine drives all of the jobs of a scheduler.
+// It owns the queue of the scheduled runs and the lifecycle state
+// of the jobs; Schedule, Start, Cancel and the completed runs pass
+// control funcs to it over a channel, rather than mutating the
+// state themselves. Control funcs must not block.
+
+// jobQueue is a min-heap of jobs ordered by the time
+// their next runs are scheduled at.
+type jobQueue []*jobC
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	return q[i].scheduledAt.Before(q[j].scheduledAt)
+}
+
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	j := x.(*jobC)
+	j.index = len(*q)
+	*q = append(*q, j)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.index = -1
+	*q = old[:n-1]
+	return j
+}
+
+// Runs f on the loop goroutine, starting the loop if necessary.
+func (s *Scheduler) do(f func()) {
+	s.loopMu.Lock()
+	defer s.loopMu.Unlock()
+	if !s.looping {
+		s.looping = true
+		if s.ctl == nil {
+			s.ctl = make(chan func())
+		}
+		go s.loop()
+	}
+	s.ctl <- f
+}
+
+// Runs f on the loop goroutine and waits for it to return.
+func (s *Scheduler) call(f func()) {
+	done := make(chan struct{})
+	s.do(func() {
+		f()
+		close(done)
+	})
+	<-done
+}
+
+// Dispatches the due jobs, runs the control funcs and sleeps
+// until the earliest run in the queue. The loop exits once the
+// scheduler is stopped and nothing is queued, so the schedulers
+// that aren't started hold no goroutines; the next control func
+// starts it again.
+func (s *Scheduler) loop() {
+	var (
+		timer   Timer
+		armed   time.Time
+		checker Timer
+	)
+	due := make(chan struct{}, 1)
+	check := make(chan struct{}, 1)
+	for {
+		now := s.now()
+		s.detectStep(now)
+		for len(s.queue) > 0 && !s.queue[0].scheduledAt.After(now) {
+			j := heap.Pop(&s.queue).(*jobC)
+			if late := now.Sub(j.scheduledAt); late >= s.misfireThreshold() && j.opts.Misfire == t.MisfireSkip {
+				s.skip(j, now)
+				continue
+			}
+			j.inflight = true
+			go j.dispatch(j.scheduledAt, j.occurrence())
+		}
+		if len(s.queue) > 0 {
+			// rearm only if the earliest run has changed
+			if at := s.queue[0].scheduledAt; timer == nil || !at.Equal(armed) {
+				if timer != nil {
+					timer.Stop()
+				}
+				armed = at
+				timer = s.clk().AfterFunc(at.Sub(now), func() {
+					select {
+					case due <- struct{}{}:
+					default:
+					}
+				})
+			}
+		} else if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+		// the timers run on the monotonic clock, wake up
+		// periodically to notice the steps of the wall clock
+		if checker == nil && len(s.queue) > 0 {
+			checker = s.clk().AfterFunc(stepCheckInterval, func() {
+				select {
+				case check <- struct{}{}:
+				default:
+				}
+			})
+		}
+		// a control func being passed keeps the loop running
+		if !s.started && len(s.queue) == 0 && s.loopMu.TryLock() {
+			if checker != nil {
+				checker.Stop()
+			}
+			s.looping = false
+			s.loopMu.Unlock()
+			return
+		}
+		select {
+		case f := <-s.ctl:
+			f()
+		case <-due:
+			timer = nil
+		case <-check:
+			checker = nil
+		}
+	}
+}
+
+const (
+	// The wall clock is checked for steps at least this often
+	// while there are scheduled runs.
+	stepCheckInterval = time.Minute
+	// The wall clock has stepped if it drifted away from the
+	// monotonic clock by maxClockStep or more.
+	maxClockStep = time.Second
+)
+
+// Reschedules the queued runs that depend on the wall clock if the
+// wall clock has stepped since the last check, e.g. by an NTP step
+// or a manual change. The monotonic clock stops while the machine
+// sleeps, so waking up looks like a step too; the runs missed in
+// the meantime follow the misfire policy of their jobs. Emits an
+// EventClockStep listing the jobs whose next runs have moved.
+func (s *Scheduler) detectStep(now time.Time) {
+	mono, wall := s.stepMono, s.stepWall
+	s.stepMono, s.stepWall = now, now.Round(0)
+	if mono.IsZero() {
+		return
+	}
+	step := now.Round(0).Sub(wall) - now.Sub(mono)
+	if step > -maxClockStep && step < maxClockStep {
+		return
+	}
+	var moved []string
+	for _, j := range append(jobQueue{}, s.queue...) {
+		if now.Round(0).Sub(j.scheduledAt.Round(0)) >= s.misfireThreshold() {
+			if j.opts.Misfire == t.MisfireSkip {
+				j.setNext(j.nextFrom(now))
+			} else {
+				// missed, postponed runs are run right away
+				j.delay += now.Sub(j.scheduledAt)
+				j.scheduledAt = now
+			}
+		} else if _, ok := j.when.Interval(); ok {
+			continue
+		} else {
+			at := j.nextFrom(j.when.LastRun)
+			if d := at.Sub(j.occurrence()); d > -maxClockStep && d < maxClockStep {
+				continue
+			}
+			j.setNext(at)
+		}
+		heap.Fix(&s.queue, j.index)
+		moved = append(moved, j.name)
+	}
+	sort.Strings(moved)
+	s.logf("ticktock: the wall clock stepped by %v, rescheduled %v", step, moved)
+	go s.emit(Event{Kind: EventClockStep, Time: now, Step: step, Jobs: moved})
+}
+
+// Schedules the job if the scheduler is started.
+func (s *Scheduler) add(j *jobC) {
+	if !s.started || j.active || j.completed || j.isCancelled() {
+		return
+	}
+	j.active = true
+	s.active++
+	if !j.watching {
+		// triggers are watched once, a restarted
+		// scheduler doesn't watch them again
+		j.watching = true
+		j.load()
+		j.watch()
+		if qs, ok := s.store.(QueueStore); ok {
+			// runs the payloads left by a previous process
+			j.drain(qs)
+		}
+		if st, ok := s.store.(RunStore); ok {
+			// scheduled once the zombies are reaped
+			j.reaping = true
+			go j.reapZombies(st)
+			return
+		}
+	}
+	s.queueMissed(j, nil)
+}
+
+// Schedules the active job, and runs the occurrence it missed while
+// stopped right away if it has the at-least-once semantics, unless the
+// occurrence is replayed already.
+func (s *Scheduler) queueMissed(j *jobC, replayed map[string]bool) {
+	missed, ok := j.missed()
+	s.schedule(j)
+	if ok && j.opts.Semantics == t.AtLeastOnce && j.index >= 0 && !replayed[occurrenceKey(missed)] {
+		s.catchUp(j, missed)
+	}
+}
+
+// Runs the occurrence the queued job missed right away, in place
+// of its next run.
+func (s *Scheduler) catchUp(j *jobC, missed time.Time) {
+	s.logf("ticktock: running the occurrence %v of %v missed while stopped", missed, j.name)
+	now := s.now()
+	j.delay = now.Sub(missed)
+	j.scheduledAt = now
+	heap.Fix(&s.queue, j.index)
+}
+
+// Queues or ticks the active job, unless it's paused.
+func (s *Scheduler) schedule(j *jobC) {
+	if s.held(j) {
+		return
+	}
+	if interval, ok := j.tickInterval(); ok {
+		s.startTicking(j, interval)
+		return
+	}
+	s.push(j)
+}
+
+// Starts ticking the job from its next run.
+func (s *Scheduler) startTicking(j *jobC, interval time.Duration) {
+	j.setNext(j.next())
+	j.ticker = make(chan struct{})
+	j.inflight = true
+	go j.tick(j.scheduledAt, interval, j.ticker)
+}
+
+// Skips the missed run of the job, the job waits for its next
+// occurrence after now.
+func (s *Scheduler) skip(j *jobC, now time.Time) {
+	s.logf("ticktock: skipped the run of %v missed at %v", j.name, j.scheduledAt)
+	j.setNext(j.nextFrom(now))
+	heap.Push(&s.queue, j)
+}
+
+// Computes the next run of the job and pushes it to the queue.
+func (s *Scheduler) push(j *jobC) {
+	j.setNext(j.next())
+	heap.Push(&s.queue, j)
+}
+
+// Pushes the job back to the queue after a run, if it has
+// more runs to go.
+func (s *Scheduler) requeue(j *jobC) {
+	j.inflight = false
+	if !j.forever {
+		j.completed = true
+	}
+	if s.started && !j.completed && !j.isCancelled() {
+		if !s.held(j) {
+			s.push(j)
+		}
+		return
+	}
+	s.finish(j)
+}
+
+// Removes the cancelled job from the queue. If the job is
+// running, requeue finishes it once the run is completed.
+func (s *Scheduler) remove(j *jobC) {
+	if j.index >= 0 {
+		heap.Remove(&s.queue, j.index)
+	}
+	s.untick(j)
+	s.stopResumeTimer(j)
+	if !j.inflight {
+		s.finish(j)
+	}
+}
+
+// Unschedules all of the jobs. The running ones are finished
+// by requeue once their runs are completed.
+func (s *Scheduler) stop() {
+	s.started = false
+	for len(s.queue) > 0 {
+		s.finish(heap.Pop(&s.queue).(*jobC))
+	}
+	for _, j := range s.jobs.all() {
+		s.untick(j)
+		if !j.inflight {
+			// paused
+			s.finish(j)
+		}
+	}
+}
+
+// Pauses the job, it's kept scheduled but its runs are skipped
+// until it's resumed. An in-flight run is allowed to complete.
+func (s *Scheduler) pause(j *jobC) {
+	s.stopResumeTimer(j)
+	j.paused = true
+	s.unschedule(j)
+}
+
+// Removes the job from the queue, or stops ticking it. The job is
+// still active.
+func (s *Scheduler) unschedule(j *jobC) {
+	if j.index >= 0 {
+		heap.Remove(&s.queue, j.index)
+	}
+	s.untick(j)
+}
+
+// Resumes the paused job from its next run.
+func (s *Scheduler) resume(j *jobC) {
+	s.stopResumeTimer(j)
+	if !j.paused {
+		return
+	}
+	j.paused = false
+	if j.active && !j.inflight {
+		s.schedule(j)
+	}
+}
+
+// Pauses the job, and resumes it at until unless it's paused
+// or resumed again in the meantime.
+func (s *Scheduler) snooze(j *jobC, until time.Time) {
+	s.pause(j)
+	var timer Timer
+	timer = s.clk().AfterFunc(until.Sub(s.now()), func() {
+		s.do(func() {
+			if j.resumeTimer == timer {
+				s.resume(j)
+			}
+		})
+	})
+	j.resumeTimer = timer
+	j.snoozedUntil = until
+}
+
+func (s *Scheduler) stopResumeTimer(j *jobC) {
+	if j.resumeTimer != nil {
+		j.resumeTimer.Stop()
+		j.resumeTimer = nil
+	}
+	j.snoozedUntil = time.Time{}
+}
+
+// Stops the timer of a ticked job, the job is finished
+// once its last run is completed.
+func (s *Scheduler) untick(j *jobC) {
+	if j.ticker != nil {
+		close(j.ticker)
+		j.ticker = nil
+	}
+}
+
+// Marks the job as not scheduled.
+func (s *Scheduler) finish(j *jobC) {
+	if !j.active {
+		return
+	}
+	j.active = false
+	s.active--
+	s.release()
+}
+
+// Releases the Start calls waiting for the jobs, if
+// there are no jobs left to run.
+func (s *Scheduler) release() {
+	if s.active > 0 {
+		return
+	}
+	for _, c := range s.waiters {
+		close(c)
+	}
+	s.waiters = nil
+}
+
+// Intervals shorter than tickThreshold are ticked by a timer of
+// their own, rather than through the queue. A run per tick through
+// the loop would reset its timer and allocate a new one each time.
+const tickThreshold = time.Millisecond
+
+// The last stretch of the wait for a tick that is spun on rather
+// than slept, see waitUntil.
+const spinWindow = 100 * time.Microsecond
+
+// Returns the interval the job is ticked at, reports false if
+// the job is run through the queue. Only the jobs with plain
+// intervals on the system clock are ticked.
+func (j *jobC) tickInterval() (time.Duration, bool) {
+	if j.scheduler.clock != nil || !j.forever || j.splay > 0 ||
+		j.opts.AlignTo != t.AlignNone || j.opts.Jitter > 0 || j.opts.ExcludeCalendar != nil {
+		return 0, false
+	}
+	d, ok := j.when.Interval()
+	if !ok || d <= 0 || d >= tickThreshold {
+		return 0, false
+	}
+	return d, true
+}
+
+// Runs the job from at on every interval until stop is closed.
+// The runs are sequential; the ticks missed by a long run or
+// a blackout are skipped, rather than run back to back.
+func (j *jobC) tick(at time.Time, interval time.Duration, stop chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	var last time.Time
+	for waitUntil(at, timer, stop) {
+		if until, ok := j.effectiveOpts().BlackedOut(time.Now()); ok {
+			at = until
+			continue
+		}
+		if j.scheduler.dryRun {
+			j.dryRun(at)
+		} else {
+			j.fire(at, nil)
+		}
+		last = time.Now()
+		if j.opts.IntervalMode == t.FixedRate {
+			at = at.Add(interval)
+			if late := last.Sub(at); late >= 0 {
+				at = at.Add((late/interval + 1) * interval)
+			}
+		} else {
+			at = last.Add(interval)
+		}
+	}
+	j.stopTicking(interval, last)
+}
+
+// Waits until at, reports false if stop is closed in the meantime.
+// Timers fire only as precisely as the timers of the runtime allow,
+// up to timerSlack late, so the wait sleeps on the timer until then,
+// sleeps the OS thread until the last spinWindow before at, and only
+// spins on the rest.
+func waitUntil(at time.Time, timer *time.Timer, stop chan struct{}) bool {
+	if d := time.Until(at) - timerSlack; d > 0 {
+		timer.Reset(d)
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+	if d := time.Until(at) - spinWindow; d > 0 {
+		sleepThread(d)
+	}
+	for {
+		select {
+		case <-stop:
+			return false
+		default:
+		}
+		if !time.Now().Before(at) {
+			return true
+		}
+		runtime.Gosched()
+	}
+}
+
+// Records the last run of a ticked job once it stops ticking,
+// and finishes it. The runs in between aren't stored, it'd be
+// a write per tick. Like requeue, the job is ticked again if
+// the scheduler is restarted in the meantime.
+func (j *jobC) stopTicking(interval time.Duration, last time.Time) {
+	if !last.IsZero() {
+		if st := j.scheduler.store; st != nil {
+			if err := st.SetLastRun(j.name, last); err != nil {
+				j.scheduler.logf("ticktock: storing the last run of %v failed: %v", j.name, err)
+			}
+		}
+	}
+	j.scheduler.do(func() {
+		s := j.scheduler
+		j.inflight = false
+		if !last.IsZero() {
+			j.when.LastRun = last
+		}
+		if s.started && j.ticker == nil && !j.isCancelled() {
+			if !s.held(j) {
+				s.startTicking(j, interval)
+			}
+			return
+		}
+		s.finish(j)
+	})
+}
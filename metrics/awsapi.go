@@ -0,0 +1,176 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIPublisher publishes the metrics with the CloudWatch API over
+// HTTPS, signed with the static credentials of an IAM user or of an
+// assumed role. Use an adapter of the AWS SDK as the Publisher to
+// get the credentials from the instance metadata.
+type APIPublisher struct {
+	// Region of CloudWatch, e.g. "us-east-1".
+	Region string
+	// AccessKeyID and SecretAccessKey of the credentials, and
+	// SessionToken if they are temporary.
+	AccessKeyID, SecretAccessKey, SessionToken string
+	// Endpoint overrides the endpoint of the region, optional.
+	Endpoint string
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Returns an APIPublisher for region with the credentials of the
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables.
+func EnvPublisher(region string) *APIPublisher {
+	return &APIPublisher{
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Publishes the data in namespace with the PutMetricData action.
+func (p *APIPublisher) PutMetricData(ctx context.Context, namespace string, data []Datum) error {
+	if p.AccessKeyID == "" || p.SecretAccessKey == "" {
+		return errors.New("metrics: no AWS credentials are provided")
+	}
+	form := url.Values{
+		"Action":    {"PutMetricData"},
+		"Version":   {"2010-08-01"},
+		"Namespace": {namespace},
+	}
+	for i, d := range data {
+		m := "MetricData.member." + strconv.Itoa(i+1) + "."
+		form.Set(m+"MetricName", d.Name)
+		form.Set(m+"Unit", d.Unit)
+		form.Set(m+"Timestamp", d.Timestamp.UTC().Format(time.RFC3339))
+		form.Set(m+"StatisticValues.SampleCount", formatFloat(d.SampleCount))
+		form.Set(m+"StatisticValues.Sum", formatFloat(d.Sum))
+		form.Set(m+"StatisticValues.Minimum", formatFloat(d.Min))
+		form.Set(m+"StatisticValues.Maximum", formatFloat(d.Max))
+		names := make([]string, 0, len(d.Dimensions))
+		for name := range d.Dimensions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for j, name := range names {
+			dim := m + "Dimensions.member." + strconv.Itoa(j+1) + "."
+			form.Set(dim+"Name", name)
+			form.Set(dim+"Value", d.Dimensions[name])
+		}
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://monitoring." + p.Region + ".amazonaws.com/"
+	}
+	body := form.Encode()
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	p.sign(req, body, time.Now())
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("metrics: PutMetricData failed with %v: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// Signs the request with Signature Version 4.
+func (p *APIPublisher) sign(req *http.Request, body string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+	}
+	if p.SessionToken != "" {
+		headers["x-amz-security-token"] = p.SessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signed := strings.Join(names, ";")
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	creq := strings.Join([]string{"POST", path, req.URL.RawQuery, canonical.String(), signed, hexSHA256(body)}, "\n")
+	scope := date + "/" + p.Region + "/monitoring/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(creq)
+	key := hmacSHA256([]byte("AWS4"+p.SecretAccessKey), date)
+	key = hmacSHA256(key, p.Region)
+	key = hmacSHA256(key, "monitoring")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+p.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,194 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Datum is a metric of a job aggregated over an interval, as the
+// statistic set of the values it's made of. The events of a kind
+// are counted as values of 1.
+type Datum struct {
+	Name       string
+	Dimensions map[string]string
+	// Unit is "Count" or "Seconds".
+	Unit        string
+	Timestamp   time.Time
+	SampleCount float64
+	Sum         float64
+	Min, Max    float64
+}
+
+// Publisher publishes the metrics to CloudWatch. It can be an
+// adapter of the PutMetricData of the AWS SDK, to use the credentials
+// of its default chain, such as the roles of the EC2 instances and the
+// ECS tasks; see APIPublisher for one that doesn't need the SDK.
+type Publisher interface {
+	PutMetricData(ctx context.Context, namespace string, data []Datum) error
+}
+
+// CloudWatch publishes the metrics of the runs to AWS CloudWatch. The
+// events of each job are counted by their kinds, and the durations of
+// the completed runs are timed, in a namespace with a Job dimension:
+// 		succeeded{Job=report}     Count
+// 		duration{Job=report}      Seconds
+// The metrics are published every interval. The metrics of a flush
+// that fails are dropped.
+// Example:
+// 		cw := metrics.NewCloudWatch("Ticktock", metrics.EnvPublisher("us-east-1"), time.Minute)
+// 		cw.Dimensions = map[string]string{"Scheduler": "billing"}
+// 		defer cw.Close()
+// 		s := ticktock.New(ticktock.WithListener(cw))
+type CloudWatch struct {
+	// Dimensions are added to the Job dimension of all of the
+	// metrics. They should be set before the CloudWatch is used.
+	Dimensions map[string]string
+
+	namespace string
+	publisher Publisher
+	interval  time.Duration
+
+	mu   sync.Mutex
+	data map[cwKey]*Datum
+
+	// starts the loop on the first event
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+type cwKey struct {
+	job, name string
+}
+
+// Returns a CloudWatch that publishes the metrics in namespace with
+// p every interval, a minute if it's not positive.
+func NewCloudWatch(namespace string, p Publisher, interval time.Duration) *CloudWatch {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &CloudWatch{
+		namespace: namespace,
+		publisher: p,
+		interval:  interval,
+		data:      make(map[cwKey]*Datum),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Counts the event.
+func (cw *CloudWatch) OnEvent(e ticktock.Event) {
+	if e.Job == "" {
+		return
+	}
+	cw.once.Do(func() { go cw.loop() })
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.observe(e.Job, e.Kind.String(), "Count", 1)
+	if e.Kind == ticktock.EventSucceeded || e.Kind == ticktock.EventFailed {
+		cw.observe(e.Job, "duration", "Seconds", e.Duration.Seconds())
+	}
+}
+
+// Adds the value to the statistic set of the metric. Must be called
+// with mu held.
+func (cw *CloudWatch) observe(job, name, unit string, v float64) {
+	k := cwKey{job: job, name: name}
+	d := cw.data[k]
+	if d == nil {
+		d = &Datum{Name: name, Unit: unit, Min: v, Max: v}
+		cw.data[k] = d
+	}
+	d.SampleCount++
+	d.Sum += v
+	if v < d.Min {
+		d.Min = v
+	}
+	if v > d.Max {
+		d.Max = v
+	}
+}
+
+func (cw *CloudWatch) loop() {
+	defer close(cw.done)
+	ticker := time.NewTicker(cw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			cw.Flush(context.Background())
+		case <-cw.stop:
+			return
+		}
+	}
+}
+
+// The number of the data published with a call.
+const maxData = 1000
+
+// Publishes the metrics aggregated since the last flush.
+func (cw *CloudWatch) Flush(ctx context.Context) error {
+	cw.mu.Lock()
+	agg := cw.data
+	cw.data = make(map[cwKey]*Datum)
+	cw.mu.Unlock()
+	if len(agg) == 0 {
+		return nil
+	}
+	now := time.Now()
+	data := make([]Datum, 0, len(agg))
+	for k, d := range agg {
+		d.Timestamp = now
+		d.Dimensions = map[string]string{"Job": k.job}
+		for name, v := range cw.Dimensions {
+			d.Dimensions[name] = v
+		}
+		data = append(data, *d)
+	}
+	sort.Slice(data, func(i, j int) bool {
+		if data[i].Dimensions["Job"] != data[j].Dimensions["Job"] {
+			return data[i].Dimensions["Job"] < data[j].Dimensions["Job"]
+		}
+		return data[i].Name < data[j].Name
+	})
+	for len(data) > 0 {
+		n := len(data)
+		if n > maxData {
+			n = maxData
+		}
+		if err := cw.publisher.PutMetricData(ctx, cw.namespace, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// Stops publishing the metrics periodically, and publishes the
+// metrics aggregated since the last flush.
+func (cw *CloudWatch) Close() error {
+	// the loop is never started after Close
+	cw.once.Do(func() { close(cw.done) })
+	close(cw.stop)
+	<-cw.done
+	return cw.Flush(context.Background())
+}
@@ -0,0 +1,155 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// fakeCloudWatch records the forms of the PutMetricData requests.
+type fakeCloudWatch struct {
+	mu     sync.Mutex
+	forms  []url.Values
+	auth   []string
+	status int
+}
+
+func (f *fakeCloudWatch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forms = append(f.forms, r.PostForm)
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+	if f.status != 0 {
+		http.Error(w, "<Error><Code>Throttling</Code></Error>", f.status)
+	}
+}
+
+func (f *fakeCloudWatch) requests() ([]url.Values, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.forms...), append([]string(nil), f.auth...)
+}
+
+func newFakeCloudWatch(test *testing.T) (*fakeCloudWatch, *APIPublisher) {
+	f := &fakeCloudWatch{}
+	srv := httptest.NewServer(f)
+	test.Cleanup(srv.Close)
+	return f, &APIPublisher{
+		Region:          "us-east-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		Endpoint:        srv.URL + "/",
+	}
+}
+
+func TestCloudWatch(test *testing.T) {
+	f, p := newFakeCloudWatch(test)
+	cw := NewCloudWatch("Ticktock", p, time.Hour)
+	cw.Dimensions = map[string]string{"Scheduler": "billing"}
+	cw.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: "report", Duration: time.Second})
+	cw.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: "report", Duration: 3 * time.Second})
+	cw.OnEvent(ticktock.Event{Kind: ticktock.EventClockStep})
+	if err := cw.Close(); err != nil {
+		test.Fatal(err)
+	}
+	forms, auth := f.requests()
+	if len(forms) != 1 {
+		test.Fatalf("expected the metrics to be published once on Close, found %v requests", len(forms))
+	}
+	form := forms[0]
+	for k, want := range map[string]string{
+		"Action":                         "PutMetricData",
+		"Namespace":                      "Ticktock",
+		"MetricData.member.1.MetricName": "duration",
+		"MetricData.member.1.Unit":       "Seconds",
+		"MetricData.member.1.StatisticValues.SampleCount": "2",
+		"MetricData.member.1.StatisticValues.Sum":         "4",
+		"MetricData.member.1.StatisticValues.Minimum":     "1",
+		"MetricData.member.1.StatisticValues.Maximum":     "3",
+		"MetricData.member.1.Dimensions.member.1.Name":    "Job",
+		"MetricData.member.1.Dimensions.member.1.Value":   "report",
+		"MetricData.member.1.Dimensions.member.2.Name":    "Scheduler",
+		"MetricData.member.1.Dimensions.member.2.Value":   "billing",
+		"MetricData.member.2.MetricName":                  "succeeded",
+		"MetricData.member.2.Unit":                        "Count",
+		"MetricData.member.2.StatisticValues.Sum":         "2",
+		"MetricData.member.3.MetricName":                  "",
+	} {
+		if got := form.Get(k); got != want {
+			test.Errorf("%v: expected %q, found %q", k, want, got)
+		}
+	}
+	date := time.Now().UTC().Format("20060102")
+	if want := "AWS4-HMAC-SHA256 Credential=AKID/" + date + "/us-east-1/monitoring/aws4_request"; !strings.HasPrefix(auth[0], want) {
+		test.Errorf("expected the request to be signed, found %q", auth[0])
+	}
+}
+
+func TestCloudWatch_Batches(test *testing.T) {
+	f, p := newFakeCloudWatch(test)
+	cw := NewCloudWatch("Ticktock", p, time.Hour)
+	for i := 0; i < 600; i++ {
+		cw.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: fmt.Sprint("job-", i)})
+	}
+	if err := cw.Close(); err != nil {
+		test.Fatal(err)
+	}
+	forms, _ := f.requests()
+	if len(forms) != 2 || forms[0].Get("MetricData.member.1000.MetricName") == "" || forms[1].Get("MetricData.member.200.MetricName") == "" {
+		test.Errorf("expected 1200 metrics published in two batches, found %v requests", len(forms))
+	}
+}
+
+func TestCloudWatch_Interval(test *testing.T) {
+	f, p := newFakeCloudWatch(test)
+	cw := NewCloudWatch("Ticktock", p, 20*time.Millisecond)
+	defer cw.Close()
+	cw.OnEvent(ticktock.Event{Kind: ticktock.EventFailed, Job: "report"})
+	for i := 0; i < 100; i++ {
+		if forms, _ := f.requests(); len(forms) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Error("expected the metrics to be published every interval")
+}
+
+func TestCloudWatch_Errors(test *testing.T) {
+	f, p := newFakeCloudWatch(test)
+	f.status = http.StatusBadRequest
+	cw := NewCloudWatch("Ticktock", p, time.Hour)
+	cw.OnEvent(ticktock.Event{Kind: ticktock.EventFailed, Job: "report"})
+	if err := cw.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "Throttling") {
+		test.Errorf("expected the error of CloudWatch, found %v", err)
+	}
+	cw.Close()
+	if err := (&APIPublisher{Region: "us-east-1"}).PutMetricData(context.Background(), "Ticktock", nil); err == nil {
+		test.Error("expected an error without credentials")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Datadog pushes the metrics of the runs to the DogStatsD server of
+// a Datadog agent over UDP. Each event is counted by its kind, and
+// the durations of the completed runs are timed, tagged with the job,
+// the scheduler and, for the completed runs, the outcome:
+// 		ticktock.failed:1|c|#job:report,scheduler:billing,outcome:failure
+// 		ticktock.duration:1520|ms|#job:report,scheduler:billing,outcome:failure
+// The metrics are best effort, the ones that can't be sent are
+// dropped.
+// Example:
+// 		dd := metrics.NewDatadog("localhost:8125", "billing")
+// 		dd.Events = true
+// 		s := ticktock.New(ticktock.WithListener(dd))
+type Datadog struct {
+	// Prefix prefixes the names of the metrics, "ticktock" if
+	// it's empty.
+	Prefix string
+	// Tags are added to all of the metrics, as in "env:prod".
+	Tags []string
+	// Events sends a Datadog event for each run that fails after
+	// its retries, so monitors can alert on them.
+	Events bool
+
+	scheduler string
+	conn      *udpConn
+}
+
+// Returns a Datadog that sends the metrics to the agent at addr,
+// tagged with the name of the scheduler, untagged if it's empty.
+// The fields of the Datadog should be set before it's used.
+func NewDatadog(addr, scheduler string) *Datadog {
+	return &Datadog{scheduler: scheduler, conn: &udpConn{addr: addr}}
+}
+
+// Sends the metrics of the event.
+func (d *Datadog) OnEvent(e ticktock.Event) {
+	if e.Job == "" {
+		return
+	}
+	prefix := d.Prefix
+	if prefix == "" {
+		prefix = "ticktock"
+	}
+	tags := []string{"job:" + tagValue(e.Job)}
+	if d.scheduler != "" {
+		tags = append(tags, "scheduler:"+tagValue(d.scheduler))
+	}
+	switch e.Kind {
+	case ticktock.EventSucceeded:
+		tags = append(tags, "outcome:success")
+	case ticktock.EventFailed:
+		tags = append(tags, "outcome:failure")
+	}
+	tags = append(tags, d.Tags...)
+	suffix := "|#" + strings.Join(tags, ",")
+	lines := prefix + "." + sanitize(e.Kind.String()) + ":1|c" + suffix
+	if e.Kind == ticktock.EventSucceeded || e.Kind == ticktock.EventFailed {
+		lines += "\n" + prefix + ".duration:" + millis(e.Duration) + "|ms" + suffix
+	}
+	if d.Events && e.Kind == ticktock.EventFailed {
+		title := fmt.Sprintf("ticktock: %v failed", e.Job)
+		text := fmt.Sprintf("run %v failed after its retries: %v", e.RunID, e.Err)
+		// the newlines of the text are escaped as \\n
+		text = strings.Replace(text, "\n", "\\\\n", -1)
+		lines += fmt.Sprintf("\n_e{%d,%d}:%s|%s|t:error|s:ticktock%s", len(title), len(text), title, text, suffix)
+	}
+	d.conn.write(lines)
+}
+
+// Closes the connection to the agent.
+func (d *Datadog) Close() error {
+	return d.conn.close()
+}
+
+// Replaces the characters that separate the tags of DogStatsD with
+// underscores.
+func tagValue(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ',', '|', '#', '\n':
+			return '_'
+		}
+		return r
+	}, v)
+}
@@ -0,0 +1,76 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Returns a UDP listener standing in for the agent, and a func
+// returning the next packet it receives.
+func listenUDP(test *testing.T) (addr string, next func() string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		test.Skip(err)
+	}
+	test.Cleanup(func() { conn.Close() })
+	return conn.LocalAddr().String(), func() string {
+		buf := make([]byte, 64<<10)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			test.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+}
+
+func TestDatadog(test *testing.T) {
+	addr, next := listenUDP(test)
+	dd := NewDatadog(addr, "billing")
+	dd.Tags = []string{"env:prod"}
+	dd.Events = true
+	defer dd.Close()
+
+	dd.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: "acme/report", Duration: 1520 * time.Millisecond})
+	want := "ticktock.succeeded:1|c|#job:acme/report,scheduler:billing,outcome:success,env:prod\n" +
+		"ticktock.duration:1520|ms|#job:acme/report,scheduler:billing,outcome:success,env:prod"
+	if got := next(); got != want {
+		test.Errorf("expected\n%v\nfound\n%v", want, got)
+	}
+
+	dd.OnEvent(ticktock.Event{Kind: ticktock.EventFailed, Job: "report", RunID: "r1", Err: errors.New("line 1\nline 2")})
+	lines := strings.Split(next(), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ticktock.failed:1|c|#job:report,scheduler:billing,outcome:failure") {
+		test.Fatalf("unexpected metrics of a failure: %q", lines)
+	}
+	title, text := "ticktock: report failed", `run r1 failed after its retries: line 1\\nline 2`
+	if want := "_e{23,48}:" + title + "|" + text + "|t:error|s:ticktock|#"; !strings.HasPrefix(lines[2], want) {
+		test.Errorf("expected the event\n%v\nfound\n%v", want, lines[2])
+	}
+
+	// the kinds of events without durations are only counted
+	dd.Prefix = "jobs"
+	dd.OnEvent(ticktock.Event{Kind: ticktock.EventRetrying, Job: "a,b|c"})
+	if got, want := next(), "jobs.retrying:1|c|#job:a_b_c,scheduler:billing,env:prod"; got != want {
+		test.Errorf("expected %v, found %v", want, got)
+	}
+}
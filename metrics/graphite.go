@@ -0,0 +1,161 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Graphite pushes the metrics of the runs to Graphite over TCP, in
+// its plaintext protocol. The events of each job are counted by
+// their kinds and flushed every interval, with the mean and the
+// maximum durations of the runs completed in the interval:
+// 		<prefix>.<job>.succeeded 12 1700000000
+// 		<prefix>.<job>.duration.mean 1.52 1700000000
+// 		<prefix>.<job>.duration.max 3.1 1700000000
+// The durations are in seconds. The metrics of a flush that fails
+// are dropped.
+// Example:
+// 		g := metrics.NewGraphite("graphite:2003", "ticktock", time.Minute)
+// 		defer g.Close()
+// 		s := ticktock.New(ticktock.WithListener(g))
+type Graphite struct {
+	addr   string
+	prefix string
+
+	mu        sync.Mutex
+	counts    map[string]int64
+	durations map[string]*durations
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type durations struct {
+	n        int64
+	sum, max time.Duration
+}
+
+// Returns a Graphite that flushes the metrics to addr every interval,
+// a minute if it's not positive, with the names prefixed by prefix,
+// "ticktock" if it's empty.
+func NewGraphite(addr, prefix string, interval time.Duration) *Graphite {
+	if prefix == "" {
+		prefix = "ticktock"
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	g := &Graphite{
+		addr:      addr,
+		prefix:    prefix,
+		counts:    make(map[string]int64),
+		durations: make(map[string]*durations),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go g.loop(interval)
+	return g
+}
+
+// Counts the event.
+func (g *Graphite) OnEvent(e ticktock.Event) {
+	if e.Job == "" {
+		return
+	}
+	job := sanitize(e.Job)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counts[job+"."+sanitize(e.Kind.String())]++
+	if e.Kind == ticktock.EventSucceeded || e.Kind == ticktock.EventFailed {
+		d := g.durations[job]
+		if d == nil {
+			d = &durations{}
+			g.durations[job] = d
+		}
+		d.n++
+		d.sum += e.Duration
+		if e.Duration > d.max {
+			d.max = e.Duration
+		}
+	}
+}
+
+func (g *Graphite) loop(interval time.Duration) {
+	defer close(g.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.Flush()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// Sends the metrics counted since the last flush.
+func (g *Graphite) Flush() error {
+	g.mu.Lock()
+	counts, durs := g.counts, g.durations
+	g.counts, g.durations = make(map[string]int64), make(map[string]*durations)
+	g.mu.Unlock()
+	if len(counts) == 0 {
+		return nil
+	}
+	ts := " " + strconv.FormatInt(time.Now().Unix(), 10) + "\n"
+	var lines []string
+	for name, n := range counts {
+		lines = append(lines, g.prefix+"."+name+" "+strconv.FormatInt(n, 10)+ts)
+	}
+	for job, d := range durs {
+		mean := d.sum.Seconds() / float64(d.n)
+		lines = append(lines,
+			g.prefix+"."+job+".duration.mean "+strconv.FormatFloat(mean, 'f', -1, 64)+ts,
+			g.prefix+"."+job+".duration.max "+strconv.FormatFloat(d.max.Seconds(), 'f', -1, 64)+ts)
+	}
+	sort.Strings(lines)
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l)
+	}
+	conn, err := net.DialTimeout("tcp", g.addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("metrics: dialing graphite failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("metrics: writing to graphite failed: %v", err)
+	}
+	return nil
+}
+
+// Stops flushing the metrics periodically, and flushes the metrics
+// counted since the last flush.
+func (g *Graphite) Close() error {
+	close(g.stop)
+	<-g.done
+	return g.Flush()
+}
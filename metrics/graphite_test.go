@@ -0,0 +1,112 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Returns a TCP listener standing in for Graphite, and a func
+// returning the lines of the next connection it accepts.
+func listenTCP(test *testing.T) (addr string, next func() []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Skip(err)
+	}
+	test.Cleanup(func() { ln.Close() })
+	return ln.Addr().String(), func() []string {
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second))
+		conn, err := ln.Accept()
+		if err != nil {
+			test.Fatal(err)
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		b, err := io.ReadAll(conn)
+		if err != nil {
+			test.Fatal(err)
+		}
+		return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+}
+
+func TestGraphite(test *testing.T) {
+	addr, next := listenTCP(test)
+	g := NewGraphite(addr, "billing", time.Hour)
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventStarted, Job: "acme/report"})
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: "acme/report", Duration: time.Second})
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventStarted, Job: "acme/report"})
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventFailed, Job: "acme/report", Duration: 2 * time.Second})
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventClockStep})
+
+	done := make(chan error, 1)
+	go func() { done <- g.Flush() }()
+	lines := next()
+	if err := <-done; err != nil {
+		test.Fatal(err)
+	}
+	want := []string{
+		"billing.acme_report.duration.max 2",
+		"billing.acme_report.duration.mean 1.5",
+		"billing.acme_report.failed 1",
+		"billing.acme_report.started 2",
+		"billing.acme_report.succeeded 1",
+	}
+	ts := regexp.MustCompile(` \d+$`)
+	if len(lines) != len(want) {
+		test.Fatalf("expected %q, found %q", want, lines)
+	}
+	for i, l := range lines {
+		if !ts.MatchString(l) || ts.ReplaceAllString(l, "") != want[i] {
+			test.Errorf("expected %q with a timestamp, found %q", want[i], l)
+		}
+	}
+
+	// counted from zero after a flush, and flushed on close
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventRetrying, Job: "sync"})
+	go func() { done <- g.Close() }()
+	lines = next()
+	if err := <-done; err != nil {
+		test.Fatal(err)
+	}
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "billing.sync.retrying 1 ") {
+		test.Errorf("expected the retry to be flushed on close, found %q", lines)
+	}
+	if err := g.Flush(); err != nil {
+		test.Errorf("expected nothing to be sent without metrics, found %v", err)
+	}
+}
+
+func TestGraphite_Unreachable(test *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Skip(err)
+	}
+	// nothing listens on the address once it's closed
+	ln.Close()
+	g := NewGraphite(ln.Addr().String(), "", time.Hour)
+	defer g.Close()
+	g.OnEvent(ticktock.Event{Kind: ticktock.EventStarted, Job: "report"})
+	if err := g.Flush(); err == nil {
+		test.Error("expected an error flushing to an unreachable server")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// The number of the events Honeycomb sends in a batch.
+const honeycombBatch = 100
+
+// Honeycomb sends the canonical events of the runs to a Honeycomb
+// dataset, as a ticktock.RunSink. The events are batched, and sent
+// every interval or once a batch is full. The events of a batch that
+// fails to be sent are dropped.
+// Example:
+// 		hc := metrics.NewHoneycomb(os.Getenv("HONEYCOMB_API_KEY"), "ticktock", 10*time.Second)
+// 		defer hc.Close()
+// 		s := ticktock.New(ticktock.WithRunSink(hc))
+type Honeycomb struct {
+	// APIHost is the API of Honeycomb, https://api.honeycomb.io if
+	// it's empty.
+	APIHost string
+	// OnError is called with the errors of sending the events,
+	// optional.
+	OnError func(err error)
+	// Client sends the events, http.DefaultClient if nil.
+	Client *http.Client
+
+	key, dataset string
+	interval     time.Duration
+
+	mu     sync.Mutex
+	events []ticktock.RunEvent
+
+	// starts the loop on the first event
+	once sync.Once
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Returns a Honeycomb that sends the events to dataset with the API
+// key, every interval, 10 seconds if it's not positive. The fields
+// of the Honeycomb should be set before it's used.
+func NewHoneycomb(key, dataset string, interval time.Duration) *Honeycomb {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return &Honeycomb{
+		key:      key,
+		dataset:  dataset,
+		interval: interval,
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Adds the event to the batch.
+func (h *Honeycomb) Emit(e ticktock.RunEvent) {
+	h.once.Do(func() { go h.loop() })
+	h.mu.Lock()
+	h.events = append(h.events, e)
+	n := len(h.events)
+	h.mu.Unlock()
+	if n >= honeycombBatch {
+		select {
+		case h.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *Honeycomb) loop() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.full:
+		case <-h.stop:
+			return
+		}
+		if err := h.Flush(context.Background()); err != nil && h.OnError != nil {
+			h.OnError(err)
+		}
+	}
+}
+
+// The event of the batch API of Honeycomb.
+type honeycombEvent struct {
+	Time time.Time         `json:"time"`
+	Data ticktock.RunEvent `json:"data"`
+}
+
+// Sends the events added since the last flush.
+func (h *Honeycomb) Flush(ctx context.Context) error {
+	h.mu.Lock()
+	events := h.events
+	h.events = nil
+	h.mu.Unlock()
+	for len(events) > 0 {
+		n := len(events)
+		if n > honeycombBatch {
+			n = honeycombBatch
+		}
+		if err := h.send(ctx, events[:n]); err != nil {
+			return err
+		}
+		events = events[n:]
+	}
+	return nil
+}
+
+func (h *Honeycomb) send(ctx context.Context, events []ticktock.RunEvent) error {
+	batch := make([]honeycombEvent, len(events))
+	for i, e := range events {
+		batch[i] = honeycombEvent{Time: e.Started, Data: e}
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	host := h.APIHost
+	if host == "" {
+		host = "https://api.honeycomb.io"
+	}
+	req, err := http.NewRequest("POST", host+"/1/batch/"+h.dataset, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Honeycomb-Team", h.key)
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("metrics: sending the events to honeycomb failed with %v: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// Stops sending the events periodically, and sends the events added
+// since the last flush.
+func (h *Honeycomb) Close() error {
+	// the loop is never started after Close
+	h.once.Do(func() { close(h.done) })
+	close(h.stop)
+	<-h.done
+	return h.Flush(context.Background())
+}
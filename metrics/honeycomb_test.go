@@ -0,0 +1,146 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// fakeHoneycomb records the batches sent to the batch API.
+type fakeHoneycomb struct {
+	mu      sync.Mutex
+	batches [][]map[string]interface{}
+	status  int
+}
+
+func (f *fakeHoneycomb) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/1/batch/jobs" || r.Header.Get("X-Honeycomb-Team") != "key" || r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	if f.status != 0 {
+		http.Error(w, "unknown dataset", f.status)
+		return
+	}
+	var batch []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.batches = append(f.batches, batch)
+	f.mu.Unlock()
+}
+
+func TestHoneycomb(test *testing.T) {
+	fake := &fakeHoneycomb{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	hc := NewHoneycomb("key", "jobs", time.Hour)
+	hc.APIHost = srv.URL
+
+	started := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	hc.Emit(ticktock.RunEvent{
+		Job:       "acme/report",
+		Namespace: "acme",
+		RunID:     "r1",
+		Started:   started,
+		Duration:  1500 * time.Millisecond,
+		Attempts:  2,
+		Outcome:   "failed",
+		Error:     "timeout",
+		Metadata:  map[string]string{"owner": "team-a"},
+	})
+	if err := hc.Close(); err != nil {
+		test.Fatal(err)
+	}
+	if len(fake.batches) != 1 || len(fake.batches[0]) != 1 {
+		test.Fatalf("expected a batch of an event, found %v", fake.batches)
+	}
+	e := fake.batches[0][0]
+	if e["time"] != started.Format(time.RFC3339) {
+		test.Errorf("expected the event at the start of the run, found %v", e["time"])
+	}
+	data, _ := e["data"].(map[string]interface{})
+	want := map[string]interface{}{
+		"job":       "acme/report",
+		"namespace": "acme",
+		"runId":     "r1",
+		"duration":  float64(1500 * time.Millisecond),
+		"attempts":  float64(2),
+		"outcome":   "failed",
+		"error":     "timeout",
+	}
+	for k, v := range want {
+		if data[k] != v {
+			test.Errorf("expected %v of %v, found %v", k, v, data[k])
+		}
+	}
+	if md, _ := data["metadata"].(map[string]interface{}); md["owner"] != "team-a" {
+		test.Errorf("expected the metadata, found %v", data["metadata"])
+	}
+}
+
+func TestHoneycomb_Batches(test *testing.T) {
+	fake := &fakeHoneycomb{}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	hc := NewHoneycomb("key", "jobs", time.Hour)
+	hc.APIHost = srv.URL
+	defer hc.Close()
+	for i := 0; i < honeycombBatch; i++ {
+		hc.Emit(ticktock.RunEvent{Job: "report"})
+	}
+	// sent once the batch is full, rather than on the interval
+	for i := 0; i < 100; i++ {
+		fake.mu.Lock()
+		n := len(fake.batches)
+		fake.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.batches) != 1 || len(fake.batches[0]) != honeycombBatch {
+		test.Errorf("expected a full batch to be sent, found %v batches", len(fake.batches))
+	}
+}
+
+func TestHoneycomb_Errors(test *testing.T) {
+	fake := &fakeHoneycomb{status: http.StatusNotFound}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	hc := NewHoneycomb("key", "jobs", time.Hour)
+	hc.APIHost = srv.URL
+	hc.Emit(ticktock.RunEvent{Job: "report"})
+	err := hc.Flush(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "404") || !strings.Contains(err.Error(), "unknown dataset") {
+		test.Errorf("expected the status and message of the failure, found %v", err)
+	}
+	if err := hc.Close(); err != nil {
+		test.Errorf("expected the events of the failed batch to be dropped, found %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics pushes the metrics and the events of the runs of
+// a scheduler to monitoring systems, as ticktock.Listeners and
+// ticktock.RunSinks, for the deployments that can't scrape them.
+package metrics
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// StatsD pushes the metrics of the runs to a StatsD server over UDP.
+// Each event of a job is counted by its kind, and the durations of
+// the completed runs, including their retries, are timed:
+// 		<prefix>.<job>.started:1|c
+// 		<prefix>.<job>.failed:1|c
+// 		<prefix>.<job>.duration:1520|ms
+// The metrics are best effort, the ones that can't be sent are
+// dropped.
+// Example:
+// 		s := ticktock.New(ticktock.WithListener(metrics.NewStatsD("localhost:8125", "ticktock")))
+type StatsD struct {
+	prefix string
+	conn   *udpConn
+}
+
+// Returns a StatsD that sends the metrics to addr, with the names
+// prefixed by prefix, "ticktock" if it's empty.
+func NewStatsD(addr, prefix string) *StatsD {
+	if prefix == "" {
+		prefix = "ticktock"
+	}
+	return &StatsD{prefix: prefix, conn: &udpConn{addr: addr}}
+}
+
+// Sends the metrics of the event.
+func (s *StatsD) OnEvent(e ticktock.Event) {
+	if e.Job == "" {
+		return
+	}
+	name := s.prefix + "." + sanitize(e.Job) + "."
+	lines := name + sanitize(e.Kind.String()) + ":1|c"
+	if e.Kind == ticktock.EventSucceeded || e.Kind == ticktock.EventFailed {
+		lines += "\n" + name + "duration:" + millis(e.Duration) + "|ms"
+	}
+	s.conn.write(lines)
+}
+
+// Closes the connection to the server.
+func (s *StatsD) Close() error {
+	return s.conn.close()
+}
+
+// udpConn is dialed on the first write, and again after a failed
+// write.
+type udpConn struct {
+	addr string
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (c *udpConn) write(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		conn, err := net.Dial("udp", c.addr)
+		if err != nil {
+			return
+		}
+		c.conn = conn
+	}
+	if _, err := c.conn.Write([]byte(s)); err != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *udpConn) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Replaces the characters that aren't allowed in the segments of
+// the metric names, including the dots and the slashes of the
+// namespaced jobs, with underscores.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func millis(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64)
+}
@@ -0,0 +1,47 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+func TestStatsD(test *testing.T) {
+	addr, next := listenUDP(test)
+	s := NewStatsD(addr, "")
+	defer s.Close()
+
+	s.OnEvent(ticktock.Event{Kind: ticktock.EventStarted, Job: "acme/report.daily"})
+	if got, want := next(), "ticktock.acme_report_daily.started:1|c"; got != want {
+		test.Errorf("expected %v, found %v", want, got)
+	}
+	s.OnEvent(ticktock.Event{Kind: ticktock.EventFailed, Job: "report", Duration: 1520500 * time.Microsecond})
+	want := "ticktock.report.failed:1|c\nticktock.report.duration:1520.5|ms"
+	if got := next(); got != want {
+		test.Errorf("expected\n%v\nfound\n%v", want, got)
+	}
+
+	// the events of the scheduler itself are not sent
+	s.OnEvent(ticktock.Event{Kind: ticktock.EventClockStep})
+	s = NewStatsD(addr, "billing")
+	defer s.Close()
+	s.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: "report", Duration: 2 * time.Second})
+	if got, want := next(), "billing.report.succeeded:1|c\nbilling.report.duration:2000|ms"; got != want {
+		test.Errorf("expected\n%v\nfound\n%v", want, got)
+	}
+}
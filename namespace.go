@@ -0,0 +1,234 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// Quota limits the jobs of a namespace. Zero fields are unlimited.
+type Quota struct {
+	// MaxJobs is the number of the jobs the namespace can have.
+	MaxJobs int `json:"maxJobs,omitempty"`
+	// MaxConcurrent is the number of the runs of the namespace in
+	// progress at the same time. Runs over it wait for a slot.
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+	// MaxRetries caps the RetryCount of the jobs of the namespace.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// MaxLaunchesPerMinute limits the rate the runs of the namespace
+	// are launched at, the runs over it are delayed. Bursts of up
+	// to a minute's worth of runs are allowed.
+	MaxLaunchesPerMinute int `json:"maxLaunchesPerMinute,omitempty"`
+}
+
+// Namespace is a tenant-scoped view of a scheduler, so that each
+// customer of a shared scheduler can register their own schedules
+// within a quota. The jobs of a namespace are registered on the
+// scheduler as "<namespace>/<name>"; the namespace refers to them
+// by their names without the prefix.
+type Namespace struct {
+	s     *Scheduler
+	name  string
+	quota Quota
+	// limits the runs in progress, nil if there is no limit
+	sem chan struct{}
+	// limits the launches, nil if there is no limit
+	rate *tokenBucket
+	// serializes the registrations to enforce MaxJobs
+	mu sync.Mutex
+	// accessed atomically
+	running   int64
+	launched  uint64
+	throttled uint64
+}
+
+// Returns the namespace called name, creating it with the quota if
+// it doesn't exist. The quota of an existing namespace isn't changed.
+// name can't contain a slash.
+// Example:
+// 		ns := s.Namespace("acme", ticktock.Quota{MaxJobs: 100, MaxConcurrent: 4})
+// 		err := ns.Schedule("report", job, &t.When{Every: t.Every(1).Hours()})
+func (s *Scheduler) Namespace(name string, q Quota) *Namespace {
+	if name == "" || strings.Contains(name, "/") {
+		panic(fmt.Sprintf("ticktock: not a valid namespace name: %q", name))
+	}
+	s.nsMu.Lock()
+	defer s.nsMu.Unlock()
+	if ns, ok := s.namespaces[name]; ok {
+		return ns
+	}
+	ns := &Namespace{s: s, name: name, quota: q, rate: newTokenBucket(q.MaxLaunchesPerMinute)}
+	if q.MaxConcurrent > 0 {
+		ns.sem = make(chan struct{}, q.MaxConcurrent)
+	}
+	if s.namespaces == nil {
+		s.namespaces = make(map[string]*Namespace)
+	}
+	s.namespaces[name] = ns
+	return ns
+}
+
+// Returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// Returns the quota of the namespace.
+func (ns *Namespace) Quota() Quota {
+	return ns.quota
+}
+
+// Schedules a job called name in the namespace, with the defaults
+// of the scheduler. See Scheduler.Schedule.
+func (ns *Namespace) Schedule(name string, job Job, when *t.When) error {
+	return ns.ScheduleWithOpts(name, job, ns.s.defaultOpts(when))
+}
+
+// Schedules a job called name in the namespace. Returns an error if
+// the namespace has as many jobs as its quota allows. The RetryCount
+// of opts is capped by the quota.
+func (ns *Namespace) ScheduleWithOpts(name string, job Job, opts *t.Opts) error {
+	opts = ns.capRetries(opts)
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if max := ns.quota.MaxJobs; max > 0 && len(ns.jobNames()) >= max {
+		return fmt.Errorf("the namespace %v has reached its quota of %v jobs", ns.name, max)
+	}
+	return ns.s.register(ns.qualify(name), job, opts, ns)
+}
+
+// Returns opts with the RetryCount capped by the quota.
+func (ns *Namespace) capRetries(opts *t.Opts) *t.Opts {
+	if max := ns.quota.MaxRetries; max > 0 && opts.RetryCount > max {
+		o := *opts
+		o.RetryCount = max
+		return &o
+	}
+	return opts
+}
+
+// Cancels the job called name in the namespace. See Scheduler.Cancel.
+func (ns *Namespace) Cancel(name string) {
+	if j, ok := ns.s.jobs.get(ns.qualify(name)); ok && j.ns == ns {
+		ns.s.Cancel(j.name)
+	}
+}
+
+// Runs the job called name in the namespace immediately.
+func (ns *Namespace) Trigger(name string) error {
+	if j, ok := ns.s.jobs.get(ns.qualify(name)); ok && j.ns == ns {
+		return ns.s.Trigger(j.name)
+	}
+	return errors.New("no job exists with the name provided")
+}
+
+// Returns the status of the job called name in the namespace,
+// reports false if there is no such job.
+func (ns *Namespace) Status(name string) (JobStatus, bool) {
+	if j, ok := ns.s.jobs.get(ns.qualify(name)); ok && j.ns == ns {
+		st, ok := ns.s.Status(j.name)
+		st.Name = name
+		return st, ok
+	}
+	return JobStatus{}, false
+}
+
+// Returns the statuses of the jobs of the namespace, sorted by name.
+func (ns *Namespace) Jobs() []JobStatus {
+	names := ns.jobNames()
+	sort.Strings(names)
+	statuses := make([]JobStatus, 0, len(names))
+	for _, name := range names {
+		if st, ok := ns.s.Status(name); ok {
+			st.Name = strings.TrimPrefix(name, ns.name+"/")
+			statuses = append(statuses, st)
+		}
+	}
+	return statuses
+}
+
+// NamespaceStats is the consumption of the quota of a namespace.
+type NamespaceStats struct {
+	Name  string `json:"name"`
+	Quota Quota  `json:"quota"`
+	Jobs  int    `json:"jobs"`
+	// Running is the number of the runs in progress.
+	Running int `json:"running"`
+	// Launched is the number of the runs launched, and Throttled
+	// the number of those delayed by MaxLaunchesPerMinute.
+	Launched  uint64 `json:"launched"`
+	Throttled uint64 `json:"throttled"`
+}
+
+// Returns the consumption of the quota of the namespace.
+func (ns *Namespace) Stats() NamespaceStats {
+	return NamespaceStats{
+		Name:      ns.name,
+		Quota:     ns.quota,
+		Jobs:      len(ns.jobNames()),
+		Running:   int(atomic.LoadInt64(&ns.running)),
+		Launched:  atomic.LoadUint64(&ns.launched),
+		Throttled: atomic.LoadUint64(&ns.throttled),
+	}
+}
+
+// Waits for the launch rate and a slot of the namespace, reports
+// false if ctx is done in the meantime. The slot is released by
+// calling done.
+func (ns *Namespace) acquire(ctx context.Context) (done func(), ok bool) {
+	if wait := ns.rate.reserve(ns.s.now()); wait > 0 {
+		atomic.AddUint64(&ns.throttled, 1)
+		elapsed := make(chan struct{})
+		timer := ns.s.clk().AfterFunc(wait, func() { close(elapsed) })
+		select {
+		case <-elapsed:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false
+		}
+	}
+	if ns.sem != nil {
+		select {
+		case ns.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+	atomic.AddUint64(&ns.launched, 1)
+	atomic.AddInt64(&ns.running, 1)
+	return func() {
+		atomic.AddInt64(&ns.running, -1)
+		if ns.sem != nil {
+			<-ns.sem
+		}
+	}, true
+}
+
+// Returns the qualified names of the jobs of the namespace.
+func (ns *Namespace) jobNames() []string {
+	return ns.s.jobs.names(func(j *jobC) bool { return j.ns == ns })
+}
+
+func (ns *Namespace) qualify(name string) string {
+	return ns.name + "/" + name
+}
@@ -0,0 +1,231 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// Logger logs the failures of a scheduler. *log.Logger
+// implements it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Store persists the last runs of the jobs, so jobs pick up
+// their schedules where they left off across restarts.
+type Store interface {
+	// LastRun returns the last run of the job called name,
+	// the zero time if it has never run.
+	LastRun(name string) (time.Time, error)
+	SetLastRun(name string, tm time.Time) error
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// Creates a scheduler with the options. The zero value of
+// Scheduler is also ready to use, with the default options.
+func New(opts ...Option) *Scheduler {
+	s := &Scheduler{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.aging > 0 && s.capacity != nil {
+		s.capacity.prioritize(s.aging, s.now)
+	}
+	return s
+}
+
+// Sets the clock of the scheduler, the system clock by default.
+func WithClock(c Clock) Option {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// Sets the logger the failures are logged with. Failures are
+// not logged by default.
+func WithLogger(l Logger) Option {
+	return func(s *Scheduler) {
+		s.logger = l
+	}
+}
+
+// Sets the location the At, On and Cron of the schedules are
+// interpreted in, time.Local by default. Jobs can override it
+// with Opts.Location.
+func WithLocation(loc *time.Location) Option {
+	return func(s *Scheduler) {
+		s.loc = loc
+	}
+}
+
+// Limits the number of runs in progress at the same time. Runs
+// over the limit wait for a slot. No limit if n is zero.
+func WithMaxConcurrent(n int) Option {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.sem = make(chan struct{}, n)
+		} else {
+			s.sem = nil
+		}
+	}
+}
+
+// Limits the total weight of the runs in progress at the same time
+// to n, with the runs weighing their Opts.Weight. Runs over the
+// capacity wait for the runs in progress to complete, in order;
+// a run weighing more than n waits to run alone. Unlike
+// WithMaxConcurrent, heavy jobs don't all start at once.
+// No limit if n is zero.
+// Example:
+// 		s := ticktock.New(ticktock.WithCapacity(10))
+// 		s.ScheduleWithOpts("export", job, &t.Opts{When: when, Weight: 4})
+func WithCapacity(n int) Option {
+	return func(s *Scheduler) {
+		if n > 0 {
+			s.capacity = newWeighted(int64(n))
+		} else {
+			s.capacity = nil
+		}
+	}
+}
+
+// Serves the runs waiting for the capacity of the scheduler, see
+// WithCapacity, by the Priority of their jobs rather than in order.
+// A waiting run gains a level of priority for every aging it waits,
+// up to t.PriorityCritical, so the low priority runs eventually run
+// under a constant load of the high priority ones. aging is a
+// minute if it's zero. The aged priority of a waiting run is in
+// its JobStatus.
+// Example:
+// 		s := ticktock.New(ticktock.WithCapacity(4), ticktock.WithPriorityDispatch(30*time.Second))
+func WithPriorityDispatch(aging time.Duration) Option {
+	return func(s *Scheduler) {
+		if aging <= 0 {
+			aging = defaultPriorityAging
+		}
+		s.aging = aging
+	}
+}
+
+const defaultPriorityAging = time.Minute
+
+// Sets the default options of the jobs scheduled with Schedule,
+// such as RetryCount, Timeout, Jitter and the hooks. When and
+// Triggers of the defaults are ignored.
+func WithDefaults(opts *t.Opts) Option {
+	return func(s *Scheduler) {
+		s.defaults = opts
+	}
+}
+
+// Adds a listener receiving the events of the scheduler.
+func WithListener(l Listener) Option {
+	return func(s *Scheduler) {
+		s.listeners = append(s.listeners, l)
+	}
+}
+
+// Adds a sink receiving the canonical event of each run, see
+// RunEvent.
+func WithRunSink(sink RunSink) Option {
+	return func(s *Scheduler) {
+		s.runSinks = append(s.runSinks, sink)
+	}
+}
+
+// Puts the scheduler in the dry-run mode. The jobs are not run;
+// each run that would start is logged and emitted as an EventDryRun
+// with the time it was scheduled at. Useful to validate a set of
+// schedules before letting them run.
+func WithDryRun() Option {
+	return func(s *Scheduler) {
+		s.dryRun = true
+	}
+}
+
+// Sets how late a run can start before it's missed, a minute by
+// default. Runs are late if the process was stalled, or all at once
+// after the machine wakes up from sleep; instead of running them in
+// a burst, the missed runs follow the Misfire policy of their jobs.
+func WithMisfireThreshold(d time.Duration) Option {
+	return func(s *Scheduler) {
+		s.misfireAfter = d
+	}
+}
+
+// Limits the retries across all of the jobs to n per minute, so
+// a systemic outage doesn't multiply the load with retries. Once
+// the budget is exhausted, failed runs fail right away until the
+// budget refills. No limit if n is zero.
+func WithRetryBudget(n int) Option {
+	return func(s *Scheduler) {
+		s.retries = newTokenBucket(n)
+	}
+}
+
+// Sets the gate that defers the runs while the host is overloaded.
+// The runs of the jobs below t.PriorityCritical are skipped, or
+// postponed with respect to their Misfire, while g reports the host
+// overloaded. Each of them is emitted as an EventOverloaded.
+// Example:
+// 		s := ticktock.New(ticktock.WithLoadGate(ticktock.MaxCPU(0.9)))
+func WithLoadGate(g LoadGate) Option {
+	return func(s *Scheduler) {
+		s.load = g
+	}
+}
+
+// Sets the provider the secret://name placeholders in the built-in
+// job types are resolved with. See ResolveSecrets.
+func WithSecrets(p SecretsProvider) Option {
+	return func(s *Scheduler) {
+		s.secrets = p
+	}
+}
+
+// Sets the store the last runs are persisted to.
+func WithStore(st Store) Option {
+	return func(s *Scheduler) {
+		s.store = st
+	}
+}
+
+func (s *Scheduler) now() time.Time {
+	return s.clk().Now()
+}
+
+func (s *Scheduler) misfireThreshold() time.Duration {
+	if s.misfireAfter <= 0 {
+		return time.Minute
+	}
+	return s.misfireAfter
+}
+
+func (s *Scheduler) clk() Clock {
+	if s.clock == nil {
+		return realClock{}
+	}
+	return s.clock
+}
+
+func (s *Scheduler) logf(format string, v ...interface{}) {
+	if s.logger != nil {
+		s.logger.Printf(format, v...)
+	}
+}
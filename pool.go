@@ -0,0 +1,177 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a pool of workers shared by schedulers, so that the
+// libraries of a process that each create a scheduler of their own
+// don't run more jobs at once than the process can afford. The runs
+// of all of the schedulers sharing the pool take workers by their
+// Opts.Weight, and wait for them in order, regardless of the
+// scheduler they belong to.
+//
+// Workers can carry labels, such as "gpu" or "io". The jobs with an
+// Opts.Affinity run only on the workers carrying all of its labels,
+// the other jobs only on the workers without labels.
+type Pool struct {
+	mu     sync.RWMutex
+	groups []*workerGroup
+	// accessed atomically
+	running int64
+	waiting int64
+}
+
+// workerGroup is a set of the workers of a pool with the same labels.
+type workerGroup struct {
+	labels  []string
+	workers *weighted
+}
+
+// Returns a pool of n workers without labels, GOMAXPROCS workers
+// if n is zero or negative.
+// Example:
+// 		pool := ticktock.NewPool(8)
+// 		billing := ticktock.New(ticktock.WithPool(pool))
+// 		reports := ticktock.New(ticktock.WithPool(pool))
+func NewPool(n int) *Pool {
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	p := &Pool{}
+	p.AddWorkers(n)
+	return p
+}
+
+// Adds n workers carrying the labels to the pool.
+// Example:
+// 		pool.AddWorkers(2, "gpu")
+// 		s.ScheduleWithOpts("train", job, &t.Opts{When: when, Affinity: []string{"gpu"}})
+func (p *Pool) AddWorkers(n int, labels ...string) {
+	if n <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.groups = append(p.groups, &workerGroup{
+		labels:  append([]string(nil), labels...),
+		workers: newWeighted(int64(n)),
+	})
+}
+
+// PoolStats is the usage of a pool.
+type PoolStats struct {
+	Workers int `json:"workers"`
+	// Running is the number of the runs holding workers, and
+	// Waiting the number of those waiting for them.
+	Running int `json:"running"`
+	Waiting int `json:"waiting"`
+}
+
+// Returns the usage of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.RLock()
+	var workers int64
+	for _, g := range p.groups {
+		workers += g.workers.size
+	}
+	p.mu.RUnlock()
+	return PoolStats{
+		Workers: int(workers),
+		Running: int(atomic.LoadInt64(&p.running)),
+		Waiting: int(atomic.LoadInt64(&p.waiting)),
+	}
+}
+
+// Takes the workers for a run of the weight with the affinity, from
+// the first group of the workers that carry its labels with enough
+// free workers, or waits for the group with the fewest waiters.
+// Reports false if no workers carry the labels, or ctx is done in
+// the meantime. The workers are released by calling done.
+func (p *Pool) acquire(ctx context.Context, weight int64, affinity []string) (done func(), ok bool) {
+	p.mu.RLock()
+	var eligible []*workerGroup
+	for _, g := range p.groups {
+		if g.carries(affinity) {
+			eligible = append(eligible, g)
+		}
+	}
+	p.mu.RUnlock()
+	if len(eligible) == 0 {
+		return nil, false
+	}
+	var group *workerGroup
+	for _, g := range eligible {
+		if g.workers.tryAcquire(weight) {
+			group = g
+			break
+		}
+	}
+	if group == nil {
+		group = eligible[0]
+		for _, g := range eligible[1:] {
+			if g.workers.waiting() < group.workers.waiting() {
+				group = g
+			}
+		}
+		atomic.AddInt64(&p.waiting, 1)
+		ok := group.workers.acquire(ctx, weight)
+		atomic.AddInt64(&p.waiting, -1)
+		if !ok {
+			return nil, false
+		}
+	}
+	atomic.AddInt64(&p.running, 1)
+	return func() {
+		atomic.AddInt64(&p.running, -1)
+		group.workers.release(weight)
+	}, true
+}
+
+// Reports whether the group is eligible for the affinity: it carries
+// all of its labels, or has no labels if the affinity is empty.
+func (g *workerGroup) carries(affinity []string) bool {
+	if len(affinity) == 0 {
+		return len(g.labels) == 0
+	}
+	for _, label := range affinity {
+		found := false
+		for _, l := range g.labels {
+			if l == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs the jobs of the scheduler on the workers of the pool,
+// shared with the other schedulers. Scheduler-wide limits, such
+// as WithMaxConcurrent and WithCapacity, still apply; a run takes
+// a worker once it's within them. Clones share the pool.
+func WithPool(p *Pool) Option {
+	return func(s *Scheduler) {
+		s.pool = p
+	}
+}
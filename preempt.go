@@ -0,0 +1,135 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// ErrPreempted is the error of a run cancelled to make room for the
+// run of a critical job. See WithPreemption.
+var ErrPreempted = errors.New("ticktock: the run was preempted by a critical job")
+
+// Lets the runs of the t.PriorityCritical jobs preempt the runs of
+// the Preemptible jobs, for the maintenance windows that can't wait
+// for the runs in progress to complete. A critical run that doesn't
+// fit into the capacity of the scheduler, see WithCapacity, cancels
+// the context of the preemptible runs in progress, of the lowest
+// priority and the latest started first, until it fits. Each of the
+// preempted runs fails with ErrPreempted, is emitted as an
+// EventPreempted, and is run again. With WithPriorityDispatch, the
+// critical run takes the freed capacity before the waiting runs of
+// the lower priorities.
+// Example:
+// 		s := ticktock.New(ticktock.WithCapacity(4), ticktock.WithPreemption())
+// 		s.ScheduleWithOpts("backup", job, &t.Opts{When: when, Preemptible: true})
+// 		s.ScheduleWithOpts("failover", job, &t.Opts{When: when, Priority: t.PriorityCritical})
+func WithPreemption() Option {
+	return func(s *Scheduler) {
+		s.preemption = true
+	}
+}
+
+// preemptible is a run in progress of a preemptible job.
+type preemptible struct {
+	j       *jobC
+	id      string
+	weight  int64
+	started time.Time
+	cancel  context.CancelFunc
+	flag    int32 // set atomically once preempted
+}
+
+func (r *preemptible) preempted() bool {
+	return r != nil && atomic.LoadInt32(&r.flag) == 1
+}
+
+// Tracks the run of the job as preemptible, until it's untracked.
+func (s *Scheduler) track(j *jobC, id string, weight int64, cancel context.CancelFunc) *preemptible {
+	r := &preemptible{j: j, id: id, weight: weight, started: s.now(), cancel: cancel}
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+	if s.preemptibles == nil {
+		s.preemptibles = make(map[*preemptible]struct{})
+	}
+	s.preemptibles[r] = struct{}{}
+	return r
+}
+
+func (s *Scheduler) untrack(r *preemptible) {
+	s.pmu.Lock()
+	defer s.pmu.Unlock()
+	delete(s.preemptibles, r)
+}
+
+// Preempts the preemptible runs in progress to free the weight for
+// the run of the critical job called by, if there are enough.
+func (s *Scheduler) preempt(weight int64, by string) {
+	s.pmu.Lock()
+	var runs []*preemptible
+	for r := range s.preemptibles {
+		if r.j.opts.Priority < t.PriorityCritical && !r.preempted() {
+			runs = append(runs, r)
+		}
+	}
+	sort.Slice(runs, func(i, k int) bool {
+		if pi, pk := runs[i].j.opts.Priority, runs[k].j.opts.Priority; pi != pk {
+			return pi < pk
+		}
+		return runs[i].started.After(runs[k].started)
+	})
+	var preempted []*preemptible
+	for _, r := range runs {
+		if weight <= 0 {
+			break
+		}
+		atomic.StoreInt32(&r.flag, 1)
+		r.cancel()
+		weight -= r.weight
+		preempted = append(preempted, r)
+	}
+	s.pmu.Unlock()
+	for _, r := range preempted {
+		s.logf("ticktock: preempted the run %v of %v for %v", r.id, r.j.name, by)
+		s.emit(Event{Kind: EventPreempted, Job: r.j.name, RunID: r.id, Time: s.now(), Jobs: []string{by}})
+	}
+}
+
+// Acquires the weight of the capacity for a run of the job, preempting
+// the preemptible runs if the job is critical and it doesn't fit.
+// Reports false if ctx is done in the meantime.
+func (j *jobC) acquireCapacity(ctx context.Context, c *weighted, weight int64) bool {
+	s := j.scheduler
+	if s.preemption && j.opts.Priority >= t.PriorityCritical {
+		if c.tryAcquire(weight) {
+			return true
+		}
+		s.preempt(c.shortfall(weight), j.name)
+	}
+	j.mu.Lock()
+	j.waitingSince = s.now()
+	j.mu.Unlock()
+	ok := c.acquirePriority(ctx, weight, j.opts.Priority)
+	j.mu.Lock()
+	j.waitingSince = time.Time{}
+	j.mu.Unlock()
+	return ok
+}
@@ -0,0 +1,212 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"sync"
+)
+
+const shardCount = 32
+
+// registry holds the jobs of a scheduler by name. It's sharded by
+// the hash of the names, so registrations from many goroutines don't
+// contend on a single lock. The zero value is ready to use.
+type registry struct {
+	shards [shardCount]shard
+}
+
+type shard struct {
+	mu   sync.Mutex
+	jobs map[string]*jobC
+}
+
+// Returns the shard of name.
+func (r *registry) shard(name string) *shard {
+	return &r.shards[r.index(name)]
+}
+
+// Returns the index of the shard of name, using FNV-1a.
+func (r *registry) index(name string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		h ^= uint32(name[i])
+		h *= 16777619
+	}
+	return h % shardCount
+}
+
+// Returns the job called name.
+func (r *registry) get(name string) (*jobC, bool) {
+	sh := r.shard(name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	j, ok := sh.jobs[name]
+	return j, ok
+}
+
+// Adds the job, false if a job already exists with its name.
+func (r *registry) insert(j *jobC) bool {
+	sh := r.shard(j.name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.jobs[j.name]; ok {
+		return false
+	}
+	r.put(j)
+	return true
+}
+
+// Adds the job, replacing the job with its name. Returns the
+// replaced job, nil if there is none. The job is kept in the
+// namespace of the replaced one.
+func (r *registry) replace(j *jobC) *jobC {
+	sh := r.shard(j.name)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	old := sh.jobs[j.name]
+	if old != nil {
+		j.ns = old.ns
+	}
+	r.put(j)
+	return old
+}
+
+// Adds all of the jobs, or none of them if a job already exists with
+// the name of one. Returns the name that exists.
+func (r *registry) insertAll(jobs []*jobC) (string, bool) {
+	names := make([]string, len(jobs))
+	for i, j := range jobs {
+		names[i] = j.name
+	}
+	defer r.lock(names...)()
+	for _, j := range jobs {
+		if _, ok := r.shard(j.name).jobs[j.name]; ok {
+			return j.name, false
+		}
+	}
+	for _, j := range jobs {
+		r.put(j)
+	}
+	return "", true
+}
+
+// Replaces the job old with j, registered with another name. Reports
+// false if old is no longer registered, or a job exists with the
+// name of j.
+func (r *registry) move(old, j *jobC) bool {
+	defer r.lock(old.name, j.name)()
+	if r.shard(old.name).jobs[old.name] != old {
+		return false
+	}
+	if _, ok := r.shard(j.name).jobs[j.name]; ok {
+		return false
+	}
+	delete(r.shard(old.name).jobs, old.name)
+	r.put(j)
+	return true
+}
+
+// Adds the job, the lock of its shard must be held.
+func (r *registry) put(j *jobC) {
+	sh := r.shard(j.name)
+	if sh.jobs == nil {
+		sh.jobs = make(map[string]*jobC)
+	}
+	sh.jobs[j.name] = j
+}
+
+// Locks the shards of the names and returns a func that unlocks
+// them. The shards are locked in order, so the goroutines locking
+// several of them don't deadlock.
+func (r *registry) lock(names ...string) func() {
+	var locked [shardCount]bool
+	for _, name := range names {
+		locked[r.index(name)] = true
+	}
+	for i := range r.shards {
+		if locked[i] {
+			r.shards[i].mu.Lock()
+		}
+	}
+	return func() {
+		for i := range r.shards {
+			if locked[i] {
+				r.shards[i].mu.Unlock()
+			}
+		}
+	}
+}
+
+// Returns all of the jobs.
+func (r *registry) all() []*jobC {
+	var jobs []*jobC
+	for i := range r.shards {
+		sh := &r.shards[i]
+		sh.mu.Lock()
+		for _, j := range sh.jobs {
+			jobs = append(jobs, j)
+		}
+		sh.mu.Unlock()
+	}
+	return jobs
+}
+
+// Removes and returns all of the jobs.
+func (r *registry) clear() []*jobC {
+	var jobs []*jobC
+	for i := range r.shards {
+		sh := &r.shards[i]
+		sh.mu.Lock()
+		for _, j := range sh.jobs {
+			jobs = append(jobs, j)
+		}
+		sh.jobs = nil
+		sh.mu.Unlock()
+	}
+	return jobs
+}
+
+// Returns the names of the jobs f is true for.
+func (r *registry) names(f func(*jobC) bool) []string {
+	var names []string
+	for i := range r.shards {
+		sh := &r.shards[i]
+		sh.mu.Lock()
+		for name, j := range sh.jobs {
+			if f(j) {
+				names = append(names, name)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return names
+}
+
+// Removes and returns the jobs f is true for.
+func (r *registry) removeFunc(f func(*jobC) bool) []*jobC {
+	var jobs []*jobC
+	for i := range r.shards {
+		sh := &r.shards[i]
+		sh.mu.Lock()
+		for name, j := range sh.jobs {
+			if f(j) {
+				jobs = append(jobs, j)
+				delete(sh.jobs, name)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return jobs
+}
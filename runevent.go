@@ -0,0 +1,134 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// RunEvent is the canonical event of a run, emitted once the run is
+// completed with everything known about it, for the analysis of the
+// runs by any of their fields.
+type RunEvent struct {
+	Job       string `json:"job"`
+	Namespace string `json:"namespace,omitempty"`
+	RunID     string `json:"runId"`
+	Host      string `json:"host"`
+	// Scheduled is the time the run was scheduled or triggered at,
+	// Dispatched the time it started waiting for the capacity, and
+	// Started and Finished the times its first attempt started and
+	// its last one finished.
+	Scheduled  time.Time `json:"scheduled"`
+	Dispatched time.Time `json:"dispatched"`
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	// Delay is how late the run was dispatched, Wait how long it
+	// waited for the capacity, and Duration how long it took,
+	// including its retries.
+	Delay    time.Duration `json:"delay"`
+	Wait     time.Duration `json:"wait"`
+	Duration time.Duration `json:"duration"`
+	Attempts int           `json:"attempts"`
+	// SLOViolated is true if the run took longer than the
+	// DurationSLO of the job.
+	SLOViolated bool `json:"sloViolated,omitempty"`
+	// Outcome is "succeeded", "failed", "preempted" or "cancelled".
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+	// PayloadSize is the size of the payload the run was triggered
+	// with, see TriggerWithPayload.
+	PayloadSize int               `json:"payloadSize,omitempty"`
+	Priority    int               `json:"priority"`
+	Weight      int               `json:"weight"`
+	Tags        []string          `json:"tags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// RunSink receives the canonical events of the runs. Emit is called
+// synchronously from the goroutines of the runs, it should return
+// quickly.
+type RunSink interface {
+	Emit(e RunEvent)
+}
+
+// RunSinkFunc adapts an ordinary function to a RunSink, e.g. to
+// publish the events to Kafka with a producer.
+type RunSinkFunc func(e RunEvent)
+
+// Calls f with e.
+func (f RunSinkFunc) Emit(e RunEvent) {
+	f(e)
+}
+
+// Returns a RunSink that writes the events to w as JSON, one per
+// line.
+// Example:
+// 		s := ticktock.New(ticktock.WithRunSink(ticktock.JSONRunSink(os.Stdout)))
+func JSONRunSink(w io.Writer) RunSink {
+	return &jsonRunSink{enc: json.NewEncoder(w)}
+}
+
+type jsonRunSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *jsonRunSink) Emit(e RunEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(e)
+}
+
+// Emits the canonical event of the completed run.
+func (j *jobC) emitRun(e RunEvent, params interface{}, preempted bool, err error) {
+	sinks := j.scheduler.runSinks
+	if len(sinks) == 0 {
+		return
+	}
+	e.Job, e.Host = j.name, hostname()
+	if j.ns != nil {
+		e.Namespace = j.ns.name
+	}
+	e.Delay = e.Dispatched.Sub(e.Scheduled)
+	e.Wait = e.Started.Sub(e.Dispatched)
+	e.Duration = e.Finished.Sub(e.Started)
+	e.SLOViolated = j.opts.DurationSLO > 0 && e.Duration > j.opts.DurationSLO
+	switch {
+	case err == nil:
+		e.Outcome = "succeeded"
+	case preempted:
+		e.Outcome = "preempted"
+	case j.isCancelled() || errors.Is(err, context.Canceled):
+		e.Outcome = "cancelled"
+	default:
+		e.Outcome = "failed"
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if p, ok := params.([]byte); ok {
+		e.PayloadSize = len(p)
+	}
+	e.Priority, e.Weight = j.opts.Priority, int(j.weight())
+	e.Tags, e.Metadata = j.opts.Tags, j.opts.Metadata
+	for _, s := range sinks {
+		s.Emit(e)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// SecretsProvider resolves the secrets the jobs refer to by name,
+// e.g. from a secrets manager. It's consulted at run time, so the
+// secrets aren't stored in plaintext config.
+type SecretsProvider interface {
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// SecretsFunc is a func as a SecretsProvider.
+type SecretsFunc func(ctx context.Context, name string) (string, error)
+
+func (f SecretsFunc) Secret(ctx context.Context, name string) (string, error) {
+	return f(ctx, name)
+}
+
+type secretsKey struct{}
+
+// A placeholder of a secret, e.g. secret://db-password or
+// secret://database/creds/app#password.
+var secretRef = regexp.MustCompile(`secret://[A-Za-z0-9_.\-/#]+`)
+
+// Replaces the secret://name placeholders in s with the secrets
+// of the provider of the scheduler, resolved from the context of
+// a run. Returns s as is if it has no placeholders, and an error
+// if it does but the scheduler has no provider.
+// Example:
+// 		dsn, err := ticktock.ResolveSecrets(ctx, "postgres://app:secret://db-password@db/app")
+func ResolveSecrets(ctx context.Context, s string) (string, error) {
+	if !secretRef.MatchString(s) {
+		return s, nil
+	}
+	p, _ := ctx.Value(secretsKey{}).(SecretsProvider)
+	if p == nil {
+		return "", errors.New("no secrets provider to resolve the secrets")
+	}
+	var err error
+	resolved := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		var secret string
+		secret, err = p.Secret(ctx, ref[len("secret://"):])
+		return secret
+	})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
@@ -0,0 +1,269 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sentry reports the final failures of the runs of a
+// scheduler to Sentry, as a ticktock.Listener.
+package sentry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock"
+)
+
+// Reporter captures the final failures of the runs into Sentry, with
+// the name of the job, the ID of the run and the errors of its
+// attempts. The failures of the jobs that panicked carry the stack
+// trace of the panic. The reports are sent in the background,
+// OnEvent doesn't wait for them.
+// Example:
+// 		r := &sentry.Reporter{DSN: os.Getenv("SENTRY_DSN"), Environment: "prod"}
+// 		defer r.Close()
+// 		s := ticktock.New(ticktock.WithListener(r))
+type Reporter struct {
+	// DSN of the Sentry project, as in
+	// https://<key>@o0.ingest.sentry.io/<project>.
+	DSN string
+	// Environment, Release and ServerName are set on the events,
+	// optional.
+	Environment, Release, ServerName string
+	// OnError is called with the errors of sending the reports,
+	// optional.
+	OnError func(err error)
+	// Client sends the reports, http.DefaultClient if nil.
+	Client *http.Client
+
+	mu sync.Mutex
+	// the failed attempts of the runs in progress by run ID
+	attempts map[string][]attempt
+	wg       sync.WaitGroup
+}
+
+type attempt struct {
+	Attempt int       `json:"attempt"`
+	Time    time.Time `json:"time"`
+	Error   string    `json:"error"`
+}
+
+// Records the failed attempts of the runs, and reports the runs that
+// fail after their retries.
+func (r *Reporter) OnEvent(e ticktock.Event) {
+	switch e.Kind {
+	case ticktock.EventRetrying:
+		r.mu.Lock()
+		if r.attempts == nil {
+			r.attempts = make(map[string][]attempt)
+		}
+		r.attempts[e.RunID] = append(r.attempts[e.RunID], attempt{Attempt: e.Attempt - 1, Time: e.Time, Error: errString(e.Err)})
+		r.mu.Unlock()
+	case ticktock.EventSucceeded:
+		r.mu.Lock()
+		delete(r.attempts, e.RunID)
+		r.mu.Unlock()
+	case ticktock.EventFailed:
+		r.mu.Lock()
+		attempts := r.attempts[e.RunID]
+		delete(r.attempts, e.RunID)
+		r.mu.Unlock()
+		attempts = append(attempts, attempt{Attempt: e.Attempt, Time: time.Now(), Error: errString(e.Err)})
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			if err := r.report(context.Background(), e, attempts); err != nil && r.OnError != nil {
+				r.OnError(err)
+			}
+		}()
+	}
+}
+
+// Waits for the reports in progress to be sent.
+func (r *Reporter) Close() error {
+	r.wg.Wait()
+	return nil
+}
+
+// The event of Sentry, see https://develop.sentry.dev/sdk/event-payloads/.
+type event struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Logger      string                 `json:"logger"`
+	Transaction string                 `json:"transaction"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	ServerName  string                 `json:"server_name,omitempty"`
+	Fingerprint []string               `json:"fingerprint"`
+	Tags        map[string]string      `json:"tags"`
+	Extra       map[string]interface{} `json:"extra"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+// Sends the failure of the run of the event, with the attempts made,
+// to Sentry.
+func (r *Reporter) report(ctx context.Context, e ticktock.Event, attempts []attempt) error {
+	u, err := url.Parse(r.DSN)
+	if err != nil || u.User == nil {
+		return errors.New("sentry: not a valid DSN is provided")
+	}
+	project := strings.TrimPrefix(u.Path, "/")
+	endpoint := u.Scheme + "://" + u.Host + "/api/" + project + "/envelope/"
+
+	ev := event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "ticktock",
+		Transaction: e.Job,
+		Environment: r.Environment,
+		Release:     r.Release,
+		ServerName:  r.ServerName,
+		Fingerprint: []string{"ticktock", e.Job},
+		Tags:        map[string]string{"job": e.Job, "run_id": e.RunID},
+		Extra: map[string]interface{}{
+			"started":  e.Time,
+			"duration": e.Duration.String(),
+			"attempts": attempts,
+		},
+	}
+	ex := exception{Type: fmt.Sprintf("%T", e.Err), Value: errString(e.Err)}
+	var pe *ticktock.PanicError
+	if errors.As(e.Err, &pe) {
+		ex.Type = "panic"
+		ex.Stacktrace = &stacktrace{Frames: parseStack(pe.Stack)}
+	}
+	ev.Exception.Values = []exception{ex}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"dsn":%q}`+"\n", ev.EventID, r.DSN)
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteString("\n")
+
+	req, err := http.NewRequest("POST", endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=ticktock/1.0, sentry_key="+u.User.Username())
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("sentry: reporting %v failed with %v: %s", e.Job, resp.Status, msg)
+	}
+	return nil
+}
+
+// Parses the frames of a stack trace formatted by debug.Stack, from
+// the panic on, the outermost first as Sentry expects them.
+func parseStack(stack []byte) []frame {
+	var frames []frame
+	sc := bufio.NewScanner(bytes.NewReader(stack))
+	var fn string
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, "\t") {
+			// the function, or the goroutine header
+			if strings.HasPrefix(line, "created by ") {
+				fn = strings.TrimPrefix(line, "created by ")
+				if i := strings.Index(fn, " in goroutine"); i > 0 {
+					fn = fn[:i]
+				}
+			} else if i := strings.LastIndex(line, "("); i > 0 {
+				fn = line[:i]
+			}
+			continue
+		}
+		loc := strings.TrimSpace(line)
+		if i := strings.LastIndex(loc, " +0x"); i > 0 {
+			loc = loc[:i]
+		}
+		i := strings.LastIndex(loc, ":")
+		if i < 0 {
+			continue
+		}
+		n, _ := strconv.Atoi(loc[i+1:])
+		frames = append(frames, frame{Function: fn, Filename: loc[:i], Lineno: n})
+	}
+	// the frames of the recovery, up to the panic
+	for i, f := range frames {
+		if f.Function == "panic" {
+			frames = frames[i+1:]
+			break
+		}
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
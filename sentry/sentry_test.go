@@ -0,0 +1,146 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sentry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock"
+	"github.com/rakyll/ticktock/t"
+)
+
+// fakeTransport records the envelopes sent to Sentry.
+type fakeTransport struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	events   []event
+}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	// the envelope header, the item header and the event
+	lines := bytes.Split(bytes.TrimSuffix(b, []byte("\n")), []byte("\n"))
+	if len(lines) != 3 {
+		return nil, errors.New("unexpected envelope: " + string(b))
+	}
+	var ev event
+	if err := json.Unmarshal(lines[2], &ev); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.events = append(f.events, ev)
+	f.mu.Unlock()
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}")), Request: req}, nil
+}
+
+func newReporter() (*Reporter, *fakeTransport) {
+	ft := &fakeTransport{}
+	return &Reporter{
+		DSN:         "https://key@o0.ingest.sentry.io/42",
+		Environment: "prod",
+		Client:      &http.Client{Transport: ft},
+		OnError:     func(err error) { panic(err) },
+	}, ft
+}
+
+// Tests if the failed runs are reported with the errors of their
+// attempts, and the runs that succeed after a retry are skipped.
+func TestReporter(test *testing.T) {
+	r, ft := newReporter()
+	r.OnEvent(ticktock.Event{Kind: ticktock.EventRetrying, Job: "report", RunID: "r1", Attempt: 2, Err: errors.New("timeout")})
+	r.OnEvent(ticktock.Event{Kind: ticktock.EventFailed, Job: "report", RunID: "r1", Attempt: 2, Err: errors.New("refused")})
+	// the runs that succeed after a retry aren't reported
+	r.OnEvent(ticktock.Event{Kind: ticktock.EventRetrying, Job: "sync", RunID: "r2", Attempt: 2, Err: errors.New("timeout")})
+	r.OnEvent(ticktock.Event{Kind: ticktock.EventSucceeded, Job: "sync", RunID: "r2"})
+	r.Close()
+
+	if len(ft.events) != 1 {
+		test.Fatalf("expected a report of the failed run only, found %v", len(ft.events))
+	}
+	req, ev := ft.requests[0], ft.events[0]
+	if req.URL.String() != "https://o0.ingest.sentry.io/api/42/envelope/" {
+		test.Errorf("unexpected endpoint: %v", req.URL)
+	}
+	if auth := req.Header.Get("X-Sentry-Auth"); !strings.Contains(auth, "sentry_key=key") {
+		test.Errorf("expected the key of the DSN, found %q", auth)
+	}
+	if ev.Tags["job"] != "report" || ev.Tags["run_id"] != "r1" {
+		test.Errorf("unexpected tags: %v", ev.Tags)
+	}
+	if len(ev.Fingerprint) != 2 || ev.Fingerprint[0] != "ticktock" || ev.Fingerprint[1] != "report" {
+		test.Errorf("expected the failures to be grouped by the job, found %v", ev.Fingerprint)
+	}
+	if ev.Environment != "prod" || ev.Transaction != "report" || ev.Level != "error" {
+		test.Errorf("unexpected event: %+v", ev)
+	}
+	if vs := ev.Exception.Values; len(vs) != 1 || vs[0].Value != "refused" || vs[0].Stacktrace != nil {
+		test.Errorf("unexpected exception: %+v", vs)
+	}
+	attempts, _ := ev.Extra["attempts"].([]interface{})
+	if len(attempts) != 2 || attempts[0].(map[string]interface{})["error"] != "timeout" {
+		test.Errorf("expected the errors of both of the attempts, found %v", ev.Extra["attempts"])
+	}
+}
+
+// Tests if the panics of the jobs are reported with their stack
+// traces, as the listener of a scheduler.
+func TestReporter_Panic(test *testing.T) {
+	r, ft := newReporter()
+	sh := ticktock.New(ticktock.WithListener(r))
+	sh.Schedule("panics", &panicJob{}, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("panics")
+	for i := 0; i < 100; i++ {
+		ft.mu.Lock()
+		n := len(ft.events)
+		ft.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	r.Close()
+	ft.mu.Lock()
+	defer ft.mu.Unlock()
+	if len(ft.events) != 1 {
+		test.Fatalf("expected the panic to be reported, found %v reports", len(ft.events))
+	}
+	ex := ft.events[0].Exception.Values[0]
+	if ex.Type != "panic" || ex.Stacktrace == nil || len(ex.Stacktrace.Frames) == 0 {
+		test.Fatalf("expected the stack trace of the panic, found %+v", ex)
+	}
+	if last := ex.Stacktrace.Frames[len(ex.Stacktrace.Frames)-1]; !strings.HasSuffix(last.Function, "panicJob.Run") {
+		test.Errorf("expected the panicking func as the innermost frame, found %+v", last)
+	}
+}
+
+type panicJob struct{}
+
+func (panicJob) Run() error {
+	panic("boom")
+}
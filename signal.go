@@ -0,0 +1,98 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Triggers the job called name on the default scheduler
+// each time the process receives sig.
+func TriggerOnSignal(sig os.Signal, name string) error {
+	return defaultScheduler.TriggerOnSignal(sig, name)
+}
+
+// Triggers the job called name each time the process receives
+// sig, until the job is cancelled. The binding carries over to
+// the job that replaces it by Upsert. Returns an error if there
+// is no such job.
+// Example:
+// 		s.TriggerOnSignal(syscall.SIGUSR1, "rotate-logs")
+func (s *Scheduler) TriggerOnSignal(sig os.Signal, name string) error {
+	j, ok := s.jobs.get(name)
+	if !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				s.Trigger(name)
+			case <-j.context().Done():
+				// the job is cancelled, or replaced
+				next, ok := s.jobs.get(name)
+				if !ok || next == j {
+					return
+				}
+				j = next
+			}
+		}
+	}()
+	return nil
+}
+
+// Starts the scheduler and blocks until the process receives SIGTERM
+// or SIGINT, or the scheduler has no jobs left to run, in which case
+// it returns nil. On a signal, it stops the scheduler and waits for
+// the in-flight runs to complete, up to drainTimeout. If they don't complete in
+// time, or another signal is received meanwhile, their contexts are
+// cancelled and an error is returned without waiting further.
+// Example:
+// 		if err := ticktock.RunUntilSignal(s, 30*time.Second); err != nil {
+// 			log.Fatal(err)
+// 		}
+func RunUntilSignal(s *Scheduler, drainTimeout time.Duration) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(c)
+	done := make(chan struct{})
+	go func() {
+		s.Start()
+		close(done)
+	}()
+	select {
+	case <-c:
+	case <-done:
+		return nil
+	}
+	s.Stop()
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+	case <-c:
+	}
+	go s.CancelAll()
+	return errors.New("ticktock: the in-flight runs didn't complete in time")
+}
@@ -0,0 +1,204 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// jobSpec is the serializable definition of a job.
+type jobSpec struct {
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Opts   specOpts        `json:"opts"`
+}
+
+// specOpts are the serializable fields of t.Opts.
+type specOpts struct {
+	When          *t.When           `json:"when"`
+	Interrupt     bool              `json:"interrupt,omitempty"`
+	Misfire       int               `json:"misfire,omitempty"`
+	Semantics     int               `json:"semantics,omitempty"`
+	Overlap       int               `json:"overlap,omitempty"`
+	Splay         time.Duration     `json:"splay,omitempty"`
+	AlignTo       int               `json:"alignTo,omitempty"`
+	IntervalMode  int               `json:"intervalMode,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Jitter        time.Duration     `json:"jitter,omitempty"`
+	Priority      int               `json:"priority,omitempty"`
+	Weight        int               `json:"weight,omitempty"`
+	Affinity      []string          `json:"affinity,omitempty"`
+	Preemptible   bool              `json:"preemptible,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	RetryCount    int               `json:"retryCount,omitempty"`
+	RetryDelay    time.Duration     `json:"retryDelay,omitempty"`
+	RetryDeadline time.Duration     `json:"retryDeadline,omitempty"`
+	Timeout       time.Duration     `json:"timeout,omitempty"`
+	SoftTimeout   time.Duration     `json:"softTimeout,omitempty"`
+	DurationSLO   time.Duration     `json:"durationSLO,omitempty"`
+	HistorySize   int               `json:"historySize,omitempty"`
+	HistoryAge    time.Duration     `json:"historyAge,omitempty"`
+}
+
+func newSpecOpts(o *t.Opts) specOpts {
+	when := *o.When
+	when.Within = nil
+	var loc string
+	if o.Location != nil {
+		loc = o.Location.String()
+	}
+	return specOpts{
+		Location:      loc,
+		When:          &when,
+		Interrupt:     o.Interrupt,
+		Misfire:       o.Misfire,
+		Semantics:     o.Semantics,
+		Overlap:       o.Overlap,
+		Splay:         o.Splay,
+		AlignTo:       o.AlignTo,
+		IntervalMode:  o.IntervalMode,
+		Tags:          o.Tags,
+		Metadata:      o.Metadata,
+		Jitter:        o.Jitter,
+		Priority:      o.Priority,
+		Weight:        o.Weight,
+		Affinity:      o.Affinity,
+		Preemptible:   o.Preemptible,
+		RetryCount:    o.RetryCount,
+		RetryDelay:    o.RetryDelay,
+		RetryDeadline: o.RetryDeadline,
+		Timeout:       o.Timeout,
+		SoftTimeout:   o.SoftTimeout,
+		DurationSLO:   o.DurationSLO,
+		HistorySize:   o.HistorySize,
+		HistoryAge:    o.HistoryAge,
+	}
+}
+
+func (o specOpts) opts() (*t.Opts, error) {
+	var loc *time.Location
+	if o.Location != "" {
+		var err error
+		if loc, err = time.LoadLocation(o.Location); err != nil {
+			return nil, err
+		}
+	}
+	return &t.Opts{
+		Location:      loc,
+		When:          o.When,
+		Interrupt:     o.Interrupt,
+		Misfire:       o.Misfire,
+		Semantics:     o.Semantics,
+		Overlap:       o.Overlap,
+		Splay:         o.Splay,
+		AlignTo:       o.AlignTo,
+		IntervalMode:  o.IntervalMode,
+		Tags:          o.Tags,
+		Metadata:      o.Metadata,
+		Jitter:        o.Jitter,
+		Priority:      o.Priority,
+		Weight:        o.Weight,
+		Affinity:      o.Affinity,
+		Preemptible:   o.Preemptible,
+		RetryCount:    o.RetryCount,
+		RetryDelay:    o.RetryDelay,
+		RetryDeadline: o.RetryDeadline,
+		Timeout:       o.Timeout,
+		SoftTimeout:   o.SoftTimeout,
+		DurationSLO:   o.DurationSLO,
+		HistorySize:   o.HistorySize,
+		HistoryAge:    o.HistoryAge,
+	}, nil
+}
+
+// Returns a JSON snapshot of the job definitions, including their
+// timing, options, metadata and last runs. The jobs should be of
+// the types registered with RegisterJobType, and are saved with
+// their exported fields as the parameters. Options that can't be
+// serialized, such as calendars, blackouts, triggers, hooks, the
+// Within hours, the holidays and the location of the fiscal timings
+// and the composed timings, are not included.
+func (s *Scheduler) Snapshot() ([]byte, error) {
+	jobs := s.jobs.all()
+	specs := make([]jobSpec, 0, len(jobs))
+	for _, j := range jobs {
+		typ, ok := jobType(j.job)
+		if !ok {
+			return nil, fmt.Errorf("job %v: type %T is not registered", j.name, j.job)
+		}
+		params, err := json.Marshal(j.job)
+		if err != nil {
+			return nil, fmt.Errorf("job %v: %v", j.name, err)
+		}
+		specs = append(specs, jobSpec{Name: j.name, Type: typ, Params: params})
+	}
+	// the loop owns LastRun, serialize on the loop
+	var (
+		b   []byte
+		err error
+	)
+	s.call(func() {
+		for i, j := range jobs {
+			specs[i].Opts = newSpecOpts(j.opts)
+		}
+		b, err = json.Marshal(specs)
+	})
+	return b, err
+}
+
+// Schedules the jobs of a snapshot taken with Snapshot, or of a
+// config in the same format. Their last runs are restored, so the
+// jobs pick up their schedules where they left off. All of the jobs are decoded before any is
+// scheduled, an error returned while scheduling leaves the jobs
+// before it scheduled.
+func (s *Scheduler) RestoreSnapshot(data []byte) error {
+	var specs []jobSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return err
+	}
+	jobs := make([]Job, len(specs))
+	opts := make([]*t.Opts, len(specs))
+	for i, spec := range specs {
+		job, err := NewJob(spec.Type, spec.Params)
+		if err != nil {
+			return fmt.Errorf("job %v: %v", spec.Name, err)
+		}
+		if opts[i], err = spec.Opts.opts(); err != nil {
+			return fmt.Errorf("job %v: %v", spec.Name, err)
+		}
+		jobs[i] = job
+	}
+	for i, spec := range specs {
+		if err := s.ScheduleWithOpts(spec.Name, jobs[i], opts[i]); err != nil {
+			return fmt.Errorf("job %v: %v", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+// Schedules a job of the type called typ, created with the
+// parameters. See RegisterJobType.
+func (s *Scheduler) ScheduleType(name, typ string, params json.RawMessage, opts *t.Opts) error {
+	job, err := NewJob(typ, params)
+	if err != nil {
+		return err
+	}
+	return s.ScheduleWithOpts(name, job, opts)
+}
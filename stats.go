@@ -0,0 +1,141 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// The durations of the runs are counted in exponential buckets,
+// the ith holding the runs up to a millisecond << i and the last
+// one holding the longer runs.
+const histBuckets = 24
+
+// histogram is the distribution of the durations of the runs
+// of a job.
+type histogram struct {
+	mu       sync.Mutex
+	counts   [histBuckets]uint64
+	runs     uint64
+	failures uint64
+	sum      time.Duration
+	max      time.Duration
+}
+
+func bucketBound(i int) time.Duration {
+	if i == histBuckets-1 {
+		return math.MaxInt64
+	}
+	return time.Millisecond << uint(i)
+}
+
+// Records a run that took d.
+func (h *histogram) record(d time.Duration, failed bool) {
+	i := 0
+	for i < histBuckets-1 && d > bucketBound(i) {
+		i++
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.runs++
+	if failed {
+		h.failures++
+	}
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Returns the upper bound of the bucket the qth quantile of the
+// durations falls into, no more than the longest run. Must be
+// called with mu held.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.runs == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.runs)))
+	var n uint64
+	for i, c := range h.counts {
+		if n += c; n >= rank {
+			if b := bucketBound(i); b < h.max {
+				return b
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+// JobStats is the distribution of the durations of the runs of
+// a job, including their retries, since the job is scheduled.
+// The percentiles are the upper bounds of the buckets they fall
+// into, so they are accurate to a factor of two.
+type JobStats struct {
+	Name     string        `json:"name"`
+	Runs     uint64        `json:"runs"`
+	Failures uint64        `json:"failures"`
+	Mean     time.Duration `json:"mean"`
+	P50      time.Duration `json:"p50"`
+	P90      time.Duration `json:"p90"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+	// Buckets are the non-empty buckets of the distribution.
+	Buckets []Bucket `json:"buckets,omitempty"`
+}
+
+// Bucket counts the runs that took longer than the previous
+// bucket, up to UpperBound.
+type Bucket struct {
+	UpperBound time.Duration `json:"upperBound"`
+	Count      uint64        `json:"count"`
+}
+
+// Returns the run duration stats of the job called name, reports
+// false if there is no such job.
+func (s *Scheduler) Stats(name string) (JobStats, bool) {
+	j, ok := s.jobs.get(name)
+	if !ok {
+		return JobStats{}, false
+	}
+	return j.stats(), true
+}
+
+func (j *jobC) stats() JobStats {
+	h := &j.durations
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	st := JobStats{
+		Name:     j.name,
+		Runs:     h.runs,
+		Failures: h.failures,
+		P50:      h.quantile(0.5),
+		P90:      h.quantile(0.9),
+		P99:      h.quantile(0.99),
+		Max:      h.max,
+	}
+	if h.runs > 0 {
+		st.Mean = h.sum / time.Duration(h.runs)
+	}
+	for i, c := range h.counts {
+		if c > 0 {
+			st.Buckets = append(st.Buckets, Bucket{UpperBound: bucketBound(i), Count: c})
+		}
+	}
+	return st
+}
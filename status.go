@@ -0,0 +1,99 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"sort"
+	"time"
+)
+
+// JobStatus describes a job registered on a scheduler.
+type JobStatus struct {
+	Name     string            `json:"name"`
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// LastRun is the zero time if the job has never run.
+	LastRun time.Time `json:"lastRun"`
+	// NextRun is the zero time if the job is not scheduled,
+	// e.g. the scheduler is not started or the job is running.
+	NextRun time.Time `json:"nextRun"`
+	Running bool      `json:"running"`
+	Paused  bool      `json:"paused"`
+	// Disabled is true if the job has a tag disabled by DisableTag.
+	Disabled bool `json:"disabled"`
+	// SnoozedUntil is the time the paused job is resumed at, the
+	// zero time unless it's snoozed.
+	SnoozedUntil time.Time `json:"snoozedUntil"`
+	// Priority is the priority of the job, and EffectivePriority
+	// the priority of its run waiting for capacity, aged by
+	// WithPriorityDispatch; the same as Priority if no run waits.
+	Priority          int `json:"priority"`
+	EffectivePriority int `json:"effectivePriority"`
+	// LastError is the final error of the last run, empty if
+	// it succeeded.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Returns the status of the job called name, reports false
+// if there is no such job.
+func (s *Scheduler) Status(name string) (JobStatus, bool) {
+	j, ok := s.jobs.get(name)
+	if !ok {
+		return JobStatus{}, false
+	}
+	var st JobStatus
+	s.call(func() { st = j.status() })
+	return st, true
+}
+
+// Returns the statuses of all of the jobs, sorted by name.
+func (s *Scheduler) Jobs() []JobStatus {
+	jobs := s.jobs.all()
+	statuses := make([]JobStatus, len(jobs))
+	s.call(func() {
+		for i, j := range jobs {
+			statuses[i] = j.status()
+		}
+	})
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Name < statuses[k].Name
+	})
+	return statuses
+}
+
+// Returns the status of the job, must be called on the loop.
+func (j *jobC) status() JobStatus {
+	st := JobStatus{
+		Name:     j.name,
+		Tags:     j.opts.Tags,
+		Metadata: j.opts.Metadata,
+		LastRun:  j.when.LastRun,
+	}
+	if j.index >= 0 {
+		st.NextRun = j.scheduledAt
+	}
+	j.mu.Lock()
+	st.Running = j.running > 0
+	if j.last.Err != nil {
+		st.LastError = j.last.Err.Error()
+	}
+	since := j.waitingSince
+	j.mu.Unlock()
+	st.Priority = j.opts.Priority
+	st.EffectivePriority = agedPriority(j.opts.Priority, since, j.scheduler.now(), j.scheduler.aging)
+	st.Paused = j.paused
+	st.Disabled = j.scheduler.disabled(j)
+	st.SnoozedUntil = j.snoozedUntil
+	return st
+}
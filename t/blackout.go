@@ -0,0 +1,93 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"time"
+)
+
+// Represents time windows no runs can start within, such
+// as maintenance windows.
+type Blackout interface {
+	// Returns the first window ending after tm. It returns
+	// zero times if there are no such windows.
+	Next(tm time.Time) (start, end time.Time)
+}
+
+// Represents a one-off window from Start to End.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Returns the period if it ends after tm.
+func (p Period) Next(tm time.Time) (start, end time.Time) {
+	if tm.Before(p.End) {
+		return p.Start, p.End
+	}
+	return
+}
+
+type daily struct {
+	start, end time.Duration // since midnight
+	loc        *time.Location
+}
+
+// Returns a window recurring every day from start to end in loc.
+// start and end are formatted as "15:04", the window spans midnight
+// if end is not after start. If loc is nil, local time is used.
+// Panics if start or end can't be parsed.
+// Example:
+// 		t.Daily("23:30", "01:00", nil) // every night from 23:30 to 01:00
+func Daily(start, end string, loc *time.Location) Blackout {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &daily{start: parseClock(start), end: parseClock(end), loc: loc}
+}
+
+// Returns the first daily window ending after tm.
+func (d *daily) Next(tm time.Time) (start, end time.Time) {
+	tm = tm.In(d.loc)
+	y, m, day := tm.Date()
+	// start from yesterday's window, it may span midnight
+	for i := -1; i <= 1; i++ {
+		date := time.Date(y, m, day+i, 0, 0, 0, 0, d.loc)
+		start, end = onDate(date, d.start), onDate(date, d.end)
+		if d.end <= d.start {
+			end = onDate(date.AddDate(0, 0, 1), d.end)
+		}
+		if tm.Before(end) {
+			return
+		}
+	}
+	return time.Time{}, time.Time{}
+}
+
+// Reports whether tm is within any of the windows of the blackouts,
+// and returns the latest end of these windows.
+func blackedOut(blackouts []Blackout, tm time.Time) (until time.Time, ok bool) {
+	for _, b := range blackouts {
+		start, end := b.Next(tm)
+		if end.IsZero() || tm.Before(start) {
+			continue
+		}
+		if end.After(until) {
+			until = end
+		}
+		ok = true
+	}
+	return
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"time"
+)
+
+// Represents a calendar of moments a job must not run at.
+// Organizational calendars can be used to shape schedules by
+// implementing it.
+type Calendar interface {
+	IsExcluded(time.Time) bool
+}
+
+// Adapts an ordinary function to a Calendar.
+type CalendarFunc func(time.Time) bool
+
+// Calls f with tm.
+func (f CalendarFunc) IsExcluded(tm time.Time) bool {
+	return f(tm)
+}
+
+// Represents a calendar excluding Saturdays and Sundays.
+type Weekends struct{}
+
+// Reports whether tm is on a Saturday or a Sunday.
+func (Weekends) IsExcluded(tm time.Time) bool {
+	day := tm.Weekday()
+	return day == time.Saturday || day == time.Sunday
+}
+
+// Represents a calendar composed of calendars. A moment is
+// excluded if any of the calendars exclude it.
+// Example:
+// 		t.Calendars{t.Weekends{}, holidays}
+type Calendars []Calendar
+
+// Reports whether any of the calendars exclude tm.
+func (c Calendars) IsExcluded(tm time.Time) bool {
+	for _, cal := range c {
+		if cal.IsExcluded(tm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Represents a calendar excluding a set of days, such as
+// public holidays. A day is matched in the location of its
+// date.
+// Example:
+// 		t.Dates{
+// 			time.Date(2014, time.December, 25, 0, 0, 0, 0, time.Local),
+// 			time.Date(2015, time.January, 1, 0, 0, 0, 0, time.Local),
+// 		}
+type Dates []time.Time
+
+// Reports whether tm is on one of the dates.
+func (d Dates) IsExcluded(tm time.Time) bool {
+	for _, date := range d {
+		y1, m1, d1 := date.Date()
+		y2, m2, d2 := tm.In(date.Location()).Date()
+		if y1 == y2 && m1 == m2 && d1 == d2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import "time"
+
+// Set is a set of moments, such as the days of Dates, the hours
+// of Hours or the runs of a When. See Intersect and Except.
+type Set interface {
+	Contains(tm time.Time) bool
+}
+
+// SetFunc adapts an ordinary function to a Set.
+type SetFunc func(time.Time) bool
+
+// Calls f with tm.
+func (f SetFunc) Contains(tm time.Time) bool {
+	return f(tm)
+}
+
+// Reports whether tm is on one of the dates.
+func (d Dates) Contains(tm time.Time) bool {
+	return d.IsExcluded(tm)
+}
+
+// Reports whether tm is on a Saturday or a Sunday.
+func (w Weekends) Contains(tm time.Time) bool {
+	return w.IsExcluded(tm)
+}
+
+// Reports whether any of the calendars excludes tm.
+func (c Calendars) Contains(tm time.Time) bool {
+	return c.IsExcluded(tm)
+}
+
+// Reports whether tm is within the hours.
+func (h *Hours) Contains(tm time.Time) bool {
+	return !h.IsExcluded(tm)
+}
+
+// Reports whether tm is one of the runs. The runs are counted from
+// a minute before tm, so only the timings anchored to the clock,
+// such as Cron, At and Solar, contain the same moments regardless
+// of their last runs.
+func (w *When) Contains(tm time.Time) bool {
+	start := tm.Add(-time.Minute)
+	for i := 0; i < maxContainsSteps; i++ {
+		next := w.next(start, start)
+		if next.IsZero() || next.After(tm) {
+			return false
+		}
+		if next.Equal(tm) {
+			return true
+		}
+		start = next
+	}
+	return false
+}
+
+// Maximum number of runs Contains steps through in the minute
+// before the moment, enough for the runs of every second.
+const maxContainsSteps = 64
+
+// Maximum number of runs of the base timing an intersection or
+// an exception looks through for one that the sets keep, before
+// it gives up and reports no more runs.
+const maxComposedSteps = 1 << 14
+
+const (
+	composeUnion = iota
+	composeIntersect
+	composeExcept
+)
+
+// composition is the timing of a When built by Union,
+// Intersect or Except.
+type composition struct {
+	op    int
+	whens []*When // the parts of a union, or the base
+	sets  []Set
+}
+
+// Returns the timing of the runs of any of the timings, e.g. the
+// business hours and a weekend maintenance window. The runs that
+// coincide are run once. The union counts from the latest LastRun
+// of the timings. A union repeats if any of its timings does; the
+// timings that don't repeat, such as Each, are then run again on
+// every run of the union. The intervals of Every count from the
+// last run of the union, whichever timing it was of.
+// Example:
+// 		t.Union(
+// 			&t.When{Every: t.Every(10).Minutes(), Within: t.BusinessHours("09:00", "17:00", nil)},
+// 			&t.When{Cron: "0 0 2 * * SAT"})
+func Union(whens ...*When) *When {
+	u := &When{composition: &composition{op: composeUnion, whens: whens}}
+	for _, w := range whens {
+		if w.LastRun.After(u.LastRun) {
+			u.LastRun = w.LastRun
+		}
+	}
+	return u
+}
+
+// Returns the timing of the runs of w that all of the sets
+// contain, e.g. the runs in the business hours.
+// Example:
+// 		t.Intersect(&t.When{Cron: "0 */15 * * * *"}, t.BusinessHours("09:00", "17:00", nil))
+func Intersect(w *When, sets ...Set) *When {
+	return &When{composition: &composition{op: composeIntersect, whens: []*When{w}, sets: sets}}
+}
+
+// Returns the timing of the runs of w that none of the sets
+// contain, e.g. the days other than the holidays.
+// Example:
+// 		t.Except(&t.When{Cron: "@daily"}, holidays)
+func Except(w *When, sets ...Set) *When {
+	return &When{composition: &composition{op: composeExcept, whens: []*When{w}, sets: sets}}
+}
+
+// Returns the first run after now, counting from start.
+func (c *composition) next(start, now time.Time) time.Time {
+	if c.op == composeUnion {
+		var earliest time.Time
+		for _, w := range c.whens {
+			if next := w.next(start, now); !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+				earliest = next
+			}
+		}
+		return earliest
+	}
+	w := c.whens[0]
+	next := w.next(start, now)
+	for i := 0; i < maxComposedSteps && !next.IsZero(); i++ {
+		if c.admits(next) {
+			return next
+		}
+		next = w.next(next, next)
+	}
+	return time.Time{}
+}
+
+// Reports whether the run of the base timing at tm is kept by
+// the sets of an intersection or an exception.
+func (c *composition) admits(tm time.Time) bool {
+	for _, s := range c.sets {
+		if s.Contains(tm) != (c.op == composeIntersect) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *composition) repeats() bool {
+	for _, w := range c.whens {
+		if w.Repeats() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *composition) validate() error {
+	for _, w := range c.whens {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
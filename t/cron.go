@@ -0,0 +1,503 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package t
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Years a Quartz expression can refer to.
+const (
+	minCronYear = 1970
+	maxCronYear = 2099
+)
+
+// Cron is a schedule parsed from a cron expression. Both the
+// standard five fields and the seven fields of Quartz are supported:
+// 		minute hour day-of-month month day-of-week
+// 		second minute hour day-of-month month day-of-week [year]
+// Fields may contain *, lists, ranges and steps, such as 1,15 or
+// 9-17/2; months and week days may be named, e.g. JAN or MON-FRI.
+// Day of week is 0-7 with Sunday as 0 or 7 in the standard format,
+// and 1-7 with Sunday as 1 in the Quartz format. If both days are
+// restricted, either of them matches; ? leaves a day field out.
+// Quartz modifiers are supported:
+// 		L    the last day of the month, or L-3 three days before it
+// 		15W  the weekday nearest to the 15th, LW the last weekday
+// 		6L   the last Friday of the month
+// 		6#3  the third Friday of the month
+// The conventional aliases are supported as well:
+// 		@yearly, @annually  0 0 1 1 *
+// 		@monthly            0 0 1 * *
+// 		@weekly             0 0 * * 0
+// 		@daily, @midnight   0 0 * * *
+// 		@hourly             0 * * * *
+// 		@reboot             once, right after the scheduler starts
+type Cron struct {
+	reboot bool
+
+	second, minute, hour, dom, month, dow uint64
+	// nil if any year
+	years map[int]bool
+
+	// day of month modifiers
+	domAny, domLast, domLastWeekday bool
+	domLastOffset                   int
+	domNearestWeekday               int // 0 if not set
+	// day of week modifiers
+	dowAny   bool
+	dowLast  []time.Weekday
+	dowNth   []nthWeekday
+	dowEmpty bool // ? or only the modifiers are set
+}
+
+type nthWeekday struct {
+	day time.Weekday
+	n   int
+}
+
+var (
+	monthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	dayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parses a cron expression. See Cron. Returns a *ParseError
+// pointing at the field that fails to parse.
+func ParseCron(expr string) (*Cron, error) {
+	orig := expr
+	expr = strings.TrimSpace(expr)
+	if expr == "@reboot" {
+		return &Cron{reboot: true}, nil
+	}
+	if strings.HasPrefix(expr, "@") {
+		alias, ok := cronAliases[expr]
+		if !ok {
+			return nil, &ParseError{Field: "Cron", Expr: orig, Pos: strings.Index(orig, "@"),
+				Msg: fmt.Sprintf("unknown alias %q", expr), Hint: aliasHint(expr)}
+		}
+		return ParseCron(alias)
+	}
+	fields, offsets := splitFields(orig)
+	quartz := false
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+		offsets = append([]int{-1}, offsets...)
+	case 6, 7:
+		quartz = true
+	default:
+		return nil, &ParseError{Field: "Cron", Expr: orig,
+			Msg:  fmt.Sprintf("expected 5, 6 or 7 fields, found %v", len(fields)),
+			Hint: "the standard fields are minute, hour, day of month, month and day of week"}
+	}
+	// describes the field i that failed to parse
+	fieldErr := func(i int, name, expects string) error {
+		return &ParseError{Field: "Cron", Expr: orig, Pos: offsets[i],
+			Msg:  fmt.Sprintf("%v field %q expects %v", name, fields[i], expects),
+			Hint: cronHint(fields[i], name, quartz)}
+	}
+	c := &Cron{}
+	var err error
+	if c.second, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fieldErr(0, "second", "* or 0-59")
+	}
+	if c.minute, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+		return nil, fieldErr(1, "minute", "* or 0-59")
+	}
+	if c.hour, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+		return nil, fieldErr(2, "hour", "* or 0-23")
+	}
+	if err = c.parseDayOfMonth(fields[3]); err != nil {
+		return nil, fieldErr(3, "day of month", "*, ?, 1-31, L, L-n, LW or nW")
+	}
+	if c.month, err = parseCronField(fields[4], 1, 12, monthNames); err != nil {
+		return nil, fieldErr(4, "month", "*, 1-12 or JAN-DEC")
+	}
+	if err = c.parseDayOfWeek(fields[5], quartz); err != nil {
+		days := "0-7"
+		if quartz {
+			days = "1-7"
+		}
+		return nil, fieldErr(5, "day of week", "*, ?, "+days+" or SUN-SAT, optionally with L or #n")
+	}
+	if len(fields) == 7 && fields[6] != "*" {
+		bits, err := parseCronYears(fields[6])
+		if err != nil {
+			return nil, fieldErr(6, "year", fmt.Sprintf("* or %v-%v", minCronYear, maxCronYear))
+		}
+		c.years = bits
+	}
+	return c, nil
+}
+
+func (c *Cron) parseDayOfMonth(f string) (err error) {
+	switch {
+	case f == "?":
+		c.domAny = true
+		c.dom = 0
+		return nil
+	case f == "*":
+		c.domAny = true
+	case f == "L":
+		c.domLast = true
+		return nil
+	case f == "LW":
+		c.domLastWeekday = true
+		return nil
+	case strings.HasPrefix(f, "L-"):
+		n, err := strconv.Atoi(f[2:])
+		if err != nil || n < 0 || n > 30 {
+			return fmt.Errorf("invalid offset %q", f)
+		}
+		c.domLast, c.domLastOffset = true, n
+		return nil
+	case strings.HasSuffix(f, "W"):
+		n, err := strconv.Atoi(f[:len(f)-1])
+		if err != nil || n < 1 || n > 31 {
+			return fmt.Errorf("invalid day %q", f)
+		}
+		c.domNearestWeekday = n
+		return nil
+	}
+	c.dom, err = parseCronField(f, 1, 31, nil)
+	return err
+}
+
+func (c *Cron) parseDayOfWeek(f string, quartz bool) error {
+	switch f {
+	case "?":
+		c.dowEmpty = true
+		return nil
+	case "*":
+		c.dowAny = true
+	}
+	// converts a day number to time.Weekday
+	day := func(s string) (time.Weekday, error) {
+		if d, ok := dayNames[strings.ToUpper(s)]; ok {
+			return time.Weekday(d), nil
+		}
+		n, err := strconv.Atoi(s)
+		if quartz {
+			if err != nil || n < 1 || n > 7 {
+				return 0, fmt.Errorf("invalid day %q", s)
+			}
+			return time.Weekday(n - 1), nil
+		}
+		if err != nil || n < 0 || n > 7 {
+			return 0, fmt.Errorf("invalid day %q", s)
+		}
+		return time.Weekday(n % 7), nil
+	}
+	var plain []string
+	for _, part := range strings.Split(f, ",") {
+		switch {
+		case part == "L":
+			// Saturday, the last day of the week
+			c.dowLast = append(c.dowLast, time.Saturday)
+		case len(part) > 1 && strings.HasSuffix(part, "L"):
+			d, err := day(part[:len(part)-1])
+			if err != nil {
+				return err
+			}
+			c.dowLast = append(c.dowLast, d)
+		case strings.Contains(part, "#"):
+			ds, ns, _ := strings.Cut(part, "#")
+			d, err := day(ds)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(ns)
+			if err != nil || n < 1 || n > 5 {
+				return fmt.Errorf("invalid occurrence %q", part)
+			}
+			c.dowNth = append(c.dowNth, nthWeekday{day: d, n: n})
+		default:
+			plain = append(plain, part)
+		}
+	}
+	if len(plain) == 0 {
+		return nil
+	}
+	// normalize the numbers to the standard format, 0-7
+	names := make(map[string]int, len(dayNames))
+	for k, v := range dayNames {
+		names[k] = v
+		if quartz {
+			names[k] = v + 1
+		}
+	}
+	min, max := 0, 7
+	if quartz {
+		min = 1
+	}
+	bits, err := parseCronField(strings.Join(plain, ","), min, max, names)
+	if err != nil {
+		return err
+	}
+	for d := min; d <= max; d++ {
+		if bits&(1<<uint(d)) == 0 {
+			continue
+		}
+		w := d % 7
+		if quartz {
+			w = d - 1
+		}
+		c.dow |= 1 << uint(w)
+	}
+	return nil
+}
+
+// Parses a field of numbers within [min, max] into a bit set.
+func parseCronField(f string, min, max int, names map[string]int) (uint64, error) {
+	if f == "" {
+		return 0, errors.New("empty field")
+	}
+	var bits uint64
+	for _, part := range strings.Split(f, ",") {
+		lo, hi, step, err := parseCronRange(part, min, max, names)
+		if err != nil {
+			return 0, err
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// Parses a part of a field, such as *, 5, 1-5, */15 or 10-40/5.
+func parseCronRange(part string, min, max int, names map[string]int) (lo, hi, step int, err error) {
+	rng, stepStr, hasStep := strings.Cut(part, "/")
+	step = 1
+	if hasStep {
+		if step, err = strconv.Atoi(stepStr); err != nil || step < 1 {
+			return 0, 0, 0, fmt.Errorf("invalid step %q", stepStr)
+		}
+	}
+	num := func(s string) (int, error) {
+		if n, ok := names[strings.ToUpper(s)]; ok {
+			return n, nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not within %v-%v", s, min, max)
+		}
+		return n, nil
+	}
+	switch {
+	case rng == "*":
+		lo, hi = min, max
+	case strings.Contains(rng, "-"):
+		a, b, _ := strings.Cut(rng, "-")
+		if lo, err = num(a); err != nil {
+			return
+		}
+		if hi, err = num(b); err != nil {
+			return
+		}
+		if lo > hi {
+			return 0, 0, 0, fmt.Errorf("invalid range %q", rng)
+		}
+	default:
+		if lo, err = num(rng); err != nil {
+			return
+		}
+		hi = lo
+		if hasStep {
+			// 5/15 means from 5 to max every 15
+			hi = max
+		}
+	}
+	return lo, hi, step, nil
+}
+
+func parseCronYears(f string) (map[int]bool, error) {
+	years := make(map[int]bool)
+	for _, part := range strings.Split(f, ",") {
+		lo, hi, step, err := parseCronRange(part, minCronYear, maxCronYear, nil)
+		if err != nil {
+			return nil, err
+		}
+		for y := lo; y <= hi; y += step {
+			years[y] = true
+		}
+	}
+	return years, nil
+}
+
+// Returns the first moment matching the expression after tm, in
+// the location of tm. Returns the zero time if there is none. For
+// @reboot, returns a moment right after tm.
+func (c *Cron) Next(tm time.Time) time.Time {
+	return c.next(tm, MonthEndSkip)
+}
+
+// Returns the first moment after tm, with respect to the
+// month-end policy.
+func (c *Cron) next(tm time.Time, monthEnd int) time.Time {
+	if c.reboot {
+		return tm.Add(time.Millisecond)
+	}
+	loc := tm.Location()
+	tm = tm.Truncate(time.Second).Add(time.Second)
+	for tm.Year() <= maxCronYear {
+		prev := tm
+		y, m, d := tm.Date()
+		switch {
+		case c.years != nil && !c.years[y]:
+			tm = time.Date(y+1, time.January, 1, 0, 0, 0, 0, loc)
+		case c.month&(1<<uint(m)) == 0:
+			tm = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+		case !c.matchDay(tm, monthEnd):
+			tm = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(tm.Hour())) == 0:
+			tm = time.Date(y, m, d, tm.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(tm.Minute())) == 0:
+			tm = time.Date(y, m, d, tm.Hour(), tm.Minute()+1, 0, 0, loc)
+		case c.second&(1<<uint(tm.Second())) == 0:
+			tm = tm.Add(time.Second)
+		default:
+			return tm
+		}
+		if !tm.After(prev) {
+			// an ambiguous local time, e.g. when the clocks
+			// are turned back, is resolved to the earlier one
+			tm = prev.Add(time.Second)
+		}
+	}
+	return time.Time{}
+}
+
+// Reports whether the day of tm matches. If both of the day
+// fields are restricted, either of them matches.
+func (c *Cron) matchDay(tm time.Time, monthEnd int) bool {
+	domRestricted := !c.domAny
+	dowRestricted := !c.dowAny && !c.dowEmpty || len(c.dowLast) > 0 || len(c.dowNth) > 0
+	switch {
+	case domRestricted && dowRestricted:
+		return c.matchDayOfMonth(tm, monthEnd) || c.matchDayOfWeek(tm)
+	case domRestricted:
+		return c.matchDayOfMonth(tm, monthEnd)
+	case dowRestricted:
+		return c.matchDayOfWeek(tm)
+	}
+	return true
+}
+
+func (c *Cron) matchDayOfMonth(tm time.Time, monthEnd int) bool {
+	d := tm.Day()
+	last := daysIn(tm)
+	switch {
+	case c.domLast:
+		return d == last-c.domLastOffset
+	case c.domLastWeekday:
+		return d == nearestWeekday(tm, last)
+	case c.domNearestWeekday > 0:
+		n := c.domNearestWeekday
+		if n > last {
+			n = last
+		}
+		return d == nearestWeekday(tm, n)
+	}
+	if c.dom&(1<<uint(d)) != 0 {
+		return true
+	}
+	switch monthEnd {
+	case MonthEndClamp:
+		// any of the days after the last day
+		return d == last && c.dom>>uint(last+1) != 0
+	case MonthEndRoll:
+		// the days after the last day of the previous month
+		prev := daysIn(time.Date(tm.Year(), tm.Month(), 0, 0, 0, 0, 0, time.UTC))
+		return prev+d <= 31 && c.dom&(1<<uint(prev+d)) != 0
+	}
+	return false
+}
+
+func (c *Cron) matchDayOfWeek(tm time.Time) bool {
+	wd := tm.Weekday()
+	if c.dow&(1<<uint(wd)) != 0 {
+		return true
+	}
+	for _, d := range c.dowLast {
+		if d == wd && tm.Day()+7 > daysIn(tm) {
+			return true
+		}
+	}
+	for _, nth := range c.dowNth {
+		if nth.day == wd && (tm.Day()-1)/7+1 == nth.n {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the number of days in the month of tm.
+func daysIn(tm time.Time) int {
+	return time.Date(tm.Year(), tm.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// Returns the weekday of the month of tm nearest to the
+// day d, without crossing to another month.
+func nearestWeekday(tm time.Time, d int) int {
+	wd := time.Date(tm.Year(), tm.Month(), d, 0, 0, 0, 0, time.UTC).Weekday()
+	switch wd {
+	case time.Saturday:
+		if d == 1 {
+			return 3
+		}
+		return d - 1
+	case time.Sunday:
+		if d == daysIn(tm) {
+			return d - 2
+		}
+		return d + 1
+	}
+	return d
+}
+
+// Parsed expressions, When.Cron is parsed once.
+var crons sync.Map
+
+func parseCronCached(expr string) (*Cron, error) {
+	if c, ok := crons.Load(expr); ok {
+		return c.(*Cron), nil
+	}
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	crons.Store(expr, c)
+	return c, nil
+}
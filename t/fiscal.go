@@ -0,0 +1,193 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// The fiscal months are the calendar months.
+	FiscalCalendar = iota
+	// The fiscal quarters are of 13 weeks, their months of 4, 4
+	// and 5 weeks.
+	Fiscal445
+	// The months of the quarters are of 4, 5 and 4 weeks.
+	Fiscal454
+	// The months of the quarters are of 5, 4 and 4 weeks.
+	Fiscal544
+)
+
+const (
+	// Runs once in a fiscal quarter.
+	FiscalQuarter = iota
+	// Runs once in a fiscal month.
+	FiscalMonth
+	// Runs once in a fiscal year.
+	FiscalYear
+)
+
+// Represents a schedule on the periods of a fiscal calendar, such
+// as the first business day of each fiscal quarter.
+//
+// The fiscal year starts in YearStart, January if it's zero. With
+// FiscalCalendar, the periods start on the 1st of their months. With
+// the week-based patterns, the year starts on the first WeekStart
+// on or after the 1st of YearStart and is of 52 or 53 weeks; the
+// 53rd week falls into the last month.
+//
+// Day is the business day of the period the job runs on, 1 being
+// the first; negative days count from the end of the period, -1
+// being the last. The job runs on the first day of the period if
+// Day is zero. Business days are Monday to Friday, other than the
+// days Holidays excludes. The runs are at At in Loc, at midnight if
+// At is empty, and in local time if Loc is nil.
+// Example:
+// 		// the first business day of each fiscal quarter, the
+// 		// fiscal year starting in April
+// 		&t.When{Fiscal: &t.Fiscal{YearStart: time.April, Day: 1, At: "06:00"}}
+type Fiscal struct {
+	YearStart time.Month
+	Pattern   int
+	WeekStart time.Weekday
+	Period    int
+	Day       int
+	Holidays  Calendar `json:"-"`
+	At        string
+	Loc       *time.Location `json:"-"`
+}
+
+// Returns the first run after start, zero time if there is none.
+func (f *Fiscal) next(start time.Time) time.Time {
+	loc := f.Loc
+	if loc == nil {
+		loc = time.Local
+	}
+	hour, minute, _ := clockAt(f.At)
+	fy := start.In(loc).Year() - 1
+	for i := 0; i < 4; i++ {
+		periods := f.periods(fy+i, loc)
+		for k := 0; k < len(periods)-1; k++ {
+			day, ok := f.runDay(periods[k], periods[k+1])
+			if !ok {
+				continue
+			}
+			y, m, d := day.Date()
+			if at := time.Date(y, m, d, hour, minute, 0, 0, loc); at.After(start) {
+				return at
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Returns the starts of the periods of the fiscal year starting in
+// the calendar year y, followed by the start of the next year.
+func (f *Fiscal) periods(y int, loc *time.Location) []time.Time {
+	months := f.months(y, loc)
+	var step int
+	switch f.Period {
+	case FiscalMonth:
+		step = 1
+	case FiscalYear:
+		step = 12
+	default:
+		step = 3
+	}
+	periods := make([]time.Time, 0, 13)
+	for k := 0; k < len(months); k += step {
+		periods = append(periods, months[k])
+	}
+	return periods
+}
+
+// Returns the starts of the 12 fiscal months of the fiscal year
+// starting in the calendar year y, followed by the start of the
+// next year.
+func (f *Fiscal) months(y int, loc *time.Location) []time.Time {
+	first := f.YearStart
+	if first == 0 {
+		first = time.January
+	}
+	months := make([]time.Time, 0, 13)
+	if f.Pattern == FiscalCalendar {
+		for k := 0; k <= 12; k++ {
+			months = append(months, time.Date(y, first+time.Month(k), 1, 0, 0, 0, 0, loc))
+		}
+		return months
+	}
+	weeks := map[int][3]int{Fiscal445: {4, 4, 5}, Fiscal454: {4, 5, 4}, Fiscal544: {5, 4, 4}}[f.Pattern]
+	tm := f.weekYearStart(y, first, loc)
+	for k := 0; k < 12; k++ {
+		months = append(months, tm)
+		y, m, d := tm.Date()
+		tm = time.Date(y, m, d+7*weeks[k%3], 0, 0, 0, 0, loc)
+	}
+	// the 53rd week, if any, is in the last month
+	return append(months, f.weekYearStart(y+1, first, loc))
+}
+
+// Returns the first WeekStart on or after the 1st of the month.
+func (f *Fiscal) weekYearStart(y int, m time.Month, loc *time.Location) time.Time {
+	tm := time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	return tm.AddDate(0, 0, (int(f.WeekStart)-int(tm.Weekday())+7)%7)
+}
+
+// Returns the day the job runs on in the period from start until
+// end. Reports false if the period doesn't have the business day.
+func (f *Fiscal) runDay(start, end time.Time) (time.Time, bool) {
+	if f.Day == 0 {
+		return start, true
+	}
+	day, step, n := start, 1, f.Day
+	if n < 0 {
+		y, m, d := end.Date()
+		day, step, n = time.Date(y, m, d-1, 0, 0, 0, 0, end.Location()), -1, -n
+	}
+	for !day.Before(start) && day.Before(end) {
+		if f.isBusinessDay(day) {
+			if n--; n == 0 {
+				return day, true
+			}
+		}
+		y, m, d := day.Date()
+		day = time.Date(y, m, d+step, 0, 0, 0, 0, day.Location())
+	}
+	return time.Time{}, false
+}
+
+func (f *Fiscal) isBusinessDay(day time.Time) bool {
+	if wd := day.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	return f.Holidays == nil || !f.Holidays.IsExcluded(day)
+}
+
+func validateFiscal(f *Fiscal) error {
+	if f.Pattern < FiscalCalendar || f.Pattern > Fiscal544 {
+		return &ParseError{Field: "Fiscal", Expr: fmt.Sprint(f.Pattern), Msg: "pattern expects one of FiscalCalendar, Fiscal445, Fiscal454 or Fiscal544"}
+	}
+	if f.Period < FiscalQuarter || f.Period > FiscalYear {
+		return &ParseError{Field: "Fiscal", Expr: fmt.Sprint(f.Period), Msg: "period expects one of FiscalQuarter, FiscalMonth or FiscalYear"}
+	}
+	if f.YearStart < 0 || f.YearStart > time.December {
+		return &ParseError{Field: "Fiscal", Expr: fmt.Sprint(int(f.YearStart)), Msg: "year start expects a month"}
+	}
+	if _, _, ok := clockAt(f.At); !ok {
+		return &ParseError{Field: "Fiscal", Expr: f.At, Msg: "At expects HH:MM, such as 09:30"}
+	}
+	return nil
+}
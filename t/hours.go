@@ -0,0 +1,86 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"fmt"
+	"time"
+)
+
+// Represents the daily hours of the week days a job is allowed
+// to run within.
+type Hours struct {
+	start, end time.Duration // since midnight
+	loc        *time.Location
+	days       [7]bool
+}
+
+// Returns the hours between start and end on weekdays, from Monday
+// to Friday, in loc. start and end are formatted as "15:04", end
+// should be after start. If loc is nil, local time is used.
+// Panics if start or end can't be parsed.
+// Example:
+// 		// every 10 minutes from 09:00 to 17:00 on weekdays
+// 		&t.When{Every: t.Every(10).Minutes(), Within: t.BusinessHours("09:00", "17:00", nil)}
+func BusinessHours(start, end string, loc *time.Location) *Hours {
+	if loc == nil {
+		loc = time.Local
+	}
+	h := &Hours{start: parseClock(start), end: parseClock(end), loc: loc}
+	for d := time.Monday; d <= time.Friday; d++ {
+		h.days[d] = true
+	}
+	return h
+}
+
+// Reports whether tm is out of the hours.
+func (h *Hours) IsExcluded(tm time.Time) bool {
+	return !h.next(tm).Equal(tm)
+}
+
+// Returns the earliest moment within the hours, not before tm.
+func (h *Hours) next(tm time.Time) time.Time {
+	tm = tm.In(h.loc)
+	y, m, d := tm.Date()
+	for i := 0; i <= 7; i++ {
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, h.loc)
+		if !h.days[day.Weekday()] {
+			continue
+		}
+		opens, closes := onDate(day, h.start), onDate(day, h.end)
+		if tm.Before(opens) {
+			return opens
+		}
+		if tm.Before(closes) {
+			return tm
+		}
+	}
+	return tm
+}
+
+// Returns the time of day c on the date of day, on the wall clock,
+// which isn't c after midnight on the days the clocks change.
+func onDate(day time.Time, c time.Duration) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, int(c/time.Hour), int(c%time.Hour/time.Minute), 0, 0, day.Location())
+}
+
+func parseClock(s string) time.Duration {
+	c, err := time.Parse("15:04", s)
+	if err != nil {
+		panic(fmt.Sprintf("t: cannot parse %q as hours: %v", s, err))
+	}
+	return time.Duration(c.Hour())*time.Hour + time.Duration(c.Minute())*time.Minute
+}
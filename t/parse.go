@@ -0,0 +1,207 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ParseError describes a timing expression that fails to parse,
+// such as the Each, At or Cron of a When.
+// Example:
+// 		invalid Cron "0 *7 * * *" at position 2: minute field "*7"
+// 		expects * or 0-59; did you mean "*/7"?
+type ParseError struct {
+	// Field is the field of When the expression belongs to.
+	Field string
+	Expr  string
+	// Pos is the byte offset of the offending part of Expr.
+	Pos int
+	Msg string
+	// Hint suggests a fix, empty if there is none.
+	Hint string
+}
+
+func (e *ParseError) Error() string {
+	msg := fmt.Sprintf("invalid %v %q at position %v: %v", e.Field, e.Expr, e.Pos, e.Msg)
+	if e.Hint != "" {
+		msg += "; " + e.Hint
+	}
+	return msg
+}
+
+// Validate reports whether the Each, At, Cron, Weeks, ISOWeeks and
+// Fiscal of the timing, or of the parts of a composed timing, parse.
+// The error is a *ParseError.
+func (w *When) Validate() error {
+	if w.composition != nil {
+		return w.composition.validate()
+	}
+	if w.Cron != "" {
+		if _, err := parseCronCached(w.Cron); err != nil {
+			return err
+		}
+	}
+	if w.Each != "" {
+		if err := validateEach(w.Each); err != nil {
+			return err
+		}
+	}
+	if w.At != "" {
+		if err := validateAt(w.At); err != nil {
+			return err
+		}
+	}
+	if len(w.Weeks) > 0 {
+		if err := validateWeeks(w); err != nil {
+			return err
+		}
+	}
+	if w.Fiscal != nil {
+		if err := validateFiscal(w.Fiscal); err != nil {
+			return err
+		}
+	}
+	if len(w.ISOWeeks) > 0 {
+		if err := validateISOWeeks(w.ISOWeeks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the fields of a cron expression, with their offsets.
+func splitFields(expr string) (fields []string, offsets []int) {
+	start := -1
+	for i, r := range expr {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				fields, offsets = append(fields, expr[start:i]), append(offsets, start)
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields, offsets = append(fields, expr[start:]), append(offsets, start)
+	}
+	return fields, offsets
+}
+
+var stepTypo = regexp.MustCompile(`^\*(\d+)$`)
+
+// Suggests a fix for a cron field that fails to parse.
+func cronHint(field, name string, quartz bool) string {
+	if m := stepTypo.FindStringSubmatch(field); m != nil {
+		return fmt.Sprintf("did you mean \"*/%v\"?", m[1])
+	}
+	if name == "day of week" && quartz && (field == "0" || strings.HasPrefix(field, "0-")) {
+		return "the days of week are 1-7 from Sunday with 6 or 7 fields"
+	}
+	if name == "day of month" && field == "0" {
+		return "the days of month start from 1"
+	}
+	if name == "hour" && field == "24" {
+		return "did you mean \"0\"?"
+	}
+	return ""
+}
+
+// Suggests the aliases starting like the unknown one.
+func aliasHint(alias string) string {
+	var similar []string
+	for a := range cronAliases {
+		if len(alias) > 1 && strings.HasPrefix(a, alias[:2]) {
+			similar = append(similar, a)
+		}
+	}
+	if len(similar) == 0 {
+		similar = []string{"@yearly", "@monthly", "@weekly", "@daily", "@hourly", "@reboot"}
+	}
+	sort.Strings(similar)
+	return "did you mean " + strings.Join(similar, " or ") + "?"
+}
+
+func validateEach(each string) error {
+	if _, err := time.ParseDuration(each); err == nil {
+		return nil
+	}
+	e := &ParseError{Field: "Each", Expr: each, Msg: "expects a duration such as 1h30m"}
+	// looks for the number without a unit, or the unknown unit
+	i := 0
+	if i < len(each) && (each[i] == '+' || each[i] == '-') {
+		i++
+	}
+	for i < len(each) {
+		start := i
+		for i < len(each) && (each[i] >= '0' && each[i] <= '9' || each[i] == '.') {
+			i++
+		}
+		if i == start {
+			e.Pos = i
+			return e
+		}
+		num := each[start:i]
+		for i < len(each) && !(each[i] >= '0' && each[i] <= '9' || each[i] == '.') {
+			i++
+		}
+		switch unit := each[start+len(num) : i]; unit {
+		case "ns", "us", "µs", "μs", "ms", "s", "m", "h":
+		case "":
+			e.Pos, e.Msg = i, fmt.Sprintf("%q has no unit", num)
+			e.Hint = fmt.Sprintf("did you mean \"%vs\" or \"%vm\"?", num, num)
+			return e
+		default:
+			e.Pos, e.Msg = start+len(num), fmt.Sprintf("unknown unit %q, expects ns, us, ms, s, m or h", unit)
+			if unit == "d" {
+				if n, err := strconv.ParseFloat(num, 64); err == nil {
+					e.Hint = fmt.Sprintf("days are not a unit, did you mean \"%vh\"?", n*24)
+				}
+			}
+			return e
+		}
+	}
+	return e
+}
+
+func validateAt(at string) error {
+	m := atRe.FindStringSubmatchIndex(at)
+	if m == nil {
+		e := &ParseError{Field: "At", Expr: at, Msg: "expects HH:MM, such as 09:30, **:15 or 10:*5"}
+		if h, min, ok := strings.Cut(at, ":"); ok && len(h) == 1 && len(min) == 2 {
+			e.Hint = fmt.Sprintf("did you mean \"0%v\"?", at)
+		}
+		return e
+	}
+	hour, minute := at[m[2]:m[3]], at[m[4]:m[5]]
+	if hour != "**" {
+		if h, err := strconv.Atoi(hour); err != nil || h > 23 {
+			return &ParseError{Field: "At", Expr: at, Pos: m[2], Msg: fmt.Sprintf("hour %q expects ** or 00-23", hour)}
+		}
+	}
+	if minute[0] != '*' {
+		if n, err := strconv.Atoi(minute); err != nil || n > 59 {
+			return &ParseError{Field: "At", Expr: at, Pos: m[4], Msg: fmt.Sprintf("minute %q expects *N or 00-59", minute)}
+		}
+	}
+	return nil
+}
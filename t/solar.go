@@ -0,0 +1,103 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	Sunrise = iota
+	Sunset
+)
+
+// Julian date of the Unix epoch and J2000.
+const (
+	julianUnixEpoch = 2440587.5
+	julianJ2000     = 2451545.0
+)
+
+// Represents a daily schedule relative to sunrise or sunset
+// at a location, computed astronomically. Lat and Lon are in
+// degrees, north and east are positive. The job doesn't run on
+// days the event doesn't happen, e.g. during the polar night.
+// Example:
+// 		// every day, 30 minutes before sunrise in Istanbul
+// 		&t.When{Solar: &t.Solar{Lat: 41.01, Lon: 28.97, Event: t.Sunrise, Offset: -30 * time.Minute}}
+type Solar struct {
+	Lat, Lon float64
+	Event    int
+	Offset   time.Duration
+}
+
+// Returns the first moment of the event after start, zero
+// time if the event doesn't happen for a year.
+func (s *Solar) next(start time.Time) time.Time {
+	y, m, d := start.UTC().Date()
+	for i := -1; i <= 366; i++ {
+		day := time.Date(y, m, d+i, 0, 0, 0, 0, time.UTC)
+		rise, set, ok := sunriseSunset(day, s.Lat, s.Lon)
+		if !ok {
+			continue
+		}
+		tm := rise
+		if s.Event == Sunset {
+			tm = set
+		}
+		if tm = tm.Add(s.Offset); tm.After(start) {
+			return tm
+		}
+	}
+	return time.Time{}
+}
+
+// Computes the sunrise and the sunset around the given day with
+// the sunrise equation. Reports false if the sun doesn't rise or
+// set on that day.
+func sunriseSunset(day time.Time, lat, lon float64) (rise, set time.Time, ok bool) {
+	jdate := float64(day.Unix())/86400 + julianUnixEpoch
+	n := math.Ceil(jdate - julianJ2000 + 0.0008)
+	// mean solar time
+	jstar := n - lon/360
+	// solar mean anomaly
+	m := math.Mod(357.5291+0.98560028*jstar, 360)
+	mrad := radians(m)
+	// equation of the center
+	c := 1.9148*math.Sin(mrad) + 0.02*math.Sin(2*mrad) + 0.0003*math.Sin(3*mrad)
+	// ecliptic longitude
+	lambda := radians(math.Mod(m+c+180+102.9372, 360))
+	transit := julianJ2000 + jstar + 0.0053*math.Sin(mrad) - 0.0069*math.Sin(2*lambda)
+	// declination of the sun
+	sinDecl := math.Sin(lambda) * math.Sin(radians(23.4397))
+	cosDecl := math.Cos(math.Asin(sinDecl))
+	// hour angle
+	latrad := radians(lat)
+	cosOmega := (math.Sin(radians(-0.833)) - math.Sin(latrad)*sinDecl) / (math.Cos(latrad) * cosDecl)
+	if cosOmega < -1 || cosOmega > 1 {
+		return
+	}
+	omega := math.Acos(cosOmega) * 180 / math.Pi
+	return julianToTime(transit - omega/360), julianToTime(transit + omega/360), true
+}
+
+func julianToTime(j float64) time.Time {
+	sec := (j - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(sec*float64(time.Second)))
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
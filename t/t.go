@@ -16,8 +16,12 @@
 package t
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"reflect"
 	"regexp"
 	"strconv"
 	"time"
@@ -34,6 +38,7 @@ const (
 	Sat
 
 	tNone = iota
+	tMicrosecond
 	tMillisecond
 	tSecond
 	tMinute
@@ -42,12 +47,225 @@ const (
 	tWeek
 )
 
+const (
+	// Runs are allowed to overlap.
+	OverlapAllow = iota
+	// A run is skipped if the previous run is still in progress.
+	OverlapSkip
+	// A run is queued until the previous run is completed.
+	// Multiple queued runs are coalesced into one.
+	OverlapQueue
+)
+
+const (
+	// A run that can't happen at its scheduled time is skipped,
+	// the job waits for its next occurrence.
+	MisfireSkip = iota
+	// A run that can't happen at its scheduled time is postponed
+	// to the earliest moment it's allowed.
+	MisfirePostpone
+)
+
+const (
+	// The runs follow Misfire, whether an occurrence can be
+	// missed or run twice depends on the store of the scheduler.
+	SemanticsDefault = iota
+	// An occurrence runs at most once. Missed occurrences are
+	// skipped, and the occurrences and the stored payloads are
+	// recorded as done before they run, so a crash in the middle
+	// of a run doesn't replay it.
+	AtMostOnce
+	// An occurrence runs at least once. Missed occurrences are
+	// postponed; the occurrence missed while the scheduler was
+	// down and the runs interrupted by a crash are replayed once
+	// it's started, at the risk of running them twice.
+	AtLeastOnce
+)
+
+const (
+	PriorityLow = iota - 1
+	// The default priority of the jobs.
+	PriorityNormal
+	PriorityHigh
+	// Critical jobs run regardless of the load of the host,
+	// see ticktock.WithLoadGate.
+	PriorityCritical
+)
+
+const (
+	AlignNone = iota
+	// Aligns the runs to the beginning of minutes.
+	AlignMinute
+	// Aligns the runs to the beginning of hours.
+	AlignHour
+	// Aligns the runs to the beginning of days.
+	AlignDay
+)
+
+const (
+	// The interval is measured from the completion of the previous
+	// run, the runs drift by the duration of the job.
+	FixedDelay = iota
+	// The interval is measured from the time the previous run was
+	// scheduled at, the runs don't drift by the duration of the job.
+	// Runs missed while the job is running are skipped.
+	FixedRate
+)
+
+const (
+	// Days of month a month doesn't have, e.g. the 31st in
+	// April, are skipped.
+	MonthEndSkip = iota
+	// Days of month a month doesn't have are clamped to its
+	// last day, e.g. the 31st of April is the 30th.
+	MonthEndClamp
+	// Days of month a month doesn't have roll over into the
+	// next month, e.g. the 31st of April is the 1st of May.
+	MonthEndRoll
+)
+
+// Maximum number of consecutive excluded occurrences
+// looked through to find the next run.
+const maxExcluded = 1 << 20
+
 // Represents options for a scheduled job.
 type Opts struct {
 	When *When
+	// ExcludeCalendar contains the moments the job must not run at.
+	// Excluded runs are skipped or postponed with respect to Misfire.
+	// Postponed runs are moved to the same time of the first day
+	// that is not excluded.
+	ExcludeCalendar Calendar
+	// Blackouts contain the windows no runs can start within.
+	// Runs falling into a window are skipped or postponed to
+	// the end of the window with respect to Misfire.
+	Blackouts []Blackout
+	// Interrupt cancels the context of an in-flight run when
+	// a blackout window begins. Otherwise, in-flight runs are
+	// allowed to finish.
+	Interrupt bool
+	// Misfire is the policy for runs that can't happen
+	// at their scheduled time.
+	Misfire int
+	// Semantics is the delivery guarantee of the occurrences,
+	// AtMostOnce or AtLeastOnce. It overrides Misfire, and needs
+	// a store to hold across restarts, see ticktock.WithStore.
+	Semantics int
+	// Triggers fire the job in addition to When.
+	Triggers []Trigger
+	// Overlap is the policy for runs fired while the previous
+	// run is still in progress, either by When or a trigger.
+	Overlap int
+	// Splay delays the runs by an offset up to Splay, derived from
+	// the hostname and the job name. Identical processes on many
+	// hosts spread the runs of a job over the window, while each
+	// host keeps the same offset. Schedules that aren't aligned to
+	// the clock, such as plain intervals, are not affected.
+	Splay time.Duration
+	// AlignTo aligns interval schedules to the clock. The runs happen
+	// at the multiples of the interval from the beginning of the
+	// minute, hour or day, e.g. every 5 minutes aligned to the hour
+	// runs at :00, :05, :10 and so on. Schedules with At or Solar
+	// are already aligned to the clock, and not affected.
+	AlignTo int
+	// IntervalMode decides where the interval to the next run
+	// is measured from, FixedDelay or FixedRate.
+	IntervalMode int
+	// Tags group related jobs, such as the jobs of a tenant, to be
+	// queried or cancelled together.
+	Tags []string
+	// Metadata travels with the job, such as its owner or runbook,
+	// and is reported with its status.
+	Metadata map[string]string
+	// Jitter delays each run by a random offset up to Jitter.
+	Jitter time.Duration
+	// Priority of the job, PriorityNormal by default.
+	Priority int
+	// Weight is how much of the capacity of the scheduler the
+	// runs of the job take, such as the memory or the connections
+	// they need, 1 if zero. See ticktock.WithCapacity.
+	Weight int
+	// Affinity is the labels of the workers of the pool of the
+	// scheduler the job runs on, see ticktock.Pool. The job runs
+	// only on the workers carrying all of them.
+	Affinity []string
+	// Location the At, On and Cron of the job are interpreted in,
+	// overriding the location of the scheduler.
+	Location *time.Location
 
 	RetryCount int
-	Timeout    time.Duration
+	// RetryOn limits the retries to the errors matching one of its
+	// targets, the other errors fail the run right away. Errors are
+	// matched with errors.Is, or with errors.As if the target is a nil
+	// pointer of an error type, such as (*net.OpError)(nil). All errors
+	// are retried if it's empty.
+	RetryOn []error
+	// RetryDelay is the delay before the first retry, doubled
+	// for each of the following ones. Retries right away if zero.
+	RetryDelay time.Duration
+	// RetryDeadline bounds the time spent on all of the attempts
+	// of a run, so the retries don't spill into the next run. The
+	// attempt in progress is cancelled once it passes, and no more
+	// retries are started. No limit if zero.
+	RetryDeadline time.Duration
+	// Timeout cancels the context of an attempt that runs
+	// longer. No limit if zero.
+	Timeout time.Duration
+	// SoftTimeout warns about an attempt that runs longer, before
+	// Timeout cancels it: the attempt is emitted as an
+	// EventSoftTimeout, and OnSoftTimeout is called. No warning
+	// if zero.
+	SoftTimeout time.Duration
+	// DurationSLO is the expected duration of a run, including its
+	// retries. A run that takes longer, even if it succeeds, is
+	// emitted as an EventSLOViolated, and OnSLOViolation is called,
+	// so a creeping slowness is caught before runs are missed. No
+	// SLO if zero.
+	DurationSLO time.Duration
+	// Preemptible lets the runs of the critical jobs cancel the
+	// runs of the job to make room for them, the preempted runs
+	// are run again. See ticktock.WithPreemption.
+	Preemptible bool
+	// HistorySize is the number of the last runs kept in the
+	// history of the job, 32 if zero. HistoryAge prunes the runs
+	// started longer ago from the history, no limit if zero. The
+	// pruned runs are archived if the store of the scheduler is a
+	// ticktock.HistoryStore.
+	HistorySize int
+	HistoryAge  time.Duration
+	// BaseContext returns the parent context of each run, e.g. to
+	// carry the tenant, a logger or a deadline to the job. The runs
+	// are still cancelled if the job is cancelled.
+	BaseContext func() context.Context
+	// ReadyCheck is called before each run, e.g. to check that
+	// the database the job depends on is up. If it fails, the run
+	// is skipped or postponed with respect to Misfire; postponed
+	// runs check again every ReadyCheckInterval until it passes.
+	ReadyCheck func(ctx context.Context) error
+	// ReadyCheckInterval is how often a postponed run checks its
+	// ReadyCheck and the load gate of the scheduler again, 10
+	// seconds if zero.
+	ReadyCheckInterval time.Duration
+
+	// BeforeRun is called with the name of the job before each
+	// run, AfterRun after the run with its final error.
+	BeforeRun func(name string)
+	AfterRun  func(name string, err error)
+	// OnRetry is called before each retry with the number of the
+	// attempt to start, 2 for the first retry, the error of the
+	// previous attempt and the delay before the attempt.
+	OnRetry func(name string, attempt int, err error, delay time.Duration)
+	// OnZombie is called with the runs of the job a crashed process
+	// left unfinished, before the job is scheduled. It requires a
+	// ticktock.RunStore.
+	OnZombie func(name, runID string, started time.Time)
+	// OnSoftTimeout is called once an attempt runs longer than
+	// SoftTimeout, with the number of the attempt, 1 for the
+	// first one.
+	OnSoftTimeout func(name string, attempt int)
+	// OnSLOViolation is called once a run took longer than
+	// DurationSLO, with how long it took.
+	OnSLOViolation func(name string, took time.Duration)
 }
 
 // Represents timing for schedule jobs.
@@ -57,6 +275,7 @@ type Opts struct {
 // 		&When{Every: Every(1).Hours(), At :"**:*5"} // every hour at the first *5 minute
 // 		&When{Every: Every(2).Weeks(), On: Sun, At: "12:12"} // every 2 weeks on Sunday at 12:12
 // 		&When{Each: "2h3m"} // every 2 hour and 3 minutes
+// 		&When{Every: Every(10).Minutes(), Within: BusinessHours("09:00", "17:00", nil)} // every 10 minutes on business hours
 type When struct {
 	LastRun time.Time
 	Each    string // string parseable by time.ParseDuration
@@ -64,6 +283,39 @@ type When struct {
 	Every *every
 	On    int
 	At    string
+
+	// Within limits the runs to the hours. Runs falling out of
+	// the hours are moved to the beginning of the next hours.
+	Within *Hours
+
+	// Solar schedules the runs relative to sunrise or sunset,
+	// other timing fields are ignored if it's set.
+	Solar *Solar
+
+	// Fiscal schedules the runs on the periods of a fiscal
+	// calendar, other timing fields are ignored if it's set.
+	Fiscal *Fiscal
+
+	// Cron schedules the runs with a cron expression, see
+	// ParseCron. Other timing fields are ignored if it's set.
+	// An invalid expression makes the When invalid.
+	Cron string
+	// MonthEnd is the policy for the days of month of Cron that
+	// a month doesn't have, such as the 31st in short months.
+	MonthEnd int
+
+	// ISOWeeks limits the runs to the ISO 8601 weeks of the year,
+	// such as EvenWeeks. The runs in other weeks are skipped.
+	ISOWeeks []int
+
+	// Weeks limits the runs to the weeks of the month on the day
+	// On at At, e.g. []int{1, 3} for the 1st and the 3rd Monday
+	// of every month. Negative weeks count from the end of the
+	// month, -1 is the last. Every is ignored if it's set.
+	Weeks []int
+
+	// set by Union, Intersect and Except
+	composition *composition
 }
 
 type every struct {
@@ -81,6 +333,13 @@ func Every(n int) *every {
 	return &every{t: tSecond, n: n}
 }
 
+// Sets the unit to microseconds. Sub-millisecond intervals
+// keep a CPU busy while the job is scheduled.
+func (e *every) Microseconds() *every {
+	e.t = tMicrosecond
+	return e
+}
+
 // Sets the unit to milliseconds.
 func (e *every) Milliseconds() *every {
 	e.t = tMillisecond
@@ -117,27 +376,314 @@ func (e *every) Weeks() *every {
 	return e
 }
 
-// Duration from start to the next scheduled moment.
-func (w *When) Next(start time.Time) time.Duration {
-	var interval, diff time.Duration
-	interval = w.Duration(start)
-	for {
-		diff = start.Add(interval).Sub(time.Now())
-		if diff > 0 {
+var unitNames = map[int]string{
+	tMicrosecond: "microseconds",
+	tMillisecond: "milliseconds",
+	tSecond:      "seconds",
+	tMinute:      "minutes",
+	tHour:        "hours",
+	tDay:         "days",
+	tWeek:        "weeks",
+}
+
+type everyJSON struct {
+	N    int
+	Unit string
+}
+
+// Encodes the interval as {"N": 2, "Unit": "hours"}.
+func (e *every) MarshalJSON() ([]byte, error) {
+	return json.Marshal(everyJSON{N: e.n, Unit: unitNames[e.t]})
+}
+
+// Decodes an interval encoded by MarshalJSON.
+func (e *every) UnmarshalJSON(b []byte) error {
+	var v everyJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	for t, name := range unitNames {
+		if name == v.Unit {
+			*e = *Every(v.N)
+			e.t = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown unit %q", v.Unit)
+}
+
+// Duration from start to the next moment the job is allowed to
+// run, with respect to ExcludeCalendar, Blackouts and Misfire.
+// See NextAfter.
+func (o *Opts) Next(start time.Time) time.Duration {
+	now := time.Now()
+	next := o.next(start, now)
+	if next.IsZero() {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// Returns the first moment after now the job is allowed to run,
+// counting from the LastRun of When, or from now if it has never
+// run. Returns the zero time if there are no more runs. Unlike Next,
+// it doesn't read the clock; the same inputs give the same moment.
+func (o *Opts) NextAfter(now time.Time) time.Time {
+	start := o.When.LastRun
+	if start.IsZero() {
+		start = now
+	}
+	return o.next(start, now)
+}
+
+func (o *Opts) next(start, now time.Time) time.Time {
+	next := o.When.next(start, now)
+	if next.IsZero() {
+		return next
+	}
+	if aligned, ok := o.align(start, now); ok {
+		next = aligned
+	}
+	for i := 0; i < maxExcluded; i++ {
+		var postponed time.Time
+		if o.ExcludeCalendar != nil && o.ExcludeCalendar.IsExcluded(next) {
+			postponed = next.AddDate(0, 0, 1)
+		} else if until, ok := o.BlackedOut(next); ok {
+			postponed = until
+		} else {
 			break
 		}
+		if o.Misfire == MisfireSkip {
+			if n := o.When.next(next, now); n.After(next) {
+				postponed = n
+			}
+		}
+		next = postponed
+	}
+	return next
+}
+
+// Returns the delay before the attempt, 2 for the first retry.
+func (o *Opts) Backoff(attempt int) time.Duration {
+	if o.RetryDelay <= 0 || attempt < 2 {
+		return 0
+	}
+	d := o.RetryDelay
+	for i := 2; i < attempt; i++ {
+		if d > math.MaxInt64/2 {
+			return math.MaxInt64
+		}
+		d *= 2
+	}
+	return d
+}
+
+// Reports whether the error of a failed attempt should be
+// retried with respect to RetryOn.
+func (o *Opts) Retryable(err error) bool {
+	if len(o.RetryOn) == 0 {
+		return true
+	}
+	for _, target := range o.RetryOn {
+		if v := reflect.ValueOf(target); v.Kind() == reflect.Ptr && v.IsNil() {
+			if errors.As(err, reflect.New(v.Type()).Interface()) {
+				return true
+			}
+		} else if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the first aligned moment after both start and now,
+// reports false if the schedule can't be aligned.
+func (o *Opts) align(start, now time.Time) (time.Time, bool) {
+	w := o.When
+	if o.AlignTo == AlignNone || w.At != "" || w.Solar != nil || w.Fiscal != nil || len(w.Weeks) > 0 || len(w.ISOWeeks) > 0 || (w.Every == nil && w.Each == "") {
+		return time.Time{}, false
+	}
+	interval := w.Duration(start)
+	if interval <= 0 {
+		return time.Time{}, false
+	}
+	var boundary time.Time
+	y, m, d := start.Date()
+	switch o.AlignTo {
+	case AlignMinute:
+		boundary = time.Date(y, m, d, start.Hour(), start.Minute(), 0, 0, start.Location())
+	case AlignHour:
+		boundary = time.Date(y, m, d, start.Hour(), 0, 0, 0, start.Location())
+	case AlignDay:
+		boundary = time.Date(y, m, d, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Time{}, false
+	}
+	next := boundary.Add((start.Sub(boundary)/interval + 1) * interval)
+	if next.Before(now) {
+		next = next.Add((now.Sub(next)/interval + 1) * interval)
+	}
+	if w.Within != nil {
+		next = w.Within.next(next)
+	}
+	return next, true
+}
+
+// Reports whether tm is within a blackout window, and
+// returns the end of the window.
+func (o *Opts) BlackedOut(tm time.Time) (until time.Time, ok bool) {
+	return blackedOut(o.Blackouts, tm)
+}
+
+// Duration from start to the next scheduled moment. See NextAfter.
+func (w *When) Next(start time.Time) time.Duration {
+	now := time.Now()
+	next := w.next(start, now)
+	if next.IsZero() {
+		return 0
+	}
+	return next.Sub(now)
+}
+
+// Returns the first run after now, counting from LastRun, or from
+// now if it has never run. Returns the zero time if there are no
+// more runs. Unlike Next, it doesn't read the clock; the same
+// inputs give the same run.
+// Example:
+// 		now := time.Date(2024, 5, 6, 9, 30, 0, 0, time.UTC)
+// 		(&When{Cron: "@hourly"}).NextAfter(now) // 10:00
+func (w *When) NextAfter(now time.Time) time.Time {
+	start := w.LastRun
+	if start.IsZero() {
+		start = now
+	}
+	return w.next(start, now)
+}
+
+// Returns the first run after now, counting from start.
+func (w *When) next(start, now time.Time) time.Time {
+	if w.composition != nil {
+		return w.composition.next(start, now)
+	}
+	next := w.nextRun(start, now)
+	for i := 0; len(w.ISOWeeks) > 0 && !next.IsZero() && !w.inISOWeeks(next); i++ {
+		if i == maxComposedSteps {
+			return time.Time{}
+		}
+		next = w.nextRun(next, next)
+	}
+	return next
+}
+
+// Returns the first run after now, counting from start, regardless
+// of ISOWeeks.
+func (w *When) nextRun(start, now time.Time) time.Time {
+	if w.Cron != "" && start.Before(now) {
+		// the first run after now, rather than looking
+		// through the runs since start
+		start = now.In(start.Location())
+	}
+	interval := w.duration(start)
+	if d, ok := w.Interval(); ok {
+		// skip the missed runs at once, there may be
+		// millions of them for the short intervals
+		if late := now.Sub(start.Add(interval)); late >= 0 {
+			interval += (late/d + 1) * d
+		}
+	}
+	for !start.Add(interval).After(now) {
 		// fake the run in the past
 		// and look for the next run time in the future.
-		interval += w.Duration(start.Add(interval))
+		d := w.duration(start.Add(interval))
+		if d <= 0 {
+			// no more runs, e.g. a cron expression of past
+			// years or an invalid schedule
+			return time.Time{}
+		}
+		interval += d
 	}
-	return diff
+	next := start.Add(interval)
+	if w.Within != nil {
+		next = w.Within.next(next)
+	}
+	return next
+}
+
+// Reports whether the job runs repeatedly, rather than once.
+func (w *When) Repeats() bool {
+	if w.composition != nil {
+		return w.composition.repeats()
+	}
+	return w.Every != nil || w.Solar != nil || w.Fiscal != nil || len(w.Weeks) > 0 || (w.Cron != "" && w.Cron != "@reboot")
+}
+
+// Returns the interval between the runs, or the delay of the
+// run of Each. Reports false if the runs depend on the wall
+// clock, rather than only on the time elapsed since the last run.
+func (w *When) Interval() (time.Duration, bool) {
+	if w.composition != nil || w.Within != nil || w.Solar != nil || w.Fiscal != nil || w.Cron != "" || len(w.Weeks) > 0 || len(w.ISOWeeks) > 0 {
+		return 0, false
+	}
+	if w.Each != "" {
+		dur, err := time.ParseDuration(w.Each)
+		return dur, err == nil && dur > 0
+	}
+	if w.Every == nil || w.At != "" || w.On != NoDay {
+		return 0, false
+	}
+	return w.Duration(time.Time{}), true
 }
 
 func (w *When) Duration(start time.Time) time.Duration {
+	if w.composition != nil || len(w.ISOWeeks) > 0 {
+		next := w.next(start, start)
+		if next.IsZero() {
+			return 0
+		}
+		return next.Sub(start)
+	}
+	return w.duration(start)
+}
+
+// Returns the duration until the next run after start, regardless
+// of ISOWeeks.
+func (w *When) duration(start time.Time) time.Duration {
+	if w.Solar != nil {
+		next := w.Solar.next(start)
+		if next.IsZero() {
+			return 0
+		}
+		return next.Sub(start)
+	}
+	if w.Fiscal != nil {
+		next := w.Fiscal.next(start)
+		if next.IsZero() {
+			return 0
+		}
+		return next.Sub(start)
+	}
+	if w.Cron != "" {
+		c, err := parseCronCached(w.Cron)
+		if err != nil {
+			return 0
+		}
+		next := c.next(start, w.MonthEnd)
+		if next.IsZero() {
+			return 0
+		}
+		return next.Sub(start)
+	}
 	if w.Each != "" {
 		dur, _ := time.ParseDuration(w.Each)
 		return dur
 	}
+	if len(w.Weeks) > 0 {
+		next := w.nextOnWeeks(start)
+		if next.IsZero() {
+			return 0
+		}
+		return next.Sub(start)
+	}
 	// handle if no Every
 	if w.Every == nil {
 		return nextDayAndAtMatch(start, w.On, w.At)
@@ -146,6 +692,8 @@ func (w *When) Duration(start time.Time) time.Duration {
 	var dur time.Duration
 	n := time.Duration(w.Every.n)
 	switch w.Every.t {
+	case tMicrosecond:
+		dur = n * time.Microsecond
 	case tMillisecond:
 		dur = n * time.Millisecond
 	case tSecond:
@@ -184,9 +732,13 @@ func nextDayAndAtMatch(start time.Time, day int, at string) time.Duration {
 	return dur
 }
 
+var atRe = regexp.MustCompile("([\\d|\\*]{2}):([\\d|\\*]\\d)")
+
 func nextAtMatch(start time.Time, at string) (d time.Duration) {
-	re := regexp.MustCompile("([\\d|\\*]{2}):([\\d|\\*]\\d)")
-	matches := re.FindAllStringSubmatch(at, -1)
+	if at == "" {
+		return
+	}
+	matches := atRe.FindAllStringSubmatch(at, -1)
 	if len(matches) < 1 {
 		return
 	}
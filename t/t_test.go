@@ -15,6 +15,9 @@
 package t
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
 	"testing"
 	"time"
@@ -32,7 +35,8 @@ func TestNextDayAndAtMatch(test *testing.T) {
 
 func TestNext_EachValid(test *testing.T) {
 	w := &When{Each: "2h5m"}
-	dur := w.Next(time.Now())
+	now := time.Now()
+	dur := w.NextAfter(now).Sub(now)
 	if dur != 2*time.Hour+5*time.Minute {
 		test.Fatalf("next run should happen in 2hrs5mins, found %v.", dur)
 	}
@@ -49,7 +53,8 @@ func TestNext_EachInvalid(test *testing.T) {
 // Tests every 5 minutes.
 func TestNext_EveryMinutes(test *testing.T) {
 	w := &When{Every: Every(5).Minutes()}
-	dur := w.Next(time.Now())
+	now := time.Now()
+	dur := w.NextAfter(now).Sub(now)
 	if dur != 5*time.Minute {
 		test.Fatalf("next run should happen in 5mins, found %v.", dur)
 	}
@@ -59,7 +64,7 @@ func TestNext_EveryMinutes(test *testing.T) {
 func TestNext_EveryHourWithAt(test *testing.T) {
 	now := newTime(time.Now(), 0, 0, 40)
 	w := &When{Every: Every(1).Hours(), At: "00:10"}
-	dur := w.Next(now)
+	dur := w.NextAfter(now).Sub(now)
 	if dur != time.Hour+30*time.Minute {
 		test.Fatalf("next run should happen in 1hr30mins, found %v.", dur)
 	}
@@ -69,7 +74,7 @@ func TestNext_EveryHourWithAt(test *testing.T) {
 func TestNext_EveryDayWithAtMinuteWildcard(test *testing.T) {
 	start := newTime(time.Now(), 0, 20, 30) // 20:30, 2 later at 01:50
 	w := &When{Every: Every(1).Days(), On: Sun, At: "21:*7"}
-	dur := w.Next(start)
+	dur := w.NextAfter(start).Sub(start)
 	if dur != 25*time.Hour+7*time.Minute {
 		test.Fatalf("next run should happen in 25h7m0s, found %v.", dur)
 	}
@@ -79,7 +84,7 @@ func TestNext_EveryDayWithAtMinuteWildcard(test *testing.T) {
 func TestNext_EveryDayWithAtHourWildcard(test *testing.T) {
 	start := newTime(time.Now(), 0, 0, 0) // 20:30, 2 later at 01:50
 	w := &When{Every: Every(1).Days(), On: Sun, At: "**:10"}
-	dur := w.Next(start)
+	dur := w.NextAfter(start).Sub(start)
 	if dur != 24*time.Hour+10*time.Minute {
 		test.Fatalf("next run should happen in 24h10m0s, found %v.", dur)
 	}
@@ -89,7 +94,7 @@ func TestNext_EveryDayWithAtHourWildcard(test *testing.T) {
 func TestNext_EveryDayWithAtAndDay(test *testing.T) {
 	start := newTime(time.Now(), 0, 20, 30) // 20:30, 2 later at 01:50
 	w := &When{Every: Every(2).Days(), On: Sun, At: "01:50"}
-	dur := w.Next(start)
+	dur := w.NextAfter(start).Sub(start)
 	if dur != 53*time.Hour+20*time.Minute {
 		test.Fatalf("next run should happen in 53hr20min0sec, found %v.", dur)
 	}
@@ -100,13 +105,44 @@ func TestNext_EveryWithWeekAtAndDay(test *testing.T) {
 	start := newTime(time.Now(), 0, 0, 0)
 	weekdayDiff := int(math.Mod(float64(7+Sun-time.Now().Weekday()-1), 7))
 	w := &When{Every: Every(1).Weeks(), On: Sun, At: "12:00"}
-	dur := w.Next(start)
+	dur := w.NextAfter(start).Sub(start)
 	hours := (7+weekdayDiff)*24 + 12
 	if dur != time.Duration(hours)*time.Hour {
 		test.Fatalf("next run should happen in 53hr20min0sec, found %v.", dur)
 	}
 }
 
+func TestWhen_NextAfter(test *testing.T) {
+	now := time.Date(2024, 5, 6, 9, 30, 0, 0, time.UTC) // Monday
+	for _, tt := range []struct {
+		when *When
+		want time.Time
+	}{
+		{&When{Cron: "@hourly"}, time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)},
+		{&When{Each: "1h", LastRun: now.Add(-15 * time.Minute)}, now.Add(45 * time.Minute)},
+		// the missed runs are skipped
+		{&When{Every: Every(10).Minutes(), LastRun: now.Add(-25 * time.Minute)}, now.Add(5 * time.Minute)},
+		{&When{Every: Every(1).Hours(), Within: BusinessHours("13:00", "17:00", time.UTC)}, time.Date(2024, 5, 6, 13, 0, 0, 0, time.UTC)},
+		{&When{Cron: "0 0 12 1 1 ? 2010"}, time.Time{}},
+	} {
+		got := tt.when.NextAfter(now)
+		if !got.Equal(tt.want) {
+			test.Errorf("%+v: expected %v, found %v", tt.when, tt.want, got)
+		}
+		if again := tt.when.NextAfter(now); !again.Equal(got) {
+			test.Errorf("%+v: expected the same run again, found %v", tt.when, again)
+		}
+	}
+	o := &Opts{
+		When:      &When{Every: Every(1).Hours()},
+		Blackouts: []Blackout{Period{Start: now.Add(30 * time.Minute), End: now.Add(2 * time.Hour)}},
+		Misfire:   MisfirePostpone,
+	}
+	if got, want := o.NextAfter(now), now.Add(2*time.Hour); !got.Equal(want) {
+		test.Errorf("expected the run postponed to %v, found %v", want, got)
+	}
+}
+
 func nextTime(date time.Time, daysLater, hour, min int) time.Time {
 	return date.Add(time.Duration(daysLater*(24+hour))*time.Hour + time.Duration(min)*time.Minute)
 }
@@ -115,3 +151,582 @@ func newTime(date time.Time, days int, exactHour, exactMin int) time.Time {
 	next := date.Add(time.Duration(days) * time.Hour)
 	return time.Date(next.Year(), next.Month(), next.Day(), exactHour, exactMin, 0, 0, next.Location())
 }
+
+// Tests if runs on excluded dates are skipped or postponed.
+func TestOptsNext_ExcludeCalendar(test *testing.T) {
+	now := time.Now()
+	for misfire, want := range map[int]time.Duration{
+		MisfireSkip:     96 * time.Hour,
+		MisfirePostpone: 72 * time.Hour,
+	} {
+		o := &Opts{
+			When:            &When{Each: "48h"},
+			ExcludeCalendar: Dates{now.AddDate(0, 0, 2)},
+			Misfire:         misfire,
+		}
+		dur := o.Next(now).Round(time.Minute)
+		if dur != want {
+			test.Errorf("misfire policy %v: next run should happen in %v, found %v.", misfire, want, dur)
+		}
+	}
+}
+
+// Tests if the next moment within business hours is found.
+func TestHours_Next(test *testing.T) {
+	h := BusinessHours("09:00", "17:00", time.UTC)
+	wed := time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		tm, want time.Time
+	}{
+		{wed.Add(8 * time.Hour), wed.Add(9 * time.Hour)},
+		{wed.Add(12 * time.Hour), wed.Add(12 * time.Hour)},
+		{wed.Add(18 * time.Hour), wed.Add(33 * time.Hour)},
+		{wed.AddDate(0, 0, 3).Add(10 * time.Hour), wed.AddDate(0, 0, 5).Add(9 * time.Hour)},
+	}
+	for _, tt := range tests {
+		if got := h.next(tt.tm); !got.Equal(tt.want) {
+			test.Errorf("next moment within hours after %v should be %v, found %v", tt.tm, tt.want, got)
+		}
+	}
+}
+
+// Tests if the hours follow the wall clock on the days it changes.
+func TestHours_DST(test *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		test.Skip(err)
+	}
+	h := &Hours{start: parseClock("09:00"), end: parseClock("17:00"), loc: loc}
+	for d := range h.days {
+		h.days[d] = true
+	}
+	// the clocks spring forward, and fall back
+	for _, day := range []time.Time{
+		time.Date(2024, time.March, 10, 0, 0, 0, 0, loc),
+		time.Date(2024, time.November, 3, 0, 0, 0, 0, loc),
+	} {
+		y, m, d := day.Date()
+		tm := time.Date(y, m, d, 8, 0, 0, 0, loc)
+		if want := time.Date(y, m, d, 9, 0, 0, 0, loc); !h.next(tm).Equal(want) {
+			test.Errorf("hours after %v should open at %v, found %v", tm, want, h.next(tm))
+		}
+		if !h.IsExcluded(time.Date(y, m, d, 17, 30, 0, 0, loc)) {
+			test.Errorf("expected the hours to close at 17:00 on %v", day)
+		}
+	}
+}
+
+// Tests if daily windows spanning midnight are found.
+func TestDaily_Next(test *testing.T) {
+	b := Daily("23:00", "01:00", time.UTC)
+	day := time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		tm, start, end time.Time
+	}{
+		{day.Add(30 * time.Minute), day.Add(-time.Hour), day.Add(time.Hour)},
+		{day.Add(12 * time.Hour), day.Add(23 * time.Hour), day.Add(25 * time.Hour)},
+	}
+	for _, tt := range tests {
+		start, end := b.Next(tt.tm)
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			test.Errorf("window after %v should be %v-%v, found %v-%v", tt.tm, tt.start, tt.end, start, end)
+		}
+	}
+}
+
+// Tests if the daily windows follow the wall clock on the days it
+// changes.
+func TestDaily_DST(test *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		test.Skip(err)
+	}
+	b := Daily("22:00", "04:00", loc)
+	// the clocks spring forward on the night of March 31
+	tm := time.Date(2024, time.March, 30, 23, 0, 0, 0, loc)
+	start, end := b.Next(tm)
+	wantStart := time.Date(2024, time.March, 30, 22, 0, 0, 0, loc)
+	wantEnd := time.Date(2024, time.March, 31, 4, 0, 0, 0, loc)
+	if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+		test.Errorf("window after %v should be %v-%v, found %v-%v", tm, wantStart, wantEnd, start, end)
+	}
+	b = Daily("12:00", "13:00", loc)
+	tm = time.Date(2024, time.March, 31, 12, 30, 0, 0, loc)
+	if start, _ := b.Next(tm); !start.Equal(time.Date(2024, time.March, 31, 12, 0, 0, 0, loc)) {
+		test.Errorf("expected the window to start at noon on the wall clock, found %v", start)
+	}
+}
+
+// Tests if runs falling into a blackout are skipped or postponed.
+func TestOptsNext_Blackouts(test *testing.T) {
+	now := time.Now()
+	window := Period{Start: now.Add(90 * time.Minute), End: now.Add(150 * time.Minute)}
+	for misfire, want := range map[int]time.Duration{
+		MisfireSkip:     3 * time.Hour,
+		MisfirePostpone: 150 * time.Minute,
+	} {
+		o := &Opts{
+			When:      &When{Each: "1h"},
+			Blackouts: []Blackout{window},
+			Misfire:   misfire,
+		}
+		// the first run at +1h is not blacked out
+		if dur := o.Next(now).Round(time.Minute); dur != time.Hour {
+			test.Errorf("misfire policy %v: first run should happen in 1h, found %v.", misfire, dur)
+		}
+		dur := o.Next(now.Add(time.Hour)).Round(time.Minute)
+		if dur != want {
+			test.Errorf("misfire policy %v: next run should happen in %v, found %v.", misfire, want, dur)
+		}
+	}
+}
+
+// Tests if composed calendars exclude the moments any of them exclude.
+func TestCalendars(test *testing.T) {
+	wed := time.Date(2014, time.January, 1, 12, 0, 0, 0, time.UTC)
+	cal := Calendars{Weekends{}, Dates{wed}}
+	for tm, want := range map[time.Time]bool{
+		wed:                  true,
+		wed.AddDate(0, 0, 1): false,
+		wed.AddDate(0, 0, 3): true,
+		wed.AddDate(0, 0, 4): true,
+		wed.AddDate(0, 0, 5): false,
+	} {
+		if got := cal.IsExcluded(tm); got != want {
+			test.Errorf("%v should be excluded: %v, found %v", tm, want, got)
+		}
+	}
+}
+
+// Tests sunrise and sunset in Greenwich on the summer solstice.
+func TestSolar_Next(test *testing.T) {
+	day := time.Date(2014, time.June, 21, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		solar *Solar
+		want  time.Time
+	}{
+		{&Solar{Lat: 51.4779, Lon: -0.0015}, day.Add(3*time.Hour + 43*time.Minute)},
+		{&Solar{Lat: 51.4779, Lon: -0.0015, Event: Sunset}, day.Add(20*time.Hour + 21*time.Minute)},
+		{&Solar{Lat: 51.4779, Lon: -0.0015, Offset: -30 * time.Minute}, day.Add(3*time.Hour + 13*time.Minute)},
+	}
+	for _, tt := range tests {
+		got := tt.solar.next(day)
+		if diff := got.Sub(tt.want); diff < -2*time.Minute || diff > 2*time.Minute {
+			test.Errorf("next solar event should be around %v, found %v", tt.want, got)
+		}
+	}
+	// no sunrise in the polar night
+	if got := (&Solar{Lat: 89}).next(time.Date(2014, time.December, 21, 0, 0, 0, 0, time.UTC)); got.Month() == time.December {
+		test.Errorf("sun is not expected to rise in December on the north pole, found %v", got)
+	}
+}
+
+// Tests if intervals are aligned to the clock.
+func TestOptsAlign(test *testing.T) {
+	start := time.Date(2014, time.January, 1, 10, 3, 20, 0, time.UTC)
+	tests := []struct {
+		opts *Opts
+		want time.Time
+	}{
+		{&Opts{When: &When{Every: Every(5).Minutes()}, AlignTo: AlignHour}, start.Add(time.Minute + 40*time.Second)},
+		{&Opts{When: &When{Every: Every(5).Minutes()}, AlignTo: AlignMinute}, start.Add(4*time.Minute + 40*time.Second)},
+		{&Opts{When: &When{Each: "6h"}, AlignTo: AlignDay}, start.Add(time.Hour + 56*time.Minute + 40*time.Second)},
+	}
+	for _, tt := range tests {
+		got, ok := tt.opts.align(start, start)
+		if !ok || !got.Equal(tt.want) {
+			test.Errorf("aligned run should happen at %v, found %v", tt.want, got)
+		}
+	}
+	if _, ok := (&Opts{When: &When{Every: Every(1).Days(), At: "10:00"}, AlignTo: AlignHour}).align(start, start); ok {
+		test.Errorf("schedules with At are not expected to be aligned")
+	}
+}
+
+func BenchmarkNext_EveryDayWithAt(b *testing.B) {
+	w := &When{Every: Every(1).Days(), At: "10:00"}
+	start := time.Now()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w.Next(start)
+	}
+}
+
+func TestParseCron(test *testing.T) {
+	utc := func(y int, m time.Month, d, h, min, sec int) time.Time {
+		return time.Date(y, m, d, h, min, sec, 0, time.UTC)
+	}
+	start := utc(2014, time.June, 1, 10, 20, 30) // Sunday
+	for _, tt := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", utc(2014, time.June, 1, 10, 30, 0)},
+		{"0 9 * * MON-FRI", utc(2014, time.June, 2, 9, 0, 0)},
+		{"0 0 1,15 * 0", utc(2014, time.June, 8, 0, 0, 0)},
+		{"0 0 0 ? * 2-6", utc(2014, time.June, 2, 0, 0, 0)},
+		{"30 0 12 L * ?", utc(2014, time.June, 30, 12, 0, 30)},
+		{"0 0 12 L-2 * ?", utc(2014, time.June, 28, 12, 0, 0)},
+		{"0 0 12 15W * ?", utc(2014, time.June, 16, 12, 0, 0)},
+		{"0 0 12 LW AUG ?", utc(2014, time.August, 29, 12, 0, 0)},
+		{"0 0 12 ? * 6L", utc(2014, time.June, 27, 12, 0, 0)},
+		{"0 0 12 ? * 6#3", utc(2014, time.June, 20, 12, 0, 0)},
+		{"0 0 12 ? * FRI#1", utc(2014, time.June, 6, 12, 0, 0)},
+		{"0 0 12 29 FEB ? 2015-2020", utc(2016, time.February, 29, 12, 0, 0)},
+		{"0 0 12 1 1 ? 2010", time.Time{}},
+	} {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			test.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(start); !got.Equal(tt.want) {
+			test.Errorf("%q: expected %v, found %v", tt.expr, tt.want, got)
+		}
+	}
+	for _, expr := range []string{"* * * *", "60 * * * *", "0 0 32 * *", "0 0 0 ? * 8", "0 0 0 ? * 2#6"} {
+		if _, err := ParseCron(expr); err == nil {
+			test.Errorf("%q: expected an error", expr)
+		}
+	}
+}
+
+func TestWhen_Validate(test *testing.T) {
+	for _, tt := range []struct {
+		when  *When
+		field string
+		pos   int
+		hint  string
+	}{
+		{&When{Cron: "0 *7 * * *"}, "Cron", 2, `did you mean "*/7"?`},
+		{&When{Cron: "0 0 0 * * 0-5"}, "Cron", 10, "the days of week are 1-7 from Sunday with 6 or 7 fields"},
+		{&When{Cron: "* * * *"}, "Cron", 0, "the standard fields are minute, hour, day of month, month and day of week"},
+		{&When{Cron: "@dayly"}, "Cron", 0, "did you mean @daily?"},
+		{&When{Each: "30"}, "Each", 2, `did you mean "30s" or "30m"?`},
+		{&When{Each: "1h2d"}, "Each", 3, `days are not a unit, did you mean "48h"?`},
+		{&When{At: "9:30"}, "At", 0, `did you mean "09:30"?`},
+		{&When{Every: Every(1).Days(), At: "10:75"}, "At", 3, ""},
+	} {
+		err := tt.when.Validate()
+		perr, ok := err.(*ParseError)
+		if !ok {
+			test.Errorf("%+v: expected a parse error, found %v", tt.when, err)
+			continue
+		}
+		if perr.Field != tt.field || perr.Pos != tt.pos || perr.Hint != tt.hint {
+			test.Errorf("%+v: unexpected error: %#v", tt.when, perr)
+		}
+	}
+	for _, w := range []*When{
+		{Cron: "0 */7 * * *"},
+		{Cron: "@daily"},
+		{Each: "1h30m"},
+		{Every: Every(1).Hours(), At: "**:*5"},
+	} {
+		if err := w.Validate(); err != nil {
+			test.Errorf("%+v: %v", w, err)
+		}
+	}
+	want := `invalid Cron "0 *7 * * *" at position 2: hour field "*7" expects * or 0-23; did you mean "*/7"?`
+	if err := (&When{Cron: "0 *7 * * *"}).Validate(); err.Error() != want {
+		test.Errorf("expected %v, found %v", want, err)
+	}
+}
+
+func TestWhen_Cron(test *testing.T) {
+	w := &When{Cron: "0 */10 * * * ?"}
+	dur := w.Next(time.Now())
+	if dur <= 0 || dur > 10*time.Minute {
+		test.Errorf("expected the next run within 10 minutes, found %v", dur)
+	}
+	if got := (&When{Cron: "0 0 12 1 1 ? 2010"}).Next(time.Now()); got != 0 {
+		test.Errorf("expected no next run, found %v", got)
+	}
+}
+
+func TestParseCron_Aliases(test *testing.T) {
+	start := time.Date(2014, time.June, 1, 10, 20, 30, 0, time.UTC)
+	for expr, want := range map[string]time.Time{
+		"@yearly":  time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"@monthly": time.Date(2014, time.July, 1, 0, 0, 0, 0, time.UTC),
+		"@weekly":  time.Date(2014, time.June, 8, 0, 0, 0, 0, time.UTC),
+		"@daily":   time.Date(2014, time.June, 2, 0, 0, 0, 0, time.UTC),
+		"@hourly":  time.Date(2014, time.June, 1, 11, 0, 0, 0, time.UTC),
+	} {
+		c, err := ParseCron(expr)
+		if err != nil {
+			test.Fatalf("%q: %v", expr, err)
+		}
+		if got := c.Next(start); !got.Equal(want) {
+			test.Errorf("%q: expected %v, found %v", expr, want, got)
+		}
+	}
+	w := &When{Cron: "@reboot"}
+	if dur := w.Next(time.Now()); dur <= 0 || dur > time.Second || w.Repeats() {
+		test.Errorf("expected @reboot to run once right away, found %v", dur)
+	}
+}
+
+func TestWhen_CronMonthEnd(test *testing.T) {
+	start := time.Date(2014, time.April, 1, 0, 0, 0, 0, time.UTC)
+	for policy, want := range map[int]time.Time{
+		MonthEndSkip:  time.Date(2014, time.May, 31, 12, 0, 0, 0, time.UTC),
+		MonthEndClamp: time.Date(2014, time.April, 30, 12, 0, 0, 0, time.UTC),
+		MonthEndRoll:  time.Date(2014, time.May, 1, 12, 0, 0, 0, time.UTC),
+	} {
+		w := &When{Cron: "0 12 31 * *", MonthEnd: policy}
+		if got := start.Add(w.Duration(start)); !got.Equal(want) {
+			test.Errorf("policy %v: expected %v, found %v", policy, want, got)
+		}
+	}
+}
+
+func TestWhen_Microseconds(test *testing.T) {
+	w := &When{Every: Every(250).Microseconds()}
+	if d, ok := w.Interval(); !ok || d != 250*time.Microsecond {
+		test.Errorf("expected an interval of 250µs, found %v", d)
+	}
+	// an hour of missed runs is skipped at once
+	dur := w.Next(time.Now().Add(-time.Hour))
+	if dur <= 0 || dur > 250*time.Microsecond {
+		test.Errorf("expected the next run within 250µs, found %v", dur)
+	}
+	if _, ok := (&When{Every: Every(1).Days(), At: "10:00"}).Interval(); ok {
+		test.Error("expected no fixed interval for a run at a time of day")
+	}
+}
+
+func TestWhen_Interval(test *testing.T) {
+	for _, tt := range []struct {
+		w    *When
+		want time.Duration
+		ok   bool
+	}{
+		{&When{Each: "90s"}, 90 * time.Second, true},
+		{&When{Every: Every(2).Days()}, 48 * time.Hour, true},
+		{&When{Every: Every(1).Hours(), At: "**:30"}, 0, false},
+		{&When{Every: Every(1).Weeks(), On: Sun}, 0, false},
+		{&When{Every: Every(5).Minutes(), Within: BusinessHours("09:00", "17:00", nil)}, 0, false},
+		{&When{Cron: "@hourly"}, 0, false},
+		{&When{Each: "2hm"}, 0, false},
+	} {
+		if got, ok := tt.w.Interval(); got != tt.want || ok != tt.ok {
+			test.Errorf("%+v: expected %v, %v; found %v, %v", tt.w, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+type pathError struct{ path string }
+
+func (e *pathError) Error() string { return "bad path " + e.path }
+
+func TestOpts_Retryable(test *testing.T) {
+	errTransient := errors.New("transient")
+	o := &Opts{RetryOn: []error{errTransient, context.DeadlineExceeded, (*pathError)(nil)}}
+	for err, want := range map[error]bool{
+		errTransient:                            true,
+		fmt.Errorf("fetch: %w", errTransient):   true,
+		context.DeadlineExceeded:                true,
+		fmt.Errorf("open: %w", &pathError{"/"}): true,
+		errors.New("invalid input"):             false,
+	} {
+		if got := o.Retryable(err); got != want {
+			test.Errorf("%v: expected retryable to be %v", err, want)
+		}
+	}
+	if !(&Opts{}).Retryable(errors.New("any")) {
+		test.Error("expected all errors to be retried without RetryOn")
+	}
+}
+
+func TestOpts_Backoff(test *testing.T) {
+	o := &Opts{RetryDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 0, 2: time.Second, 3: 2 * time.Second, 5: 8 * time.Second, 100: math.MaxInt64} {
+		if got := o.Backoff(attempt); got != want {
+			test.Errorf("attempt %v: expected %v, found %v", attempt, want, got)
+		}
+	}
+}
+
+func TestUnion(test *testing.T) {
+	now := time.Date(2024, 5, 6, 9, 30, 0, 0, time.UTC) // Monday
+	w := Union(
+		&When{Cron: "0 0 18 * * MON-FRI"},
+		&When{Cron: "0 0 2 * * SAT"},
+		&When{Cron: "0 0 18 * * *"}, // coincides on weekdays
+	)
+	var runs []time.Time
+	for at := now; len(runs) < 7; {
+		at = w.NextAfter(at)
+		runs = append(runs, at)
+	}
+	want := []time.Time{
+		time.Date(2024, 5, 6, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 7, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 8, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 9, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 10, 18, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 11, 2, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 11, 18, 0, 0, 0, time.UTC),
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			test.Errorf("run %v: expected %v, found %v", i, want[i], runs[i])
+		}
+	}
+	if !w.Repeats() {
+		test.Errorf("expected the union to repeat")
+	}
+	if _, ok := w.Interval(); ok {
+		test.Errorf("expected the union not to have an interval")
+	}
+	if err := Union(&When{Cron: "@daily"}, &When{Cron: "0 *7 * * *"}).Validate(); err == nil {
+		test.Errorf("expected the invalid part to be reported")
+	}
+}
+
+func TestIntersectExcept(test *testing.T) {
+	now := time.Date(2024, 5, 6, 16, 30, 0, 0, time.UTC) // Monday
+	hourly := &When{Cron: "@hourly"}
+	in := Intersect(hourly, BusinessHours("09:00", "17:00", time.UTC))
+	if got, want := in.NextAfter(now), time.Date(2024, 5, 7, 9, 0, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the intersection to run at %v, found %v", want, got)
+	}
+	holidays := Dates{time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC)}
+	ex := Except(&When{Cron: "0 0 6 * * *"}, Weekends{}, holidays)
+	if got, want := ex.NextAfter(now), time.Date(2024, 5, 8, 6, 0, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the exception to run at %v, found %v", want, got)
+	}
+	// the runs of a timing as a set
+	quarters := Except(&When{Cron: "0 */15 * * * *"}, hourly)
+	if got, want := quarters.NextAfter(now), time.Date(2024, 5, 6, 16, 45, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the exception to run at %v, found %v", want, got)
+	}
+	if got, want := quarters.NextAfter(time.Date(2024, 5, 6, 16, 50, 0, 0, time.UTC)), time.Date(2024, 5, 6, 17, 15, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the exception to skip the hour to %v, found %v", want, got)
+	}
+	if got := Intersect(hourly, Dates{}).NextAfter(now); !got.IsZero() {
+		test.Errorf("expected no runs in an empty set, found %v", got)
+	}
+}
+
+func TestWhen_Weeks(test *testing.T) {
+	now := time.Date(2024, 5, 6, 9, 30, 0, 0, time.UTC) // the 1st Monday of May
+	w := &When{On: Mon, Weeks: []int{1, 3}, At: "09:00"}
+	var runs []time.Time
+	for at := now; len(runs) < 3; {
+		at = w.NextAfter(at)
+		runs = append(runs, at)
+	}
+	want := []time.Time{
+		time.Date(2024, 5, 20, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 17, 9, 0, 0, 0, time.UTC),
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			test.Errorf("run %v: expected %v, found %v", i, want[i], runs[i])
+		}
+	}
+	// the last Friday, and the 5th Friday only in the months with one
+	last := &When{On: Fri, Weeks: []int{-1}}
+	if got, want := last.NextAfter(now), time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the last Friday to be %v, found %v", want, got)
+	}
+	fifth := &When{On: Fri, Weeks: []int{5}, At: "18:00"}
+	if got, want := fifth.NextAfter(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)), time.Date(2024, 8, 30, 18, 0, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the next 5th Friday to be %v, found %v", want, got)
+	}
+	for _, w := range []*When{
+		{Weeks: []int{1}},
+		{On: Mon, Weeks: []int{6}},
+		{On: Mon, Weeks: []int{1}, At: "**:15"},
+	} {
+		if err := w.Validate(); err == nil {
+			test.Errorf("%+v: expected an error", w)
+		}
+	}
+}
+
+func TestWhen_Fiscal(test *testing.T) {
+	now := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	// the fiscal year starts in April, the 1st of April 2024 is a Monday
+	f := &Fiscal{YearStart: time.April, Day: 1, At: "06:00", Loc: time.UTC}
+	w := &When{Fiscal: f}
+	var runs []time.Time
+	for at := now; len(runs) < 3; {
+		at = w.NextAfter(at)
+		runs = append(runs, at)
+	}
+	want := []time.Time{
+		time.Date(2024, 4, 1, 6, 0, 0, 0, time.UTC),
+		time.Date(2024, 7, 1, 6, 0, 0, 0, time.UTC),
+		time.Date(2024, 10, 1, 6, 0, 0, 0, time.UTC),
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			test.Errorf("run %v: expected %v, found %v", i, want[i], runs[i])
+		}
+	}
+	// the 1st of June 2024 is a Saturday, the 3rd a holiday
+	f = &Fiscal{Period: FiscalMonth, Day: 1, Holidays: Dates{time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)}, Loc: time.UTC}
+	if got, want := (&When{Fiscal: f}).NextAfter(time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)), time.Date(2024, 6, 4, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the first business day to be %v, found %v", want, got)
+	}
+	// 4-4-5 from the first Monday of January 2024, the 1st
+	f = &Fiscal{Pattern: Fiscal445, WeekStart: time.Monday, Period: FiscalMonth, Loc: time.UTC}
+	w = &When{Fiscal: f}
+	runs = runs[:0]
+	for at := now; len(runs) < 3; {
+		at = w.NextAfter(at)
+		runs = append(runs, at)
+	}
+	want = []time.Time{
+		time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC),  // after 4, 4 and 5 weeks
+		time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC), // 4 weeks
+		time.Date(2024, 5, 27, 0, 0, 0, 0, time.UTC), // 4 weeks
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			test.Errorf("run %v: expected %v, found %v", i, want[i], runs[i])
+		}
+	}
+	// the last business day of the fiscal year, which has 53
+	// weeks until the 5th of January 2025
+	f = &Fiscal{Pattern: Fiscal445, WeekStart: time.Monday, Period: FiscalYear, Day: -1, Loc: time.UTC}
+	if got, want := (&When{Fiscal: f}).NextAfter(now), time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		test.Errorf("expected the last business day of the year to be %v, found %v", want, got)
+	}
+	if err := (&When{Fiscal: &Fiscal{Pattern: 7}}).Validate(); err == nil {
+		test.Errorf("expected an invalid pattern to be reported")
+	}
+}
+
+func TestWhen_ISOWeeks(test *testing.T) {
+	now := time.Date(2024, 5, 6, 9, 30, 0, 0, time.UTC) // Monday of week 19
+	w := &When{Cron: "0 0 9 * * MON", ISOWeeks: EvenWeeks()}
+	var runs []time.Time
+	for at := now; len(runs) < 3; {
+		at = w.NextAfter(at)
+		runs = append(runs, at)
+	}
+	want := []time.Time{
+		time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 27, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC),
+	}
+	for i := range want {
+		if !runs[i].Equal(want[i]) {
+			test.Errorf("run %v: expected %v, found %v", i, want[i], runs[i])
+		}
+	}
+	if d := w.Duration(now); d != runs[0].Sub(now) {
+		test.Errorf("expected the duration to skip to the even week, found %v", d)
+	}
+	if _, ok := w.Interval(); ok {
+		test.Errorf("expected the timing not to have an interval")
+	}
+	if err := (&When{Cron: "@daily", ISOWeeks: []int{54}}).Validate(); err == nil {
+		test.Errorf("expected an invalid week to be reported")
+	}
+}
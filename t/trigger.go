@@ -0,0 +1,89 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+// Represents an event source that fires a job in addition to
+// its timing. A scheduled job starts watching its triggers when
+// the scheduler is started, and stops when it's cancelled.
+type Trigger interface {
+	// Calls fire each time an event occurs, until done is closed.
+	Watch(fire func(), done <-chan struct{})
+}
+
+// Adapts a callback registering function to a Trigger.
+type TriggerFunc func(fire func(), done <-chan struct{})
+
+// Calls f with fire and done.
+func (f TriggerFunc) Watch(fire func(), done <-chan struct{}) {
+	f(fire, done)
+}
+
+// Represents a trigger that fires on each value received
+// from the channel.
+// Example:
+// 		signups := make(chan struct{})
+// 		&t.Opts{When: &t.When{Each: "1h"}, Triggers: []t.Trigger{t.ChanTrigger(signups)}}
+type ChanTrigger <-chan struct{}
+
+// Calls fire for each value received from the channel.
+func (c ChanTrigger) Watch(fire func(), done <-chan struct{}) {
+	for {
+		select {
+		case _, ok := <-c:
+			if !ok {
+				return
+			}
+			fire()
+		case <-done:
+			return
+		}
+	}
+}
+
+// Represents a trigger whose events carry the params of the runs
+// they fire. Scheduled jobs watch it with WatchParams rather than
+// Watch; the runs read the params with ticktock.Params.
+type ParamsTrigger interface {
+	Trigger
+	// Calls fire with the params of each event, until done is closed.
+	WatchParams(fire func(params interface{}), done <-chan struct{})
+}
+
+// Represents a trigger that fires on each value received from
+// the channel, with the value as the params of the run.
+// Example:
+// 		orders := make(chan interface{})
+// 		&t.Opts{When: &t.When{Each: "1h"}, Triggers: []t.Trigger{t.ParamsChanTrigger(orders)}}
+type ParamsChanTrigger <-chan interface{}
+
+// Calls fire for each value received from the channel.
+func (c ParamsChanTrigger) Watch(fire func(), done <-chan struct{}) {
+	c.WatchParams(func(interface{}) { fire() }, done)
+}
+
+// Calls fire with each value received from the channel.
+func (c ParamsChanTrigger) WatchParams(fire func(params interface{}), done <-chan struct{}) {
+	for {
+		select {
+		case v, ok := <-c:
+			if !ok {
+				return
+			}
+			fire(v)
+		case <-done:
+			return
+		}
+	}
+}
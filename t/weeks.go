@@ -0,0 +1,133 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package t
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Returns the even ISO weeks of the year, for the runs every other
+// week aligned with the week numbers rather than with the last run.
+// A year of 53 weeks is followed by two odd weeks in a row.
+// Example:
+// 		// every other Monday at 09:00, in the even weeks
+// 		&t.When{Cron: "0 0 9 * * MON", ISOWeeks: t.EvenWeeks()}
+func EvenWeeks() []int {
+	return isoWeeksFrom(2)
+}
+
+// Returns the odd ISO weeks of the year. See EvenWeeks.
+func OddWeeks() []int {
+	return isoWeeksFrom(1)
+}
+
+func isoWeeksFrom(first int) []int {
+	var weeks []int
+	for n := first; n <= 53; n += 2 {
+		weeks = append(weeks, n)
+	}
+	return weeks
+}
+
+// Reports whether tm is in one of the ISOWeeks.
+func (w *When) inISOWeeks(tm time.Time) bool {
+	_, week := tm.ISOWeek()
+	for _, n := range w.ISOWeeks {
+		if n == week {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the first run on the weeks of the month after start, on
+// the day On at At, or at midnight if At is empty.
+func (w *When) nextOnWeeks(start time.Time) time.Time {
+	hour, minute, _ := clockAt(w.At)
+	y, mon, _ := start.Date()
+	var earliest time.Time
+	// the 5th weekday of a month comes around within months
+	for i := 0; i < 24 && earliest.IsZero(); i++ {
+		for _, week := range w.Weeks {
+			day, ok := weekOfMonthDay(y, mon+time.Month(i), time.Weekday(w.On-1), week)
+			if !ok {
+				continue
+			}
+			at := time.Date(y, mon+time.Month(i), day, hour, minute, 0, 0, start.Location())
+			if at.After(start) && (earliest.IsZero() || at.Before(earliest)) {
+				earliest = at
+			}
+		}
+	}
+	return earliest
+}
+
+// Returns the day of the nth weekday of the month, counting from
+// the end of the month if n is negative. Reports false if the
+// month doesn't have one.
+func weekOfMonthDay(y int, m time.Month, wd time.Weekday, n int) (int, bool) {
+	first := time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	days := time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	day := 1 + (int(wd)-int(first.Weekday())+7)%7
+	if n > 0 {
+		day += (n - 1) * 7
+	} else {
+		last := day + (days-day)/7*7
+		day = last + (n+1)*7
+	}
+	return day, day >= 1 && day <= days
+}
+
+func validateWeeks(w *When) error {
+	expr := fmt.Sprint(w.Weeks)
+	if w.On == NoDay {
+		return &ParseError{Field: "Weeks", Expr: expr, Msg: "expects a day in On, such as t.Mon"}
+	}
+	for i, n := range w.Weeks {
+		if n == 0 || n < -5 || n > 5 {
+			return &ParseError{Field: "Weeks", Expr: expr, Pos: i, Msg: fmt.Sprintf("week %v expects 1 to 5, or -1 to -5 from the end of the month", n)}
+		}
+	}
+	if _, _, ok := clockAt(w.At); !ok {
+		return &ParseError{Field: "At", Expr: w.At, Msg: "expects HH:MM with Weeks, such as 09:30"}
+	}
+	return nil
+}
+
+func validateISOWeeks(weeks []int) error {
+	for i, n := range weeks {
+		if n < 1 || n > 53 {
+			return &ParseError{Field: "ISOWeeks", Expr: fmt.Sprint(weeks), Pos: i, Msg: fmt.Sprintf("week %v expects 1 to 53", n)}
+		}
+	}
+	return nil
+}
+
+// Returns the hour and the minute of a plain HH:MM, midnight if at
+// is empty. Reports false if at isn't a plain HH:MM.
+func clockAt(at string) (hour, minute int, ok bool) {
+	if at == "" {
+		return 0, 0, true
+	}
+	m := atRe.FindStringSubmatch(at)
+	if m == nil || m[1] == "**" || m[2][0] == '*' {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(m[1])
+	minute, _ = strconv.Atoi(m[2])
+	return hour, minute, hour < 24 && minute < 60
+}
@@ -17,7 +17,17 @@
 package ticktock
 
 import (
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 
@@ -33,14 +43,134 @@ type Job interface {
 	Run() error
 }
 
+// ContextJob is a job that is run with a context carrying
+// information about the run, such as the trigger params.
+//
+// The context is cancelled once the run is cancelled, times out or
+// is preempted. Composite jobs, such as the chains, the parallel
+// jobs and the decorators of other jobs, run their children with
+// RunJob and the context of their own run, or a context derived from
+// it; they don't start more children once it's done, and return an
+// error wrapping ctx.Err() that tells which children completed,
+// such as a *jobs.PartialError.
+type ContextJob interface {
+	Job
+	RunContext(ctx context.Context) error
+}
+
+// Runs the job with ctx, as a scheduler does: a ContextJob is run
+// with ctx, and the other jobs with Run. Returns ctx.Err() without
+// running the job if ctx is already done. See ContextJob.
+func RunJob(ctx context.Context, job Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cj, ok := job.(ContextJob); ok {
+		return cj.RunContext(ctx)
+	}
+	return job.Run()
+}
+
+type paramsKey struct{}
+
+// Returns the payload the run was triggered with, nil if
+// the run wasn't triggered with a payload.
+func Payload(ctx context.Context) []byte {
+	p, _ := Params(ctx).([]byte)
+	return p
+}
+
+type runIDKey struct{}
+
+// Returns the ID of the run, unique among the runs of the
+// scheduler. Events and errors of the run carry the same ID.
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey{}).(string)
+	return id
+}
+
+type scheduledKey struct{}
+
+// Returns the time the run was scheduled or triggered at, zero if
+// ctx isn't the context of a run.
+func ScheduledTime(ctx context.Context) time.Time {
+	at, _ := ctx.Value(scheduledKey{}).(time.Time)
+	return at
+}
+
+// Returns the params the run was triggered with, nil if the
+// run wasn't triggered with params. The params of the runs
+// triggered with a payload are the payload.
+func Params(ctx context.Context) interface{} {
+	return ctx.Value(paramsKey{})
+}
+
 // Scheduler represents a job scheduler that manages
 // a set of scheduled jobs.
 type Scheduler struct {
-	jobs    map[string]*jobC
-	started bool
+	jobs      registry
+	blackouts []t.Blackout
+	// guards blackouts, jobs read them while a shard of
+	// the registry may be locked
+	bmu sync.Mutex
+
+	clock  Clock
+	logger Logger
+	loc    *time.Location
+	store  Store
+	// the runs of the process recorded in a RunStore, so they
+	// aren't reaped as zombies
+	runsMu  sync.Mutex
+	ownRuns map[string]bool
+	// opts of the jobs scheduled without opts, may be nil
+	defaults  *t.Opts
+	listeners []Listener
+	runSinks  []RunSink
+	dryRun    bool
+	// runs later than this are missed, see WithMisfireThreshold
+	misfireAfter time.Duration
+	// limits the retries of all jobs, nil if there is no limit
+	retries *tokenBucket
+	// receives the final failures, allocated by Errors
+	errsMu sync.Mutex
+	errs   chan JobError
+	// limits the runs in progress, nil if there is no limit
+	sem chan struct{}
+	// limits the weight of the runs in progress, nil if there
+	// is no limit
+	capacity *weighted
+	// the aging of the priorities of the runs waiting for the
+	// capacity, zero if they are served in order
+	aging time.Duration
+	// the workers shared with other schedulers, may be nil
+	pool *Pool
+	// the runs in progress that can be preempted
+	preemption   bool
+	pmu          sync.Mutex
+	preemptibles map[*preemptible]struct{}
+	// resolves the secrets of the runs, may be nil
+	secrets SecretsProvider
+	// defers the runs while the host is overloaded, may be nil
+	load LoadGate
+	// the namespaces by name, see Namespace
+	nsMu       sync.Mutex
+	namespaces map[string]*Namespace
 
-	wg sync.WaitGroup
-	mu sync.Mutex
+	// ctl passes control funcs to the loop goroutine, which
+	// owns the rest of the fields; see loop.go. loopMu guards
+	// looping, and is held while a func is passed.
+	ctl     chan func()
+	loopMu  sync.Mutex
+	looping bool
+	started bool
+	queue   jobQueue
+	// number of jobs that are either queued or running
+	active  int
+	waiters []chan struct{}
+	// the readings the wall clock is checked for steps against
+	stepMono, stepWall time.Time
+	// the tags whose jobs are disabled, see DisableTag
+	disabledTags map[string]bool
 }
 
 // Schedules a job called name, with the provided timing
@@ -55,129 +185,1166 @@ func ScheduleWithOpts(name string, job Job, opts *t.Opts) (err error) {
 	return defaultScheduler.ScheduleWithOpts(name, job, opts)
 }
 
+// Schedules a job called name on the default scheduler, run at
+// the earliest of the timings. See Scheduler.ScheduleMulti.
+func ScheduleMulti(name string, job Job, whens ...*t.When) error {
+	return defaultScheduler.ScheduleMulti(name, job, whens...)
+}
+
+// Schedules the jobs on the default scheduler, all or none of them.
+// See Scheduler.ScheduleAll.
+func ScheduleAll(specs map[string]JobSpec) error {
+	return defaultScheduler.ScheduleAll(specs)
+}
+
+// Schedules a job called name on the default scheduler, unless an
+// equivalent one exists. See Scheduler.ScheduleIfAbsent.
+func ScheduleIfAbsent(name string, job Job, opts *t.Opts) (existed bool, err error) {
+	return defaultScheduler.ScheduleIfAbsent(name, job, opts)
+}
+
+// Schedules a job called name on the default scheduler, replacing
+// the job with the name if there is one. See Scheduler.Upsert.
+func Upsert(name string, job Job, opts *t.Opts) error {
+	return defaultScheduler.Upsert(name, job, opts)
+}
+
+// Renames a job registered on the default scheduler. See
+// Scheduler.Rename.
+func Rename(from, to string) error {
+	return defaultScheduler.Rename(from, to)
+}
+
 // Cancels a scheduled job registered on the default scheduler.
-// If job is already running, waits for the run to be completed
-// and cancels the next runs.
+// See Scheduler.Cancel.
 func Cancel(name string) {
 	defaultScheduler.Cancel(name)
 }
 
+// Cancels all of the jobs registered on the default scheduler.
+// See Scheduler.CancelAll.
+func CancelAll() {
+	defaultScheduler.CancelAll()
+}
+
+// Adds a blackout to the default scheduler.
+func AddBlackout(b t.Blackout) {
+	defaultScheduler.AddBlackout(b)
+}
+
 // Starts the jobs registered for the default scheduler.
 func Start() {
 	defaultScheduler.Start()
 }
 
+// Stops the default scheduler. See Scheduler.Stop.
+func Stop() {
+	defaultScheduler.Stop()
+}
+
 // Schedules a job on the scheduler. Name should be unique
 // among all registered jobs.
 func (s *Scheduler) Schedule(name string, job Job, when *t.When) error {
-	return s.ScheduleWithOpts(name, job, &t.Opts{When: when})
+	return s.ScheduleWithOpts(name, job, s.defaultOpts(when))
+}
+
+// Schedules a job on the scheduler with several timings, it runs
+// at the earliest next run among them. A run shared by the timings
+// is run once. The timings should repeat. See t.Union.
+// Example:
+// 		s.ScheduleMulti("sync", job,
+// 			&t.When{Cron: "0 0 * * * MON-FRI"},
+// 			&t.When{Cron: "0 0 6 * * SAT"})
+func (s *Scheduler) ScheduleMulti(name string, job Job, whens ...*t.When) error {
+	if len(whens) == 0 {
+		return errors.New("not a valid opts.When is provided")
+	}
+	for _, w := range whens {
+		if w == nil || !w.Repeats() {
+			return errors.New("the timings of a job with several timings should repeat")
+		}
+	}
+	return s.Schedule(name, job, t.Union(whens...))
+}
+
+// JobSpec is a job and its options, to be scheduled with ScheduleAll.
+// If Opts is nil, the job is scheduled at When with the defaults of
+// the scheduler.
+type JobSpec struct {
+	Job  Job
+	When *t.When
+	Opts *t.Opts
+}
+
+// Schedules the jobs by name, all or none of them. All of the specs
+// are validated and the names are checked against the registered
+// jobs before any is scheduled, the error returned names the job
+// that failed.
+// Example:
+// 		err := s.ScheduleAll(map[string]ticktock.JobSpec{
+// 			"backup":  {Job: backup, When: &t.When{Cron: "0 0 3 * * *"}},
+// 			"cleanup": {Job: cleanup, When: &t.When{Every: t.Every(1).Hours()}},
+// 		})
+func (s *Scheduler) ScheduleAll(specs map[string]JobSpec) error {
+	names := make([]string, 0, len(specs))
+	for name := range specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	jobs := make([]*jobC, 0, len(names))
+	for _, name := range names {
+		spec := specs[name]
+		opts := spec.Opts
+		if opts == nil {
+			opts = s.defaultOpts(spec.When)
+		}
+		j, err := s.newJob(name, spec.Job, opts, nil)
+		if err != nil {
+			return fmt.Errorf("job %v: %v", name, err)
+		}
+		jobs = append(jobs, j)
+	}
+	if name, ok := s.jobs.insertAll(jobs); !ok {
+		return fmt.Errorf("job %v: a job already exists with the name provided", name)
+	}
+	for _, j := range jobs {
+		j := j
+		// if the scheduler is not started yet, Start will add the job
+		s.do(func() { s.add(j) })
+	}
+	return nil
+}
+
+// Returns the defaults of the scheduler with when.
+func (s *Scheduler) defaultOpts(when *t.When) *t.Opts {
+	opts := &t.Opts{}
+	if s.defaults != nil {
+		*opts = *s.defaults
+		opts.Triggers = nil
+	}
+	opts.When = when
+	return opts
 }
 
+// Schedules a job with the options on the scheduler. A timing that
+// fails to parse is reported as a *t.ParseError.
 func (s *Scheduler) ScheduleWithOpts(name string, job Job, opts *t.Opts) (err error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.register(name, job, opts, nil)
+}
+
+// Schedules a job with the options as ScheduleWithOpts does, unless
+// a job with an equivalent spec is already scheduled with the name,
+// so components initialized more than once can schedule their jobs
+// each time. Reports whether the job existed. A job with the name
+// but a different spec is an error. The specs are equivalent if the
+// jobs are deeply equal, and so are the serializable options and
+// the timings, except for their LastRun; a job holding a func is
+// only equivalent to itself.
+func (s *Scheduler) ScheduleIfAbsent(name string, job Job, opts *t.Opts) (existed bool, err error) {
+	j, err := s.newJob(name, job, opts, nil)
+	if err != nil {
+		return false, err
+	}
+	for !s.jobs.insert(j) {
+		old, ok := s.jobs.get(name)
+		if !ok {
+			// cancelled in the meantime
+			continue
+		}
+		var eq bool
+		// the loop owns LastRun, compare on the loop
+		s.call(func() { eq = old.equivalent(j) })
+		if !eq {
+			return false, errors.New("a job already exists with the name provided, with a different spec")
+		}
+		return true, nil
+	}
+	// if the scheduler is not started yet, Start will add the job
+	s.do(func() { s.add(j) })
+	return false, nil
+}
 
-	if _, ok := s.jobs[name]; ok {
+// Reports whether the jobs have equivalent specs. See
+// ScheduleIfAbsent. Must be called on the loop.
+func (j *jobC) equivalent(o *jobC) bool {
+	if j.job != o.job && !reflect.DeepEqual(j.job, o.job) {
+		return false
+	}
+	a, b := newSpecOpts(j.opts), newSpecOpts(o.opts)
+	a.When.LastRun, b.When.LastRun = time.Time{}, time.Time{}
+	return reflect.DeepEqual(a, b) && reflect.DeepEqual(j.when.Within, o.when.Within)
+}
+
+// Registers the job in the namespace, nil if it's not in one.
+func (s *Scheduler) register(name string, job Job, opts *t.Opts, ns *Namespace) error {
+	j, err := s.newJob(name, job, opts, ns)
+	if err != nil {
+		return err
+	}
+	if !s.jobs.insert(j) {
 		return errors.New("a job already exists with the name provided")
 	}
-	if opts.When == nil || opts.When.Duration(time.Now()) == 0 {
-		return errors.New("not a valid opts.When is provided")
+	// if the scheduler is not started yet, Start will add the job
+	s.do(func() { s.add(j) })
+	return nil
+}
+
+// Validates the options and returns the job, not registered yet.
+func (s *Scheduler) newJob(name string, job Job, opts *t.Opts, ns *Namespace) (*jobC, error) {
+	if opts.When == nil {
+		return nil, errors.New("not a valid opts.When is provided")
 	}
-	if s.jobs == nil {
-		s.jobs = make(map[string]*jobC)
+	if err := opts.When.Validate(); err != nil {
+		return nil, err
 	}
-	s.jobs[name] = &jobC{
-		scheduler:  s,
-		job:        job,
-		retryCount: opts.RetryCount,
-		when:       opts.When,
-		forever:    opts.When.Every != nil,
-		cancelSig:  make(chan bool),
+	if opts.When.Duration(time.Now()) == 0 {
+		return nil, errors.New("not a valid opts.When is provided")
 	}
-	if s.started {
-		s.wg.Add(1)
-		s.jobs[name].schedule()
+	switch opts.Semantics {
+	case t.AtMostOnce, t.AtLeastOnce:
+		o := *opts
+		o.Misfire = t.MisfireSkip
+		if o.Semantics == t.AtLeastOnce {
+			o.Misfire = t.MisfirePostpone
+		}
+		opts = &o
 	}
-	return
+	j := &jobC{
+		scheduler: s,
+		name:      name,
+		job:       job,
+		opts:      opts,
+		when:      opts.When,
+		forever:   opts.When.Repeats(),
+		index:     -1,
+		ns:        ns,
+	}
+	if opts.Splay > 0 {
+		j.splay = splay(hostname(), name, opts.Splay)
+	}
+	if len(opts.Triggers) > 0 {
+		j.stop = make(chan struct{})
+	}
+	return j, nil
 }
 
 // Cancels a job called name. If there is no such job, returns
-// immediately. If the job is alreading running, scheduler waits
-// for the job to complete and cancels the job.
+// immediately. Cancel doesn't wait for the job: the next runs,
+// including the queued and the postponed ones, are cancelled
+// right away. If the job is already running, the context of the
+// run is cancelled, and the run is allowed to complete.
 func (s *Scheduler) Cancel(name string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.cancel(name)
+}
+
+// RunResult is the outcome of a run.
+type RunResult struct {
+	RunID string
+	// Time is the time the run was scheduled or triggered at.
+	Time     time.Time
+	Started  time.Time
+	Duration time.Duration
+	// Err is the final error of the run, after its retries.
+	Err error
+}
+
+// Cancels the job called name as Cancel does, and waits for its
+// in-flight run to complete or ctx to be done. Returns the result
+// of the last run of the job, so shutdown code can tell whether the
+// final run completed cleanly; the zero RunResult if the job has
+// never run.
+func (s *Scheduler) CancelWait(ctx context.Context, name string) (RunResult, error) {
+	job, idle, ok := s.cancel(name)
+	if !ok {
+		return RunResult{}, errors.New("no job exists with the name provided")
+	}
+	if idle != nil {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return RunResult{}, ctx.Err()
+		}
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.last, nil
+}
 
-	job, ok := s.jobs[name]
+// Removes the job called name from the scheduler and cancels it.
+// Returns the job and a channel closed once its in-flight runs are
+// completed, nil if there are none.
+func (s *Scheduler) cancel(name string) (*jobC, <-chan struct{}, bool) {
+	sh := s.jobs.shard(name)
+	sh.mu.Lock()
+	job, ok := sh.jobs[name]
+	delete(sh.jobs, name)
+	sh.mu.Unlock()
 	if !ok {
+		return nil, nil, false
+	}
+	idle := job.cancel()
+	s.do(func() { s.remove(job) })
+	return job, idle, true
+}
+
+// Cancels all of the jobs and removes them from the scheduler,
+// and waits for their in-flight runs to complete.
+func (s *Scheduler) CancelAll() {
+	jobs := s.jobs.clear()
+	var idle []<-chan struct{}
+	for _, j := range jobs {
+		if c := j.cancel(); c != nil {
+			idle = append(idle, c)
+		}
+	}
+	s.do(func() {
+		for _, j := range jobs {
+			s.remove(j)
+		}
+	})
+	for _, c := range idle {
+		<-c
+	}
+}
+
+// Cancels the jobs tagged with tag. See Cancel.
+func (s *Scheduler) CancelByTag(tag string) {
+	jobs := s.jobs.removeFunc(func(j *jobC) bool { return j.hasTag(tag) })
+	if len(jobs) == 0 {
 		return
 	}
-	job.cancel()
-	delete(s.jobs, name)
+	for _, j := range jobs {
+		j.cancel()
+	}
+	s.do(func() {
+		for _, j := range jobs {
+			s.remove(j)
+		}
+	})
+}
+
+// Returns the names of the jobs tagged with tag, sorted.
+func (s *Scheduler) JobsByTag(tag string) []string {
+	names := s.jobs.names(func(j *jobC) bool { return j.hasTag(tag) })
+	sort.Strings(names)
+	return names
+}
+
+// Pauses the job called name, its scheduled runs are skipped until
+// it's resumed. An in-flight run is allowed to complete, and the job
+// can still be triggered while paused.
+func (s *Scheduler) Pause(name string) error {
+	job, ok := s.jobs.get(name)
+	if !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	s.call(func() { s.pause(job) })
+	return nil
+}
+
+// Resumes the paused job called name from its next run, the runs
+// missed while paused are not run.
+func (s *Scheduler) Resume(name string) error {
+	job, ok := s.jobs.get(name)
+	if !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	s.call(func() { s.resume(job) })
+	return nil
+}
+
+// Pauses the job called name until the given time, and resumes
+// it then. Pausing, resuming or snoozing the job again in the
+// meantime replaces the snooze. A time that has passed resumes
+// the job.
+// Example:
+// 		s.Snooze("reindex", time.Now().Add(2*time.Hour))
+func (s *Scheduler) Snooze(name string, until time.Time) error {
+	job, ok := s.jobs.get(name)
+	if !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	s.call(func() {
+		if until.After(s.now()) {
+			s.snooze(job, until)
+		} else {
+			s.resume(job)
+		}
+	})
+	return nil
+}
+
+// Runs the job called name immediately, regardless of its
+// timing. Scheduled runs of the job are not affected.
+func (s *Scheduler) Trigger(name string) error {
+	return s.TriggerWithPayload(name, nil)
+}
+
+// Runs the job called name immediately with the payload. If the
+// job is a ContextJob, the payload can be retrieved with Payload
+// from the context of the run.
+func (s *Scheduler) TriggerWithPayload(name string, payload []byte) error {
+	if payload == nil {
+		return s.TriggerWithParams(name, nil)
+	}
+	return s.TriggerWithParams(name, payload)
+}
+
+// Runs the job called name immediately with the params, so the
+// same job can be run with different inputs. If the job is a
+// ContextJob, the params can be retrieved with Params from the
+// context of the run.
+func (s *Scheduler) TriggerWithParams(name string, params interface{}) error {
+	job, ok := s.jobs.get(name)
+	if !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	if payload, ok := params.([]byte); ok {
+		if qs, ok := s.store.(QueueStore); ok && !s.dryRun {
+			return job.enqueue(qs, payload)
+		}
+	}
+	go job.fire(s.now(), params)
+	return nil
 }
 
-// Starts to schedule the jobs.
+// Adds a blackout applying to all of the jobs, in addition to
+// their own blackouts. Runs scheduled into a blackout window are
+// handled with respect to the misfire policy of each job.
+func (s *Scheduler) AddBlackout(b t.Blackout) {
+	s.bmu.Lock()
+	defer s.bmu.Unlock()
+	s.blackouts = append(s.blackouts, b)
+}
+
+// Starts to schedule the jobs, and blocks until there are
+// no jobs left to run or the scheduler is stopped. A scheduler
+// can be started again, the jobs that have runs left are
+// rescheduled.
 func (s *Scheduler) Start() {
-	s.started = true
-	for _, j := range s.jobs {
-		s.wg.Add(1)
-		j.schedule()
+	done := make(chan struct{})
+	s.do(func() {
+		s.started = true
+		for _, j := range s.jobs.all() {
+			s.add(j)
+		}
+		s.waiters = append(s.waiters, done)
+		s.release()
+	})
+	<-done
+}
+
+// Stops scheduling the jobs. The in-flight runs are allowed to
+// complete, Start returns once they are completed. Jobs can still
+// be scheduled, cancelled and triggered while the scheduler is
+// stopped; a stopped scheduler holds no goroutines once its runs
+// are completed.
+func (s *Scheduler) Stop() {
+	s.do(s.stop)
+}
+
+// Returns a new scheduler, not started, with the configuration,
+// blackouts and jobs of s. The jobs are cloned with their options
+// and last runs, but share the Job values and triggers with s.
+// Returns an error if a job can't be scheduled on the clone, e.g.
+// if its schedule has no runs left.
+func (s *Scheduler) Clone() (*Scheduler, error) {
+	c := &Scheduler{
+		clock:     s.clock,
+		logger:    s.logger,
+		loc:       s.loc,
+		store:     s.store,
+		defaults:  s.defaults,
+		listeners: s.listeners,
+		runSinks:  s.runSinks,
+		dryRun:    s.dryRun,
+		secrets:   s.secrets,
+		load:      s.load,
+		pool:      s.pool,
+		aging:     s.aging,
+
+		misfireAfter: s.misfireAfter,
+		preemption:   s.preemption,
+	}
+	if s.sem != nil {
+		c.sem = make(chan struct{}, cap(s.sem))
+	}
+	if s.capacity != nil {
+		c.capacity = newWeighted(s.capacity.size)
+		if c.aging > 0 {
+			c.capacity.prioritize(c.aging, c.now)
+		}
+	}
+	if s.retries != nil {
+		c.retries = newTokenBucket(int(s.retries.max))
+	}
+	s.bmu.Lock()
+	c.blackouts = append([]t.Blackout(nil), s.blackouts...)
+	s.bmu.Unlock()
+
+	jobs := s.jobs.all()
+	opts := make([]*t.Opts, len(jobs))
+	// the loop owns LastRun, copy on the loop
+	s.call(func() {
+		for i, j := range jobs {
+			o := *j.opts
+			when := *j.when
+			o.When = &when
+			opts[i] = &o
+		}
+		for tag := range s.disabledTags {
+			c.disableTag(tag)
+		}
+	})
+	for i, j := range jobs {
+		var ns *Namespace
+		if j.ns != nil {
+			ns = c.Namespace(j.ns.name, j.ns.quota)
+		}
+		if err := c.register(j.name, j.job, opts[i], ns); err != nil {
+			return nil, fmt.Errorf("cloning %v: %v", j.name, err)
+		}
 	}
-	s.wg.Wait()
+	return c, nil
 }
 
+// jobC is kept small, a scheduler may hold hundreds
+// of thousands of them.
 type jobC struct {
-	scheduler  *Scheduler
-	job        Job
-	retryCount int
-	when       *t.When
-	forever    bool
-	timer      *time.Timer
-	cancelSig  chan bool
+	scheduler *Scheduler
+	name      string
+	ns        *Namespace // nil if not in a namespace
+	job       Job
+	opts      *t.Opts
+	when      *t.When
+	splay     time.Duration
+	// closed on cancel, only allocated if the job has triggers
+	stop chan struct{}
+	// the time the next run is scheduled at, delay after
+	// its occurrence by the jitter or a postponed misfire
+	scheduledAt time.Time
+	delay       time.Duration
+	forever     bool
+	// owned by the loop goroutine of the scheduler
+	index     int // in the queue, -1 if not queued
+	active    bool
+	completed bool // has no runs left
+	watching  bool
+	paused    bool
+	reaping   bool // until the zombies are reaped
+	// resumes the job paused for a while
+	resumeTimer Timer
+	// the time the paused job is resumed at, zero unless it's snoozed
+	snoozedUntil time.Time
+	// dispatched or ticking, until requeue or stopTicking
+	inflight bool
+	// closed to stop ticking, nil if the job isn't ticked
+	ticker chan struct{}
+
+	mu           sync.Mutex
+	cancelled    bool
+	running      int32
+	queued       bool
+	queuedAt     time.Time
+	queuedParams interface{}
+	// a run is postponed until the ReadyCheck and
+	// the load gate pass
+	postponed bool
+	// the time a run started waiting for the capacity
+	// of the scheduler, zero if none is waiting
+	waitingSince time.Time
+	// closed once the runs are completed, allocated
+	// if the job is cancelled while running
+	idle chan struct{}
+	// closed once the runs in progress are completed,
+	// allocated by waitIdle
+	quiet chan struct{}
+	// whether the queue of the stored payloads is being
+	// drained, and whether it should be read again
+	draining, drainAgain bool
+	// the durations of the completed runs
+	durations histogram
+	// the result of the last completed run, guarded by mu
+	last    RunResult
+	history history
+	// the context of the runs, allocated on the first run
+	ctx       context.Context
+	cancelCtx context.CancelFunc
 }
 
-func (j *jobC) schedule() {
-	select {
-	case <-j.cancelSig:
-		// TODO: cancel the timer
-		j.timer.Stop()
-		j.done()
+// Returns the next occurrence of the schedule.
+func (j *jobC) next() time.Time {
+	if j.when.LastRun.IsZero() {
+		j.when.LastRun = j.scheduler.now()
+	}
+	start := j.when.LastRun
+	if j.opts.IntervalMode == t.FixedRate && !j.scheduledAt.IsZero() {
+		start = j.occurrence()
+	}
+	return j.nextFrom(start)
+}
+
+// Schedules the next run at the occurrence, plus the jitter.
+// Must be called on the loop.
+func (j *jobC) setNext(occurrence time.Time) {
+	j.delay = 0
+	if j.opts.Jitter > 0 {
+		j.delay = time.Duration(rand.Int63n(int64(j.opts.Jitter)))
+	}
+	j.scheduledAt = occurrence.Add(j.delay)
+}
+
+// Returns the occurrence of the schedule the next run is for.
+// Must be called on the loop.
+func (j *jobC) occurrence() time.Time {
+	return j.scheduledAt.Add(-j.delay)
+}
+
+// Returns the next occurrence of the schedule after start, without
+// the jitter.
+func (j *jobC) nextFrom(start time.Time) time.Time {
+	now := j.scheduler.now()
+	// intervals are measured on the monotonic clock, which
+	// In strips, so wall clock steps don't move their runs
+	if _, ok := j.when.Interval(); !ok {
+		if loc := j.location(); loc != nil {
+			start = start.In(loc)
+		}
+	}
+	// splay the run, but compute the next one
+	// as if the previous one wasn't splayed
+	next := nextAfter(j.effectiveOpts(), start.Add(-j.splay), now)
+	if next.IsZero() {
+		// no more runs
+		next = now
+	}
+	return next.Add(j.splay)
+}
+
+// Returns the first moment after now the options allow a run at,
+// counting from start rather than the LastRun of their When.
+func nextAfter(opts *t.Opts, start, now time.Time) time.Time {
+	o, w := *opts, *opts.When
+	w.LastRun = start
+	o.When = &w
+	return o.NextAfter(now)
+}
+
+// Returns the location the timing of the job is interpreted
+// in, nil if it's time.Local.
+func (j *jobC) location() *time.Location {
+	if j.opts.Location != nil {
+		return j.opts.Location
+	}
+	return j.scheduler.loc
+}
+
+// Loads the last run of the job from the store of the
+// scheduler, unless it's already known.
+func (j *jobC) load() {
+	st := j.scheduler.store
+	if st == nil || !j.when.LastRun.IsZero() {
+		return
+	}
+	last, err := st.LastRun(j.name)
+	if err != nil {
+		j.scheduler.logf("ticktock: loading the last run of %v failed: %v", j.name, err)
+		return
+	}
+	j.when.LastRun = last
+}
+
+// Runs the job popped from the queue, and hands it back
+// to the loop for the next run.
+func (j *jobC) dispatch(at, occurrence time.Time) {
+	if j.scheduler.dryRun {
+		j.dryRun(at)
+	} else if !j.completedBefore(occurrence) {
+		if j.opts.Semantics == t.AtMostOnce {
+			j.setCompleted(occurrence)
+			j.fire(at, nil)
+		} else {
+			j.fire(at, nil)
+			j.setCompleted(occurrence)
+		}
+	}
+	last := j.scheduler.now()
+	if st := j.scheduler.store; st != nil {
+		if err := st.SetLastRun(j.name, last); err != nil {
+			j.scheduler.logf("ticktock: storing the last run of %v failed: %v", j.name, err)
+		}
+	}
+	j.scheduler.do(func() {
+		// the loop owns LastRun once the job is added
+		j.when.LastRun = last
+		j.scheduler.requeue(j)
+	})
+}
+
+func newRunID() string {
+	b := make([]byte, 8)
+	crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var (
+	hostOnce sync.Once
+	host     string
+)
+
+func hostname() string {
+	hostOnce.Do(func() {
+		host, _ = os.Hostname()
+	})
+	return host
+}
+
+// Returns an offset in [0, window) derived from host and name.
+func splay(host, name string, window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(host))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	return time.Duration(h.Sum64() % uint64(window))
+}
+
+// Returns the options of the job, including the blackouts
+// of the scheduler.
+func (j *jobC) effectiveOpts() *t.Opts {
+	j.scheduler.bmu.Lock()
+	blackouts := j.scheduler.blackouts
+	j.scheduler.bmu.Unlock()
+	if len(blackouts) == 0 {
+		return j.opts
+	}
+	opts := *j.opts
+	opts.Blackouts = append(append([]t.Blackout{}, blackouts...), j.opts.Blackouts...)
+	return &opts
+}
+
+// Starts watching the triggers of the job.
+func (j *jobC) watch() {
+	for _, tr := range j.opts.Triggers {
+		if pt, ok := tr.(t.ParamsTrigger); ok {
+			go pt.WatchParams(func(params interface{}) { go j.fire(j.scheduler.now(), params) }, j.stop)
+			continue
+		}
+		go tr.Watch(func() { go j.fire(j.scheduler.now(), nil) }, j.stop)
+	}
+}
+
+// Cancels the runs of the job, and the context of the
+// in-flight ones. The job is never run again. Returns a
+// chan closed once the in-flight runs are completed, nil
+// if the job is not running.
+func (j *jobC) cancel() <-chan struct{} {
+	return j.retire(true)
+}
+
+// Cancels the runs of the job as cancel does, but only cancels the
+// context of the in-flight ones if interrupt is true.
+func (j *jobC) retire(interrupt bool) <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.cancelled {
+		return j.idle
+	}
+	j.cancelled = true
+	j.queued, j.queuedParams = false, nil
+	// the context of the runs is cancelled once they're completed
+	if (interrupt || j.running == 0) && j.cancelCtx != nil {
+		j.cancelCtx()
+	}
+	if j.stop != nil {
+		close(j.stop)
+	}
+	if j.running > 0 {
+		j.idle = make(chan struct{})
+	}
+	return j.idle
+}
+
+func (j *jobC) hasTag(tag string) bool {
+	for _, name := range j.opts.Tags {
+		if name == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *jobC) isCancelled() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.cancelled
+}
+
+// Returns the context the runs of the job derive from,
+// done once the job is cancelled.
+func (j *jobC) context() context.Context {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.ctx == nil {
+		j.ctx, j.cancelCtx = context.WithCancel(context.Background())
+		if j.cancelled {
+			j.cancelCtx()
+		}
+	}
+	return j.ctx
+}
+
+// Reports the run scheduled at at, instead of running the job.
+func (j *jobC) dryRun(at time.Time) {
+	j.scheduler.logf("ticktock: dry run of %v scheduled at %v", j.name, at)
+	j.scheduler.emit(Event{Kind: EventDryRun, Job: j.name, Time: at})
+}
+
+// Runs the job scheduled or triggered at at, with respect to the
+// blackouts and the overlap policy. If queued runs are coalesced,
+// the last one wins.
+func (j *jobC) fire(at time.Time, params interface{}) {
+	if j.isCancelled() {
+		return
+	}
+	if j.scheduler.dryRun {
+		j.dryRun(j.scheduler.now())
+		return
+	}
+	opts := j.effectiveOpts()
+	now := j.scheduler.now()
+	if until, ok := opts.BlackedOut(now); ok {
+		if opts.Misfire == t.MisfirePostpone {
+			j.scheduler.clk().AfterFunc(until.Sub(now), func() { j.fire(at, params) })
+		}
+		return
+	}
+	if j.held(opts) {
+		j.postpone(opts, at, params)
 		return
-	default:
-		if j.when.LastRun.IsZero() {
-			j.when.LastRun = time.Now()
-		}
-		dur := j.when.Next(j.when.LastRun)
-		j.timer = time.AfterFunc(dur, func() {
-			j.run()
-			j.when.LastRun = time.Now()
-			if j.forever {
-				j.schedule()
-				return
+	}
+	j.mu.Lock()
+	if j.cancelled {
+		j.mu.Unlock()
+		return
+	}
+	if j.running > 0 {
+		switch j.opts.Overlap {
+		case t.OverlapSkip:
+			j.mu.Unlock()
+			return
+		case t.OverlapQueue:
+			j.queued = true
+			j.queuedAt, j.queuedParams = at, params
+			j.mu.Unlock()
+			return
+		}
+	}
+	j.running++
+	j.mu.Unlock()
+	j.runQueued(at, params)
+}
+
+// Reports whether the run of the job is held back, as its
+// ReadyCheck fails or the host is overloaded, and emits why.
+func (j *jobC) held(opts *t.Opts) bool {
+	if opts.ReadyCheck != nil {
+		if err := opts.ReadyCheck(j.context()); err != nil {
+			j.scheduler.logf("ticktock: %v is not ready to run: %v", j.name, err)
+			j.scheduler.emit(Event{Kind: EventNotReady, Job: j.name, Time: j.scheduler.now(), Err: err})
+			return true
+		}
+	}
+	if load := j.scheduler.load; load != nil && opts.Priority < t.PriorityCritical && load.Overloaded() {
+		j.scheduler.logf("ticktock: the host is overloaded, deferred the run of %v", j.name)
+		j.scheduler.emit(Event{Kind: EventOverloaded, Job: j.name, Time: j.scheduler.now()})
+		return true
+	}
+	return false
+}
+
+// Fires the run again after the ReadyCheckInterval if the job
+// postpones its misfires, otherwise the run is skipped. Only one
+// postponed run is kept, the runs postponed in the meantime are
+// coalesced into it.
+func (j *jobC) postpone(opts *t.Opts, at time.Time, params interface{}) {
+	if opts.Misfire != t.MisfirePostpone || j.isCancelled() {
+		return
+	}
+	j.mu.Lock()
+	postponed := j.postponed
+	j.postponed = true
+	j.mu.Unlock()
+	if postponed {
+		return
+	}
+	j.scheduler.clk().AfterFunc(readyCheckInterval(opts), func() {
+		j.mu.Lock()
+		j.postponed = false
+		j.mu.Unlock()
+		j.fire(at, params)
+	})
+}
+
+const defaultReadyCheckInterval = 10 * time.Second
+
+// Returns how often the held back runs of the job check again.
+func readyCheckInterval(opts *t.Opts) time.Duration {
+	if opts.ReadyCheckInterval <= 0 {
+		return defaultReadyCheckInterval
+	}
+	return opts.ReadyCheckInterval
+}
+
+// Runs the job, again if it's preempted, and then the run queued
+// in the meantime if there is any. The caller must have incremented
+// running.
+func (j *jobC) runQueued(at time.Time, params interface{}) {
+	for {
+		if j.run(at, params) && !j.isCancelled() {
+			// the preempted run waits for the capacity again
+			continue
+		}
+		j.mu.Lock()
+		if !j.queued {
+			j.running--
+			if j.running == 0 {
+				if j.cancelled && j.cancelCtx != nil {
+					j.cancelCtx()
+				}
+				if j.idle != nil {
+					close(j.idle)
+				}
+				if j.quiet != nil {
+					close(j.quiet)
+					j.quiet = nil
+				}
 			}
-			j.done()
-		})
+			j.mu.Unlock()
+			return
+		}
+		at, params = j.queuedAt, j.queuedParams
+		j.queued, j.queuedAt, j.queuedParams = false, time.Time{}, nil
+		j.mu.Unlock()
+	}
+}
+
+// Returns the weight of the runs of the job, 1 if it's not set.
+func (j *jobC) weight() int64 {
+	if j.opts.Weight <= 0 {
+		return 1
 	}
+	return int64(j.opts.Weight)
 }
 
-func (j *jobC) run() {
+// Runs the job scheduled or triggered at at, retrying the failed
+// attempts. Reports whether the run was preempted.
+func (j *jobC) run(at time.Time, params interface{}) (preempted bool) {
+	dispatched := j.scheduler.now()
+	base := j.context()
+	if j.opts.BaseContext != nil {
+		if ctx := j.opts.BaseContext(); ctx != nil {
+			base = ctx
+		}
+	}
+	ctx, cancel := context.WithCancel(base)
+	defer cancel()
+	if base != j.context() {
+		// the job's context still cancels the run
+		defer context.AfterFunc(j.context(), cancel)()
+	}
+	if params != nil {
+		ctx = context.WithValue(ctx, paramsKey{}, params)
+	}
+	id := newRunID()
+	ctx = context.WithValue(ctx, runIDKey{}, id)
+	ctx = context.WithValue(ctx, scheduledKey{}, at)
+	if j.scheduler.secrets != nil {
+		ctx = context.WithValue(ctx, secretsKey{}, j.scheduler.secrets)
+	}
+	if opts := j.effectiveOpts(); opts.Interrupt {
+		now := j.scheduler.now()
+		if start, ok := nextBlackout(opts.Blackouts, now); ok {
+			timer := j.scheduler.clk().AfterFunc(start.Sub(now), cancel)
+			defer timer.Stop()
+		}
+	}
+	// the slot of the namespace is taken first, a namespace at
+	// its quota shouldn't hold the slots of the others
+	if ns := j.ns; ns != nil {
+		done, ok := ns.acquire(ctx)
+		if !ok {
+			j.scheduler.logf("ticktock: the run of %v was cancelled while waiting for the quota of %v", j.name, ns.name)
+			return
+		}
+		defer done()
+	}
+	if sem := j.scheduler.sem; sem != nil {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
+	weight := j.weight()
+	if c := j.scheduler.capacity; c != nil {
+		if !j.acquireCapacity(ctx, c, weight) {
+			j.scheduler.logf("ticktock: the run of %v was cancelled while waiting for capacity", j.name)
+			return
+		}
+		defer c.release(weight)
+	}
+	if p := j.scheduler.pool; p != nil {
+		done, ok := p.acquire(ctx, weight, j.opts.Affinity)
+		if !ok {
+			if ctx.Err() == nil {
+				j.scheduler.logf("ticktock: no workers of the pool carry the labels %v of %v", j.opts.Affinity, j.name)
+			} else {
+				j.scheduler.logf("ticktock: the run of %v was cancelled while waiting for a worker", j.name)
+			}
+			return
+		}
+		defer done()
+	}
+	var pr *preemptible
+	if j.scheduler.preemption && j.opts.Preemptible {
+		pr = j.scheduler.track(j, id, weight, cancel)
+		defer j.scheduler.untrack(pr)
+	}
+	if j.opts.BeforeRun != nil {
+		j.opts.BeforeRun(j.name)
+	}
+	started := j.scheduler.now()
+	j.scheduler.emit(Event{Kind: EventStarted, Job: j.name, Time: started, RunID: id})
+	j.setStarted(StartedRun{RunID: id, Time: at, Started: started})
+	defer j.setFinished(id)
+	if j.opts.RetryDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.opts.RetryDeadline)
+		defer cancel()
+	}
+	var (
+		err      error
+		attempts int
+	)
 retryLoop:
-	for i := 0; i < j.retryCount+1; i++ {
-		if err := j.job.Run(); err == nil {
+	for i := 0; i < j.opts.RetryCount+1; i++ {
+		if i > 0 && !j.retry(ctx, id, i+1, err) {
+			break retryLoop
+		}
+		attempts++
+		if err = j.runOnce(ctx, id, i+1); err == nil || j.isCancelled() || pr.preempted() || !j.opts.Retryable(err) {
 			break retryLoop
 		}
 	}
+	if pr.preempted() {
+		err = ErrPreempted
+	}
+	took := j.scheduler.now().Sub(started)
+	j.durations.record(took, err != nil)
+	j.mu.Lock()
+	j.last = RunResult{RunID: id, Time: at, Started: started, Duration: took, Err: err}
+	pruned := j.history.add(j.last, j.opts.HistorySize, j.opts.HistoryAge, j.scheduler.now())
+	j.mu.Unlock()
+	j.archive(pruned)
+	if err != nil {
+		j.scheduler.logf("ticktock: %v failed: %v", j.name, err)
+		j.scheduler.emit(Event{Kind: EventFailed, Job: j.name, Time: started, Err: err, RunID: id, Duration: took, Attempt: attempts})
+		j.scheduler.reportError(JobError{Job: j.name, RunID: id, Time: at, Err: err})
+	} else {
+		j.scheduler.emit(Event{Kind: EventSucceeded, Job: j.name, Time: started, RunID: id, Duration: took})
+	}
+	if slo := j.opts.DurationSLO; slo > 0 && took > slo {
+		j.scheduler.logf("ticktock: %v took %v, longer than its SLO of %v", j.name, took, slo)
+		j.scheduler.emit(Event{Kind: EventSLOViolated, Job: j.name, Time: started, Err: err, RunID: id, Duration: took})
+		if j.opts.OnSLOViolation != nil {
+			j.opts.OnSLOViolation(j.name, took)
+		}
+	}
+	if j.opts.AfterRun != nil {
+		j.opts.AfterRun(j.name, err)
+	}
+	j.emitRun(RunEvent{
+		RunID:      id,
+		Scheduled:  at,
+		Dispatched: dispatched,
+		Started:    started,
+		Finished:   started.Add(took),
+		Attempts:   attempts,
+	}, params, pr.preempted(), err)
+	return pr.preempted()
 }
 
-func (j *jobC) cancel() {
-	j.cancelSig <- true
-	if j.timer != nil {
-		j.timer.Stop()
+// Returns the earliest start of the blackout windows after now.
+func nextBlackout(blackouts []t.Blackout, now time.Time) (start time.Time, ok bool) {
+	for _, b := range blackouts {
+		s, end := b.Next(now)
+		if !end.IsZero() && !s.After(now) {
+			// in progress, look for the following window
+			s, end = b.Next(end)
+		}
+		if end.IsZero() {
+			continue
+		}
+		if !ok || s.Before(start) {
+			start, ok = s, true
+		}
 	}
+	return
 }
 
-func (j *jobC) done() {
-	// TODO: jobC should not have its scheduler
-	// handle this elsewhere
-	j.scheduler.wg.Done()
+// Prepares the attempt to retry the failed run, and waits for
+// its delay. Reports false if the run shouldn't be retried.
+func (j *jobC) retry(ctx context.Context, id string, attempt int, err error) bool {
+	if !j.scheduler.retries.take(j.scheduler.now()) {
+		j.scheduler.logf("ticktock: the retry budget is exhausted, not retrying %v", j.name)
+		return false
+	}
+	delay := j.opts.Backoff(attempt)
+	if deadline, ok := ctx.Deadline(); ok && j.scheduler.now().Add(delay).After(deadline) {
+		j.scheduler.logf("ticktock: not retrying %v, the retry would start past the deadline of the run", j.name)
+		return false
+	}
+	if j.opts.OnRetry != nil {
+		j.opts.OnRetry(j.name, attempt, err, delay)
+	}
+	j.scheduler.emit(Event{Kind: EventRetrying, Job: j.name, Time: j.scheduler.now(), Err: err, Attempt: attempt, RunID: id})
+	if delay <= 0 {
+		return true
+	}
+	elapsed := make(chan struct{})
+	timer := j.scheduler.clk().AfterFunc(delay, func() { close(elapsed) })
+	select {
+	case <-elapsed:
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	}
+}
+
+func (j *jobC) runOnce(ctx context.Context, id string, attempt int) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	if j.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.opts.Timeout)
+		defer cancel()
+	}
+	if d := j.opts.SoftTimeout; d > 0 {
+		timer := j.scheduler.clk().AfterFunc(d, func() {
+			j.scheduler.logf("ticktock: attempt %v of %v is running longer than %v", attempt, j.name, d)
+			j.scheduler.emit(Event{Kind: EventSoftTimeout, Job: j.name, Time: j.scheduler.now(), RunID: id, Attempt: attempt})
+			if j.opts.OnSoftTimeout != nil {
+				j.opts.OnSoftTimeout(j.name, attempt)
+			}
+		})
+		defer timer.Stop()
+	}
+	if cj, ok := j.job.(ContextJob); ok {
+		return cj.RunContext(ctx)
+	}
+	return j.job.Run()
 }
@@ -15,8 +15,25 @@
 package ticktock
 
 import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -194,3 +211,2871 @@ func TestWhen_LastRun(test *testing.T) {
 		&t.When{LastRun: lastRun, Each: "300ms"})
 	sh.Start()
 }
+
+// Tests a job run at the earliest of several timings.
+func TestScheduleMulti(test *testing.T) {
+	sh := &Scheduler{}
+	ran := make(chan struct{}, 1)
+	err := sh.ScheduleMulti("multi", &anyJob{Fn: func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	}}, &t.When{Cron: "0 0 6 * * SAT"}, &t.When{Cron: "* * * * * *"})
+	if err != nil {
+		test.Fatal(err)
+	}
+	go sh.Start()
+	defer sh.Cancel("multi")
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		test.Fatal("expected the job to run at the earliest of its timings")
+	}
+	if st, _ := sh.Status("multi"); st.NextRun.Sub(time.Now()) > time.Second {
+		test.Errorf("expected the next run within a second, found %v", st.NextRun)
+	}
+	if err := sh.ScheduleMulti("once", &counterJob{}, &t.When{Each: "1s"}); err == nil {
+		test.Errorf("expected the timings that don't repeat to be rejected")
+	}
+}
+
+// Tests if a batch of jobs is scheduled all or nothing.
+func TestScheduleAll(test *testing.T) {
+	sh := &Scheduler{}
+	every := func() *t.When { return &t.When{Every: t.Every(1).Hours()} }
+	if err := sh.ScheduleAll(map[string]JobSpec{
+		"a": {Job: &counterJob{}, When: every()},
+		"b": {Job: &counterJob{}, When: &t.When{Cron: "invalid"}},
+	}); err == nil {
+		test.Errorf("expected the invalid timing to be rejected")
+	}
+	if jobs := sh.Jobs(); len(jobs) != 0 {
+		test.Errorf("expected no jobs to be scheduled, found %v", jobs)
+	}
+	sh.Schedule("c", &counterJob{}, every())
+	if err := sh.ScheduleAll(map[string]JobSpec{
+		"a": {Job: &counterJob{}, When: every()},
+		"c": {Job: &counterJob{}, Opts: &t.Opts{When: every()}},
+	}); err == nil {
+		test.Errorf("expected the existing name to be rejected")
+	}
+	if jobs := sh.Jobs(); len(jobs) != 1 {
+		test.Errorf("expected only the existing job, found %v", jobs)
+	}
+	if err := sh.ScheduleAll(map[string]JobSpec{
+		"a": {Job: &counterJob{}, When: every()},
+		"b": {Job: &counterJob{}, Opts: &t.Opts{When: every()}},
+	}); err != nil {
+		test.Fatal(err)
+	}
+	if jobs := sh.Jobs(); len(jobs) != 3 {
+		test.Errorf("expected 3 jobs, found %v", jobs)
+	}
+}
+
+// Tests if a job is replaced in place, keeping its last run and stats.
+func TestUpsert(test *testing.T) {
+	sh := &Scheduler{}
+	var old, updated int32
+	ran := make(chan struct{}, 1)
+	sh.Schedule("job", &anyJob{Fn: func() {
+		atomic.AddInt32(&old, 1)
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	}}, &t.When{Every: t.Every(20).Milliseconds()})
+	go sh.Start()
+	defer sh.CancelAll()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		test.Fatal("expected the job to run")
+	}
+	if err := sh.Pause("job"); err != nil {
+		test.Fatal(err)
+	}
+	before, _ := sh.Status("job")
+	err := sh.Upsert("job", &anyJob{Fn: func() { atomic.AddInt32(&updated, 1) }}, &t.Opts{
+		When: &t.When{Every: t.Every(1).Hours()},
+	})
+	if err != nil {
+		test.Fatal(err)
+	}
+	n := atomic.LoadInt32(&old)
+	st, ok := sh.Status("job")
+	if !ok {
+		test.Fatal("expected the job to be scheduled")
+	}
+	if !st.LastRun.Equal(before.LastRun) || !st.Paused {
+		test.Errorf("expected the last run %v and the paused state to be kept, found %v, %v", before.LastRun, st.LastRun, st.Paused)
+	}
+	if stats, _ := sh.Stats("job"); stats.Runs == 0 {
+		test.Errorf("expected the stats of the replaced job to be kept")
+	}
+	sh.Resume("job")
+	if st, _ := sh.Status("job"); st.NextRun.Sub(before.LastRun) < 59*time.Minute {
+		test.Errorf("expected the next run an hour after the last run, found %v", st.NextRun)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if got := atomic.LoadInt32(&old); got != n {
+		test.Errorf("expected the replaced job not to run, it ran %v more times", got-n)
+	}
+	if err := sh.Upsert("new", &counterJob{}, &t.Opts{When: &t.When{Every: t.Every(1).Hours()}}); err != nil {
+		test.Fatal(err)
+	}
+	if jobs := sh.Jobs(); len(jobs) != 2 {
+		test.Errorf("expected 2 jobs, found %v", jobs)
+	}
+}
+
+// Tests if a renamed job keeps its schedule and stats.
+func TestRename(test *testing.T) {
+	sh := &Scheduler{}
+	ran := make(chan struct{}, 1)
+	sh.Schedule("old", &anyJob{Fn: func() {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+	}}, &t.When{Every: t.Every(20).Milliseconds()})
+	sh.Schedule("taken", &counterJob{}, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	defer sh.CancelAll()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		test.Fatal("expected the job to run")
+	}
+	if err := sh.Rename("old", "taken"); err == nil {
+		test.Errorf("expected renaming to an existing name to fail")
+	}
+	sh.Pause("old")
+	before, _ := sh.Status("old")
+	if err := sh.Rename("old", "new"); err != nil {
+		test.Fatal(err)
+	}
+	if _, ok := sh.Status("old"); ok {
+		test.Errorf("expected the old name to be free")
+	}
+	st, ok := sh.Status("new")
+	if !ok {
+		test.Fatal("expected the job to be renamed")
+	}
+	if st.LastRun.Before(before.LastRun) || !st.Paused {
+		test.Errorf("expected the last run %v and the paused state to be kept, found %v, %v", before.LastRun, st.LastRun, st.Paused)
+	}
+	if stats, _ := sh.Stats("new"); stats.Runs == 0 {
+		test.Errorf("expected the stats to be kept")
+	}
+	select {
+	case <-ran:
+	default:
+	}
+	sh.Resume("new")
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		test.Fatal("expected the renamed job to run")
+	}
+	if err := sh.Rename("missing", "other"); err == nil {
+		test.Errorf("expected renaming a missing job to fail")
+	}
+}
+
+// Tests if renaming fails while the store holds the payloads or
+// the runs in progress of the job under its name.
+func TestRename_Stored(test *testing.T) {
+	qs := &memQueueStore{memStore: memStore{runs: map[string]time.Time{}}, pending: map[string][]QueuedPayload{
+		"a": {{ID: "1", Payload: []byte("x")}},
+	}}
+	sh := New(WithStore(qs))
+	sh.Schedule("a", &counterJob{}, &t.When{Every: t.Every(1).Hours()})
+	if err := sh.Rename("a", "b"); err == nil {
+		test.Error("expected renaming a job with pending payloads to fail")
+	}
+	qs.Ack("a", "1")
+	if err := sh.Rename("a", "b"); err != nil {
+		test.Errorf("expected the job to be renamed once its payloads are acked, found %v", err)
+	}
+
+	rs := &runStore{memStore: memStore{runs: map[string]time.Time{}}, started: map[string]map[string]StartedRun{}}
+	sh = New(WithStore(rs))
+	job := &blockingJob{started: make(chan struct{})}
+	sh.Schedule("a", job, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("a")
+	<-job.started
+	if err := sh.Rename("a", "b"); err == nil {
+		test.Error("expected renaming a job with a run in progress to fail")
+	}
+	if runs, _ := rs.Started("a"); len(runs) != 1 {
+		test.Errorf("expected the run to stay recorded under the name, found %v", runs)
+	}
+	sh.Cancel("a")
+}
+
+// Tests if scheduling an equivalent job again succeeds.
+func TestScheduleIfAbsent(test *testing.T) {
+	sh := &Scheduler{}
+	opts := func(cron string) *t.Opts {
+		return &t.Opts{When: &t.When{Cron: cron}, Tags: []string{"init"}}
+	}
+	if existed, err := sh.ScheduleIfAbsent("job", &counterJob{}, opts("0 0 * * * *")); err != nil || existed {
+		test.Fatalf("expected the job to be scheduled, found %v, %v", existed, err)
+	}
+	if existed, err := sh.ScheduleIfAbsent("job", &counterJob{}, opts("0 0 * * * *")); err != nil || !existed {
+		test.Errorf("expected the equivalent job to exist, found %v, %v", existed, err)
+	}
+	if _, err := sh.ScheduleIfAbsent("job", &counterJob{}, opts("0 30 * * * *")); err == nil {
+		test.Errorf("expected the job with another timing to be rejected")
+	}
+	if _, err := sh.ScheduleIfAbsent("job", &counterJob{Count: 1}, opts("0 0 * * * *")); err == nil {
+		test.Errorf("expected another job to be rejected")
+	}
+	fn := &anyJob{Fn: func() {}}
+	sh.Schedule("fn", fn, &t.When{Each: "1h"})
+	if existed, err := sh.ScheduleIfAbsent("fn", fn, &t.Opts{When: &t.When{Each: "1h"}}); err != nil || !existed {
+		test.Errorf("expected the same job to exist, found %v, %v", existed, err)
+	}
+}
+
+// Tests if the jobs of a disabled tag are skipped until it's enabled.
+func TestDisableTag(test *testing.T) {
+	sh := &Scheduler{}
+	var essential, other int32
+	sh.ScheduleWithOpts("essential", &anyJob{Fn: func() { atomic.AddInt32(&essential, 1) }}, &t.Opts{
+		When: &t.When{Every: t.Every(10).Milliseconds()},
+	})
+	sh.DisableTag("nonessential")
+	sh.ScheduleWithOpts("other", &anyJob{Fn: func() { atomic.AddInt32(&other, 1) }}, &t.Opts{
+		When: &t.When{Every: t.Every(10).Milliseconds()},
+		Tags: []string{"nonessential"},
+	})
+	go sh.Start()
+	defer sh.CancelAll()
+	time.Sleep(60 * time.Millisecond)
+	if atomic.LoadInt32(&essential) == 0 {
+		test.Errorf("expected the job without the tag to run")
+	}
+	if n := atomic.LoadInt32(&other); n != 0 {
+		test.Errorf("expected the disabled job not to run, it ran %v times", n)
+	}
+	if st, _ := sh.Status("other"); !st.Disabled || !st.NextRun.IsZero() {
+		test.Errorf("expected the job to be listed as disabled, found %+v", st)
+	}
+	if tags := sh.DisabledTags(); len(tags) != 1 || tags[0] != "nonessential" {
+		test.Errorf("expected the disabled tags to be [nonessential], found %v", tags)
+	}
+	sh.EnableTag("nonessential")
+	time.Sleep(60 * time.Millisecond)
+	if atomic.LoadInt32(&other) == 0 {
+		test.Errorf("expected the enabled job to run")
+	}
+	if st, _ := sh.Status("other"); st.Disabled {
+		test.Errorf("expected the job to be enabled")
+	}
+}
+
+// Tests if a job is run immediately when triggered.
+func TestTrigger(test *testing.T) {
+	sh := &Scheduler{}
+	done := make(chan bool, 1)
+	sh.Schedule("hi", &anyJob{Fn: func() { done <- true }}, &t.When{Each: "1h"})
+	if err := sh.Trigger("hi"); err != nil {
+		test.Fatalf("unexpected error during trigger: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		test.Fatal("triggered job is expected to run, but it didn't")
+	}
+	if err := sh.Trigger("hello"); err == nil {
+		test.Fatal("error expected while triggering a non-existing job, but not found")
+	}
+}
+
+// Tests if a job is fired by its triggers.
+func TestTriggers_Chan(test *testing.T) {
+	sh := &Scheduler{}
+	c := make(chan struct{})
+	done := make(chan bool, 1)
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() { done <- true }}, &t.Opts{
+		When:     &t.When{Each: "1h"},
+		Triggers: []t.Trigger{t.ChanTrigger(c)},
+	})
+	go sh.Start()
+	c <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		test.Fatal("job is expected to run on trigger, but it didn't")
+	}
+}
+
+type paramsJob struct {
+	params chan interface{}
+}
+
+func (job *paramsJob) Run() error {
+	return job.RunContext(context.Background())
+}
+
+func (job *paramsJob) RunContext(ctx context.Context) error {
+	job.params <- Params(ctx)
+	return nil
+}
+
+// Tests if the runs receive the params they are triggered with.
+func TestTriggerWithParams(test *testing.T) {
+	sh := &Scheduler{}
+	c := make(chan interface{})
+	job := &paramsJob{params: make(chan interface{}, 1)}
+	sh.ScheduleWithOpts("hi", job, &t.Opts{
+		When:     &t.When{Each: "1h"},
+		Triggers: []t.Trigger{t.ParamsChanTrigger(c)},
+	})
+	go sh.Start()
+	if err := sh.TriggerWithParams("hi", 42); err != nil {
+		test.Fatal(err)
+	}
+	if p := <-job.params; p != 42 {
+		test.Errorf("expected the run to receive 42, found %v", p)
+	}
+	c <- "order-1"
+	if p := <-job.params; p != "order-1" {
+		test.Errorf("expected the run to receive order-1, found %v", p)
+	}
+	sh.Trigger("hi")
+	if p := <-job.params; p != nil {
+		test.Errorf("expected no params, found %v", p)
+	}
+}
+
+// Tests if overlapping runs are skipped or queued.
+func TestOverlap(test *testing.T) {
+	for policy, want := range map[int]int32{
+		t.OverlapSkip:  1,
+		t.OverlapQueue: 2,
+	} {
+		sh := &Scheduler{}
+		var count int32
+		block := make(chan bool)
+		sh.ScheduleWithOpts("hi", &anyJob{Fn: func() {
+			atomic.AddInt32(&count, 1)
+			<-block
+		}}, &t.Opts{When: &t.When{Each: "1h"}, Overlap: policy})
+		sh.Trigger("hi")
+		time.Sleep(20 * time.Millisecond)
+		sh.Trigger("hi")
+		sh.Trigger("hi")
+		time.Sleep(20 * time.Millisecond)
+		close(block)
+		time.Sleep(20 * time.Millisecond)
+		if got := atomic.LoadInt32(&count); got != want {
+			test.Errorf("overlap policy %v: expected %v runs, found %v", policy, want, got)
+		}
+	}
+}
+
+type payloadJob struct {
+	payload chan []byte
+}
+
+func (job *payloadJob) Run() error {
+	return job.RunContext(context.Background())
+}
+
+func (job *payloadJob) RunContext(ctx context.Context) error {
+	job.payload <- Payload(ctx)
+	return nil
+}
+
+// Tests if jobs are triggered with payloads by the trigger handler.
+func TestTriggerHandler(test *testing.T) {
+	sh := &Scheduler{}
+	job := &payloadJob{payload: make(chan []byte, 1)}
+	sh.Schedule("hi", job, &t.When{Each: "1h"})
+	srv := httptest.NewServer(sh.TriggerHandler("secret"))
+	defer srv.Close()
+
+	for token, want := range map[string]int{
+		"":       http.StatusUnauthorized,
+		"wrong":  http.StatusUnauthorized,
+		"secret": http.StatusAccepted,
+	} {
+		req, _ := http.NewRequest("POST", srv.URL+"/trigger/hi", strings.NewReader("hello"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			test.Errorf("token %q: expected status %v, found %v", token, want, resp.StatusCode)
+		}
+	}
+	select {
+	case p := <-job.payload:
+		if string(p) != "hello" {
+			test.Errorf("expected payload %q, found %q", "hello", p)
+		}
+	case <-time.After(100 * time.Millisecond):
+		test.Fatal("job is expected to run on trigger, but it didn't")
+	}
+}
+
+func TestAdminHandler(test *testing.T) {
+	sh := &Scheduler{}
+	sh.ScheduleWithOpts("hi", &counterJob{}, &t.Opts{
+		When:     &t.When{Each: "1h"},
+		Metadata: map[string]string{"owner": "team-a"},
+	})
+	go sh.Start()
+	srv := httptest.NewServer(sh.AdminHandler("secret", "print"))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/jobs/hi", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var st JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		test.Fatal(err)
+	}
+	if st.Name != "hi" || st.Metadata["owner"] != "team-a" {
+		test.Errorf("unexpected status: %+v", st)
+	}
+	if d := time.Until(st.NextRun); d < 59*time.Minute || d > time.Hour {
+		test.Errorf("expected the next run in an hour, found %v", st.NextRun)
+	}
+	if jobs := sh.Jobs(); len(jobs) != 1 || jobs[0].Name != "hi" {
+		test.Errorf("unexpected jobs: %+v", jobs)
+	}
+
+	for _, h := range []http.Handler{sh.AdminHandler("secret"), sh.AdminHandler("secret", "other")} {
+		req := httptest.NewRequest("PUT", "/jobs/hello", strings.NewReader(`{"type": "print"}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			test.Errorf("expected the type not allowed to be forbidden, found %v", w.Code)
+		}
+	}
+	if _, ok := sh.Status("hello"); ok {
+		test.Error("expected no job to be scheduled of a type not allowed")
+	}
+
+	body := `{"type": "print", "params": {"Msg": "hello"}, "opts": {"when": {"Every": {"N": 2, "Unit": "hours"}}}}`
+	req, _ = http.NewRequest("PUT", srv.URL+"/jobs/hello", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		test.Fatalf("expected the job to be created, found %v", resp.Status)
+	}
+	j, ok := sh.jobs.get("hello")
+	if !ok || j.job.(*printJob).Msg != "hello" || j.when.Duration(time.Now()) != 2*time.Hour {
+		test.Error("expected the job to be scheduled from its type and params")
+	}
+
+	req, _ = http.NewRequest("DELETE", srv.URL+"/jobs/hi/pause", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "POST" {
+		test.Errorf("expected the method to be rejected, found %v allowing %q", resp.Status, resp.Header.Get("Allow"))
+	}
+}
+
+func TestPause(test *testing.T) {
+	var runs int32
+	sh := &Scheduler{}
+	sh.Schedule("hi", &anyJob{Fn: func() { atomic.AddInt32(&runs, 1) }}, &t.When{Every: t.Every(10).Milliseconds()})
+	done := make(chan struct{})
+	go func() {
+		sh.Start()
+		close(done)
+	}()
+	time.Sleep(35 * time.Millisecond)
+	if err := sh.Pause("hi"); err != nil {
+		test.Fatal(err)
+	}
+	// allow an in-flight run to complete
+	time.Sleep(5 * time.Millisecond)
+	paused := atomic.LoadInt32(&runs)
+	if paused == 0 {
+		test.Fatal("expected the job to run before it's paused")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != paused {
+		test.Errorf("expected no runs while paused, found %v", n-paused)
+	}
+	if st, _ := sh.Status("hi"); !st.Paused || !st.NextRun.IsZero() {
+		test.Errorf("unexpected status of the paused job: %+v", st)
+	}
+	if err := sh.Resume("hi"); err != nil {
+		test.Fatal(err)
+	}
+	time.Sleep(35 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n == paused {
+		test.Error("expected the job to run once resumed")
+	}
+	sh.Pause("hi")
+	sh.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		test.Error("expected Start to return once stopped while paused")
+	}
+	if err := sh.Pause("bye"); err == nil {
+		test.Error("expected an error pausing a job that doesn't exist")
+	}
+}
+
+func TestSnooze(test *testing.T) {
+	var runs int32
+	sh := &Scheduler{}
+	sh.Schedule("hi", &anyJob{Fn: func() { atomic.AddInt32(&runs, 1) }}, &t.When{Every: t.Every(10).Milliseconds()})
+	go sh.Start()
+	defer sh.Stop()
+	until := time.Now().Add(60 * time.Millisecond)
+	if err := sh.Snooze("hi", until); err != nil {
+		test.Fatal(err)
+	}
+	if st, _ := sh.Status("hi"); !st.Paused || !st.SnoozedUntil.Equal(until) {
+		test.Errorf("unexpected status of the snoozed job: %+v", st)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 0 {
+		test.Errorf("expected no runs while snoozed, found %v", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n == 0 {
+		test.Error("expected the job to run once the snooze is over")
+	}
+	if st, _ := sh.Status("hi"); st.Paused || !st.SnoozedUntil.IsZero() {
+		test.Errorf("expected the job to be resumed, found %+v", st)
+	}
+
+	// a snooze that has passed resumes the job
+	sh.Pause("hi")
+	sh.Snooze("hi", time.Now().Add(-time.Minute))
+	if st, _ := sh.Status("hi"); st.Paused {
+		test.Error("expected the job to be resumed by a snooze in the past")
+	}
+	if err := sh.Snooze("bye", until); err == nil {
+		test.Error("expected an error snoozing a job that doesn't exist")
+	}
+}
+
+func TestReadyCheck(test *testing.T) {
+	var checks, notReady int32
+	ran := make(chan struct{}, 10)
+	sh := New(WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventNotReady {
+			atomic.AddInt32(&notReady, 1)
+		}
+	})))
+	// down for the first three checks
+	sh.ScheduleWithOpts("postponed", &anyJob{Fn: func() { ran <- struct{}{} }}, &t.Opts{
+		When:    &t.When{Each: "10ms"},
+		Misfire: t.MisfirePostpone,
+		ReadyCheck: func(ctx context.Context) error {
+			if atomic.AddInt32(&checks, 1) <= 3 {
+				return errors.New("db is down")
+			}
+			return nil
+		},
+		ReadyCheckInterval: 5 * time.Millisecond,
+	})
+	var skipped int32
+	sh.ScheduleWithOpts("skipped", &anyJob{Fn: func() { atomic.AddInt32(&skipped, 1) }}, &t.Opts{
+		When:       &t.When{Every: t.Every(5).Milliseconds()},
+		ReadyCheck: func(ctx context.Context) error { return errors.New("db is down") },
+	})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		test.Fatal("expected the postponed run once the job is ready")
+	}
+	if n := atomic.LoadInt32(&checks); n != 4 {
+		test.Errorf("expected 4 checks, found %v", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&skipped); n != 0 {
+		test.Errorf("expected no runs while the job isn't ready, found %v", n)
+	}
+	if atomic.LoadInt32(&notReady) < 3 {
+		test.Error("expected the failed checks to be reported")
+	}
+}
+
+// Tests if the events of the completed runs carry their durations.
+func TestEventDuration(test *testing.T) {
+	done := make(chan Event, 1)
+	sh := New(WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventSucceeded {
+			done <- e
+		}
+	})))
+	sh.Schedule("slow", &anyJob{Fn: func() { time.Sleep(20 * time.Millisecond) }}, &t.When{Each: "1ms"})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case e := <-done:
+		if e.Duration < 20*time.Millisecond {
+			test.Errorf("expected the duration of the run, found %v", e.Duration)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the run to succeed")
+	}
+}
+
+// Tests if the panics of the jobs fail their runs.
+func TestPanicError(test *testing.T) {
+	failed := make(chan Event, 1)
+	sh := New(WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventFailed {
+			failed <- e
+		}
+	})))
+	sh.ScheduleWithOpts("panics", &anyJob{Fn: func() { panic("boom") }}, &t.Opts{
+		When:       &t.When{Each: "1ms"},
+		RetryCount: 1,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case e := <-failed:
+		var pe *PanicError
+		if !errors.As(e.Err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+			test.Errorf("expected a PanicError with the stack, found %v", e.Err)
+		}
+		if e.Attempt != 2 {
+			test.Errorf("expected 2 attempts, found %v", e.Attempt)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the run to fail")
+	}
+}
+
+// Tests if a canonical event is emitted for each run.
+func TestWithRunSink(test *testing.T) {
+	events := make(chan RunEvent, 1)
+	sh := New(WithRunSink(RunSinkFunc(func(e RunEvent) {
+		select {
+		case events <- e:
+		default:
+		}
+	})))
+	sh.ScheduleWithOpts("report", &anyJob{Fn: func() { time.Sleep(10 * time.Millisecond) }}, &t.Opts{
+		When:     &t.When{Each: "1ms"},
+		Tags:     []string{"billing"},
+		Metadata: map[string]string{"owner": "team-a"},
+	})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case e := <-events:
+		if e.Job != "report" || e.RunID == "" || e.Outcome != "succeeded" || e.Attempts != 1 {
+			test.Errorf("unexpected event: %+v", e)
+		}
+		if e.Duration < 10*time.Millisecond || !e.Finished.Equal(e.Started.Add(e.Duration)) {
+			test.Errorf("expected the timings of the run, found %+v", e)
+		}
+		if len(e.Tags) != 1 || e.Metadata["owner"] != "team-a" {
+			test.Errorf("expected the tags and the metadata of the job, found %v, %v", e.Tags, e.Metadata)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the event of the run")
+	}
+	var buf bytes.Buffer
+	JSONRunSink(&buf).Emit(RunEvent{Job: "report", Outcome: "failed"})
+	var decoded RunEvent
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded.Outcome != "failed" {
+		test.Errorf("expected the event as JSON, found %q", buf.String())
+	}
+}
+
+// Tests if the runs longer than the SLO of their jobs are reported.
+func TestDurationSLO(test *testing.T) {
+	violated := make(chan Event, 10)
+	sh := New(WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventSLOViolated {
+			violated <- e
+		}
+	})))
+	called := make(chan time.Duration, 10)
+	sh.ScheduleWithOpts("slow", &anyJob{Fn: func() { time.Sleep(20 * time.Millisecond) }}, &t.Opts{
+		When:           &t.When{Each: "1ms"},
+		DurationSLO:    10 * time.Millisecond,
+		OnSLOViolation: func(name string, took time.Duration) { called <- took },
+	})
+	sh.ScheduleWithOpts("fast", &counterJob{}, &t.Opts{
+		When:        &t.When{Each: "1ms"},
+		DurationSLO: time.Second,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case e := <-violated:
+		if e.Job != "slow" || e.Err != nil || e.Duration < 20*time.Millisecond {
+			test.Errorf("expected the successful slow run, found %+v", e)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the SLO violation")
+	}
+	if took := <-called; took < 20*time.Millisecond {
+		test.Errorf("expected OnSLOViolation with the duration, found %v", took)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for len(violated) > 0 {
+		if e := <-violated; e.Job != "slow" {
+			test.Errorf("expected no violation of the fast job, found %+v", e)
+		}
+	}
+}
+
+func TestWithLoadGate(test *testing.T) {
+	var overloaded, deferred int32 = 1, 0
+	sh := New(
+		WithLoadGate(LoadGateFunc(func() bool { return atomic.LoadInt32(&overloaded) == 1 })),
+		WithListener(ListenerFunc(func(e Event) {
+			if e.Kind == EventOverloaded {
+				atomic.AddInt32(&deferred, 1)
+			}
+		})))
+	var normal, critical int32
+	sh.Schedule("normal", &anyJob{Fn: func() { atomic.AddInt32(&normal, 1) }}, &t.When{Every: t.Every(5).Milliseconds()})
+	sh.ScheduleWithOpts("critical", &anyJob{Fn: func() { atomic.AddInt32(&critical, 1) }}, &t.Opts{
+		When:     &t.When{Every: t.Every(5).Milliseconds()},
+		Priority: t.PriorityCritical,
+	})
+	ran := make(chan struct{}, 1)
+	sh.ScheduleWithOpts("postponed", &anyJob{Fn: func() { ran <- struct{}{} }}, &t.Opts{
+		When:               &t.When{Each: "5ms"},
+		Misfire:            t.MisfirePostpone,
+		ReadyCheckInterval: 5 * time.Millisecond,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(30 * time.Millisecond)
+	if n := atomic.LoadInt32(&normal); n != 0 {
+		test.Errorf("expected no runs of the normal job while overloaded, found %v", n)
+	}
+	if atomic.LoadInt32(&critical) == 0 {
+		test.Error("expected the critical job to run while overloaded")
+	}
+	if atomic.LoadInt32(&deferred) == 0 {
+		test.Error("expected the deferred runs to be reported")
+	}
+	select {
+	case <-ran:
+		test.Fatal("expected the postponed run to wait while overloaded")
+	default:
+	}
+	atomic.StoreInt32(&overloaded, 0)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		test.Fatal("expected the postponed run once the host isn't overloaded")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&normal) == 0 {
+		test.Error("expected the normal job to run once the host isn't overloaded")
+	}
+}
+
+func TestMaxLoadAverage(test *testing.T) {
+	if _, err := os.Stat("/proc/loadavg"); err != nil {
+		test.Skip(err)
+	}
+	if !MaxLoadAverage(-1).Overloaded() {
+		test.Error("expected any load to be over -1")
+	}
+	if MaxLoadAverage(1e9).Overloaded() {
+		test.Error("expected no load to be over 1e9")
+	}
+	if _, _, ok := cpuTimes(); !ok {
+		test.Error("expected to read the CPU times")
+	}
+}
+
+func TestWithCapacity(test *testing.T) {
+	sh := New(WithCapacity(4))
+	var load, peak int32
+	job := func(weight int32) Job {
+		return &anyJob{Fn: func() {
+			n := atomic.AddInt32(&load, weight)
+			for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&load, -weight)
+		}}
+	}
+	hour := &t.When{Every: t.Every(1).Hours()}
+	sh.ScheduleWithOpts("heavy1", job(3), &t.Opts{When: hour, Weight: 3})
+	sh.ScheduleWithOpts("heavy2", job(3), &t.Opts{When: hour, Weight: 3})
+	sh.ScheduleWithOpts("light", job(1), &t.Opts{When: hour})
+	sh.ScheduleWithOpts("huge", job(4), &t.Opts{When: hour, Weight: 10})
+	go sh.Start()
+	for _, name := range []string{"heavy1", "heavy2", "light", "huge"} {
+		sh.Trigger(name)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sh.Stop()
+	if p := atomic.LoadInt32(&peak); p > 4 {
+		test.Errorf("expected the weight in progress to stay within the capacity, found %v", p)
+	}
+	if st, _ := sh.Stats("huge"); st.Runs != 1 {
+		test.Errorf("expected the job over the capacity to run alone, found %+v", st)
+	}
+}
+
+// Tests the runs of two schedulers sharing the workers of a pool.
+func TestWithPool(test *testing.T) {
+	pool := NewPool(2)
+	var running, peak int32
+	job := &anyJob{Fn: func() {
+		n := atomic.AddInt32(&running, 1)
+		for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+		}
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}}
+	var schedulers []*Scheduler
+	for i := 0; i < 2; i++ {
+		sh := New(WithPool(pool))
+		for k := 0; k < 3; k++ {
+			sh.Schedule(fmt.Sprintf("job%v", k), job, &t.When{Every: t.Every(1).Hours()})
+		}
+		go sh.Start()
+		defer sh.Stop()
+		schedulers = append(schedulers, sh)
+	}
+	for _, sh := range schedulers {
+		for k := 0; k < 3; k++ {
+			sh.Trigger(fmt.Sprintf("job%v", k))
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if st := pool.Stats(); st.Running != 2 || st.Waiting != 4 {
+		test.Errorf("expected 2 runs on the workers and 4 waiting, found %+v", st)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if p := atomic.LoadInt32(&peak); p != 2 {
+		test.Errorf("expected at most 2 runs at once across the schedulers, found %v", p)
+	}
+	if st := pool.Stats(); st.Running != 0 || st.Waiting != 0 {
+		test.Errorf("expected the workers to be released, found %+v", st)
+	}
+}
+
+// Tests the jobs run only on the workers carrying their labels.
+func TestPool_Affinity(test *testing.T) {
+	pool := NewPool(1)
+	pool.AddWorkers(1, "gpu", "io")
+	var gpu, peak int32
+	ran := make(chan string, 4)
+	sh := New(WithPool(pool))
+	for _, name := range []string{"train1", "train2"} {
+		name := name
+		sh.ScheduleWithOpts(name, &anyJob{Fn: func() {
+			n := atomic.AddInt32(&gpu, 1)
+			for p := atomic.LoadInt32(&peak); n > p && !atomic.CompareAndSwapInt32(&peak, p, n); p = atomic.LoadInt32(&peak) {
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(&gpu, -1)
+			ran <- name
+		}}, &t.Opts{When: &t.When{Every: t.Every(1).Hours()}, Affinity: []string{"gpu"}})
+	}
+	sh.Schedule("plain", &anyJob{Fn: func() { ran <- "plain" }}, &t.When{Every: t.Every(1).Hours()})
+	sh.ScheduleWithOpts("tpu", &anyJob{Fn: func() { ran <- "tpu" }}, &t.Opts{
+		When:     &t.When{Every: t.Every(1).Hours()},
+		Affinity: []string{"tpu"},
+	})
+	go sh.Start()
+	defer sh.Stop()
+	for _, name := range []string{"train1", "train2", "plain", "tpu"} {
+		sh.Trigger(name)
+	}
+	// the plain job doesn't wait for the gpu worker
+	if name := <-ran; name != "plain" {
+		test.Errorf("expected the job without affinity to run first, found %v", name)
+	}
+	for i := 0; i < 2; i++ {
+		if name := <-ran; !strings.HasPrefix(name, "train") {
+			test.Errorf("expected a job with the gpu affinity, found %v", name)
+		}
+	}
+	select {
+	case <-ran:
+		test.Errorf("expected the job without matching workers not to run")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if p := atomic.LoadInt32(&peak); p != 1 {
+		test.Errorf("expected the gpu jobs to run one at a time, found %v", p)
+	}
+}
+
+func TestWeighted(test *testing.T) {
+	w := newWeighted(3)
+	ctx := context.Background()
+	if !w.acquire(ctx, 2) {
+		test.Fatal("expected to acquire within the capacity")
+	}
+	// the heavy waiter blocks the light ones behind it
+	heavy := make(chan bool)
+	go func() { heavy <- w.acquire(ctx, 3) }()
+	time.Sleep(10 * time.Millisecond)
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if w.acquire(cctx, 1) {
+		test.Error("expected a light run not to jump the queue")
+	}
+	w.release(2)
+	if !<-heavy {
+		test.Error("expected the heavy run to acquire once released")
+	}
+	w.release(3)
+	if w.cur != 0 || w.waiters.Len() != 0 {
+		test.Errorf("expected all of the capacity back, found %v used and %v waiters", w.cur, w.waiters.Len())
+	}
+}
+
+func TestWeighted_Priority(test *testing.T) {
+	var mu sync.Mutex
+	now := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	w := newWeighted(1)
+	w.prioritize(time.Minute, clock)
+	ctx := context.Background()
+	w.acquire(ctx, 1)
+	order := make(chan int, 3)
+	// waits with the priority, until there are n waiters
+	wait := func(priority, n int) {
+		go func() {
+			w.acquirePriority(ctx, 1, priority)
+			order <- priority
+		}()
+		for w.waiting() < n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait(t.PriorityLow, 1)
+	wait(t.PriorityHigh, 2)
+	w.release(1)
+	if p := <-order; p != t.PriorityHigh {
+		test.Errorf("expected the high priority waiter first, found %v", p)
+	}
+	// the low priority waiter ages past a new high priority one
+	mu.Lock()
+	now = now.Add(3 * time.Minute)
+	mu.Unlock()
+	wait(t.PriorityHigh, 2)
+	w.release(1)
+	if p := <-order; p != t.PriorityLow {
+		test.Errorf("expected the aged low priority waiter first, found %v", p)
+	}
+	w.release(1)
+	<-order
+	if got := agedPriority(t.PriorityLow, now.Add(-time.Hour), now, time.Minute); got != t.PriorityCritical {
+		test.Errorf("expected the aged priority to stop at critical, found %v", got)
+	}
+}
+
+// Tests the aged priority of a waiting run in the status.
+func TestWithPriorityDispatch(test *testing.T) {
+	sh := New(WithCapacity(1), WithPriorityDispatch(10*time.Millisecond))
+	release := make(chan struct{})
+	hour := func() *t.When { return &t.When{Every: t.Every(1).Hours()} }
+	sh.ScheduleWithOpts("busy", &anyJob{Fn: func() { <-release }}, &t.Opts{When: hour()})
+	sh.ScheduleWithOpts("low", &counterJob{}, &t.Opts{When: hour(), Priority: t.PriorityLow})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("busy")
+	time.Sleep(10 * time.Millisecond)
+	sh.Trigger("low")
+	time.Sleep(50 * time.Millisecond)
+	st, _ := sh.Status("low")
+	if st.Priority != t.PriorityLow || st.EffectivePriority <= t.PriorityLow {
+		test.Errorf("expected the waiting run to age, found %v and %v", st.Priority, st.EffectivePriority)
+	}
+	close(release)
+	time.Sleep(20 * time.Millisecond)
+	if st, _ := sh.Status("low"); st.EffectivePriority != t.PriorityLow {
+		test.Errorf("expected the priority back to %v once run, found %v", t.PriorityLow, st.EffectivePriority)
+	}
+}
+
+// Tests a critical run preempting a preemptible one, which is
+// then run again.
+func TestWithPreemption(test *testing.T) {
+	preempted := make(chan Event, 1)
+	sh := New(WithCapacity(1), WithPriorityDispatch(0), WithPreemption(), WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventPreempted {
+			preempted <- e
+		}
+	})))
+	backup := &blockingJob{started: make(chan struct{}, 2)}
+	errs := make(chan error, 2)
+	sh.ScheduleWithOpts("backup", backup, &t.Opts{
+		When:        &t.When{Every: t.Every(1).Hours()},
+		Preemptible: true,
+		RetryCount:  3,
+		AfterRun:    func(name string, err error) { errs <- err },
+	})
+	ran := make(chan struct{}, 1)
+	sh.ScheduleWithOpts("failover", &anyJob{Fn: func() { ran <- struct{}{} }}, &t.Opts{
+		When:     &t.When{Every: t.Every(1).Hours()},
+		Priority: t.PriorityCritical,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("backup")
+	<-backup.started
+	sh.Trigger("failover")
+	select {
+	case e := <-preempted:
+		if e.Job != "backup" || len(e.Jobs) != 1 || e.Jobs[0] != "failover" {
+			test.Errorf("unexpected preemption event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the backup to be preempted")
+	}
+	if err := <-errs; err != ErrPreempted {
+		test.Errorf("expected the preempted run to fail with ErrPreempted, found %v", err)
+	}
+	<-ran
+	select {
+	case <-backup.started:
+	case <-time.After(time.Second):
+		test.Fatal("expected the preempted run to run again")
+	}
+	if st, _ := sh.Stats("backup"); st.Runs != 1 {
+		test.Errorf("expected the preempted run not to be retried, found %+v", st)
+	}
+}
+
+func TestSoftTimeout(test *testing.T) {
+	warned := make(chan Event, 1)
+	sh := New(WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventSoftTimeout {
+			warned <- e
+		}
+	})))
+	var hooked int32
+	errs := make(chan error, 1)
+	sh.ScheduleWithOpts("slow", &blockingJob{started: make(chan struct{}, 1)}, &t.Opts{
+		When:          &t.When{Every: t.Every(1).Hours()},
+		SoftTimeout:   10 * time.Millisecond,
+		Timeout:       40 * time.Millisecond,
+		OnSoftTimeout: func(name string, attempt int) { atomic.StoreInt32(&hooked, int32(attempt)) },
+		AfterRun:      func(name string, err error) { errs <- err },
+	})
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("slow")
+	select {
+	case e := <-warned:
+		if e.Job != "slow" || e.Attempt != 1 || e.RunID == "" {
+			test.Errorf("unexpected soft timeout event: %+v", e)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected a soft timeout event")
+	}
+	select {
+	case err := <-errs:
+		test.Fatalf("expected the run to be cancelled at the hard timeout only, found %v", err)
+	default:
+	}
+	if err := <-errs; err != context.DeadlineExceeded {
+		test.Errorf("expected the run to be cancelled at the hard timeout, found %v", err)
+	}
+	if atomic.LoadInt32(&hooked) != 1 {
+		test.Error("expected OnSoftTimeout to be called for the first attempt")
+	}
+}
+
+func TestConsole(test *testing.T) {
+	ran := make(chan struct{}, 1)
+	sh := &Scheduler{}
+	sh.Schedule("hi", &anyJob{Fn: func() { ran <- struct{}{} }}, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	var out bytes.Buffer
+	if err := sh.Console(strings.NewReader("trigger hi\n"), &out); err != nil {
+		test.Fatal(err)
+	}
+	<-ran
+	time.Sleep(10 * time.Millisecond)
+
+	out.Reset()
+	sh.Console(strings.NewReader("history hi\npause hi 30m\nlist\ntrigger bye\nquit\nlist\n"), &out)
+	got := out.String()
+	for _, want := range []string{"RUN", "paused until", "paused  -", "error: no job exists"} {
+		if !strings.Contains(got, want) {
+			test.Errorf("expected %q in the output of the console, found:\n%v", want, got)
+		}
+	}
+	if strings.Count(got, "JOB") != 1 {
+		test.Errorf("expected the console to stop reading at quit, found:\n%v", got)
+	}
+	if runs, _ := sh.History("hi"); len(runs) != 1 || runs[0].RunID == "" {
+		test.Errorf("expected a run in the history, found %+v", runs)
+	}
+	sh.call(func() {
+		j, _ := sh.jobs.get("hi")
+		if j.resumeTimer == nil {
+			test.Error("expected the job to be resumed in 30m")
+		}
+	})
+}
+
+func TestServeControl(test *testing.T) {
+	sh := &Scheduler{}
+	sh.Schedule("hi", &counterJob{}, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	path := test.TempDir() + "/ticktock.sock"
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		test.Skip(err)
+	}
+	defer l.Close()
+	go sh.ServeControl(l)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer conn.Close()
+	requests := []string{
+		`{"jsonrpc": "2.0", "id": 1, "method": "pause", "params": {"job": "hi", "for": "1h"}}`,
+		`{"jsonrpc": "2.0", "method": "resume", "params": {"job": "bye"}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "status", "params": {"job": "hi"}}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "reload"}`,
+		`{"jsonrpc": "2.0", "id": "4", "method": "trigger", "params": {"job": "bye"}}`,
+		`{"jsonrpc": "2.0", "id": 5, "method": "pause", "params": {"job": "hi", "for": "soon"}}`,
+	}
+	fmt.Fprintln(conn, strings.Join(requests, "\n"))
+	dec := json.NewDecoder(conn)
+	// the notification isn't answered
+	resps := make([]struct {
+		ID     json.RawMessage
+		Result json.RawMessage
+		Error  *controlError
+	}, 5)
+	for i := range resps {
+		if err := dec.Decode(&resps[i]); err != nil {
+			test.Fatal(err)
+		}
+	}
+	if string(resps[0].ID) != "1" || string(resps[0].Result) != "true" {
+		test.Errorf("unexpected response to pause: %+v", resps[0])
+	}
+	var st JobStatus
+	json.Unmarshal(resps[1].Result, &st)
+	if string(resps[1].ID) != "2" || !st.Paused {
+		test.Errorf("expected the job to be paused, found %s", resps[1].Result)
+	}
+	if resps[2].Error == nil || resps[2].Error.Code != codeMethodNotFound {
+		test.Errorf("expected method not found, found %+v", resps[2])
+	}
+	if string(resps[3].ID) != `"4"` || resps[3].Error == nil || resps[3].Error.Code != codeInvalidParams {
+		test.Errorf("expected invalid params, found %+v", resps[3])
+	}
+	if resps[4].Error == nil || resps[4].Error.Code != codeInvalidParams {
+		test.Errorf("expected the invalid duration to be reported, found %+v", resps[4])
+	}
+}
+
+func TestNamespace(test *testing.T) {
+	sh := &Scheduler{}
+	ns := sh.Namespace("acme", Quota{MaxJobs: 2, MaxConcurrent: 1, MaxRetries: 1})
+	if sh.Namespace("acme", Quota{}) != ns {
+		test.Fatal("expected the existing namespace")
+	}
+	var running, overlapped int32
+	slow := &anyJob{Fn: func() {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}}
+	when := &t.When{Every: t.Every(1).Hours()}
+	if err := ns.Schedule("a", slow, when); err != nil {
+		test.Fatal(err)
+	}
+	failing := &errorJob{errorAfter: 100}
+	if err := ns.ScheduleWithOpts("b", failing, &t.Opts{When: when, RetryCount: 5}); err != nil {
+		test.Fatal(err)
+	}
+	if err := ns.Schedule("c", slow, when); err == nil {
+		test.Error("expected the quota of the jobs to be enforced")
+	}
+	if err := sh.Schedule("c", slow, when); err != nil {
+		test.Errorf("expected the jobs outside of the namespace not to count, found %v", err)
+	}
+	if jobs := ns.Jobs(); len(jobs) != 2 || jobs[0].Name != "a" || jobs[1].Name != "b" {
+		test.Errorf("unexpected jobs in the namespace: %+v", jobs)
+	}
+	if _, ok := sh.Status("acme/a"); !ok {
+		test.Error("expected the job to be registered with the namespace prefix")
+	}
+
+	ns.Trigger("a")
+	ns.Trigger("a")
+	ns.Trigger("b")
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&overlapped) != 0 {
+		test.Error("expected no more than one run of the namespace at a time")
+	}
+	if st := ns.Stats(); st.Jobs != 2 || st.Launched != 3 || st.Throttled != 0 {
+		test.Errorf("unexpected stats of the namespace: %+v", st)
+	}
+	sh.CancelWait(context.Background(), "acme/b")
+	if failing.count != 2 {
+		test.Errorf("expected the retries to be capped at 1, found %v attempts", failing.count)
+	}
+
+	ns.Cancel("a")
+	if err := ns.Schedule("c", slow, when); err != nil {
+		test.Errorf("expected a cancelled job to free its quota, found %v", err)
+	}
+}
+
+// Tests if a job upserted in place of a job of a namespace stays in
+// the namespace, under its quota.
+func TestNamespace_Upsert(test *testing.T) {
+	sh := &Scheduler{}
+	ns := sh.Namespace("acme", Quota{MaxRetries: 1})
+	when := &t.When{Every: t.Every(1).Hours()}
+	ns.Schedule("a", &counterJob{}, when)
+	failing := &errorJob{errorAfter: 100}
+	if err := sh.Upsert("acme/a", failing, &t.Opts{When: when, RetryCount: 5}); err != nil {
+		test.Fatal(err)
+	}
+	if jobs := ns.Jobs(); len(jobs) != 1 || jobs[0].Name != "a" {
+		test.Errorf("expected the job to stay in the namespace, found %+v", jobs)
+	}
+	go sh.Start()
+	defer sh.Stop()
+	sh.Trigger("acme/a")
+	time.Sleep(50 * time.Millisecond)
+	sh.CancelWait(context.Background(), "acme/a")
+	if failing.count != 2 {
+		test.Errorf("expected the retries to be capped at 1, found %v attempts", failing.count)
+	}
+}
+
+func TestAdminHandlerWithAuth(test *testing.T) {
+	sh := &Scheduler{}
+	sh.Schedule("hi", &counterJob{}, &t.When{Every: t.Every(1).Hours()})
+	srv := httptest.NewServer(sh.AdminHandlerWithAuth(TokenAuth{
+		"read": RoleReader,
+		"ops":  RoleOperator,
+		"":     RoleOperator,
+	}))
+	defer srv.Close()
+	tests := []struct {
+		method, path, token string
+		status              int
+	}{
+		{"GET", "/jobs", "read", http.StatusOK},
+		{"GET", "/jobs/hi", "ops", http.StatusOK},
+		{"POST", "/jobs/hi/pause", "read", http.StatusForbidden},
+		{"POST", "/jobs/hi/pause", "ops", http.StatusAccepted},
+		{"GET", "/jobs", "", http.StatusUnauthorized},
+		{"GET", "/jobs", "wrong", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			test.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			test.Errorf("%v %v with %q: expected %v, found %v", tt.method, tt.path, tt.token, tt.status, resp.StatusCode)
+		}
+	}
+
+	auth := CertAuth{"ops.example.com": RoleOperator}
+	req := httptest.NewRequest("GET", "/jobs", nil)
+	if _, err := auth.Authenticate(req); err == nil {
+		test.Error("expected a request without TLS to be refused")
+	}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "ops.example.com"}},
+	}}}
+	if role, err := auth.Authenticate(req); err != nil || role != RoleOperator {
+		test.Errorf("expected the operator role, found %v, %v", role, err)
+	}
+}
+
+type secretsJob struct {
+	dsn chan string
+}
+
+func (job *secretsJob) Run() error {
+	return nil
+}
+
+func (job *secretsJob) RunContext(ctx context.Context) error {
+	dsn, err := ResolveSecrets(ctx, "postgres://app:secret://db/password@db/secret://db/name")
+	job.dsn <- dsn
+	return err
+}
+
+func TestWithSecrets(test *testing.T) {
+	var asked []string
+	sh := New(WithSecrets(SecretsFunc(func(ctx context.Context, name string) (string, error) {
+		asked = append(asked, name)
+		return map[string]string{"db/password": "hunter2", "db/name": "app"}[name], nil
+	})))
+	job := &secretsJob{dsn: make(chan string)}
+	sh.Schedule("hi", job, &t.When{Every: t.Every(1).Hours()})
+	sh.Trigger("hi")
+	if dsn := <-job.dsn; dsn != "postgres://app:hunter2@db/app" {
+		test.Errorf("unexpected dsn: %v", dsn)
+	}
+	if len(asked) != 2 {
+		test.Errorf("expected the secrets to be resolved at run time, found %v", asked)
+	}
+	if _, err := ResolveSecrets(context.Background(), "secret://db/password"); err == nil {
+		test.Error("expected an error without a provider")
+	}
+	if s, err := ResolveSecrets(context.Background(), "plain"); err != nil || s != "plain" {
+		test.Errorf("expected a value without placeholders as is, found %q, %v", s, err)
+	}
+}
+
+type printJob struct {
+	Msg string
+}
+
+func (job *printJob) Run() error {
+	return nil
+}
+
+func init() {
+	RegisterJobType("print", func() Job { return &printJob{} })
+}
+
+func TestSnapshot(test *testing.T) {
+	sh := &Scheduler{}
+	last := time.Date(2014, time.June, 1, 10, 0, 0, 0, time.UTC)
+	sh.ScheduleWithOpts("hi", &printJob{Msg: "hi"}, &t.Opts{
+		When:       &t.When{Every: t.Every(2).Hours(), At: "**:30", LastRun: last},
+		RetryCount: 3,
+		Metadata:   map[string]string{"owner": "team-a"},
+	})
+	data, err := sh.Snapshot()
+	if err != nil {
+		test.Fatal(err)
+	}
+	restored := &Scheduler{}
+	if err := restored.RestoreSnapshot(data); err != nil {
+		test.Fatal(err)
+	}
+	j, ok := restored.jobs.get("hi")
+	if !ok {
+		test.Fatal("expected the job to be restored")
+	}
+	if msg := j.job.(*printJob).Msg; msg != "hi" {
+		test.Errorf("expected the params to be restored, found %q", msg)
+	}
+	if d := j.when.Duration(last); d != 2*time.Hour+30*time.Minute {
+		test.Errorf("expected the timing to be restored, found %v", d)
+	}
+	if !j.when.LastRun.Equal(last) || j.opts.RetryCount != 3 || j.opts.Metadata["owner"] != "team-a" {
+		test.Errorf("unexpected restored opts: %+v, %+v", j.opts, j.when)
+	}
+
+	sh.Schedule("unregistered", &counterJob{}, &t.When{Each: "1h"})
+	if _, err := sh.Snapshot(); err == nil {
+		test.Error("expected an error for an unregistered job type")
+	}
+}
+
+func TestClone(test *testing.T) {
+	sh := New(WithMaxConcurrent(2))
+	last := time.Now().Add(-time.Minute)
+	sh.ScheduleWithOpts("hi", &counterJob{}, &t.Opts{
+		When: &t.When{Each: "1h", LastRun: last},
+		Tags: []string{"a"},
+	})
+	c, err := sh.Clone()
+	if err != nil {
+		test.Fatal(err)
+	}
+	if cap(c.sem) != 2 {
+		test.Errorf("expected the configuration to be cloned")
+	}
+	st, ok := c.Status("hi")
+	if !ok || !st.LastRun.Equal(last) || len(st.Tags) != 1 {
+		test.Errorf("unexpected status of the cloned job: %+v", st)
+	}
+	sh.Cancel("hi")
+	if _, ok := c.Status("hi"); !ok {
+		test.Error("expected the clone to keep the job cancelled on the original")
+	}
+
+	// a schedule with no runs left can't be cloned
+	var over int32
+	sh.Schedule("bye", &counterJob{}, t.Intersect(&t.When{Each: "1h"}, t.SetFunc(func(time.Time) bool {
+		return atomic.LoadInt32(&over) == 0
+	})))
+	atomic.StoreInt32(&over, 1)
+	if _, err := sh.Clone(); err == nil {
+		test.Error("expected an error cloning a job with no runs left")
+	}
+}
+
+// Tests if no runs start within a blackout window of the scheduler.
+func TestAddBlackout(test *testing.T) {
+	sh := &Scheduler{}
+	done := make(chan bool, 1)
+	sh.Schedule("hi", &anyJob{Fn: func() { done <- true }}, &t.When{Each: "1h"})
+	now := time.Now()
+	sh.AddBlackout(t.Period{Start: now.Add(-time.Minute), End: now.Add(time.Hour)})
+	sh.Trigger("hi")
+	select {
+	case <-done:
+		test.Fatal("job is not expected to run within a blackout, but it did")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Tests if splay offsets are deterministic and spread over the window.
+func TestSplay(test *testing.T) {
+	window := time.Hour
+	if splay("host-1", "hi", window) != splay("host-1", "hi", window) {
+		test.Fatal("splay is expected to be deterministic")
+	}
+	seen := make(map[time.Duration]bool)
+	for _, host := range []string{"host-1", "host-2", "host-3", "host-4"} {
+		d := splay(host, "hi", window)
+		if d < 0 || d >= window {
+			test.Errorf("splay for %v should be within [0, %v), found %v", host, window, d)
+		}
+		seen[d] = true
+	}
+	if len(seen) < 2 {
+		test.Errorf("splay is expected to vary among hosts, found %v", seen)
+	}
+	if d := splay("host-1", "hi", 0); d != 0 {
+		test.Errorf("splay without a window should be 0, found %v", d)
+	}
+}
+
+// Tests if fixed rate runs don't drift by the duration of the job.
+func TestFixedRate(test *testing.T) {
+	sh := &Scheduler{}
+	var count int32
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(60 * time.Millisecond)
+	}}, &t.Opts{When: &t.When{Every: t.Every(100).Milliseconds()}, IntervalMode: t.FixedRate})
+	go sh.Start()
+	time.Sleep(550 * time.Millisecond)
+	// runs at 100, 200, 300, 400 and 500ms, rather than
+	// at 100, 260 and 420ms
+	if got := atomic.LoadInt32(&count); got < 4 {
+		test.Errorf("expected to run at least 4 times at a fixed rate, ran %v times", got)
+	}
+}
+
+type blockingJob struct {
+	started chan struct{}
+}
+
+func (job *blockingJob) Run() error {
+	return job.RunContext(context.Background())
+}
+
+func (job *blockingJob) RunContext(ctx context.Context) error {
+	job.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunJob(test *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &blockingJob{started: make(chan struct{}, 1)}
+	errs := make(chan error, 1)
+	go func() { errs <- RunJob(ctx, job) }()
+	<-job.started
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		test.Errorf("expected the cancellation to reach the job, found %v", err)
+	}
+	counter := &counterJob{}
+	if err := RunJob(ctx, counter); err != context.Canceled || counter.Count != 0 {
+		test.Errorf("expected the job not to run with a done context, found %v and %v runs", err, counter.Count)
+	}
+	if err := RunJob(context.Background(), counter); err != nil || counter.Count != 1 {
+		test.Errorf("expected the job to run, found %v and %v runs", err, counter.Count)
+	}
+}
+
+func TestCancel_Running(test *testing.T) {
+	sh := &Scheduler{}
+	job := &blockingJob{started: make(chan struct{}, 1)}
+	sh.ScheduleWithOpts("hi", job, &t.Opts{
+		When:       &t.When{Every: t.Every(10).Milliseconds()},
+		RetryCount: 3,
+	})
+	done := make(chan struct{})
+	go func() {
+		sh.Start()
+		close(done)
+	}()
+	<-job.started
+	sh.Cancel("hi")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		test.Fatal("expected the run to be cancelled")
+	}
+	select {
+	case <-job.started:
+		test.Error("expected no retries after the job is cancelled")
+	default:
+	}
+}
+
+func TestCancelAll(test *testing.T) {
+	sh := &Scheduler{}
+	var running, completed int32
+	job := &anyJob{Fn: func() {
+		atomic.AddInt32(&running, 1)
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&completed, 1)
+	}}
+	for _, name := range jobNames(10) {
+		sh.Schedule(name, job, &t.When{Every: t.Every(10).Milliseconds()})
+	}
+	go sh.Start()
+	time.Sleep(30 * time.Millisecond)
+	sh.CancelAll()
+	if r, c := atomic.LoadInt32(&running), atomic.LoadInt32(&completed); r != c {
+		test.Errorf("expected the in-flight runs to be completed, %v of %v are", c, r)
+	}
+	if err := sh.Trigger("job-0"); err == nil {
+		test.Error("expected the jobs to be removed")
+	}
+	if err := sh.Schedule("job-0", job, &t.When{Each: "1h"}); err != nil {
+		test.Errorf("expected the name to be reusable, found %v", err)
+	}
+}
+
+func TestCancelByTag(test *testing.T) {
+	sh := &Scheduler{}
+	job := &counterJob{}
+	sh.ScheduleWithOpts("a-report", job, &t.Opts{When: &t.When{Each: "1h"}, Tags: []string{"tenant-a"}})
+	sh.ScheduleWithOpts("a-cleanup", job, &t.Opts{When: &t.When{Each: "1h"}, Tags: []string{"tenant-a", "cleanup"}})
+	sh.ScheduleWithOpts("b-cleanup", job, &t.Opts{When: &t.When{Each: "1h"}, Tags: []string{"tenant-b", "cleanup"}})
+	if got := strings.Join(sh.JobsByTag("cleanup"), ","); got != "a-cleanup,b-cleanup" {
+		test.Errorf("unexpected jobs tagged with cleanup: %v", got)
+	}
+	sh.CancelByTag("tenant-a")
+	if got := sh.JobsByTag("tenant-a"); len(got) != 0 {
+		test.Errorf("expected tenant-a jobs to be cancelled, found %v", got)
+	}
+	if got := strings.Join(sh.JobsByTag("cleanup"), ","); got != "b-cleanup" {
+		test.Errorf("expected b-cleanup to be left, found %v", got)
+	}
+}
+
+type memStore struct {
+	mu   sync.Mutex
+	runs map[string]time.Time
+}
+
+func (st *memStore) LastRun(name string) (time.Time, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.runs[name], nil
+}
+
+func (st *memStore) SetLastRun(name string, tm time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.runs[name] = tm
+	return nil
+}
+
+type occurrenceStore struct {
+	memStore
+	completed map[string]bool
+}
+
+func (st *occurrenceStore) Completed(name, key string) (bool, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.completed[name+"@"+key], nil
+}
+
+func (st *occurrenceStore) SetCompleted(name, key string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.completed[name+"@"+key] = true
+	return nil
+}
+
+func TestNew_OccurrenceStore(test *testing.T) {
+	// the runs at next completed, but the process crashed
+	// before their last runs were stored
+	last := time.Now().Round(0).Truncate(time.Millisecond).Add(-time.Hour + 20*time.Millisecond)
+	next := occurrenceKey(last.Add(time.Hour))
+	st := &occurrenceStore{
+		memStore:  memStore{runs: map[string]time.Time{"done": last, "todo": last}},
+		completed: map[string]bool{"done@" + next: true},
+	}
+	sh := New(WithStore(st))
+	var done, todo int32
+	sh.Schedule("done", &anyJob{Fn: func() { atomic.AddInt32(&done, 1) }}, &t.When{Every: t.Every(1).Hours()})
+	sh.Schedule("todo", &anyJob{Fn: func() { atomic.AddInt32(&todo, 1) }}, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&done); n != 0 {
+		test.Errorf("expected the completed occurrence not to run again, ran %v times", n)
+	}
+	if n := atomic.LoadInt32(&todo); n != 1 {
+		test.Errorf("expected the occurrence to run, ran %v times", n)
+	}
+	if ok, _ := st.Completed("todo", next); !ok {
+		test.Error("expected the occurrence to be recorded as completed")
+	}
+	if last, _ := st.LastRun("done"); !last.After(time.Now().Add(-time.Second)) {
+		test.Errorf("expected the last run of the skipped occurrence to be stored, found %v", last)
+	}
+}
+
+type runStore struct {
+	memStore
+	started map[string]map[string]StartedRun
+}
+
+func (st *runStore) SetStarted(name string, run StartedRun) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.started[name] == nil {
+		st.started[name] = make(map[string]StartedRun)
+	}
+	st.started[name][run.RunID] = run
+	return nil
+}
+
+func (st *runStore) SetFinished(name, id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.started[name], id)
+	return nil
+}
+
+func (st *runStore) Started(name string) ([]StartedRun, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var runs []StartedRun
+	for _, r := range st.started[name] {
+		runs = append(runs, r)
+	}
+	return runs, nil
+}
+
+func TestNew_RunStore(test *testing.T) {
+	crashed := time.Now().Add(-time.Minute)
+	st := &runStore{
+		memStore: memStore{runs: map[string]time.Time{}},
+		started: map[string]map[string]StartedRun{
+			"hi": {"r1": {RunID: "r1", Time: crashed, Started: crashed}},
+		},
+	}
+	zombies := make(chan Event, 1)
+	sh := New(WithStore(st), WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventZombie {
+			zombies <- e
+		}
+	})))
+	cleaned := make(chan string, 1)
+	running := make(chan StartedRun, 1)
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() {
+		runs, _ := st.Started("hi")
+		running <- runs[0]
+	}}, &t.Opts{
+		When: &t.When{Every: t.Every(1).Hours()},
+		OnZombie: func(name, runID string, started time.Time) {
+			if len(running) > 0 {
+				test.Error("expected the zombie to be cleaned up before the job runs")
+			}
+			cleaned <- runID
+		},
+	})
+	go sh.Start()
+	defer sh.Stop()
+	if e := <-zombies; e.RunID != "r1" || !e.Time.Equal(crashed) {
+		test.Errorf("unexpected zombie event: %+v", e)
+	}
+	if id := <-cleaned; id != "r1" {
+		test.Errorf("expected OnZombie to be called with r1, found %v", id)
+	}
+	sh.Trigger("hi")
+	if r := <-running; r.RunID == "r1" || r.RunID == "" {
+		test.Errorf("expected the run in progress to be recorded, found %+v", r)
+	}
+	sh.CancelWait(context.Background(), "hi")
+	if runs, _ := st.Started("hi"); len(runs) != 0 {
+		test.Errorf("expected no runs left started, found %+v", runs)
+	}
+}
+
+// Tests if OnZombie can call the scheduler.
+func TestNew_RunStoreHooks(test *testing.T) {
+	crashed := time.Now().Add(-time.Minute)
+	st := &runStore{
+		memStore: memStore{runs: map[string]time.Time{}},
+		started: map[string]map[string]StartedRun{
+			"hi": {"r1": {RunID: "r1", Time: crashed, Started: crashed}},
+		},
+	}
+	sh := New(WithStore(st))
+	statuses := make(chan JobStatus, 1)
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() {}}, &t.Opts{
+		When: &t.When{Every: t.Every(1).Hours()},
+		OnZombie: func(name, runID string, started time.Time) {
+			st, _ := sh.Status(name)
+			statuses <- st
+		},
+	})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case st := <-statuses:
+		if st.Name != "hi" {
+			test.Errorf("unexpected status: %+v", st)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected OnZombie to return the status of the job")
+	}
+	// scheduled once the zombie is reaped
+	time.Sleep(20 * time.Millisecond)
+	if st, _ := sh.Status("hi"); st.NextRun.IsZero() {
+		test.Errorf("expected the job to be scheduled, found %+v", st)
+	}
+}
+
+// Tests if the runs started by the process aren't reaped as zombies.
+func TestNew_RunStoreRunning(test *testing.T) {
+	st := &runStore{
+		memStore: memStore{runs: map[string]time.Time{}},
+		started:  map[string]map[string]StartedRun{},
+	}
+	var zombies int32
+	sh := New(WithStore(st), WithListener(ListenerFunc(func(e Event) {
+		if e.Kind == EventZombie {
+			atomic.AddInt32(&zombies, 1)
+		}
+	})))
+	job := &blockingJob{started: make(chan struct{})}
+	sh.Schedule("hi", job, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	sh.Trigger("hi")
+	<-job.started
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&zombies); n != 0 {
+		test.Errorf("expected no zombies, found %v", n)
+	}
+	if runs, _ := st.Started("hi"); len(runs) != 1 {
+		test.Errorf("expected the run in progress to be recorded, found %v", runs)
+	}
+	sh.CancelAll()
+}
+
+// Tests if the occurrence interrupted by a crash is run once, rather
+// than replayed and caught up on.
+func TestSemantics_AtLeastOnceCrash(test *testing.T) {
+	// crashed in the middle of the run after last
+	last := time.Now().Add(-90 * time.Minute)
+	interrupted := last.Add(time.Hour)
+	st := &runStore{
+		memStore: memStore{runs: map[string]time.Time{"hi": last}},
+		started: map[string]map[string]StartedRun{
+			"hi": {"r1": {RunID: "r1", Time: interrupted, Started: interrupted}},
+		},
+	}
+	sh := New(WithStore(st))
+	var runs int32
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() { atomic.AddInt32(&runs, 1) }}, &t.Opts{
+		When:      &t.When{Every: t.Every(1).Hours()},
+		Semantics: t.AtLeastOnce,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		test.Errorf("expected the interrupted occurrence to run once, found %v runs", n)
+	}
+}
+
+type historyStore struct {
+	memStore
+	archived []RunResult
+}
+
+func (st *historyStore) Archive(name string, runs []RunResult) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.archived = append(st.archived, runs...)
+	return nil
+}
+
+func (st *historyStore) archivedRuns() []RunResult {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]RunResult(nil), st.archived...)
+}
+
+// Tests the history pruned by size and age, and archived.
+func TestHistoryRetention(test *testing.T) {
+	st := &historyStore{memStore: memStore{runs: map[string]time.Time{}}}
+	sh := New(WithStore(st))
+	ran := make(chan struct{})
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() { ran <- struct{}{} }}, &t.Opts{
+		When:        &t.When{Every: t.Every(1).Hours()},
+		HistorySize: 3,
+		HistoryAge:  200 * time.Millisecond,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	for i := 0; i < 5; i++ {
+		sh.Trigger("hi")
+		<-ran
+	}
+	// the last run is recorded after the job returns
+	time.Sleep(50 * time.Millisecond)
+	if runs, _ := sh.History("hi"); len(runs) != 3 {
+		test.Fatalf("expected 3 runs in the history, found %v", len(runs))
+	}
+	if archived := st.archivedRuns(); len(archived) != 2 {
+		test.Fatalf("expected 2 archived runs, found %v", len(archived))
+	}
+	time.Sleep(250 * time.Millisecond)
+	if runs, _ := sh.History("hi"); len(runs) != 0 {
+		test.Errorf("expected the expired runs to be pruned, found %v", len(runs))
+	}
+	archived := st.archivedRuns()
+	if len(archived) != 5 {
+		test.Fatalf("expected 5 archived runs, found %v", len(archived))
+	}
+	for i := 1; i < len(archived); i++ {
+		if archived[i].Started.Before(archived[i-1].Started) {
+			test.Errorf("expected the runs to be archived the oldest first")
+		}
+	}
+}
+
+func TestSemantics_AtLeastOnce(test *testing.T) {
+	// down for two hours, in the middle of a run
+	last := time.Now().Add(-2 * time.Hour)
+	st := &runStore{
+		memStore: memStore{runs: map[string]time.Time{"hi": last}},
+		started: map[string]map[string]StartedRun{
+			"hi": {"r1": {RunID: "r1", Time: last, Started: last}},
+		},
+	}
+	sh := New(WithStore(st))
+	var runs int32
+	opts := &t.Opts{When: &t.When{Every: t.Every(1).Hours()}, Semantics: t.AtLeastOnce}
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() { atomic.AddInt32(&runs, 1) }}, opts)
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(50 * time.Millisecond)
+	// the interrupted run and the missed occurrence
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		test.Errorf("expected 2 replayed runs, found %v", n)
+	}
+	if opts.Misfire != t.MisfireSkip {
+		test.Error("expected the opts not to be modified")
+	}
+}
+
+func TestSemantics_AtMostOnce(test *testing.T) {
+	last := time.Now().Round(0).Truncate(time.Millisecond).Add(-time.Hour + 20*time.Millisecond)
+	next := occurrenceKey(last.Add(time.Hour))
+	st := &occurrenceStore{
+		memStore:  memStore{runs: map[string]time.Time{"hi": last}},
+		completed: map[string]bool{},
+	}
+	sh := New(WithStore(st))
+	recorded := make(chan bool, 1)
+	sh.ScheduleWithOpts("hi", &anyJob{Fn: func() {
+		ok, _ := st.Completed("hi", next)
+		recorded <- ok
+	}}, &t.Opts{When: &t.When{Every: t.Every(1).Hours()}, Semantics: t.AtMostOnce})
+	go sh.Start()
+	defer sh.Stop()
+	select {
+	case ok := <-recorded:
+		if !ok {
+			test.Error("expected the occurrence to be recorded before its run")
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the occurrence to run")
+	}
+}
+
+type logBuffer struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *logBuffer) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf(format, v...))
+}
+
+func TestNew_Store(test *testing.T) {
+	last := time.Now().Add(-10*time.Minute + 30*time.Millisecond)
+	st := &memStore{runs: map[string]time.Time{"hi": last}}
+	sh := New(WithStore(st))
+	var count int32
+	sh.Schedule("hi", &anyJob{Fn: func() { atomic.AddInt32(&count, 1) }}, &t.When{Every: t.Every(10).Minutes()})
+	go sh.Start()
+	time.Sleep(100 * time.Millisecond)
+	sh.Stop()
+	// 10 minutes after the last run loaded from the store
+	if got := atomic.LoadInt32(&count); got != 1 {
+		test.Errorf("expected the job to run once, ran %v times", got)
+	}
+	if got, _ := st.LastRun("hi"); !got.After(last) {
+		test.Errorf("expected the last run to be stored, found %v", got)
+	}
+}
+
+func TestNew_LoggerAndMaxConcurrent(test *testing.T) {
+	logs := &logBuffer{}
+	sh := New(WithLogger(logs), WithMaxConcurrent(2))
+	var running, max int32
+	job := &anyJob{Fn: func() {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	}}
+	for _, name := range jobNames(6) {
+		sh.Schedule(name, job, &t.When{Each: "10ms"})
+	}
+	sh.Schedule("fails", &errorJob{errorAfter: 100}, &t.When{Each: "10ms"})
+	sh.Start()
+	if got := atomic.LoadInt32(&max); got > 2 {
+		test.Errorf("expected at most 2 runs at once, found %v", got)
+	}
+	logs.mu.Lock()
+	defer logs.mu.Unlock()
+	if len(logs.logs) != 1 || !strings.Contains(logs.logs[0], "fails") {
+		test.Errorf("expected the failure to be logged, found %q", logs.logs)
+	}
+}
+
+func TestNew_Defaults(test *testing.T) {
+	var mu sync.Mutex
+	results := map[string]error{}
+	sh := New(WithDefaults(&t.Opts{
+		RetryCount: 2,
+		Timeout:    10 * time.Millisecond,
+		AfterRun: func(name string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = err
+		},
+	}))
+	retried := &errorJob{errorAfter: 3}
+	sh.Schedule("retried", retried, &t.When{Each: "10ms"})
+	sh.Schedule("slow", &blockingJob{started: make(chan struct{}, 3)}, &t.When{Each: "10ms"})
+	sh.Start()
+	mu.Lock()
+	defer mu.Unlock()
+	if err := results["retried"]; err != nil || retried.count != 3 {
+		test.Errorf("expected the default retry count to apply, ran %v times with %v", retried.count, err)
+	}
+	if err := results["slow"]; err != context.DeadlineExceeded {
+		test.Errorf("expected the default timeout to apply, found %v", err)
+	}
+}
+
+func TestNew_DryRun(test *testing.T) {
+	var mu sync.Mutex
+	var events []Event
+	sh := New(WithDryRun(), WithListener(ListenerFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	})))
+	job := &counterJob{}
+	sh.Schedule("hi", job, &t.When{Each: "10ms"})
+	before := time.Now()
+	sh.Start()
+	if job.Count != 0 {
+		test.Errorf("expected the job not to run in the dry-run mode, ran %v times", job.Count)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Kind != EventDryRun || events[0].Job != "hi" {
+		test.Fatalf("expected a dry-run event, found %+v", events)
+	}
+	if d := events[0].Time.Sub(before); d < 5*time.Millisecond || d > 20*time.Millisecond {
+		test.Errorf("expected the scheduled time of the run, found %v after the start", d)
+	}
+}
+
+func TestHotspots(test *testing.T) {
+	sh := &Scheduler{}
+	now := time.Now()
+	for _, name := range []string{"c", "a", "b"} {
+		sh.Schedule(name, &counterJob{}, &t.When{Each: "1h", LastRun: now})
+	}
+	sh.Schedule("d", &counterJob{}, &t.When{Each: "1h", LastRun: now.Add(-30 * time.Minute)})
+	hotspots := sh.Hotspots(90*time.Minute, time.Minute, 2)
+	if len(hotspots) != 1 {
+		test.Fatalf("expected a single hotspot, found %+v", hotspots)
+	}
+	h := hotspots[0]
+	if !h.Time.Equal(now.Add(time.Hour).Truncate(time.Minute)) {
+		test.Errorf("unexpected time of the hotspot: %v", h.Time)
+	}
+	if got := strings.Join(h.Jobs, ","); got != "a,b,c" {
+		test.Errorf("unexpected jobs of the hotspot: %v", got)
+	}
+	if len(h.Offsets) != 1 || h.Offsets["c"] != time.Minute {
+		test.Errorf("expected c to be delayed by a minute, found %v", h.Offsets)
+	}
+}
+
+func TestExportICS(test *testing.T) {
+	sh := &Scheduler{}
+	now := time.Now()
+	sh.Schedule("backup, nightly", &counterJob{}, &t.When{Every: t.Every(1).Hours(), LastRun: now})
+	var buf strings.Builder
+	if err := sh.ExportICS(&buf, 150*time.Minute); err != nil {
+		test.Fatal(err)
+	}
+	ics := buf.String()
+	if got := strings.Count(ics, "BEGIN:VEVENT"); got != 2 {
+		test.Errorf("expected 2 events, found %v in %q", got, ics)
+	}
+	start := "DTSTART:" + now.Add(time.Hour).UTC().Format("20060102T150405Z")
+	if !strings.Contains(ics, start+"\r\n") || !strings.Contains(ics, "SUMMARY:backup\\, nightly\r\n") {
+		test.Errorf("unexpected calendar: %q", ics)
+	}
+}
+
+func TestImportICS(test *testing.T) {
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:1",
+		"SUMMARY:close-books",
+		`DESCRIPTION:{"type": "print"\, "params": {"Msg": "cl`,
+		` osing"}}`,
+		"DTSTART;TZID=UTC:20140602T093000",
+		"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=FR",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:2",
+		"SUMMARY:unsupported",
+		`DESCRIPTION:{"type": "print"}`,
+		"DTSTART:20140602T093000Z",
+		"RRULE:FREQ=MONTHLY",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	events, err := ParseICS(strings.NewReader(ics), nil)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Description != `{"type": "print", "params": {"Msg": "closing"}}` {
+		test.Fatalf("unexpected events: %+v", events)
+	}
+	w, err := events[0].When(time.Now())
+	if err != nil {
+		test.Fatal(err)
+	}
+	// every other Friday at 09:30 from June 6th
+	if first := w.LastRun.Add(w.Duration(w.LastRun)); !first.Equal(time.Date(2014, time.June, 6, 9, 30, 0, 0, time.UTC)) {
+		test.Errorf("unexpected first run: %v", first)
+	}
+	if d := w.Duration(w.LastRun); d != 14*24*time.Hour {
+		test.Errorf("unexpected interval: %v", d)
+	}
+
+	sh := &Scheduler{}
+	if err := sh.ImportICS(strings.NewReader(ics)); err == nil {
+		test.Error("expected an error for the unsupported rule")
+	}
+	if _, ok := sh.jobs.get("close-books"); ok {
+		test.Error("expected no jobs to be scheduled if an event can't be imported")
+	}
+}
+
+func TestOpts_Location(test *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	sh := New(WithLocation(time.UTC))
+	sh.ScheduleWithOpts("tokyo", &counterJob{}, &t.Opts{When: &t.When{Cron: "0 0 12 * * ?"}, Location: tokyo})
+	sh.ScheduleWithOpts("utc", &counterJob{}, &t.Opts{When: &t.When{Cron: "0 0 12 * * ?"}})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(10 * time.Millisecond)
+	for name, loc := range map[string]*time.Location{"tokyo": tokyo, "utc": time.UTC} {
+		st, _ := sh.Status(name)
+		if h := st.NextRun.Round(time.Second).In(loc).Hour(); h != 12 {
+			test.Errorf("%v: expected the next run at noon, found %v", name, st.NextRun.In(loc))
+		}
+	}
+}
+
+func TestStart_Restart(test *testing.T) {
+	sh := &Scheduler{}
+	var every, once int32
+	sh.Schedule("every", &anyJob{Fn: func() { atomic.AddInt32(&every, 1) }}, &t.When{Every: t.Every(10).Milliseconds()})
+	sh.Schedule("once", &anyJob{Fn: func() { atomic.AddInt32(&once, 1) }}, &t.When{Each: "10ms"})
+	for i := 0; i < 2; i++ {
+		done := make(chan struct{})
+		go func() {
+			sh.Start()
+			close(done)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		sh.Stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			test.Fatal("expected Start to return once stopped")
+		}
+	}
+	if got := atomic.LoadInt32(&once); got != 1 {
+		test.Errorf("expected the delayed job to run once, ran %v times", got)
+	}
+	n := atomic.LoadInt32(&every)
+	if n < 4 {
+		test.Errorf("expected the job to be rescheduled after restart, ran %v times", n)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&every); got != n {
+		test.Errorf("expected no runs once stopped, found %v more", got-n)
+	}
+}
+
+func TestStart_ConcurrentSchedule(test *testing.T) {
+	sh := &Scheduler{}
+	var count int32
+	job := &anyJob{Fn: func() { atomic.AddInt32(&count, 1) }}
+	names := jobNames(100)
+	// keeps Start from returning before the other jobs are scheduled
+	sh.Schedule("anchor", job, &t.When{Each: "200ms"})
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			sh.Schedule(name, job, &t.When{Each: "10ms"})
+		}(name)
+	}
+	done := make(chan struct{})
+	go func() {
+		sh.Start()
+		close(done)
+	}()
+	wg.Wait()
+	for _, name := range names[:50] {
+		go sh.Cancel(name)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		test.Fatal("expected Start to return once the jobs are done")
+	}
+	// Each jobs run once unless cancelled before their run
+	if got := atomic.LoadInt32(&count); got < 51 || got > 101 {
+		test.Errorf("expected 51 to 101 runs, found %v", got)
+	}
+}
+
+func jobNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = "job-" + strconv.Itoa(i)
+	}
+	return names
+}
+
+func BenchmarkSchedule(b *testing.B) {
+	sh := &Scheduler{}
+	job := &counterJob{}
+	names := jobNames(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.Schedule(names[i], job, &t.When{Each: "1h"})
+	}
+}
+
+func BenchmarkSchedule_Started(b *testing.B) {
+	sh := &Scheduler{}
+	go sh.Start()
+	job := &counterJob{}
+	names := jobNames(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.Schedule(names[i], job, &t.When{Each: "1h"})
+	}
+}
+
+func BenchmarkCancel(b *testing.B) {
+	sh := &Scheduler{}
+	go sh.Start()
+	job := &counterJob{}
+	names := jobNames(b.N)
+	for i := 0; i < b.N; i++ {
+		sh.Schedule(names[i], job, &t.When{Each: "1h"})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sh.Cancel(names[i])
+	}
+}
+
+// Measures the throughput of firing jobs, from the queue to
+// the completion of the runs.
+func BenchmarkFire(b *testing.B) {
+	sh := &Scheduler{}
+	job := &anyJob{Fn: func() {}}
+	names := jobNames(b.N)
+	for i := 0; i < b.N; i++ {
+		sh.Schedule(names[i], job, &t.When{Each: "1ms"})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	sh.Start()
+}
+
+func BenchmarkSchedule_Parallel(b *testing.B) {
+	sh := &Scheduler{}
+	job := &counterJob{}
+	var n int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			name := "job-" + strconv.FormatInt(atomic.AddInt64(&n, 1), 10)
+			sh.Schedule(name, job, &t.When{Each: "1h"})
+		}
+	})
+}
+
+func TestSchedule_Microseconds(test *testing.T) {
+	sh := &Scheduler{}
+	var n int32
+	sh.Schedule("fast", &anyJob{Fn: func() { atomic.AddInt32(&n, 1) }}, &t.When{Every: t.Every(200).Microseconds()})
+	go sh.Start()
+	time.Sleep(50 * time.Millisecond)
+	sh.Cancel("fast")
+	got := atomic.LoadInt32(&n)
+	if got < 50 {
+		test.Errorf("expected the job to run at least 50 times, ran %v times", got)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if after := atomic.LoadInt32(&n); after != got {
+		test.Errorf("expected no runs after cancel, found %v more", after-got)
+	}
+}
+
+// Tests if the loops of the stopped schedulers and the schedulers
+// that were never started exit.
+func TestLoopExits(test *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		sh := &Scheduler{}
+		sh.Schedule("hi", &counterJob{}, &t.When{Each: "1h"})
+		c, err := sh.Clone()
+		if err != nil {
+			test.Fatal(err)
+		}
+		if _, ok := c.Status("hi"); !ok {
+			test.Fatal("expected the job to be cloned")
+		}
+		done := make(chan struct{})
+		go func() {
+			sh.Start()
+			close(done)
+		}()
+		for st, _ := sh.Status("hi"); st.NextRun.IsZero(); st, _ = sh.Status("hi") {
+			time.Sleep(time.Millisecond)
+		}
+		sh.Stop()
+		<-done
+	}
+	for i := 0; i < 100; i++ {
+		if runtime.NumGoroutine() <= before+10 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	test.Errorf("expected the loops to exit, found %v goroutines, %v before", runtime.NumGoroutine(), before)
+}
+
+func TestDetectStep(test *testing.T) {
+	events := make(chan Event, 1)
+	sh := New(WithListener(ListenerFunc(func(e Event) { events <- e })))
+	sh.Schedule("daily", &counterJob{}, &t.When{Every: t.Every(1).Days(), At: "10:00"})
+	sh.Schedule("interval", &counterJob{}, &t.When{Every: t.Every(1).Hours()})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(10 * time.Millisecond)
+	before, _ := sh.Status("daily")
+	sh.call(func() {
+		// a next run computed before the wall clock stepped forward an hour
+		for _, j := range sh.queue {
+			j.scheduledAt = j.scheduledAt.Add(time.Hour)
+		}
+		sh.stepWall = sh.stepWall.Add(-time.Hour)
+		sh.detectStep(sh.now())
+	})
+	select {
+	case e := <-events:
+		if e.Kind != EventClockStep || e.Step < 59*time.Minute || !reflect.DeepEqual(e.Jobs, []string{"daily"}) {
+			test.Errorf("expected the daily job to be rescheduled, found %+v", e)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected a clock step event")
+	}
+	st, _ := sh.Status("daily")
+	if d := st.NextRun.Sub(before.NextRun); d < -time.Second || d > time.Second {
+		test.Errorf("expected the next run at %v, found %v", before.NextRun, st.NextRun)
+	}
+}
+
+func TestNew_MisfireThreshold(test *testing.T) {
+	sh := New(WithMisfireThreshold(time.Second))
+	var skipped, postponed int32
+	sh.ScheduleWithOpts("skip", &anyJob{Fn: func() { atomic.AddInt32(&skipped, 1) }}, &t.Opts{
+		When: &t.When{Every: t.Every(1).Hours()}})
+	sh.ScheduleWithOpts("postpone", &anyJob{Fn: func() { atomic.AddInt32(&postponed, 1) }}, &t.Opts{
+		When:    &t.When{Every: t.Every(1).Hours()},
+		Misfire: t.MisfirePostpone})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(10 * time.Millisecond)
+	sh.call(func() {
+		// runs missed while the process was stalled for two hours
+		for _, j := range sh.queue {
+			j.scheduledAt = j.scheduledAt.Add(-2 * time.Hour)
+		}
+		heap.Init(&sh.queue)
+	})
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&skipped); n != 0 {
+		test.Errorf("expected the missed run to be skipped, ran %v times", n)
+	}
+	if n := atomic.LoadInt32(&postponed); n != 1 {
+		test.Errorf("expected the missed run to be postponed, ran %v times", n)
+	}
+	if st, _ := sh.Status("skip"); st.NextRun.Before(time.Now().Add(59 * time.Minute)) {
+		test.Errorf("expected the skipped job to wait for its next run, found %v", st.NextRun)
+	}
+}
+
+type tenantKey struct{}
+
+type tenantJob struct {
+	tenant chan interface{}
+}
+
+func (job *tenantJob) Run() error {
+	return job.RunContext(context.Background())
+}
+
+func (job *tenantJob) RunContext(ctx context.Context) error {
+	job.tenant <- ctx.Value(tenantKey{})
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestOpts_BaseContext(test *testing.T) {
+	sh := &Scheduler{}
+	job := &tenantJob{tenant: make(chan interface{}, 1)}
+	sh.ScheduleWithOpts("hi", job, &t.Opts{
+		When: &t.When{Each: "1ms"},
+		BaseContext: func() context.Context {
+			return context.WithValue(context.Background(), tenantKey{}, "acme")
+		},
+	})
+	done := make(chan struct{})
+	go func() {
+		sh.Start()
+		close(done)
+	}()
+	if tenant := <-job.tenant; tenant != "acme" {
+		test.Errorf("expected the run to carry the tenant, found %v", tenant)
+	}
+	sh.Cancel("hi")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		test.Fatal("expected the run to be cancelled")
+	}
+}
+
+type memQueueStore struct {
+	memStore
+	next    int
+	pending map[string][]QueuedPayload
+}
+
+func (st *memQueueStore) Enqueue(name string, payload []byte) (string, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.next++
+	id := strconv.Itoa(st.next)
+	st.pending[name] = append(st.pending[name], QueuedPayload{ID: id, Payload: payload})
+	return id, nil
+}
+
+func (st *memQueueStore) Pending(name string) ([]QueuedPayload, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]QueuedPayload(nil), st.pending[name]...), nil
+}
+
+func (st *memQueueStore) Ack(name, id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	q := st.pending[name]
+	for i, p := range q {
+		if p.ID == id {
+			st.pending[name] = append(q[:i:i], q[i+1:]...)
+		}
+	}
+	return nil
+}
+
+type rotatingKeys struct {
+	current string
+	keys    map[string][]byte
+}
+
+func (k *rotatingKeys) CurrentKey() (string, []byte, error) {
+	return k.current, k.keys[k.current], nil
+}
+
+func (k *rotatingKeys) Key(id string) ([]byte, error) {
+	if key, ok := k.keys[id]; ok {
+		return key, nil
+	}
+	return nil, errors.New("no such key")
+}
+
+func TestEncryptQueueStore(test *testing.T) {
+	mem := &memQueueStore{memStore: memStore{runs: map[string]time.Time{}}, pending: map[string][]QueuedPayload{}}
+	keys := &rotatingKeys{current: "k1", keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	}}
+	st := EncryptQueueStore(mem, keys)
+	st.Enqueue("hi", []byte("postgres://user:secret@db"))
+	keys.current = "k2"
+	st.Enqueue("hi", []byte("b"))
+	if stored := mem.pending["hi"][0].Payload; bytes.Contains(stored, []byte("secret")) {
+		test.Errorf("expected the payload to be encrypted, found %q", stored)
+	}
+	pending, err := st.Pending("hi")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if len(pending) != 2 || string(pending[0].Payload) != "postgres://user:secret@db" || string(pending[1].Payload) != "b" {
+		test.Errorf("expected the payloads to be decrypted with their keys, found %q", pending)
+	}
+
+	// moved to another job
+	mem.pending["bye"] = mem.pending["hi"][:1]
+	if _, err := st.Pending("bye"); err == nil {
+		test.Error("expected a payload of another job not to be decrypted")
+	}
+	mem.pending["hi"][1].Payload[len(mem.pending["hi"][1].Payload)-1] ^= 1
+	if _, err := st.Pending("hi"); err == nil {
+		test.Error("expected a tampered payload not to be decrypted")
+	}
+	if _, err := EncryptQueueStore(mem, StaticKey("short")).Enqueue("hi", nil); err == nil {
+		test.Error("expected a key of a wrong size to be refused")
+	}
+}
+
+// A store implementing all of the optional interfaces.
+type fullStore struct {
+	*memQueueStore
+	*occurrenceStore
+	*runStore
+	*historyStore
+}
+
+func (st *fullStore) LastRun(name string) (time.Time, error) {
+	return st.memQueueStore.LastRun(name)
+}
+
+func (st *fullStore) SetLastRun(name string, tm time.Time) error {
+	return st.memQueueStore.SetLastRun(name, tm)
+}
+
+// Tests if the encrypted store of a full store forwards the
+// interfaces it implements.
+func TestEncryptQueueStore_Full(test *testing.T) {
+	full := &fullStore{
+		memQueueStore:   &memQueueStore{memStore: memStore{runs: map[string]time.Time{}}, pending: map[string][]QueuedPayload{}},
+		occurrenceStore: &occurrenceStore{completed: map[string]bool{}},
+		runStore:        &runStore{started: map[string]map[string]StartedRun{}},
+		historyStore:    &historyStore{},
+	}
+	st := EncryptQueueStore(full, StaticKey(bytes.Repeat([]byte{1}, 32)))
+	if _, ok := st.(OccurrenceStore); !ok {
+		test.Error("expected the store to be an OccurrenceStore")
+	}
+	if _, ok := st.(HistoryStore); !ok {
+		test.Error("expected the store to be a HistoryStore")
+	}
+	if _, ok := EncryptQueueStore(full.memQueueStore, StaticKey(bytes.Repeat([]byte{1}, 32))).(RunStore); ok {
+		test.Error("expected the store of a QueueStore not to be a RunStore")
+	}
+
+	sh := New(WithStore(st))
+	job := &payloadJob{payload: make(chan []byte)}
+	sh.Schedule("hi", job, &t.When{Each: "1h"})
+	go sh.Start()
+	defer sh.Stop()
+	if err := sh.TriggerWithParams("hi", []byte("secret")); err != nil {
+		test.Fatal(err)
+	}
+	// the run blocks until its payload is received
+	for i := 0; ; i++ {
+		if runs, _ := full.Started("hi"); len(runs) == 1 {
+			break
+		}
+		if i == 100 {
+			test.Fatal("expected the run to be recorded as started in the inner store")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if p := <-job.payload; string(p) != "secret" {
+		test.Errorf("expected the payload to be decrypted, found %q", p)
+	}
+}
+
+func TestNew_QueueStore(test *testing.T) {
+	st := &memQueueStore{memStore: memStore{runs: map[string]time.Time{}}, pending: map[string][]QueuedPayload{}}
+	// left by a previous process
+	st.Enqueue("hi", []byte("a"))
+	sh := New(WithStore(st))
+	job := &payloadJob{payload: make(chan []byte)}
+	sh.ScheduleWithOpts("hi", job, &t.Opts{When: &t.When{Each: "1h"}, Overlap: t.OverlapSkip})
+	go sh.Start()
+	defer sh.Stop()
+	if p := <-job.payload; string(p) != "a" {
+		test.Fatalf("expected the stored payload to be replayed, found %q", p)
+	}
+	// triggered while the job is running
+	go func() {
+		for i := 0; i < 3; i++ {
+			sh.TriggerWithPayload("hi", []byte{'b' + byte(i)})
+		}
+	}()
+	for _, want := range []string{"b", "c", "d"} {
+		select {
+		case p := <-job.payload:
+			if string(p) != want {
+				test.Errorf("expected the payload %q, found %q", want, p)
+			}
+		case <-time.After(time.Second):
+			test.Fatalf("expected the payload %q to be run", want)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	if p, _ := st.Pending("hi"); len(p) != 0 {
+		test.Errorf("expected the payloads to be removed once run, found %v", p)
+	}
+}
+
+// Tests if the stored payloads wait for the ReadyCheck and the load
+// gate, rather than run into an outage or be dropped.
+func TestNew_QueueStoreHeld(test *testing.T) {
+	st := &memQueueStore{memStore: memStore{runs: map[string]time.Time{}}, pending: map[string][]QueuedPayload{}}
+	st.Enqueue("hi", []byte("a"))
+	var ready, overloaded int32 = 0, 1
+	var notReady, deferred int32
+	sh := New(WithStore(st),
+		WithLoadGate(LoadGateFunc(func() bool { return atomic.LoadInt32(&overloaded) == 1 })),
+		WithListener(ListenerFunc(func(e Event) {
+			switch e.Kind {
+			case EventNotReady:
+				atomic.AddInt32(&notReady, 1)
+			case EventOverloaded:
+				atomic.AddInt32(&deferred, 1)
+			}
+		})))
+	job := &payloadJob{payload: make(chan []byte, 1)}
+	sh.ScheduleWithOpts("hi", job, &t.Opts{
+		When: &t.When{Each: "1h"},
+		ReadyCheck: func(ctx context.Context) error {
+			if atomic.LoadInt32(&ready) == 0 {
+				return errors.New("db is down")
+			}
+			return nil
+		},
+		ReadyCheckInterval: 5 * time.Millisecond,
+	})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(30 * time.Millisecond)
+	atomic.StoreInt32(&ready, 1)
+	time.Sleep(30 * time.Millisecond)
+	select {
+	case <-job.payload:
+		test.Fatal("expected the payload to wait while the host is overloaded")
+	default:
+	}
+	if n, d := atomic.LoadInt32(&notReady), atomic.LoadInt32(&deferred); n == 0 || d == 0 {
+		test.Errorf("expected the held back payload to be reported, found %v, %v", n, d)
+	}
+	if p, _ := st.Pending("hi"); len(p) != 1 {
+		test.Fatalf("expected the payload to be kept, found %v", p)
+	}
+	atomic.StoreInt32(&overloaded, 0)
+	select {
+	case p := <-job.payload:
+		if string(p) != "a" {
+			test.Errorf("expected the stored payload, found %q", p)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the payload to run once the job is ready")
+	}
+}
+
+func TestNew_RetryBudget(test *testing.T) {
+	sh := New(WithRetryBudget(2))
+	a, b := &errorJob{errorAfter: 10}, &errorJob{errorAfter: 10}
+	sh.ScheduleWithOpts("a", a, &t.Opts{When: &t.When{Each: "1ms"}, RetryCount: 5})
+	sh.ScheduleWithOpts("b", b, &t.Opts{When: &t.When{Each: "20ms"}, RetryCount: 5})
+	sh.Start()
+	if a.count != 3 {
+		test.Errorf("expected a to run once and be retried twice, ran %v times", a.count)
+	}
+	if b.count != 1 {
+		test.Errorf("expected b not to be retried once the budget is exhausted, ran %v times", b.count)
+	}
+}
+
+func TestTokenBucket_Reserve(test *testing.T) {
+	b := newTokenBucket(60)
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		if wait := b.reserve(now); wait != 0 {
+			test.Fatalf("expected a burst of 60 launches, the %vth waits %v", i+1, wait)
+		}
+	}
+	if wait := b.reserve(now); wait != time.Second {
+		test.Errorf("expected to wait for a second, found %v", wait)
+	}
+	if wait := b.reserve(now); wait != 2*time.Second {
+		test.Errorf("expected to wait behind the previous reservation, found %v", wait)
+	}
+	if wait := b.reserve(now.Add(3 * time.Second)); wait != 0 {
+		test.Errorf("expected the bucket to be refilled, found %v", wait)
+	}
+	if (*tokenBucket)(nil).reserve(now) != 0 {
+		test.Error("expected a nil bucket not to limit")
+	}
+}
+
+func TestOpts_OnRetry(test *testing.T) {
+	type retry struct {
+		attempt int
+		delay   time.Duration
+	}
+	var retries []retry
+	sh := &Scheduler{}
+	start := time.Now()
+	sh.ScheduleWithOpts("hi", &errorJob{errorAfter: 10}, &t.Opts{
+		When:       &t.When{Each: "1ms"},
+		RetryCount: 3,
+		RetryDelay: 5 * time.Millisecond,
+		OnRetry: func(name string, attempt int, err error, delay time.Duration) {
+			if err == nil {
+				test.Errorf("expected the error of the previous attempt")
+			}
+			retries = append(retries, retry{attempt, delay})
+		},
+	})
+	sh.Start()
+	want := []retry{{2, 5 * time.Millisecond}, {3, 10 * time.Millisecond}, {4, 20 * time.Millisecond}}
+	if !reflect.DeepEqual(retries, want) {
+		test.Errorf("expected the retries %v, found %v", want, retries)
+	}
+	if d := time.Since(start); d < 35*time.Millisecond {
+		test.Errorf("expected the retries to be delayed, ran in %v", d)
+	}
+}
+
+func TestOpts_RetryDeadline(test *testing.T) {
+	sh := &Scheduler{}
+	job := &errorJob{errorAfter: 100}
+	start := time.Now()
+	sh.ScheduleWithOpts("hi", job, &t.Opts{
+		When:          &t.When{Each: "1ms"},
+		RetryCount:    10,
+		RetryDelay:    10 * time.Millisecond,
+		RetryDeadline: 50 * time.Millisecond,
+	})
+	sh.Start()
+	// the attempts start at 0, 10 and 30ms, the next one would start
+	// at 70ms, past the deadline
+	if job.count != 3 {
+		test.Errorf("expected 3 attempts within the deadline, found %v", job.count)
+	}
+	if d := time.Since(start); d > 60*time.Millisecond {
+		test.Errorf("expected the retries to stop at the deadline, took %v", d)
+	}
+}
+
+func TestErrors(test *testing.T) {
+	sh := &Scheduler{}
+	errs := sh.Errors()
+	sh.ScheduleWithOpts("hi", &errorJob{errorAfter: 10}, &t.Opts{When: &t.When{Each: "1ms"}, RetryCount: 1})
+	sh.Start()
+	select {
+	case e := <-errs:
+		if e.Job != "hi" || e.RunID == "" || e.Time.IsZero() || e.Err == nil || errors.Unwrap(e) != e.Err {
+			test.Errorf("expected the failure of hi, found %+v", e)
+		}
+	default:
+		test.Fatal("expected a failure")
+	}
+	select {
+	case e := <-errs:
+		test.Errorf("expected a single failure after the retries, found %v", e)
+	default:
+	}
+}
+
+func TestStats(test *testing.T) {
+	sh := &Scheduler{}
+	sh.Schedule("hi", &counterJob{}, &t.When{Each: "1h"})
+	j, _ := sh.jobs.get("hi")
+	for i := 1; i <= 100; i++ {
+		j.durations.record(time.Duration(i)*time.Millisecond, i > 95)
+	}
+	srv := httptest.NewServer(sh.AdminHandler("secret"))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/jobs/hi/stats", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		test.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var st JobStats
+	if err := json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		test.Fatal(err)
+	}
+	if st.Runs != 100 || st.Failures != 5 || st.Max != 100*time.Millisecond {
+		test.Errorf("unexpected stats: %+v", st)
+	}
+	// 50ms and 99ms fall into the buckets up to 64ms and 128ms
+	if st.P50 != 64*time.Millisecond || st.P99 != 100*time.Millisecond {
+		test.Errorf("expected p50 of 64ms and p99 of 100ms, found %v and %v", st.P50, st.P99)
+	}
+	if n := len(st.Buckets); n != 8 || st.Buckets[0].Count != 1 || st.Buckets[n-1].Count != 36 {
+		test.Errorf("unexpected buckets: %+v", st.Buckets)
+	}
+}
+
+func TestCancelWait(test *testing.T) {
+	sh := &Scheduler{}
+	job := &blockingJob{started: make(chan struct{}, 1)}
+	sh.Schedule("hi", job, &t.When{Every: t.Every(10).Milliseconds()})
+	go sh.Start()
+	<-job.started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := sh.CancelWait(ctx, "hi")
+	if err != nil {
+		test.Fatal(err)
+	}
+	if res.RunID == "" || res.Duration <= 0 || res.Err != context.Canceled {
+		test.Errorf("expected the result of the cancelled run, found %+v", res)
+	}
+	if _, err := sh.CancelWait(ctx, "hi"); err == nil {
+		test.Error("expected an error for a cancelled job")
+	}
+}
+
+func TestRunUntilSignal(test *testing.T) {
+	sh := &Scheduler{}
+	job := &blockingJob{started: make(chan struct{}, 1)}
+	sh.Schedule("hi", job, &t.When{Each: "1ms"})
+	done := make(chan error)
+	go func() { done <- RunUntilSignal(sh, 20*time.Millisecond) }()
+	<-job.started
+	p, _ := os.FindProcess(os.Getpid())
+	p.Signal(os.Interrupt)
+	select {
+	case err := <-done:
+		if err == nil {
+			test.Error("expected an error as the run didn't complete in time")
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected RunUntilSignal to return after the drain timeout")
+	}
+}
+
+// Tests if RunUntilSignal returns once the scheduler has no jobs
+// left to run.
+func TestRunUntilSignal_Done(test *testing.T) {
+	sh := &Scheduler{}
+	sh.Schedule("once", &counterJob{}, &t.When{Each: "10ms"})
+	done := make(chan error)
+	go func() { done <- RunUntilSignal(sh, time.Second) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			test.Error(err)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected RunUntilSignal to return once there are no jobs left")
+	}
+}
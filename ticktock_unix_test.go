@@ -0,0 +1,107 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build unix
+
+package ticktock
+
+import (
+	"os"
+	"os/signal"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// Returns the CPU time the process has used.
+func cpuTime(test *testing.T) time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		test.Skip(err)
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// Tests if the ticked jobs sleep between their ticks rather than
+// spin on them.
+func TestSchedule_MicrosecondsCPU(test *testing.T) {
+	sh := &Scheduler{}
+	var n int32
+	sh.Schedule("fast", &anyJob{Fn: func() { atomic.AddInt32(&n, 1) }}, &t.When{Every: t.Every(500).Microseconds()})
+	go sh.Start()
+	defer sh.Stop()
+	time.Sleep(10 * time.Millisecond)
+	start, cpu := time.Now(), cpuTime(test)
+	time.Sleep(200 * time.Millisecond)
+	used, took := cpuTime(test)-cpu, time.Since(start)
+	sh.Cancel("fast")
+	if got := atomic.LoadInt32(&n); got < 100 {
+		test.Errorf("expected the job to run at least 100 times, ran %v times", got)
+	}
+	if used > took/2 {
+		test.Errorf("expected the ticks to use less than half a core, used %v in %v", used, took)
+	}
+}
+
+// Tests if the signals trigger the bound job until it's cancelled.
+func TestTriggerOnSignal(test *testing.T) {
+	// keeps the process alive once the binding is stopped
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR1)
+	defer signal.Stop(c)
+
+	sh := &Scheduler{}
+	ran := make(chan string, 1)
+	sh.Schedule("hi", &anyJob{Fn: func() { ran <- "hi" }}, &t.When{Each: "1h"})
+	if err := sh.TriggerOnSignal(syscall.SIGUSR1, "bye"); err == nil {
+		test.Error("expected an error binding a job that doesn't exist")
+	}
+	before := runtime.NumGoroutine()
+	if err := sh.TriggerOnSignal(syscall.SIGUSR1, "hi"); err != nil {
+		test.Fatal(err)
+	}
+	kill := func() {
+		if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+			test.Fatal(err)
+		}
+	}
+	kill()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		test.Fatal("expected the signal to trigger the job")
+	}
+	// the binding carries over to the replacement
+	sh.Upsert("hi", &anyJob{Fn: func() { ran <- "upserted" }}, &t.Opts{When: &t.When{Each: "1h"}})
+	kill()
+	select {
+	case name := <-ran:
+		if name != "upserted" {
+			test.Errorf("expected the replacement to be triggered, found %v", name)
+		}
+	case <-time.After(time.Second):
+		test.Fatal("expected the signal to trigger the replacement")
+	}
+	sh.Cancel("hi")
+	for i := 0; runtime.NumGoroutine() > before; i++ {
+		if i == 100 {
+			test.Fatalf("expected the binding to stop, found %v goroutines, %v before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
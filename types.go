@@ -0,0 +1,71 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package ticktock
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	typesMu   sync.RWMutex
+	factories = make(map[string]func() Job)
+	typeNames = make(map[reflect.Type]string)
+)
+
+// Registers a job type called name, so the jobs of the type can be
+// referred to by the type name and parameters from configs,
+// snapshots and the admin handler. factory returns a new job of
+// the type, which the parameters of the job are decoded into as
+// JSON. Panics if name is already registered. The jobs package
+// registers its jobs, such as "cmd" and "script".
+// Example:
+// 		ticktock.RegisterJobType("print", func() ticktock.Job { return &PrintJob{} })
+func RegisterJobType(name string, factory func() Job) {
+	typesMu.Lock()
+	defer typesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic("ticktock: job type " + name + " is already registered")
+	}
+	factories[name] = factory
+	typeNames[reflect.TypeOf(factory())] = name
+}
+
+// Returns the registered type name of job.
+func jobType(job Job) (string, bool) {
+	typesMu.RLock()
+	defer typesMu.RUnlock()
+	name, ok := typeNames[reflect.TypeOf(job)]
+	return name, ok
+}
+
+// Creates a job of the type called name, with the parameters
+// decoded into the job as JSON.
+func NewJob(name string, params json.RawMessage) (Job, error) {
+	typesMu.RLock()
+	factory, ok := factories[name]
+	typesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("job type %q is not registered", name)
+	}
+	job := factory()
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, job); err != nil {
+			return nil, fmt.Errorf("job type %q: %v", name, err)
+		}
+	}
+	return job, nil
+}
@@ -0,0 +1,189 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// Schedules a job called name with the options, replacing the job
+// already scheduled with the name, if any, in a single step: there
+// is no moment the name is free, or both of the jobs are scheduled.
+// Unless opts.When has a LastRun, the new timing counts from the
+// last run of the replaced job. The run stats, the history and the
+// paused or snoozed state of the replaced job are carried over. An
+// in-flight run of the replaced job is allowed to complete, and
+// counts for the replaced job only. The job replacing a job in a
+// namespace joins the namespace, under its quota of retries.
+// Example:
+// 		err := s.Upsert("report", job, &t.Opts{
+// 			When: &t.When{Cron: "0 0 * * * *"},
+// 		})
+func (s *Scheduler) Upsert(name string, job Job, opts *t.Opts) error {
+	if old, ok := s.jobs.get(name); ok && old.ns != nil {
+		opts = old.ns.capRetries(opts)
+	}
+	j, err := s.newJob(name, job, opts, nil)
+	if err != nil {
+		return err
+	}
+	old := s.jobs.replace(j)
+	if old == nil {
+		// if the scheduler is not started yet, Start will add the job
+		s.do(func() { s.add(j) })
+		return nil
+	}
+	old.retire(false)
+	j.inherit(old)
+	s.do(func() { s.takeOver(j, old) })
+	return nil
+}
+
+// Renames the job called from to to, keeping its schedule, its
+// history and its run stats, so the job carries on as if it had
+// always been called to. The last run of the job is stored with the
+// new name. An in-flight run is allowed to complete, and its result
+// counts for the job called from only. A job in a namespace keeps
+// its namespace, to should have the same prefix. Fails while the
+// job has payloads pending in a QueueStore, or runs in progress
+// recorded in a RunStore or an OccurrenceStore, as these are
+// stored under from.
+func (s *Scheduler) Rename(from, to string) error {
+	old, ok := s.jobs.get(from)
+	if !ok {
+		return errors.New("no job exists with the name provided")
+	}
+	if from == to {
+		return nil
+	}
+	if old.ns != nil && !strings.HasPrefix(to, old.ns.name+"/") {
+		return fmt.Errorf("the job should be renamed within the namespace %v", old.ns.name)
+	}
+	var (
+		j    *jobC
+		last time.Time
+		err  error
+	)
+	// the loop owns the When of the job, copy on the loop
+	s.call(func() {
+		if err = s.checkStored(old); err != nil {
+			return
+		}
+		opts, when := *old.opts, *old.when
+		when.LastRun = time.Time{}
+		opts.When = &when
+		if j, err = s.newJob(to, old.job, &opts, old.ns); err != nil {
+			return
+		}
+		j.splay = old.splay
+		if !s.jobs.move(old, j) {
+			err = errors.New("a job already exists with the name provided")
+			return
+		}
+		old.retire(false)
+		j.inherit(old)
+		s.takeOver(j, old)
+		last = j.when.LastRun
+	})
+	if err != nil {
+		return err
+	}
+	if st := s.store; st != nil && !last.IsZero() {
+		if err := st.SetLastRun(to, last); err != nil {
+			s.logf("ticktock: storing the last run of %v failed: %v", to, err)
+		}
+	}
+	return nil
+}
+
+// Returns an error if the store holds records of the job under its
+// name that a renamed job can't pick up: the payloads pending in its
+// queue, or its runs in progress. Must be called on the loop.
+func (s *Scheduler) checkStored(j *jobC) error {
+	_, runs := s.store.(RunStore)
+	_, occurrences := s.store.(OccurrenceStore)
+	if runs || occurrences {
+		j.mu.Lock()
+		running := j.running > 0
+		j.mu.Unlock()
+		if running || j.inflight {
+			return errors.New("the job has runs in progress recorded in the store")
+		}
+	}
+	if qs, ok := s.store.(QueueStore); ok {
+		pending, err := qs.Pending(j.name)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("the job has %v payloads pending in the store", len(pending))
+		}
+	}
+	return nil
+}
+
+// Schedules the job in place of the replaced one, from the last run
+// and in the paused state of the replaced one. Must be called on the
+// loop.
+func (s *Scheduler) takeOver(j, old *jobC) {
+	if j.when.LastRun.IsZero() {
+		j.when.LastRun = old.when.LastRun
+		// an in-flight run counts as the last run,
+		// so its occurrence isn't run again
+		if old.inflight && old.scheduledAt.After(j.when.LastRun) {
+			j.when.LastRun = old.scheduledAt
+		}
+	}
+	paused, until := old.paused, old.snoozedUntil
+	s.remove(old)
+	if !until.IsZero() {
+		s.snooze(j, until)
+	} else {
+		j.paused = paused
+	}
+	s.add(j)
+}
+
+// Copies the run stats, the last run result and the history of the
+// replaced job.
+func (j *jobC) inherit(old *jobC) {
+	old.durations.mu.Lock()
+	d := histogram{
+		counts:   old.durations.counts,
+		runs:     old.durations.runs,
+		failures: old.durations.failures,
+		sum:      old.durations.sum,
+		max:      old.durations.max,
+	}
+	old.durations.mu.Unlock()
+	old.mu.Lock()
+	last := old.last
+	runs := append([]RunResult(nil), old.history.runs...)
+	old.mu.Unlock()
+
+	j.durations.mu.Lock()
+	j.durations.counts, j.durations.runs, j.durations.failures = d.counts, d.runs, d.failures
+	j.durations.sum, j.durations.max = d.sum, d.max
+	j.durations.mu.Unlock()
+	j.mu.Lock()
+	j.last = last
+	j.history.runs = runs
+	j.mu.Unlock()
+}
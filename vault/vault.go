@@ -0,0 +1,254 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vault resolves the secrets of the jobs from HashiCorp
+// Vault, as a ticktock.SecretsProvider.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider reads the secrets from Vault. The names of the secrets
+// are the paths of the secrets and the fields of their data, as in
+// "secret/data/app#api-token" or "database/creds/reporting#password";
+// the field is "value" if omitted. KV version 2 secrets are read
+// from their nested data.
+//
+// Provider authenticates with Token or, if it's empty, with AppRole.
+// The token is renewed once two thirds of its TTL have passed, and
+// AppRole logs in again if it can't be renewed.
+//
+// The secrets are cached for CacheTTL, and no longer than two thirds
+// of their leases, so the username and the password of a dynamic
+// database credential resolved on the same run match.
+// Example:
+// 		s := ticktock.New(ticktock.WithSecrets(&vault.Provider{
+// 			Addr:     "https://vault.internal:8200",
+// 			RoleID:   os.Getenv("VAULT_ROLE_ID"),
+// 			SecretID: os.Getenv("VAULT_SECRET_ID"),
+// 		}))
+type Provider struct {
+	// Addr of the Vault server, e.g. https://vault.internal:8200.
+	Addr string
+	// Token authenticates the requests, AppRole is used if empty.
+	Token string
+	// RoleID and SecretID of AppRole.
+	RoleID, SecretID string
+	// AppRolePath is the mount path of AppRole, "approle" if empty.
+	AppRolePath string
+	// Namespace of Vault Enterprise, optional.
+	Namespace string
+	// CacheTTL is how long the secrets are cached, a minute if zero.
+	CacheTTL time.Duration
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+
+	mu    sync.Mutex
+	token string
+	// when the token should be renewed, zero if it isn't renewed
+	renewAt   time.Time
+	renewable bool
+	cache     map[string]cached
+}
+
+type cached struct {
+	data    map[string]interface{}
+	expires time.Time
+}
+
+// The response of Vault to the reads and the logins.
+type response struct {
+	Data          map[string]interface{} `json:"data"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+// Secret returns the field of the secret called name.
+func (p *Provider) Secret(ctx context.Context, name string) (string, error) {
+	path, field, ok := strings.Cut(name, "#")
+	if !ok {
+		field = "value"
+	}
+	data, err := p.read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data[field]; !ok {
+			// KV version 2
+			data = nested
+		}
+	}
+	v, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("vault: %v has no field %q", path, field)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// Returns the data of the secret at path, from the cache if
+// it's fresh.
+func (p *Provider) read(ctx context.Context, path string) (map[string]interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if c, ok := p.cache[path]; ok && now.Before(c.expires) {
+		return c.data, nil
+	}
+	if err := p.authenticate(ctx, now); err != nil {
+		return nil, err
+	}
+	var resp response
+	if err := p.do(ctx, "GET", "/v1/"+strings.TrimPrefix(path, "/"), nil, &resp); err != nil {
+		return nil, err
+	}
+	ttl := p.CacheTTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	if lease := time.Duration(resp.LeaseDuration) * time.Second * 2 / 3; lease > 0 && lease < ttl {
+		ttl = lease
+	}
+	if p.cache == nil {
+		p.cache = make(map[string]cached)
+	}
+	p.cache[path] = cached{data: resp.Data, expires: now.Add(ttl)}
+	return resp.Data, nil
+}
+
+// Logs in or renews the token if necessary, must be called
+// with mu held.
+func (p *Provider) authenticate(ctx context.Context, now time.Time) error {
+	if p.token == "" {
+		if p.Token != "" {
+			p.token = p.Token
+			// learns whether the token expires
+			var resp response
+			if err := p.do(ctx, "GET", "/v1/auth/token/lookup-self", nil, &resp); err != nil {
+				return err
+			}
+			ttl, _ := resp.Data["ttl"].(float64)
+			renewable, _ := resp.Data["renewable"].(bool)
+			p.setRenewal(now, int(ttl), renewable)
+			return nil
+		}
+		return p.login(ctx, now)
+	}
+	if p.renewAt.IsZero() || now.Before(p.renewAt) {
+		return nil
+	}
+	if p.renewable {
+		var resp response
+		err := p.do(ctx, "POST", "/v1/auth/token/renew-self", struct{}{}, &resp)
+		if err == nil && resp.Auth != nil {
+			p.setRenewal(now, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+			return nil
+		}
+	}
+	if p.Token != "" {
+		// a token that can't be renewed is used until it expires
+		p.renewAt = time.Time{}
+		return nil
+	}
+	return p.login(ctx, now)
+}
+
+func (p *Provider) login(ctx context.Context, now time.Time) error {
+	if p.RoleID == "" {
+		return errors.New("vault: neither a token nor an AppRole is provided")
+	}
+	mount := p.AppRolePath
+	if mount == "" {
+		mount = "approle"
+	}
+	p.token = ""
+	var resp response
+	body := map[string]string{"role_id": p.RoleID, "secret_id": p.SecretID}
+	if err := p.do(ctx, "POST", "/v1/auth/"+mount+"/login", body, &resp); err != nil {
+		return err
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("vault: the login returned no token")
+	}
+	p.token = resp.Auth.ClientToken
+	p.setRenewal(now, resp.Auth.LeaseDuration, resp.Auth.Renewable)
+	return nil
+}
+
+// Schedules the renewal of a token with the ttl in seconds,
+// zero if it doesn't expire.
+func (p *Provider) setRenewal(now time.Time, ttl int, renewable bool) {
+	p.renewable = renewable
+	p.renewAt = time.Time{}
+	if ttl > 0 {
+		p.renewAt = now.Add(time.Duration(ttl) * time.Second * 2 / 3)
+	}
+}
+
+// Sends the request with the body encoded as JSON, and decodes
+// the response into out.
+func (p *Provider) do(ctx context.Context, method, path string, body interface{}, out *response) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.Addr, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out); err != nil && err != io.EOF {
+		return fmt.Errorf("vault: %v %v: %v", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("vault: %v %v failed with %v: %v", method, path, resp.Status, strings.Join(out.Errors, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault serves the secrets to the token it issues, and
+// counts the requests by path.
+type fakeVault struct {
+	mu       sync.Mutex
+	requests map[string]int
+	secrets  map[string]string // by path, as JSON
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	v.requests[r.Method+" "+r.URL.Path]++
+	v.mu.Unlock()
+	if r.Header.Get("X-Vault-Namespace") != "team-a" {
+		http.Error(w, `{"errors": ["wrong namespace"]}`, http.StatusBadRequest)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			http.Error(w, `{"errors": ["invalid role or secret ID"]}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"auth": {"client_token": "issued", "lease_duration": 3600, "renewable": true}}`))
+		return
+	case "/v1/auth/token/lookup-self":
+		w.Write([]byte(`{"data": {"ttl": 0, "renewable": false}}`))
+		return
+	}
+	if tok := r.Header.Get("X-Vault-Token"); tok != "issued" && tok != "static" {
+		http.Error(w, `{"errors": ["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	switch r.URL.Path {
+	case "/v1/auth/token/renew-self":
+		w.Write([]byte(`{"auth": {"client_token": "issued", "lease_duration": 3600, "renewable": true}}`))
+		return
+	}
+	s, ok := v.secrets[strings.TrimPrefix(r.URL.Path, "/v1/")]
+	if !ok {
+		http.Error(w, `{"errors": []}`, http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(s))
+}
+
+func (v *fakeVault) count(req string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.requests[req]
+}
+
+func newFakeVault(test *testing.T) (*fakeVault, string) {
+	v := &fakeVault{
+		requests: map[string]int{},
+		secrets: map[string]string{
+			"secret/data/app":          `{"data": {"data": {"api-token": "abc"}, "metadata": {"version": 2}}}`,
+			"database/creds/reporting": `{"data": {"username": "u-1", "password": "p-1"}, "lease_duration": 60}`,
+			"kv/legacy":                `{"data": {"value": 42}}`,
+		},
+	}
+	srv := httptest.NewServer(v)
+	test.Cleanup(srv.Close)
+	return v, srv.URL
+}
+
+func TestProvider_AppRole(test *testing.T) {
+	v, addr := newFakeVault(test)
+	p := &Provider{Addr: addr, RoleID: "role", SecretID: "secret", Namespace: "team-a"}
+	ctx := context.Background()
+	for name, want := range map[string]string{
+		"secret/data/app#api-token":         "abc",
+		"database/creds/reporting#username": "u-1",
+		"database/creds/reporting#password": "p-1",
+		"kv/legacy":                         "42",
+	} {
+		got, err := p.Secret(ctx, name)
+		if err != nil {
+			test.Fatalf("%v: %v", name, err)
+		}
+		if got != want {
+			test.Errorf("%v: expected %q, found %q", name, want, got)
+		}
+	}
+	if n := v.count("POST /v1/auth/approle/login"); n != 1 {
+		test.Errorf("expected to log in once, logged in %v times", n)
+	}
+	if n := v.count("GET /v1/database/creds/reporting"); n != 1 {
+		test.Errorf("expected the credential to be read once, read %v times", n)
+	}
+	if _, err := p.Secret(ctx, "secret/data/app#missing"); err == nil {
+		test.Error("expected an error for a missing field")
+	}
+	if _, err := p.Secret(ctx, "secret/data/missing"); err == nil {
+		test.Error("expected an error for a missing secret")
+	}
+
+	// renews the token once two thirds of its TTL have passed
+	p.mu.Lock()
+	p.renewAt = time.Now().Add(-time.Second)
+	p.cache = nil
+	p.mu.Unlock()
+	if _, err := p.Secret(ctx, "kv/legacy"); err != nil {
+		test.Fatal(err)
+	}
+	if n := v.count("POST /v1/auth/token/renew-self"); n != 1 {
+		test.Errorf("expected the token to be renewed, renewed %v times", n)
+	}
+}
+
+func TestProvider_Token(test *testing.T) {
+	v, addr := newFakeVault(test)
+	p := &Provider{Addr: addr, Token: "static", Namespace: "team-a"}
+	if got, err := p.Secret(context.Background(), "secret/data/app#api-token"); err != nil || got != "abc" {
+		test.Errorf("expected the secret, found %q, %v", got, err)
+	}
+	if n := v.count("GET /v1/auth/token/lookup-self"); n != 1 {
+		test.Errorf("expected the token to be looked up once, found %v", n)
+	}
+
+	p = &Provider{Addr: addr, Token: "revoked", Namespace: "team-a"}
+	_, err := p.Secret(context.Background(), "secret/data/app#api-token")
+	if err == nil || !strings.Contains(err.Error(), "permission denied") {
+		test.Errorf("expected the error of Vault, found %v", err)
+	}
+}
+
+func TestProvider_LoginFailure(test *testing.T) {
+	_, addr := newFakeVault(test)
+	p := &Provider{Addr: addr, RoleID: "role", SecretID: "wrong", Namespace: "team-a"}
+	if _, err := p.Secret(context.Background(), "kv/legacy"); err == nil || !strings.Contains(err.Error(), "invalid role") {
+		test.Errorf("expected the login to fail, found %v", err)
+	}
+	p = &Provider{Addr: addr, Namespace: "team-a"}
+	if _, err := p.Secret(context.Background(), "kv/legacy"); err == nil {
+		test.Error("expected an error without credentials")
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+
+package ticktock
+
+import "time"
+
+// The timers of the runtime are precise elsewhere, only the last
+// spinWindow is spun on.
+const timerSlack = spinWindow
+
+func sleepThread(d time.Duration) {
+	time.Sleep(d)
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ticktock
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rakyll/ticktock/t"
+)
+
+// weighted is a semaphore of a capacity shared by the runs by their
+// weights. Waiters are served in order, so the heavy runs are not
+// starved by a stream of the light ones; or by their priorities if
+// it's prioritized.
+type weighted struct {
+	size int64
+	// set by prioritize, nil if the waiters are served in order
+	now   func() time.Time
+	aging time.Duration
+
+	mu      sync.Mutex
+	cur     int64
+	waiters list.List // of *waiter
+}
+
+type waiter struct {
+	n        int64
+	ready    chan struct{}
+	priority int
+	since    time.Time
+}
+
+func newWeighted(size int64) *weighted {
+	return &weighted{size: size}
+}
+
+// Serves the waiters by their priorities aged by the time they have
+// waited, as of now, rather than in order. Must be called before
+// the semaphore is used.
+func (w *weighted) prioritize(aging time.Duration, now func() time.Time) {
+	w.aging, w.now = aging, now
+}
+
+// Acquires n of the capacity, blocking until it's available or ctx
+// is done. Reports false if ctx is done first. Weights over the
+// capacity take all of it.
+func (w *weighted) acquire(ctx context.Context, n int64) bool {
+	return w.acquirePriority(ctx, n, t.PriorityNormal)
+}
+
+// Acquires n of the capacity as acquire does, waiting with the
+// priority if the semaphore is prioritized.
+func (w *weighted) acquirePriority(ctx context.Context, n int64, priority int) bool {
+	if n > w.size {
+		n = w.size
+	}
+	w.mu.Lock()
+	if w.cur+n <= w.size && w.waiters.Len() == 0 {
+		w.cur += n
+		w.mu.Unlock()
+		return true
+	}
+	wt := &waiter{n: n, ready: make(chan struct{}), priority: priority}
+	if w.now != nil {
+		wt.since = w.now()
+	}
+	elem := w.waiters.PushBack(wt)
+	w.mu.Unlock()
+	select {
+	case <-wt.ready:
+		return true
+	case <-ctx.Done():
+		w.mu.Lock()
+		select {
+		case <-wt.ready:
+			// acquired in the meantime, give it back
+			w.cur -= n
+			w.notify()
+		default:
+			w.waiters.Remove(elem)
+			// the waiters behind may fit now
+			w.notify()
+		}
+		w.mu.Unlock()
+		return false
+	}
+}
+
+// Acquires n of the capacity if it's available without waiting,
+// reports false otherwise.
+func (w *weighted) tryAcquire(n int64) bool {
+	if n > w.size {
+		n = w.size
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cur+n <= w.size && w.waiters.Len() == 0 {
+		w.cur += n
+		return true
+	}
+	return false
+}
+
+// Returns how much of n doesn't fit into the free capacity.
+func (w *weighted) shortfall(n int64) int64 {
+	if n > w.size {
+		n = w.size
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if short := n - (w.size - w.cur); short > 0 {
+		return short
+	}
+	return 0
+}
+
+// Returns the number of the waiters.
+func (w *weighted) waiting() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.waiters.Len()
+}
+
+// Releases n of the capacity acquired with acquire.
+func (w *weighted) release(n int64) {
+	if n > w.size {
+		n = w.size
+	}
+	w.mu.Lock()
+	w.cur -= n
+	w.notify()
+	w.mu.Unlock()
+}
+
+// Wakes up the waiters that fit, in order. Must be called with mu.
+func (w *weighted) notify() {
+	for {
+		next := w.next()
+		if next == nil {
+			return
+		}
+		wt := next.Value.(*waiter)
+		if w.cur+wt.n > w.size {
+			return
+		}
+		w.cur += wt.n
+		w.waiters.Remove(next)
+		close(wt.ready)
+	}
+}
+
+// Returns the waiter to serve next: the first one, or the first one
+// of the highest aged priority if the semaphore is prioritized.
+func (w *weighted) next() *list.Element {
+	if w.now == nil {
+		return w.waiters.Front()
+	}
+	now := w.now()
+	var best *list.Element
+	var max int
+	for e := w.waiters.Front(); e != nil; e = e.Next() {
+		wt := e.Value.(*waiter)
+		if p := agedPriority(wt.priority, wt.since, now, w.aging); best == nil || p > max {
+			best, max = e, p
+		}
+	}
+	return best
+}
+
+// Returns the priority raised by a level for every aging elapsed
+// since, up to t.PriorityCritical. Priorities already above it are
+// not changed.
+func agedPriority(priority int, since, now time.Time, aging time.Duration) int {
+	if aging <= 0 || since.IsZero() || priority >= t.PriorityCritical {
+		return priority
+	}
+	aged := priority + int(now.Sub(since)/aging)
+	if aged > t.PriorityCritical {
+		aged = t.PriorityCritical
+	}
+	return aged
+}